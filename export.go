@@ -0,0 +1,44 @@
+package main
+
+import (
+	"cloud.google.com/go/pubsub"
+	"context"
+	"flag"
+	"github.com/protolambda/muskoka-worker/worker"
+	"log"
+	"os"
+	"os/signal"
+)
+
+// exportMain runs the export subcommand: it appends the results received from a subscription to a local file.
+func exportMain(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	projectID := flags.String("gcp-project-id", "muskoka", "the google cloud project to connect with pubsub to")
+	subId := flags.String("sub", "", "the pubsub subscription to receive result messages from, e.g. a subscription on a results~<client name> topic")
+	exportFile := flags.String("export-file", "results.jsonl", "the file to append the results to, as JSON lines, or as CSV if the name ends with .csv")
+	_ = flags.Parse(args)
+	if *subId == "" {
+		log.Fatalf("export requires a --sub subscription to receive results from")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		<-c
+		log.Println("shutting down")
+		cancel()
+	}()
+
+	pubsubClient, err := pubsub.NewClient(ctx, *projectID)
+	if err != nil {
+		log.Fatalf("Failed to create pubsub client: %v", err)
+	}
+	q, err := worker.NewPubsubBackend(pubsubClient, 0, worker.DefaultPubsubReceiveSettings).TaskQueue(*subId, "")
+	if err != nil {
+		log.Fatalf("Failed to open subscription: %v", err)
+	}
+	if err := worker.ExportResults(ctx, q, worker.NewResultExporter(*exportFile)); err != nil {
+		log.Fatalf("failed to receive results: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stringList is a comma-separated list flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// intList is a comma-separated list flag of integers.
+type intList []int
+
+func (l *intList) String() string {
+	var items []string
+	for _, v := range *l {
+		items = append(items, strconv.Itoa(v))
+	}
+	return strings.Join(items, ",")
+}
+
+func (l *intList) Set(v string) error {
+	*l = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", item)
+		}
+		*l = append(*l, n)
+	}
+	return nil
+}
+
+// stringMap is a flag of key=value entries, the flag can be repeated to set multiple entries.
+type stringMap map[string]string
+
+func (m *stringMap) String() string {
+	var entries []string
+	for k, v := range *m {
+		entries = append(entries, k+"="+v)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, " ")
+}
+
+func (m *stringMap) Set(v string) error {
+	i := strings.Index(v, "=")
+	if i < 0 {
+		return fmt.Errorf("expected key=value, got %q", v)
+	}
+	if *m == nil {
+		*m = make(map[string]string)
+	}
+	(*m)[v[:i]] = v[i+1:]
+	return nil
+}
+
+// intMap is a flag of key=<int> entries, the flag can be repeated to set multiple entries.
+type intMap map[string]int
+
+func (m *intMap) String() string {
+	var entries []string
+	for k, v := range *m {
+		entries = append(entries, fmt.Sprintf("%s=%d", k, v))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, " ")
+}
+
+func (m *intMap) Set(v string) error {
+	i := strings.Index(v, "=")
+	if i < 0 {
+		return fmt.Errorf("expected key=value, got %q", v)
+	}
+	n, err := strconv.Atoi(v[i+1:])
+	if err != nil {
+		return fmt.Errorf("invalid number in %q: %v", v, err)
+	}
+	if *m == nil {
+		*m = make(map[string]int)
+	}
+	(*m)[v[:i]] = n
+	return nil
+}
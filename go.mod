@@ -1,8 +1,18 @@
 module github.com/protolambda/muskoka-worker
 
-go 1.12
+go 1.13
 
 require (
 	cloud.google.com/go v0.45.1
 	cloud.google.com/go/pubsub v1.0.1
+	github.com/BurntSushi/toml v0.3.1
+	github.com/aws/aws-sdk-go v1.25.0
+	github.com/golang/protobuf v1.3.2
+	github.com/nats-io/nats.go v1.11.0
+	github.com/prometheus/client_golang v1.1.0
+	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
+	golang.org/x/sync v0.0.0-20190423024810-112230192c58
+	google.golang.org/api v0.9.0
+	google.golang.org/grpc v1.21.1
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -0,0 +1,5 @@
+// Package muskoka has the Go types of the result message and the TransitionRunner service,
+// generated from result.proto and runner.proto with protoc-gen-go v1.3.2, the version of github.com/golang/protobuf in go.mod.
+package muskoka
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. result.proto runner.proto
@@ -0,0 +1,699 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: result.proto
+
+package muskoka
+
+import (
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	wrappers "github.com/golang/protobuf/ptypes/wrappers"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type ResultMsg struct {
+	// the version of this schema, see ResultSchemaVersion. Increased on incompatible changes.
+	SchemaVersion uint32 `protobuf:"varint,1,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	Success       bool   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	// "success", "transition-rejected", "client-crash", "timeout", "resource-exceeded",
+	// "missing-post", "upload-failed" or "input-error". Since schema version 2, "failed" before.
+	Status string `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	// "memory" or "cpu", for the resource-exceeded status
+	Exceeded    string `protobuf:"bytes,4,opt,name=exceeded,proto3" json:"exceeded,omitempty"`
+	Interrupted bool   `protobuf:"varint,5,opt,name=interrupted,proto3" json:"interrupted,omitempty"`
+	// 0x-prefixed sha256 of the post state
+	PostHash string `protobuf:"bytes,6,opt,name=post_hash,json=postHash,proto3" json:"post_hash,omitempty"`
+	// 0x-prefixed hash-tree-root of the post state, if computed
+	PostRoot      string `protobuf:"bytes,7,opt,name=post_root,json=postRoot,proto3" json:"post_root,omitempty"`
+	ClientName    string `protobuf:"bytes,8,opt,name=client_name,json=clientName,proto3" json:"client_name,omitempty"`
+	ClientVersion string `protobuf:"bytes,9,opt,name=client_version,json=clientVersion,proto3" json:"client_version,omitempty"`
+	Key           string `protobuf:"bytes,10,opt,name=key,proto3" json:"key,omitempty"`
+	// the spec version of the task
+	SpecVersion string `protobuf:"bytes,18,opt,name=spec_version,json=specVersion,proto3" json:"spec_version,omitempty"`
+	// the spec config of the task
+	SpecConfig string `protobuf:"bytes,19,opt,name=spec_config,json=specConfig,proto3" json:"spec_config,omitempty"`
+	// "agrees", "disagrees", "no-majority", or empty
+	Consensus string `protobuf:"bytes,11,opt,name=consensus,proto3" json:"consensus,omitempty"`
+	// unset if the task has no expected post state
+	MatchesExpected *wrappers.BoolValue `protobuf:"bytes,12,opt,name=matches_expected,json=matchesExpected,proto3" json:"matches_expected,omitempty"`
+	Finality        *FinalityInfo       `protobuf:"bytes,13,opt,name=finality,proto3" json:"finality,omitempty"`
+	Usage           *ResourceUsage      `protobuf:"bytes,14,opt,name=usage,proto3" json:"usage,omitempty"`
+	// unset if the client did not run
+	Exit   *ExitInfo    `protobuf:"bytes,17,opt,name=exit,proto3" json:"exit,omitempty"`
+	Inputs *InputHashes `protobuf:"bytes,15,opt,name=inputs,proto3" json:"inputs,omitempty"`
+	// the JSON object the client reported about the transition, as-is. Empty if none.
+	ClientReport string `protobuf:"bytes,20,opt,name=client_report,json=clientReport,proto3" json:"client_report,omitempty"`
+	// the 0x-prefixed sha256 of the post state after every block but the last, with --per-block-posts
+	BlockPostHashes      []string     `protobuf:"bytes,21,rep,name=block_post_hashes,json=blockPostHashes,proto3" json:"block_post_hashes,omitempty"`
+	Files                *ResultFiles `protobuf:"bytes,16,opt,name=files,proto3" json:"files,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *ResultMsg) Reset()         { *m = ResultMsg{} }
+func (m *ResultMsg) String() string { return proto.CompactTextString(m) }
+func (*ResultMsg) ProtoMessage()    {}
+func (*ResultMsg) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4feee897733d2100, []int{0}
+}
+
+func (m *ResultMsg) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResultMsg.Unmarshal(m, b)
+}
+func (m *ResultMsg) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResultMsg.Marshal(b, m, deterministic)
+}
+func (m *ResultMsg) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResultMsg.Merge(m, src)
+}
+func (m *ResultMsg) XXX_Size() int {
+	return xxx_messageInfo_ResultMsg.Size(m)
+}
+func (m *ResultMsg) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResultMsg.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResultMsg proto.InternalMessageInfo
+
+func (m *ResultMsg) GetSchemaVersion() uint32 {
+	if m != nil {
+		return m.SchemaVersion
+	}
+	return 0
+}
+
+func (m *ResultMsg) GetSuccess() bool {
+	if m != nil {
+		return m.Success
+	}
+	return false
+}
+
+func (m *ResultMsg) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *ResultMsg) GetExceeded() string {
+	if m != nil {
+		return m.Exceeded
+	}
+	return ""
+}
+
+func (m *ResultMsg) GetInterrupted() bool {
+	if m != nil {
+		return m.Interrupted
+	}
+	return false
+}
+
+func (m *ResultMsg) GetPostHash() string {
+	if m != nil {
+		return m.PostHash
+	}
+	return ""
+}
+
+func (m *ResultMsg) GetPostRoot() string {
+	if m != nil {
+		return m.PostRoot
+	}
+	return ""
+}
+
+func (m *ResultMsg) GetClientName() string {
+	if m != nil {
+		return m.ClientName
+	}
+	return ""
+}
+
+func (m *ResultMsg) GetClientVersion() string {
+	if m != nil {
+		return m.ClientVersion
+	}
+	return ""
+}
+
+func (m *ResultMsg) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *ResultMsg) GetSpecVersion() string {
+	if m != nil {
+		return m.SpecVersion
+	}
+	return ""
+}
+
+func (m *ResultMsg) GetSpecConfig() string {
+	if m != nil {
+		return m.SpecConfig
+	}
+	return ""
+}
+
+func (m *ResultMsg) GetConsensus() string {
+	if m != nil {
+		return m.Consensus
+	}
+	return ""
+}
+
+func (m *ResultMsg) GetMatchesExpected() *wrappers.BoolValue {
+	if m != nil {
+		return m.MatchesExpected
+	}
+	return nil
+}
+
+func (m *ResultMsg) GetFinality() *FinalityInfo {
+	if m != nil {
+		return m.Finality
+	}
+	return nil
+}
+
+func (m *ResultMsg) GetUsage() *ResourceUsage {
+	if m != nil {
+		return m.Usage
+	}
+	return nil
+}
+
+func (m *ResultMsg) GetExit() *ExitInfo {
+	if m != nil {
+		return m.Exit
+	}
+	return nil
+}
+
+func (m *ResultMsg) GetInputs() *InputHashes {
+	if m != nil {
+		return m.Inputs
+	}
+	return nil
+}
+
+func (m *ResultMsg) GetClientReport() string {
+	if m != nil {
+		return m.ClientReport
+	}
+	return ""
+}
+
+func (m *ResultMsg) GetBlockPostHashes() []string {
+	if m != nil {
+		return m.BlockPostHashes
+	}
+	return nil
+}
+
+func (m *ResultMsg) GetFiles() *ResultFiles {
+	if m != nil {
+		return m.Files
+	}
+	return nil
+}
+
+type FinalityInfo struct {
+	JustificationBits    string      `protobuf:"bytes,1,opt,name=justification_bits,json=justificationBits,proto3" json:"justification_bits,omitempty"`
+	PreviousJustified    *Checkpoint `protobuf:"bytes,2,opt,name=previous_justified,json=previousJustified,proto3" json:"previous_justified,omitempty"`
+	CurrentJustified     *Checkpoint `protobuf:"bytes,3,opt,name=current_justified,json=currentJustified,proto3" json:"current_justified,omitempty"`
+	Finalized            *Checkpoint `protobuf:"bytes,4,opt,name=finalized,proto3" json:"finalized,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *FinalityInfo) Reset()         { *m = FinalityInfo{} }
+func (m *FinalityInfo) String() string { return proto.CompactTextString(m) }
+func (*FinalityInfo) ProtoMessage()    {}
+func (*FinalityInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4feee897733d2100, []int{1}
+}
+
+func (m *FinalityInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FinalityInfo.Unmarshal(m, b)
+}
+func (m *FinalityInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FinalityInfo.Marshal(b, m, deterministic)
+}
+func (m *FinalityInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FinalityInfo.Merge(m, src)
+}
+func (m *FinalityInfo) XXX_Size() int {
+	return xxx_messageInfo_FinalityInfo.Size(m)
+}
+func (m *FinalityInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_FinalityInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FinalityInfo proto.InternalMessageInfo
+
+func (m *FinalityInfo) GetJustificationBits() string {
+	if m != nil {
+		return m.JustificationBits
+	}
+	return ""
+}
+
+func (m *FinalityInfo) GetPreviousJustified() *Checkpoint {
+	if m != nil {
+		return m.PreviousJustified
+	}
+	return nil
+}
+
+func (m *FinalityInfo) GetCurrentJustified() *Checkpoint {
+	if m != nil {
+		return m.CurrentJustified
+	}
+	return nil
+}
+
+func (m *FinalityInfo) GetFinalized() *Checkpoint {
+	if m != nil {
+		return m.Finalized
+	}
+	return nil
+}
+
+type Checkpoint struct {
+	Epoch                uint64   `protobuf:"varint,1,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	Root                 string   `protobuf:"bytes,2,opt,name=root,proto3" json:"root,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Checkpoint) Reset()         { *m = Checkpoint{} }
+func (m *Checkpoint) String() string { return proto.CompactTextString(m) }
+func (*Checkpoint) ProtoMessage()    {}
+func (*Checkpoint) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4feee897733d2100, []int{2}
+}
+
+func (m *Checkpoint) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Checkpoint.Unmarshal(m, b)
+}
+func (m *Checkpoint) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Checkpoint.Marshal(b, m, deterministic)
+}
+func (m *Checkpoint) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Checkpoint.Merge(m, src)
+}
+func (m *Checkpoint) XXX_Size() int {
+	return xxx_messageInfo_Checkpoint.Size(m)
+}
+func (m *Checkpoint) XXX_DiscardUnknown() {
+	xxx_messageInfo_Checkpoint.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Checkpoint proto.InternalMessageInfo
+
+func (m *Checkpoint) GetEpoch() uint64 {
+	if m != nil {
+		return m.Epoch
+	}
+	return 0
+}
+
+func (m *Checkpoint) GetRoot() string {
+	if m != nil {
+		return m.Root
+	}
+	return ""
+}
+
+type ResourceUsage struct {
+	DurationMs           int64    `protobuf:"varint,1,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	UserMs               int64    `protobuf:"varint,2,opt,name=user_ms,json=userMs,proto3" json:"user_ms,omitempty"`
+	SystemMs             int64    `protobuf:"varint,3,opt,name=system_ms,json=systemMs,proto3" json:"system_ms,omitempty"`
+	MaxRss               int64    `protobuf:"varint,4,opt,name=max_rss,json=maxRss,proto3" json:"max_rss,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ResourceUsage) Reset()         { *m = ResourceUsage{} }
+func (m *ResourceUsage) String() string { return proto.CompactTextString(m) }
+func (*ResourceUsage) ProtoMessage()    {}
+func (*ResourceUsage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4feee897733d2100, []int{3}
+}
+
+func (m *ResourceUsage) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResourceUsage.Unmarshal(m, b)
+}
+func (m *ResourceUsage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResourceUsage.Marshal(b, m, deterministic)
+}
+func (m *ResourceUsage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResourceUsage.Merge(m, src)
+}
+func (m *ResourceUsage) XXX_Size() int {
+	return xxx_messageInfo_ResourceUsage.Size(m)
+}
+func (m *ResourceUsage) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResourceUsage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResourceUsage proto.InternalMessageInfo
+
+func (m *ResourceUsage) GetDurationMs() int64 {
+	if m != nil {
+		return m.DurationMs
+	}
+	return 0
+}
+
+func (m *ResourceUsage) GetUserMs() int64 {
+	if m != nil {
+		return m.UserMs
+	}
+	return 0
+}
+
+func (m *ResourceUsage) GetSystemMs() int64 {
+	if m != nil {
+		return m.SystemMs
+	}
+	return 0
+}
+
+func (m *ResourceUsage) GetMaxRss() int64 {
+	if m != nil {
+		return m.MaxRss
+	}
+	return 0
+}
+
+type ExitInfo struct {
+	// -1 if the client did not exit by itself
+	ExitCode int64 `protobuf:"varint,1,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	// the signal that killed the client, e.g. "killed"
+	Signal               string   `protobuf:"bytes,2,opt,name=signal,proto3" json:"signal,omitempty"`
+	TimedOut             bool     `protobuf:"varint,3,opt,name=timed_out,json=timedOut,proto3" json:"timed_out,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ExitInfo) Reset()         { *m = ExitInfo{} }
+func (m *ExitInfo) String() string { return proto.CompactTextString(m) }
+func (*ExitInfo) ProtoMessage()    {}
+func (*ExitInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4feee897733d2100, []int{4}
+}
+
+func (m *ExitInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExitInfo.Unmarshal(m, b)
+}
+func (m *ExitInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExitInfo.Marshal(b, m, deterministic)
+}
+func (m *ExitInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExitInfo.Merge(m, src)
+}
+func (m *ExitInfo) XXX_Size() int {
+	return xxx_messageInfo_ExitInfo.Size(m)
+}
+func (m *ExitInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExitInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExitInfo proto.InternalMessageInfo
+
+func (m *ExitInfo) GetExitCode() int64 {
+	if m != nil {
+		return m.ExitCode
+	}
+	return 0
+}
+
+func (m *ExitInfo) GetSignal() string {
+	if m != nil {
+		return m.Signal
+	}
+	return ""
+}
+
+func (m *ExitInfo) GetTimedOut() bool {
+	if m != nil {
+		return m.TimedOut
+	}
+	return false
+}
+
+type InputHashes struct {
+	Pre                  string   `protobuf:"bytes,1,opt,name=pre,proto3" json:"pre,omitempty"`
+	Blocks               []string `protobuf:"bytes,2,rep,name=blocks,proto3" json:"blocks,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InputHashes) Reset()         { *m = InputHashes{} }
+func (m *InputHashes) String() string { return proto.CompactTextString(m) }
+func (*InputHashes) ProtoMessage()    {}
+func (*InputHashes) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4feee897733d2100, []int{5}
+}
+
+func (m *InputHashes) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InputHashes.Unmarshal(m, b)
+}
+func (m *InputHashes) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InputHashes.Marshal(b, m, deterministic)
+}
+func (m *InputHashes) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InputHashes.Merge(m, src)
+}
+func (m *InputHashes) XXX_Size() int {
+	return xxx_messageInfo_InputHashes.Size(m)
+}
+func (m *InputHashes) XXX_DiscardUnknown() {
+	xxx_messageInfo_InputHashes.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InputHashes proto.InternalMessageInfo
+
+func (m *InputHashes) GetPre() string {
+	if m != nil {
+		return m.Pre
+	}
+	return ""
+}
+
+func (m *InputHashes) GetBlocks() []string {
+	if m != nil {
+		return m.Blocks
+	}
+	return nil
+}
+
+type ResultFiles struct {
+	PostState   string `protobuf:"bytes,1,opt,name=post_state,json=postState,proto3" json:"post_state,omitempty"`
+	ErrLog      string `protobuf:"bytes,2,opt,name=err_log,json=errLog,proto3" json:"err_log,omitempty"`
+	OutLog      string `protobuf:"bytes,3,opt,name=out_log,json=outLog,proto3" json:"out_log,omitempty"`
+	ErrLogTimed string `protobuf:"bytes,4,opt,name=err_log_timed,json=errLogTimed,proto3" json:"err_log_timed,omitempty"`
+	OutLogTimed string `protobuf:"bytes,5,opt,name=out_log_timed,json=outLogTimed,proto3" json:"out_log_timed,omitempty"`
+	CombinedLog string `protobuf:"bytes,6,opt,name=combined_log,json=combinedLog,proto3" json:"combined_log,omitempty"`
+	ExitInfo    string `protobuf:"bytes,7,opt,name=exit_info,json=exitInfo,proto3" json:"exit_info,omitempty"`
+	// the diff of the post state with the reference client, if they differ
+	PostDiff string `protobuf:"bytes,8,opt,name=post_diff,json=postDiff,proto3" json:"post_diff,omitempty"`
+	// the post states after every block but the last, with --per-block-posts
+	BlockPostStates []string `protobuf:"bytes,9,rep,name=block_post_states,json=blockPostStates,proto3" json:"block_post_states,omitempty"`
+	// the repro bundle of a failed transition, with --repro-bundles
+	Repro                string   `protobuf:"bytes,10,opt,name=repro,proto3" json:"repro,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ResultFiles) Reset()         { *m = ResultFiles{} }
+func (m *ResultFiles) String() string { return proto.CompactTextString(m) }
+func (*ResultFiles) ProtoMessage()    {}
+func (*ResultFiles) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4feee897733d2100, []int{6}
+}
+
+func (m *ResultFiles) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResultFiles.Unmarshal(m, b)
+}
+func (m *ResultFiles) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResultFiles.Marshal(b, m, deterministic)
+}
+func (m *ResultFiles) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResultFiles.Merge(m, src)
+}
+func (m *ResultFiles) XXX_Size() int {
+	return xxx_messageInfo_ResultFiles.Size(m)
+}
+func (m *ResultFiles) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResultFiles.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResultFiles proto.InternalMessageInfo
+
+func (m *ResultFiles) GetPostState() string {
+	if m != nil {
+		return m.PostState
+	}
+	return ""
+}
+
+func (m *ResultFiles) GetErrLog() string {
+	if m != nil {
+		return m.ErrLog
+	}
+	return ""
+}
+
+func (m *ResultFiles) GetOutLog() string {
+	if m != nil {
+		return m.OutLog
+	}
+	return ""
+}
+
+func (m *ResultFiles) GetErrLogTimed() string {
+	if m != nil {
+		return m.ErrLogTimed
+	}
+	return ""
+}
+
+func (m *ResultFiles) GetOutLogTimed() string {
+	if m != nil {
+		return m.OutLogTimed
+	}
+	return ""
+}
+
+func (m *ResultFiles) GetCombinedLog() string {
+	if m != nil {
+		return m.CombinedLog
+	}
+	return ""
+}
+
+func (m *ResultFiles) GetExitInfo() string {
+	if m != nil {
+		return m.ExitInfo
+	}
+	return ""
+}
+
+func (m *ResultFiles) GetPostDiff() string {
+	if m != nil {
+		return m.PostDiff
+	}
+	return ""
+}
+
+func (m *ResultFiles) GetBlockPostStates() []string {
+	if m != nil {
+		return m.BlockPostStates
+	}
+	return nil
+}
+
+func (m *ResultFiles) GetRepro() string {
+	if m != nil {
+		return m.Repro
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*ResultMsg)(nil), "muskoka.ResultMsg")
+	proto.RegisterType((*FinalityInfo)(nil), "muskoka.FinalityInfo")
+	proto.RegisterType((*Checkpoint)(nil), "muskoka.Checkpoint")
+	proto.RegisterType((*ResourceUsage)(nil), "muskoka.ResourceUsage")
+	proto.RegisterType((*ExitInfo)(nil), "muskoka.ExitInfo")
+	proto.RegisterType((*InputHashes)(nil), "muskoka.InputHashes")
+	proto.RegisterType((*ResultFiles)(nil), "muskoka.ResultFiles")
+}
+
+func init() { proto.RegisterFile("result.proto", fileDescriptor_4feee897733d2100) }
+
+var fileDescriptor_4feee897733d2100 = []byte{
+	// 926 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x55, 0xdf, 0x6f, 0x1b, 0x45,
+	0x10, 0x96, 0xe3, 0xc4, 0xb1, 0xc7, 0x76, 0x1b, 0x6f, 0xd3, 0x72, 0x0a, 0x3f, 0xea, 0x1a, 0x55,
+	0x8a, 0xaa, 0xd6, 0x51, 0x5b, 0x01, 0x0f, 0xbc, 0xa0, 0x84, 0x54, 0x14, 0x11, 0x40, 0x07, 0xf4,
+	0x01, 0x21, 0x9d, 0xce, 0x77, 0x73, 0xf6, 0xe2, 0xbb, 0xdb, 0xd3, 0xce, 0x6e, 0xeb, 0xf0, 0xc2,
+	0xff, 0xc0, 0xff, 0xc4, 0xbf, 0xc4, 0x33, 0xda, 0xd9, 0x3d, 0x3b, 0x8d, 0xd4, 0x37, 0xcf, 0xf7,
+	0x7d, 0x33, 0x7b, 0x33, 0xfb, 0xed, 0x18, 0x46, 0x1a, 0xc9, 0x96, 0x66, 0xde, 0x68, 0x65, 0x94,
+	0x38, 0xac, 0x2c, 0xad, 0xd5, 0x3a, 0x3d, 0xf9, 0x6c, 0xa9, 0xd4, 0xb2, 0xc4, 0x33, 0x86, 0x17,
+	0xb6, 0x38, 0x7b, 0xa7, 0xd3, 0xa6, 0x41, 0x4d, 0x5e, 0x38, 0xfb, 0xa7, 0x07, 0x83, 0x98, 0x33,
+	0xaf, 0x68, 0x29, 0x1e, 0xc3, 0x1d, 0xca, 0x56, 0x58, 0xa5, 0xc9, 0x5b, 0xd4, 0x24, 0x55, 0x1d,
+	0x75, 0xa6, 0x9d, 0xd3, 0x71, 0x3c, 0xf6, 0xe8, 0x1b, 0x0f, 0x8a, 0x08, 0x0e, 0xc9, 0x66, 0x19,
+	0x12, 0x45, 0x7b, 0xd3, 0xce, 0x69, 0x3f, 0x6e, 0x43, 0xf1, 0x00, 0x7a, 0x64, 0x52, 0x63, 0x29,
+	0xea, 0x4e, 0x3b, 0xa7, 0x83, 0x38, 0x44, 0xe2, 0x04, 0xfa, 0xb8, 0xc9, 0x10, 0x73, 0xcc, 0xa3,
+	0x7d, 0x66, 0xb6, 0xb1, 0x98, 0xc2, 0x50, 0xd6, 0x06, 0xb5, 0xb6, 0x8d, 0xc1, 0x3c, 0x3a, 0xe0,
+	0x8a, 0x37, 0x21, 0xf1, 0x31, 0x0c, 0x1a, 0x45, 0x26, 0x59, 0xa5, 0xb4, 0x8a, 0x7a, 0x3e, 0xdd,
+	0x01, 0xdf, 0xa5, 0xb4, 0xda, 0x92, 0x5a, 0x29, 0x13, 0x1d, 0xee, 0xc8, 0x58, 0x29, 0x23, 0x1e,
+	0xc2, 0x30, 0x2b, 0x25, 0xd6, 0x26, 0xa9, 0xd3, 0x0a, 0xa3, 0x3e, 0xd3, 0xe0, 0xa1, 0x1f, 0xd3,
+	0x0a, 0x5d, 0xc7, 0x41, 0xd0, 0x76, 0x3c, 0x60, 0xcd, 0xd8, 0xa3, 0x6d, 0xc7, 0x47, 0xd0, 0x5d,
+	0xe3, 0x75, 0x04, 0xcc, 0xb9, 0x9f, 0xe2, 0x11, 0x8c, 0xa8, 0xc1, 0x6c, 0x9b, 0x26, 0x98, 0x1a,
+	0x3a, 0xac, 0x4d, 0x7a, 0x08, 0x1c, 0x26, 0x99, 0xaa, 0x0b, 0xb9, 0x8c, 0xee, 0xf9, 0xc3, 0x1d,
+	0x74, 0xc1, 0x88, 0xf8, 0x04, 0x06, 0x99, 0xaa, 0x09, 0x6b, 0xb2, 0x14, 0x0d, 0x99, 0xde, 0x01,
+	0xe2, 0x12, 0x8e, 0xaa, 0xd4, 0x64, 0x2b, 0xa4, 0x04, 0x37, 0x0d, 0x66, 0x6e, 0x38, 0xa3, 0x69,
+	0xe7, 0x74, 0xf8, 0xe2, 0x64, 0xee, 0x6f, 0x75, 0xde, 0xde, 0xea, 0xfc, 0x5c, 0xa9, 0xf2, 0x4d,
+	0x5a, 0x5a, 0x8c, 0xef, 0x86, 0x9c, 0xcb, 0x90, 0x22, 0x9e, 0x43, 0xbf, 0x90, 0x75, 0x5a, 0x4a,
+	0x73, 0x1d, 0x8d, 0x39, 0xfd, 0xfe, 0x3c, 0xb8, 0x63, 0xfe, 0x2a, 0x10, 0xaf, 0xeb, 0x42, 0xc5,
+	0x5b, 0x99, 0x78, 0x0a, 0x07, 0x96, 0xd2, 0x25, 0x46, 0x77, 0x58, 0xff, 0x60, 0xab, 0x8f, 0x91,
+	0x94, 0xd5, 0x19, 0xfe, 0xe6, 0xd8, 0xd8, 0x8b, 0xc4, 0x63, 0xd8, 0xc7, 0x8d, 0x34, 0xd1, 0x84,
+	0xc5, 0x93, 0xad, 0xf8, 0x72, 0x23, 0x0d, 0x17, 0x66, 0x5a, 0x3c, 0x85, 0x9e, 0xac, 0x1b, 0x6b,
+	0x28, 0xba, 0xcb, 0xc2, 0xe3, 0xad, 0xf0, 0xb5, 0x83, 0xdd, 0x5d, 0x22, 0xc5, 0x41, 0x23, 0x3e,
+	0x87, 0x70, 0x03, 0x89, 0xc6, 0x46, 0x69, 0x13, 0x1d, 0xf3, 0x78, 0x46, 0x1e, 0x8c, 0x19, 0x13,
+	0x4f, 0x60, 0xb2, 0x28, 0x55, 0xb6, 0x4e, 0xb6, 0xee, 0x40, 0x8a, 0xee, 0x4f, 0xbb, 0xa7, 0x83,
+	0xf8, 0x2e, 0x13, 0x3f, 0x07, 0x93, 0x20, 0x89, 0x27, 0x70, 0x50, 0xc8, 0x12, 0x29, 0x3a, 0xba,
+	0x75, 0xba, 0x77, 0xff, 0x2b, 0xc7, 0xc5, 0x5e, 0x32, 0xfb, 0xaf, 0x03, 0xa3, 0x9b, 0xa3, 0x11,
+	0xcf, 0x40, 0xfc, 0x69, 0xc9, 0xc8, 0x42, 0x66, 0xa9, 0x91, 0xaa, 0x4e, 0x16, 0xd2, 0x10, 0xbf,
+	0x8d, 0x41, 0x3c, 0x79, 0x8f, 0x39, 0x97, 0x86, 0xc4, 0x39, 0x88, 0x46, 0xe3, 0x5b, 0xa9, 0x2c,
+	0x25, 0x81, 0xc5, 0x9c, 0x9f, 0xca, 0xf0, 0xc5, 0xbd, 0xed, 0xc1, 0x17, 0x2b, 0xcc, 0xd6, 0x8d,
+	0x92, 0xb5, 0x89, 0x27, 0xad, 0xfc, 0xfb, 0x56, 0x2d, 0xbe, 0x81, 0x49, 0x66, 0xb5, 0x76, 0x13,
+	0xd8, 0x95, 0xe8, 0x7e, 0xb8, 0xc4, 0x51, 0x50, 0xef, 0x2a, 0x3c, 0x87, 0x81, 0xbf, 0xd1, 0xbf,
+	0xc2, 0xa3, 0xfb, 0x40, 0xe6, 0x4e, 0x35, 0xfb, 0x12, 0x60, 0x47, 0x88, 0x63, 0x38, 0xc0, 0x46,
+	0x65, 0x2b, 0x6e, 0x74, 0x3f, 0xf6, 0x81, 0x10, 0xb0, 0xcf, 0x4f, 0x6d, 0x8f, 0xbb, 0xe7, 0xdf,
+	0xb3, 0xbf, 0x61, 0xfc, 0x9e, 0x35, 0x9c, 0xf5, 0x73, 0xab, 0xfd, 0xac, 0x2a, 0x3f, 0xa9, 0x6e,
+	0x0c, 0x2d, 0x74, 0x45, 0xe2, 0x23, 0x38, 0xb4, 0x84, 0xda, 0x91, 0x7b, 0x4c, 0xf6, 0x5c, 0x78,
+	0x45, 0xee, 0x39, 0xd3, 0x35, 0x19, 0xac, 0x1c, 0xd5, 0x65, 0xaa, 0xef, 0x01, 0x9f, 0x55, 0xa5,
+	0x9b, 0x44, 0x13, 0x71, 0x43, 0xdd, 0xb8, 0x57, 0xa5, 0x9b, 0x98, 0x68, 0xf6, 0x07, 0xf4, 0x5b,
+	0xbb, 0xb9, 0x0a, 0xce, 0x70, 0x49, 0xa6, 0x72, 0x0c, 0x27, 0xf7, 0x1d, 0x70, 0xa1, 0x72, 0xe4,
+	0x05, 0x25, 0x97, 0x75, 0x5a, 0x86, 0xef, 0x0f, 0x91, 0x4b, 0x32, 0xb2, 0xc2, 0x3c, 0x51, 0xd6,
+	0xf0, 0xb1, 0xfd, 0xb8, 0xcf, 0xc0, 0x4f, 0xd6, 0xcc, 0xbe, 0x82, 0xe1, 0x0d, 0x8f, 0xba, 0x65,
+	0xd0, 0x68, 0x0c, 0xd7, 0xef, 0x7e, 0xba, 0xaa, 0xec, 0x37, 0xd7, 0x8c, 0x73, 0x5f, 0x88, 0x66,
+	0xff, 0xee, 0xc1, 0xf0, 0x86, 0xbf, 0xc4, 0xa7, 0x00, 0x6c, 0x55, 0xb7, 0x15, 0xdb, 0x02, 0xbc,
+	0xbd, 0x7e, 0x71, 0x80, 0x6b, 0x0f, 0xb5, 0x4e, 0x4a, 0xb5, 0x6c, 0xbf, 0x0e, 0xb5, 0xfe, 0x41,
+	0x2d, 0x1d, 0xa1, 0xac, 0x61, 0x22, 0xec, 0x55, 0x65, 0x8d, 0x23, 0x66, 0x30, 0x0e, 0x19, 0x09,
+	0x7f, 0x6d, 0x58, 0xae, 0x43, 0x9f, 0xf7, 0xab, 0x83, 0x9c, 0x26, 0x24, 0x07, 0xcd, 0x81, 0xd7,
+	0xf8, 0x12, 0x5e, 0xf3, 0x08, 0x46, 0x99, 0xaa, 0x16, 0xb2, 0xc6, 0x9c, 0x4f, 0xf1, 0x4b, 0x76,
+	0xd8, 0x62, 0xee, 0xa8, 0x76, 0xac, 0xb2, 0x2e, 0x54, 0xbb, 0x67, 0xf1, 0xc6, 0xcc, 0xb9, 0xb1,
+	0x5c, 0x16, 0x45, 0xd4, 0xdf, 0x2d, 0xe1, 0x6f, 0x65, 0x51, 0xdc, 0x7a, 0xa6, 0xdc, 0x3b, 0x45,
+	0x83, 0x5b, 0xcf, 0x94, 0x27, 0x40, 0xce, 0x73, 0x1a, 0x1b, 0xad, 0xc2, 0xaa, 0xf5, 0xc1, 0xf9,
+	0x17, 0xbf, 0xbf, 0x5c, 0x4a, 0xb3, 0xb2, 0x8b, 0x79, 0xa6, 0x2a, 0xff, 0x5f, 0x56, 0xa6, 0xd5,
+	0x22, 0x4f, 0xcf, 0x82, 0x9f, 0x9f, 0xbd, 0x53, 0x7a, 0x8d, 0xda, 0x53, 0x5f, 0x07, 0x70, 0xd1,
+	0xe3, 0xf0, 0xe5, 0xff, 0x03, 0x00, 0xaa, 0xcf, 0x73, 0xcf, 0x1c, 0x07, 0x00, 0x00,
+}
@@ -0,0 +1,317 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: runner.proto
+
+package muskoka
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type TransitionRequest struct {
+	Key         string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	SpecVersion string `protobuf:"bytes,2,opt,name=spec_version,json=specVersion,proto3" json:"spec_version,omitempty"`
+	SpecConfig  string `protobuf:"bytes,3,opt,name=spec_config,json=specConfig,proto3" json:"spec_config,omitempty"`
+	// the extra CLI arguments of the spec config, space separated. Empty if none.
+	ConfigArgs string `protobuf:"bytes,4,opt,name=config_args,json=configArgs,proto3" json:"config_args,omitempty"`
+	// the SSZ encoded pre state and blocks, or the other input files of the task type
+	Pre    []byte   `protobuf:"bytes,5,opt,name=pre,proto3" json:"pre,omitempty"`
+	Blocks [][]byte `protobuf:"bytes,6,rep,name=blocks,proto3" json:"blocks,omitempty"`
+	// "blocks", "finality", "epoch", "operation" or "slots"
+	Type string `protobuf:"bytes,7,opt,name=type,proto3" json:"type,omitempty"`
+	// the epoch sub-transition or operation type, for epoch and operation tasks
+	Operation string `protobuf:"bytes,8,opt,name=operation,proto3" json:"operation,omitempty"`
+	// the number of slots to process, for slots tasks
+	Slots                uint64   `protobuf:"varint,9,opt,name=slots,proto3" json:"slots,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TransitionRequest) Reset()         { *m = TransitionRequest{} }
+func (m *TransitionRequest) String() string { return proto.CompactTextString(m) }
+func (*TransitionRequest) ProtoMessage()    {}
+func (*TransitionRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_48eceea7e2abc593, []int{0}
+}
+
+func (m *TransitionRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TransitionRequest.Unmarshal(m, b)
+}
+func (m *TransitionRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TransitionRequest.Marshal(b, m, deterministic)
+}
+func (m *TransitionRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TransitionRequest.Merge(m, src)
+}
+func (m *TransitionRequest) XXX_Size() int {
+	return xxx_messageInfo_TransitionRequest.Size(m)
+}
+func (m *TransitionRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_TransitionRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TransitionRequest proto.InternalMessageInfo
+
+func (m *TransitionRequest) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *TransitionRequest) GetSpecVersion() string {
+	if m != nil {
+		return m.SpecVersion
+	}
+	return ""
+}
+
+func (m *TransitionRequest) GetSpecConfig() string {
+	if m != nil {
+		return m.SpecConfig
+	}
+	return ""
+}
+
+func (m *TransitionRequest) GetConfigArgs() string {
+	if m != nil {
+		return m.ConfigArgs
+	}
+	return ""
+}
+
+func (m *TransitionRequest) GetPre() []byte {
+	if m != nil {
+		return m.Pre
+	}
+	return nil
+}
+
+func (m *TransitionRequest) GetBlocks() [][]byte {
+	if m != nil {
+		return m.Blocks
+	}
+	return nil
+}
+
+func (m *TransitionRequest) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *TransitionRequest) GetOperation() string {
+	if m != nil {
+		return m.Operation
+	}
+	return ""
+}
+
+func (m *TransitionRequest) GetSlots() uint64 {
+	if m != nil {
+		return m.Slots
+	}
+	return 0
+}
+
+type TransitionResponse struct {
+	Success bool `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	// the SSZ encoded post state, if the transition succeeded
+	Post []byte `protobuf:"bytes,2,opt,name=post,proto3" json:"post,omitempty"`
+	// the output of the client, stored as the out log of the task
+	Logs []byte `protobuf:"bytes,3,opt,name=logs,proto3" json:"logs,omitempty"`
+	// why the transition failed, stored as the err log of the task
+	Error                string   `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TransitionResponse) Reset()         { *m = TransitionResponse{} }
+func (m *TransitionResponse) String() string { return proto.CompactTextString(m) }
+func (*TransitionResponse) ProtoMessage()    {}
+func (*TransitionResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_48eceea7e2abc593, []int{1}
+}
+
+func (m *TransitionResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TransitionResponse.Unmarshal(m, b)
+}
+func (m *TransitionResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TransitionResponse.Marshal(b, m, deterministic)
+}
+func (m *TransitionResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TransitionResponse.Merge(m, src)
+}
+func (m *TransitionResponse) XXX_Size() int {
+	return xxx_messageInfo_TransitionResponse.Size(m)
+}
+func (m *TransitionResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_TransitionResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TransitionResponse proto.InternalMessageInfo
+
+func (m *TransitionResponse) GetSuccess() bool {
+	if m != nil {
+		return m.Success
+	}
+	return false
+}
+
+func (m *TransitionResponse) GetPost() []byte {
+	if m != nil {
+		return m.Post
+	}
+	return nil
+}
+
+func (m *TransitionResponse) GetLogs() []byte {
+	if m != nil {
+		return m.Logs
+	}
+	return nil
+}
+
+func (m *TransitionResponse) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*TransitionRequest)(nil), "muskoka.TransitionRequest")
+	proto.RegisterType((*TransitionResponse)(nil), "muskoka.TransitionResponse")
+}
+
+func init() { proto.RegisterFile("runner.proto", fileDescriptor_48eceea7e2abc593) }
+
+var fileDescriptor_48eceea7e2abc593 = []byte{
+	// 336 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x91, 0x4f, 0x4b, 0xe4, 0x40,
+	0x10, 0xc5, 0xc9, 0xce, 0xff, 0xde, 0x2c, 0xcc, 0x36, 0xcb, 0xd2, 0x8c, 0x82, 0x71, 0x4e, 0xb9,
+	0x98, 0x01, 0x07, 0x4f, 0x9e, 0xd4, 0x8b, 0xe7, 0x46, 0x3c, 0x88, 0x30, 0x24, 0xb1, 0x8d, 0x21,
+	0x99, 0xae, 0x58, 0x95, 0x28, 0xf3, 0xdd, 0x3d, 0x48, 0x57, 0x47, 0x66, 0x40, 0x6f, 0xef, 0xfd,
+	0x5e, 0x25, 0x95, 0x97, 0x12, 0x21, 0x76, 0xd6, 0x1a, 0x4c, 0x1a, 0x84, 0x16, 0xe4, 0x64, 0xdb,
+	0x51, 0x05, 0x55, 0xba, 0xfc, 0x08, 0xc4, 0xdf, 0x3b, 0x4c, 0x2d, 0x95, 0x6d, 0x09, 0x56, 0x9b,
+	0xd7, 0xce, 0x50, 0x2b, 0xe7, 0x62, 0x50, 0x99, 0x9d, 0x0a, 0xa2, 0x20, 0x9e, 0x69, 0x27, 0xe5,
+	0xa9, 0x08, 0xa9, 0x31, 0xf9, 0xe6, 0xcd, 0x20, 0x95, 0x60, 0xd5, 0x2f, 0x8e, 0x7e, 0x3b, 0x76,
+	0xef, 0x91, 0x3c, 0x11, 0x6c, 0x37, 0x39, 0xd8, 0xe7, 0xb2, 0x50, 0x03, 0x9e, 0x10, 0x0e, 0xdd,
+	0x30, 0x71, 0x03, 0x3e, 0xdb, 0xa4, 0x58, 0x90, 0x1a, 0xfa, 0x01, 0x8f, 0xae, 0xb0, 0x20, 0xb7,
+	0xb6, 0x41, 0xa3, 0x46, 0x51, 0x10, 0x87, 0xda, 0x49, 0xf9, 0x5f, 0x8c, 0xb3, 0x1a, 0xf2, 0x8a,
+	0xd4, 0x38, 0x1a, 0xc4, 0xa1, 0xee, 0x9d, 0x94, 0x62, 0xd8, 0xee, 0x1a, 0xa3, 0x26, 0xfc, 0x0e,
+	0xd6, 0xf2, 0x58, 0xcc, 0xa0, 0x31, 0x98, 0xba, 0x22, 0x6a, 0xca, 0xc1, 0x1e, 0xc8, 0x7f, 0x62,
+	0x44, 0x35, 0xb4, 0xa4, 0x66, 0x51, 0x10, 0x0f, 0xb5, 0x37, 0xcb, 0x5a, 0xc8, 0xc3, 0xf6, 0xd4,
+	0x80, 0x25, 0x23, 0x95, 0x98, 0x50, 0x97, 0xe7, 0x86, 0x88, 0x7f, 0xc1, 0x54, 0x7f, 0x59, 0xb7,
+	0xb7, 0x01, 0x6a, 0xb9, 0x7e, 0xa8, 0x59, 0x3b, 0x56, 0x43, 0x41, 0x5c, 0x38, 0xd4, 0xac, 0xdd,
+	0x36, 0x83, 0x08, 0xd8, 0x97, 0xf4, 0xe6, 0xfc, 0x51, 0xcc, 0x0f, 0xb6, 0xf1, 0x3d, 0xe4, 0xad,
+	0xf8, 0xa3, 0x3b, 0xbb, 0xc7, 0x72, 0x91, 0xf4, 0xb7, 0x49, 0xbe, 0xdd, 0x65, 0x71, 0xf4, 0x63,
+	0xe6, 0xbf, 0xfa, 0xfa, 0xe2, 0x61, 0x5d, 0x94, 0xed, 0x4b, 0x97, 0x25, 0x39, 0x6c, 0x57, 0x7c,
+	0xe7, 0x3a, 0xdd, 0x66, 0x4f, 0xe9, 0xaa, 0x7f, 0xe8, 0xec, 0x1d, 0xb0, 0x32, 0xe8, 0xa3, 0xcb,
+	0x1e, 0x66, 0x63, 0xb6, 0xeb, 0xcf, 0x01, 0x00, 0xfe, 0xac, 0x68, 0x1a, 0x21, 0x02, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// TransitionRunnerClient is the client API for TransitionRunner service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type TransitionRunnerClient interface {
+	// RunTransition applies the blocks to the pre state, and returns the post state.
+	// A failed transition is a response without success, not an error status:
+	// error statuses are for requests the daemon could not process.
+	RunTransition(ctx context.Context, in *TransitionRequest, opts ...grpc.CallOption) (*TransitionResponse, error)
+}
+
+type transitionRunnerClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewTransitionRunnerClient(cc *grpc.ClientConn) TransitionRunnerClient {
+	return &transitionRunnerClient{cc}
+}
+
+func (c *transitionRunnerClient) RunTransition(ctx context.Context, in *TransitionRequest, opts ...grpc.CallOption) (*TransitionResponse, error) {
+	out := new(TransitionResponse)
+	err := c.cc.Invoke(ctx, "/muskoka.TransitionRunner/RunTransition", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TransitionRunnerServer is the server API for TransitionRunner service.
+type TransitionRunnerServer interface {
+	// RunTransition applies the blocks to the pre state, and returns the post state.
+	// A failed transition is a response without success, not an error status:
+	// error statuses are for requests the daemon could not process.
+	RunTransition(context.Context, *TransitionRequest) (*TransitionResponse, error)
+}
+
+// UnimplementedTransitionRunnerServer can be embedded to have forward compatible implementations.
+type UnimplementedTransitionRunnerServer struct {
+}
+
+func (*UnimplementedTransitionRunnerServer) RunTransition(ctx context.Context, req *TransitionRequest) (*TransitionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RunTransition not implemented")
+}
+
+func RegisterTransitionRunnerServer(s *grpc.Server, srv TransitionRunnerServer) {
+	s.RegisterService(&_TransitionRunner_serviceDesc, srv)
+}
+
+func _TransitionRunner_RunTransition_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransitionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransitionRunnerServer).RunTransition(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/muskoka.TransitionRunner/RunTransition",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransitionRunnerServer).RunTransition(ctx, req.(*TransitionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _TransitionRunner_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "muskoka.TransitionRunner",
+	HandlerType: (*TransitionRunnerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RunTransition",
+			Handler:    _TransitionRunner_RunTransition_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "runner.proto",
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/protolambda/muskoka-worker/worker"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// releaseMain runs the release subcommand: it signs worker binaries, and writes the release manifest for self-updating workers.
+func releaseMain(args []string) {
+	flags := flag.NewFlagSet("release", flag.ExitOnError)
+	keyPath := flags.String("key", "", "file with the hex-encoded ed25519 release signing key, or its 32 byte seed")
+	releaseVersion := flags.String("version", "", "the version of the release, e.g. v0.4.1")
+	out := flags.String("out", worker.ReleaseManifestName, "the file to write the release manifest to")
+	_ = flags.Parse(args)
+	if *keyPath == "" || *releaseVersion == "" || flags.NArg() == 0 {
+		log.Fatalf("release requires a --key, a --version and at least one <GOOS>-<GOARCH>=<binary> argument")
+	}
+	key, err := worker.LoadSigningKey(*keyPath)
+	if err != nil {
+		log.Fatalf("failed to load signing key: %v", err)
+	}
+	manifest := worker.ReleaseManifest{Version: *releaseVersion}
+	for _, arg := range flags.Args() {
+		i := strings.Index(arg, "=")
+		if i <= 0 {
+			log.Fatalf("expected <GOOS>-<GOARCH>=<binary>, got %q", arg)
+		}
+		data, err := ioutil.ReadFile(arg[i+1:])
+		if err != nil {
+			log.Fatalf("failed to read binary: %v", err)
+		}
+		worker.SignRelease(&manifest, arg[:i], filepath.Base(arg[i+1:]), data, key)
+	}
+	data, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		log.Fatalf("failed to encode release manifest: %v", err)
+	}
+	if err := ioutil.WriteFile(*out, data, 0644); err != nil {
+		log.Fatalf("failed to write release manifest: %v", err)
+	}
+	log.Printf("wrote release manifest of %s to %s, upload it with the binaries to the release source", *releaseVersion, *out)
+}
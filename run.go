@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/protolambda/muskoka-worker/worker"
+	"log"
+	"os"
+	"os/signal"
+)
+
+// runMain runs a single task with local input files through the worker pipeline, without a queue or buckets,
+// and prints the result message. The result files are written to a local results dir.
+func runMain(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	pre := flags.String("pre", "pre.ssz", "the pre state file of the task")
+	var blocks stringList
+	flags.Var(&blocks, "blocks", "comma-separated block files of the task, in order. Remaining arguments are block files too.")
+	var cfg worker.Config
+	flags.StringVar(&cfg.CliCmd, "cli-cmd", "zcli transition blocks", "the cli cmd to run the transition with. May contain placeholders like {pre}, like the worker option.")
+	flags.StringVar(&cfg.SpecVersion, "spec-version", "v0.8.3", "the spec version of the task")
+	specConfig := flags.String("spec-config", "minimal", "the spec config of the task")
+	flags.Var((*stringMap)(&cfg.ConfigCliArgs), "config-cli-args", "extra cli arguments for the spec config, as <config>=<args>")
+	flags.StringVar(&cfg.ClientName, "client-name", "local", "the client name in the result")
+	flags.StringVar(&cfg.ClientVersion, "client-version", "local", "the client version in the result")
+	key := flags.String("key", "local", "the key of the task")
+	resultsDir := flags.String("results-dir", "results", "the directory to write the result files to")
+	flags.DurationVar(&cfg.TransitionTimeout, "transition-timeout", 0, "kill the client if the transition runs longer than this. Unlimited if 0.")
+	hashTreeRoot := flags.Bool("hash-tree-root", false, "also compute the hash-tree-root of the post state")
+	_ = flags.Parse(args)
+	blocks = append(blocks, flags.Args()...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		<-c
+		log.Println("shutting down")
+		cancel()
+	}()
+
+	cfg.SpecConfigs = []string{*specConfig}
+	w := &worker.Worker{Config: cfg, Results: worker.NewDirStore(*resultsDir), Runner: worker.ExecRunner{}}
+	if *hashTreeRoot {
+		w.TreeHasher = worker.SSZTreeHasher
+	}
+	tr := worker.TransitionMsg{Blocks: len(blocks), SpecVersion: cfg.SpecVersion, SpecConfig: *specConfig, Key: *key}
+	result, err := worker.RunOnce(ctx, w, tr, *pre, blocks)
+	if err != nil {
+		log.Fatalf("failed to run task: %v", err)
+	}
+	os.Stdout.Write(result)
+	if res, err := worker.DecodeResult(result); err != nil || !res.Success {
+		os.Exit(1)
+	}
+}
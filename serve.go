@@ -0,0 +1,932 @@
+package main
+
+import (
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/protolambda/muskoka-worker/worker"
+	"google.golang.org/api/option"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// serveOptions are the options of the serve and validate commands:
+// the Config of the worker, and the options of the services it is connected to.
+type serveOptions struct {
+	cfg                   worker.Config
+	targets               stringList
+	inputsFallbackBuckets stringList
+	extraClients          map[string]string
+	runnerEnv             map[string]string
+	inputsFailoverAfter   time.Duration
+	runnerKind            string
+	runnerAddr            string
+	runnerTemplate        string
+	runnerStdin           string
+	execMode              string
+	dockerImage           string
+	dockerCPUs            string
+	dockerMemory          string
+	dockerCmd             string
+	queueKind             string
+	watchDir              string
+	taskEndpoint          string
+	taskEndpointToken     string
+	taskPollInterval      time.Duration
+	storageKind           string
+	azureConnectionString string
+	azureAccountName      string
+	azureIdentityClientID string
+	fsRoot                string
+	s3Endpoint            string
+	awsRegion             string
+	natsURL               string
+	pubsubEndpoint        string
+	storageEndpoint       string
+	mirrorResultsBucket   string
+	mirrorResultsTopic    string
+	tenantsPath           string
+	maxMem                int64
+	maxCPUSeconds         int
+	unclaimedTopicName    string
+	quarantineTopicName   string
+	capabilitiesTopicName string
+	resultURLCredentials  string
+	heartbeatTopicName    string
+	statusTopicName       string
+	hashTreeRoot          bool
+	exportFile            string
+	dynamicConfigLocation string
+	dynamicConfigInterval time.Duration
+	dryRun                bool
+	controlSubId          string
+	prioritySubSuffix     string
+	signingKeyPath        string
+	controlPubKeyHex      string
+	divergenceTopicName   string
+	resultsFeedSubId      string
+	httpAddr              string
+	adminAddr             string
+	adminToken            string
+	updateBucket          string
+	updateURL             string
+	updatePubKeyHex       string
+	updateInterval        time.Duration
+	updateDrainTimeout    time.Duration
+	clientArtifact        string
+	clientArtifactSHA256  string
+}
+
+// newServeFlags defines the options of the serve command on a new flag set with the name of the command.
+func newServeFlags(name string) (*flag.FlagSet, *serveOptions) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	o := &serveOptions{}
+	fs.StringVar(&o.cfg.InputsBucket, "inputs-bucket", "muskoka-transitions", "the name of the storage bucket to download input data from")
+	fs.Var(&o.inputsFallbackBuckets, "inputs-fallback-buckets", "comma-separated mirrors of the inputs bucket (e.g. in other regions) to fail over to when downloading from the inputs bucket fails or is slow")
+	fs.DurationVar(&o.inputsFailoverAfter, "inputs-failover-after", time.Second*5, "how long to wait for the inputs bucket to respond, before also trying the next fallback bucket")
+	fs.StringVar(&o.cfg.SpecVersion, "spec-version", "v0.8.3", "the spec-version to target")
+	fs.Var(&o.cfg.SpecVersions, "spec-versions", "a range of other spec versions to also accept tasks of, for the spec configs of the targets, e.g. '>=0.8.3 <0.9.0'. Space-separated constraints that must all match, alternatives separated by '||'. Only the exact target spec versions if empty.")
+	o.cfg.SpecConfigs = stringList{"minimal"}
+	fs.Var((*stringList)(&o.cfg.SpecConfigs), "spec-config", "the config name to target. Multiple configs can be comma-separated, each gets its own subscription.")
+	fs.Var(&o.targets, "target", "a spec version and config to process tasks for, as <spec-version>/<spec-config>, e.g. 'v0.9.1/mainnet'. Multiple targets can be comma-separated, each gets its own subscription. Replaces spec-version and spec-config if not empty.")
+	fs.Var((*stringMap)(&o.cfg.ConfigCliArgs), "config-cli-args", "extra cli arguments for tasks of a spec config, as <config>=<args>, e.g. to select the client preset. Repeat the flag for multiple configs.")
+	fs.Var((*stringMap)(&o.cfg.TaskCliCmds), "task-cli-cmd", "the cli cmd for tasks of a type, as <type>=<cli-cmd>. Types: epoch, operation, slots, or blocks and finality to override --cli-cmd. Tasks of other types than blocks and finality are only processed if they have a cli cmd. Repeat the flag for multiple types.")
+	fs.StringVar(&o.cfg.CliCmd, "cli-cmd", "zcli transition blocks", "change the cli cmd to run transitions with. May contain placeholders: {pre}, {post}, {blocks...}, {spec-version}, {spec-config}, {key}, {dir} and {config-args...}, instead of appending the config cli args, --pre <file> --post <file> and the block files.")
+	fs.StringVar(&o.runnerKind, "runner", "flags", "how the client command of a task is built: 'flags' runs the cli cmd with the config cli args, --pre <file> --post <file> and the block files, or with its placeholders substituted, 'template' runs the output of --runner-template, 'grpc' sends the task to the client daemon at --runner-addr")
+	fs.StringVar(&o.runnerAddr, "runner-addr", "", "the address of the client daemon, for --runner=grpc, e.g. localhost:4000")
+	fs.StringVar(&o.runnerTemplate, "runner-template", "", "a Go text/template of the client command, for --runner=template, e.g. '{{.CliCmd}} --input {{.Pre}} --output {{.Post}} {{join .Blocks \" \"}}'. The output is split on whitespace into arguments.")
+	fs.StringVar(&o.cfg.ReferenceCmd, "reference-cmd", "", "the cli cmd of a reference client to run every block transition with after the client. If the post states differ, a field-level diff is uploaded with the results, as post-diff. Disabled if empty.")
+	fs.Var((*stringMap)(&o.extraClients), "extra-client", "an additional client to run every task with, as <name>=<version>:<cli-cmd>. Its results are published to the results topic of the client, as if it was a separate worker. Repeat the flag for multiple clients.")
+	fs.Var((*stringMap)(&o.cfg.ClientEnv), "client-env", "an environment variable of the client command, as <name>=<value>, for every task. Not applied with --exec=server or --runner=grpc. Repeat the flag for multiple variables.")
+	fs.Var((*stringList)(&o.cfg.TaskEnvAllowlist), "task-env-allow", "comma-separated environment variables that tasks may set for the client command with the env task field, or name prefixes ending with '*', e.g. 'LOG_LEVEL,ZRNT_*'. Tasks with other variables are unsupported. Refused if empty.")
+	fs.Var((*stringMap)(&o.runnerEnv), "runner-env", "an environment variable of the client command, as <name>=<template>, for --runner=template. Repeat the flag for multiple variables.")
+	fs.StringVar(&o.runnerStdin, "runner-stdin", "", "a template of the path of a file to pipe to the standard input of the client command, for --runner=template, e.g. '{{.Pre}}'. No input if empty.")
+	fs.StringVar(&o.execMode, "exec", "local", "how to run the cli cmd: 'local' as a process on the worker host, or 'docker' inside a container of --docker-image, without network access, or 'server' as a client process that is kept running, and sent the tasks over stdin")
+	fs.StringVar(&o.dockerImage, "docker-image", "", "the client image to run the cli cmd in, for --exec=docker. The task work dir is mounted at the same path.")
+	fs.StringVar(&o.dockerCPUs, "docker-cpus", "", "the CPU limit of a transition container, e.g. '2'. Unlimited if empty.")
+	fs.StringVar(&o.dockerMemory, "docker-memory", "", "the memory limit (without swap) of a transition container, e.g. '4g'. Unlimited if empty.")
+	fs.StringVar(&o.dockerCmd, "docker-cmd", "docker", "the docker CLI binary")
+	fs.StringVar(&o.cfg.CliPreflightArgs, "cli-preflight-args", "--help", "arguments appended to the cli cmd to check if the client binary responds, before subscribing. Empty to only check if the binary exists.")
+	fs.StringVar(&o.queueKind, "queue", "pubsub", "the messaging service to receive tasks from and publish results and events to: 'pubsub' (GCP Pub/Sub), 'sqs' (AWS SQS), 'nats' (NATS JetStream), 'dir' (task files in --watch-dir) or 'http' (polling --task-endpoint)")
+	fs.StringVar(&o.watchDir, "watch-dir", "tasks", "the directory to pick up JSON task files from, and write results to, for --queue=dir")
+	fs.StringVar(&o.taskEndpoint, "task-endpoint", "", "the URL of the coordinator endpoint to poll for tasks, and to post results and events to, for --queue=http")
+	fs.StringVar(&o.taskEndpointToken, "task-endpoint-token", "", "the bearer token to authenticate to the task endpoint with. No authentication if empty.")
+	fs.DurationVar(&o.taskPollInterval, "task-poll-interval", time.Second*5, "how long to wait before polling the task endpoint again, when there was no task")
+	fs.StringVar(&o.storageKind, "storage", "gcs", "the storage service of the inputs and results buckets: 'gcs' (Google Cloud Storage), 's3' (AWS S3, or S3 compatible with --s3-endpoint), 'azure' (Azure Blob Storage, buckets are containers) or 'fs' (buckets are local directories in --fs-root)")
+	fs.StringVar(&o.azureConnectionString, "azure-connection-string", "", "the connection string of the Azure storage account, for --storage=azure")
+	fs.StringVar(&o.azureAccountName, "azure-account", "", "the Azure storage account to access with the managed identity of the instance, for --storage=azure without connection string")
+	fs.StringVar(&o.azureIdentityClientID, "azure-identity-client-id", "", "the client ID of the user-assigned managed identity to use. The system-assigned identity if empty.")
+	fs.StringVar(&o.fsRoot, "fs-root", ".", "the directory with the buckets, for --storage=fs")
+	fs.StringVar(&o.s3Endpoint, "s3-endpoint", "", "the URL of an S3 compatible service (e.g. MinIO), for --storage=s3. Buckets are addressed path-style. AWS S3 if empty.")
+	fs.StringVar(&o.awsRegion, "aws-region", "", "the AWS region of the SQS queues and S3 buckets. The region of the AWS environment config if empty.")
+	fs.StringVar(&o.natsURL, "nats-url", "nats://127.0.0.1:4222", "the URL of the NATS server, for --queue=nats")
+	o.cfg.PubsubReceive = worker.DefaultPubsubReceiveSettings
+	fs.IntVar(&o.cfg.PubsubReceive.MaxOutstandingMessages, "pubsub-max-outstanding-messages", 0, "the maximum number of Pub/Sub messages being handled at the same time, per subscription. The --concurrency (or 20, if unlimited) if 0.")
+	fs.IntVar(&o.cfg.PubsubReceive.MaxOutstandingBytes, "pubsub-max-outstanding-bytes", worker.DefaultPubsubReceiveSettings.MaxOutstandingBytes, "the maximum size in bytes of the Pub/Sub messages being handled at the same time, per subscription. Unlimited if -1.")
+	fs.IntVar(&o.cfg.PubsubReceive.NumGoroutines, "pubsub-num-goroutines", worker.DefaultPubsubReceiveSettings.NumGoroutines, "the number of goroutines pulling Pub/Sub messages, per subscription")
+	fs.BoolVar(&o.cfg.PubsubReceive.Synchronous, "pubsub-synchronous", worker.DefaultPubsubReceiveSettings.Synchronous, "if Pub/Sub messages should be pulled with synchronous pull requests, instead of a streaming pull")
+	fs.StringVar(&o.pubsubEndpoint, "pubsub-endpoint", os.Getenv("PUBSUB_EMULATOR_HOST"), "the host of a Pub/Sub emulator to connect to without credentials, e.g. 'localhost:8085', for queue=pubsub. Defaults to PUBSUB_EMULATOR_HOST. Google Cloud Pub/Sub if empty.")
+	fs.StringVar(&o.storageEndpoint, "storage-endpoint", os.Getenv("STORAGE_EMULATOR_HOST"), "the host of a GCS emulator (e.g. fake-gcs-server with -scheme http) to connect to without credentials, e.g. 'localhost:4443', for storage=gcs. Defaults to STORAGE_EMULATOR_HOST. Google Cloud Storage if empty.")
+	fs.StringVar(&o.cfg.GCPProjectID, "gcp-project-id", "muskoka", "change the google cloud project to connect with pubsub to")
+	fs.StringVar(&o.cfg.WorkerID, "worker-id", "poc", "the name of the worker. Pubsub subscription id is formatted as: <spec version>~<spec config>~<client name>~<worker id> to get a unique subscription name")
+	fs.StringVar(&o.cfg.ClientName, "client-name", "eth2team", "the client name; 'zrnt', 'lighthouse', etc.")
+	fs.StringVar(&o.cfg.ResultsBucket, "results-bucket", "results-eth2team", "the name of the bucket to upload the results to.")
+	fs.StringVar(&o.cfg.ClientVersion, "client-version", "v0.1.2_1a2b3c4", "the client version, and git commit hash start. In this order, separated by an underscore.")
+	fs.StringVar(&o.cfg.ResultPathTemplate, "result-path-template", worker.DefaultResultPathTemplate, "layout of the result files in the results bucket, with the placeholders {spec-version}, {spec-config}, {key}, {client}, {client-version} and {result-key}. Must contain {client} and {result-key}.")
+	fs.Var((*stringList)(&o.cfg.ResultRoutes), "result-routes", "comma-separated results buckets, or <bucket>/<prefix> paths, that tasks may route their results to with the results-bucket and results-prefix task fields. Routing is refused if empty.")
+	fs.StringVar(&o.mirrorResultsBucket, "mirror-results-bucket", "", "a secondary bucket to copy all result files to, in the background and best-effort (retried on failure). Disabled if empty.")
+	fs.StringVar(&o.mirrorResultsTopic, "mirror-results-topic", "", "a secondary pubsub topic to publish all result messages to, in the background and best-effort (retried on failure). Disabled if empty.")
+	fs.StringVar(&o.tenantsPath, "tenants", "", "path to a JSON file with per-client results buckets and credentials files, keyed by client name. If set, results are written to the bucket of the --client-name tenant, with its credentials, and only to its own result prefixes.")
+	fs.BoolVar(&o.cfg.CleanupTmp, "cleanup-tmp", true, "if the temporary files should be removed after uploading the results of a transition")
+	fs.StringVar(&o.cfg.WorkDir, "work-dir", "", "the directory to put the temporary task work dirs in, e.g. on a scratch volume. The system temp dir if empty.")
+	fs.Int64Var(&o.cfg.MinFreeDisk, "min-free-disk", 0, "the minimum free space in bytes on the volume of the work dir. Tasks are refused (nacked) while there is less, before downloading the inputs. Not checked if 0.")
+	fs.DurationVar(&o.cfg.OrphanMaxAge, "orphan-max-age", 0, "remove workspaces in the --work-dir that are not of a running or completed task, and were not modified for this long, e.g. left behind by a crashed run. Should be longer than the transition timeout if other workers share the work dir. Disabled if 0.")
+	fs.Int64Var(&o.cfg.WorkDirQuota, "work-dir-quota", 0, "the maximum total size in bytes of the temporary task work dirs. The oldest completed workspaces are removed first, also if --cleanup-tmp is false. Unlimited if 0.")
+	o.cfg.RejectExitCodes = intList{1}
+	fs.Var((*intList)(&o.cfg.RejectExitCodes), "reject-exit-codes", "the exit codes of the client that mean it rejected the transition, e.g. for an invalid block, comma-separated. Results of these have the transition-rejected status, other failures the client-crash status.")
+	fs.BoolVar(&o.cfg.ValidateInputs, "validate-inputs", false, "if the pre state and blocks of a task should be checked to decode for the spec version and config of the task, before running the client. Tasks with invalid inputs get an input-error result. Supported for the minimal and mainnet configs of spec versions v0.8.x and v0.9.x.")
+	fs.BoolVar(&o.cfg.CompressResults, "compress-results", false, "if the post state and logs should be gzipped before upload, with a gzip Content-Encoding on the objects. Results in a local results dir are not compressed.")
+	fs.BoolVar(&o.cfg.ReproBundles, "repro-bundles", false, "if a tarball with the inputs, post state, logs, command line and environment of a failed transition should be uploaded to the repro/ prefix of the results bucket, and referenced in the result message as files.repro")
+	fs.BoolVar(&o.cfg.PerBlockPosts, "per-block-posts", false, "if transitions of multiple blocks should run the client once per block, to upload the post state after every block, to find the block a divergence starts at. Every run gets the transition timeout.")
+	fs.BoolVar(&o.cfg.CombinedLog, "combined-log", false, "if a log with stdout and stderr interleaved (in order of arrival) should be uploaded, in addition to the separate logs")
+	fs.DurationVar(&o.cfg.LiveLogAfter, "live-log-after", 0, "stream partial stdout/stderr logs to the results bucket for transitions running longer than this. Disabled if 0.")
+	fs.DurationVar(&o.cfg.LiveLogInterval, "live-log-interval", time.Second*30, "how often to upload the partial logs of a long-running transition")
+	fs.DurationVar(&o.cfg.TransitionTimeout, "transition-timeout", 0, "kill the client, and its child processes, if a transition runs longer than this. The result is reported with status 'timeout'. Unlimited if 0.")
+	fs.IntVar(&o.cfg.DownloadParallelism, "download-parallelism", 8, "the maximum number of input files (pre state and blocks) of a task to download at the same time")
+	fs.IntVar(&o.cfg.MaxStorageConcurrency, "max-storage-concurrency", 0, "the maximum number of downloads and uploads at the same time, across all tasks, e.g. to stay within storage quotas. Unlimited if 0.")
+	fs.Int64Var(&o.cfg.MaxUploadBps, "max-upload-bps", 0, "the maximum upload bandwidth in bytes per second, shared by all uploads, e.g. to not saturate the network of the VM. Unlimited if 0.")
+	fs.Int64Var(&o.cfg.MaxCapturedOutput, "max-captured-output", 0, "the maximum number of bytes of stdout, and of stderr, to keep of a client run. The rest is discarded, after a truncation marker in the logs. Unlimited if 0.")
+	fs.IntVar(&o.cfg.StorageAttempts, "storage-attempts", 3, "the maximum number of attempts of an input download or result upload, with exponential backoff and jitter between attempts")
+	fs.DurationVar(&o.cfg.StorageRetryDelay, "storage-retry-delay", time.Second, "the backoff before the first retry of a failed download or upload. It doubles with every retry, up to 30s.")
+	fs.Int64Var(&o.maxMem, "max-mem", 0, "kill the client, and its child processes, if they use more than this many bytes of resident memory. The result is reported with status 'resource-exceeded'. Unlimited if 0. Linux only.")
+	fs.IntVar(&o.maxCPUSeconds, "max-cpu-seconds", 0, "kill the client, and its child processes, if they use more than this many seconds of CPU time. The result is reported with status 'resource-exceeded'. Unlimited if 0. Linux only.")
+	fs.BoolVar(&o.cfg.VerifyInputs, "verify-inputs", true, "if downloaded inputs should be verified with the MD5 or CRC32C checksums of the objects in the inputs store. Corrupted downloads are retried.")
+	fs.StringVar(&o.cfg.CacheDir, "cache-dir", "", "a directory to cache downloaded input files in, keyed by object and generation, so repeated tasks over the same inputs skip the download. Disabled if empty.")
+	fs.Int64Var(&o.cfg.CacheMaxBytes, "cache-max-bytes", 0, "the maximum total size in bytes of the input cache. The least recently used files are evicted first. Unlimited if 0.")
+	fs.StringVar(&o.cfg.ArtifactDir, "artifact-dir", "", "a directory to cache client artifacts in, keyed by checksum. Tasks with a client artifact are refused if empty. Should not be in the --work-dir.")
+	fs.StringVar(&o.clientArtifact, "client-artifact", "", "the path of a client binary in the inputs bucket to run tasks with, instead of the program of the cli cmd. Requires --client-artifact-sha256 and an --artifact-dir.")
+	fs.StringVar(&o.clientArtifactSHA256, "client-artifact-sha256", "", "the 0x-prefixed sha256 of the --client-artifact")
+	fs.IntVar(&o.cfg.MaxBlocks, "max-blocks", 0, "the maximum number of blocks in a task. Tasks with more blocks are ignored. Unlimited if 0.")
+	fs.StringVar(&o.cfg.BatchCliCmd, "batch-cli-cmd", "", "the batch cli cmd of the client, to run multiple tasks per invocation: it is run with --manifest <file> --results <dir>, see the README. Disabled if empty.")
+	fs.IntVar(&o.cfg.BatchSize, "batch-size", 0, "the maximum number of tasks of the same spec version and config to run in one batch-cli-cmd invocation. Tasks run one by one if less than 2.")
+	fs.DurationVar(&o.cfg.BatchWait, "batch-wait", time.Second*5, "how long a batch waits for more tasks, after its first task is ready to run")
+	fs.IntVar(&o.cfg.Concurrency, "concurrency", 0, "the maximum number of tasks to process at the same time. Waiting tasks are started smallest (fewest blocks) first. Also limits the number of messages received at a time, per subscription. Unlimited, in order of delivery, if 0.")
+	fs.IntVar(&o.cfg.LargeTaskBlocks, "large-task-blocks", 0, "tasks with at least this many blocks are large, and limited by --max-large-tasks. Disabled if 0.")
+	fs.IntVar(&o.cfg.MaxLargeTasks, "max-large-tasks", 1, "the maximum number of large tasks to process at the same time, to fit memory. Only applies if --concurrency is set.")
+	fs.Var((*intMap)(&o.cfg.ConfigWeights), "config-weight", "the relative share of the concurrent task slots for a spec config subscription, as <config>=<weight>, when tasks of multiple configs are waiting. 1 by default. Only applies if --concurrency is set. Repeat the flag for multiple configs.")
+	fs.Var((*stringMap)(&o.cfg.AckPolicy), "ack-policy", "the ack action for an error class, as <class>=<action>. Classes: malformed (default nack), infra (default nack), client (default result). Actions: ack, nack, nack-backoff, quarantine, result (client and infra only). Repeat the flag for multiple classes.")
+	fs.StringVar(&o.cfg.UnsupportedAction, "unsupported-action", worker.UnsupportedAck, "what to do with tasks of another spec version or config, with too many blocks, or of an unsupported type: ack (drop the task), forward (publish it to the --unclaimed-topic, and ack) or nack (after the --unsupported-nack-delay, so another worker may claim it)")
+	fs.StringVar(&o.unclaimedTopicName, "unclaimed-topic", "", "the pubsub topic to publish unsupported tasks to, for --unsupported-action=forward")
+	fs.DurationVar(&o.cfg.UnsupportedNackDelay, "unsupported-nack-delay", time.Minute, "how long to wait before nacking an unsupported task, for --unsupported-action=nack")
+	fs.StringVar(&o.quarantineTopicName, "quarantine-topic", "", "the pubsub topic to publish the messages of failed tasks to, for the quarantine ack action")
+	fs.StringVar(&o.cfg.DedupLedger, "dedup-ledger", "", "a file to record completed tasks in, to ack redeliveries of a task completed within the --dedup-window (by the same client version, and with the same inputs if the task has checksums) without running it again. Disabled if empty.")
+	fs.DurationVar(&o.cfg.DedupWindow, "dedup-window", time.Hour, "how long completed tasks are kept in the --dedup-ledger")
+	fs.StringVar(&o.cfg.ResultSpool, "result-spool", "", "a directory to spool result messages in that failed to publish, after their result files were uploaded. The task is acked, and spooled results are retried with backoff, also after a restart. Disabled if empty.")
+	fs.BoolVar(&o.cfg.DedupDeliveries, "dedup-deliveries", true, "if concurrent deliveries of the same task should be coalesced onto a single execution, acked when it completes. If false, every delivery is processed with its own result key.")
+	fs.StringVar(&o.capabilitiesTopicName, "capabilities-topic", "", "the pubsub topic to declare the worker capabilities (task types, spec versions, configs, max blocks) to on startup. Disabled if empty. The topic must exist.")
+	fs.StringVar(&o.cfg.ResultURLs, "result-urls", worker.ResultURLsPublic, "how result files are referenced in result messages: 'public' URLs, V4 'signed' URLs (storage=gcs only) that expire after --result-url-ttl, or the object 'path' in the results bucket")
+	fs.DurationVar(&o.cfg.ResultURLTTL, "result-url-ttl", worker.MaxSignedURLTTL, "how long signed result URLs are valid, 7 days at most")
+	fs.StringVar(&o.resultURLCredentials, "result-url-credentials", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"), "the JSON key file of the service account to sign result URLs with, for result-urls=signed. Defaults to GOOGLE_APPLICATION_CREDENTIALS.")
+	fs.IntVar(&o.cfg.UploadChunkSize, "upload-chunk-size", 16<<20, "the size of the chunks that results are uploaded in, with resumable (gcs), multipart (s3) or block (azure) uploads. Failed chunks are retried on their own. The store default if 0.")
+	fs.DurationVar(&o.cfg.UploadStallTimeout, "upload-stall-timeout", time.Minute, "cancel and retry an upload if it makes no progress for this long. Never if 0.")
+	fs.StringVar(&o.cfg.ClientReport, "client-report", "", "where to read a JSON report of the client about a transition from, to embed in the result message as client-report: 'stdout' (the last line of stdout) or 'file' (the {report} file). Disabled if empty.")
+	fs.StringVar(&o.cfg.ResultFormat, "result-format", worker.ResultFormatJSON, "the encoding of the published result messages: 'json', or 'proto' (see proto/result.proto)")
+	fs.StringVar(&o.heartbeatTopicName, "heartbeat-topic", "", "the topic to publish worker heartbeats (worker, client, uptime, task counts, last error) to, e.g. 'workers-status'. With queue=http, heartbeats are posted to the task endpoint. Disabled if empty.")
+	fs.DurationVar(&o.cfg.HeartbeatInterval, "heartbeat-interval", time.Second*30, "how often to publish a heartbeat")
+	fs.StringVar(&o.statusTopicName, "status-topic", "", "the pubsub topic to publish task progress events (downloading, executing, uploading, done) to. Disabled if empty.")
+	fs.StringVar(&o.cfg.CanaryKey, "canary-key", "", "the key of a known-good task in the inputs bucket to periodically re-run, to detect client or environment drift. Disabled if empty.")
+	fs.IntVar(&o.cfg.CanaryBlocks, "canary-blocks", 0, "the number of blocks of the canary task")
+	fs.StringVar(&o.cfg.CanaryPostHash, "canary-post-hash", "", "the expected post hash (0x-prefixed hex) of the canary task. If empty, the first canary result is used as reference.")
+	fs.DurationVar(&o.cfg.CanaryInterval, "canary-interval", time.Hour, "how often to run the canary task")
+	fs.StringVar(&o.cfg.JournalDir, "journal-dir", "", "the directory to journal running tasks in. Tasks left in the journal by a crashed worker are recovered on startup. Disabled if empty.")
+	fs.StringVar(&o.cfg.RecoverMode, "recover", worker.RecoverReport, "how to recover interrupted tasks from the journal: 'report' publishes an interrupted result, 'rerun' runs the task again")
+	fs.StringVar(&o.cfg.StatsFile, "stats-file", "", "the file to persist rolling task statistics (served on /stats) in. Kept in memory only if empty.")
+	fs.BoolVar(&o.hashTreeRoot, "hash-tree-root", false, "if the SSZ hash-tree-root of the post state should be computed and reported as post-root in results. Supported for the minimal and mainnet configs of spec versions v0.8.x and v0.9.x.")
+	fs.StringVar(&o.exportFile, "export-file", "", "a local file to append every published result to, as JSON lines, or as CSV if the name ends with .csv. Disabled if empty.")
+	fs.StringVar(&o.cfg.SelfTestDir, "self-test-dir", "", "directory with a golden vector (pre.ssz, block_<i>.ssz, expected post.ssz) to run through the client on startup. The worker refuses to start if the output mismatches. Disabled if empty.")
+	fs.StringVar(&o.dynamicConfigLocation, "dynamic-config", "", "location of a JSON config (cli-cmd, inputs-bucket, results-bucket) managed by the coordinator, to load on startup and refresh periodically: gs://<bucket>/<object> or a http(s) URL. Disabled if empty.")
+	fs.DurationVar(&o.dynamicConfigInterval, "dynamic-config-interval", time.Minute*5, "how often to refresh the dynamic config")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "check the bucket permissions, the topics and subscriptions, the client CLI and the temp dir, print a report and exit, without processing tasks. Exits with a non-zero code if a check fails.")
+	fs.StringVar(&o.prioritySubSuffix, "priority-sub-suffix", "", "also receive tasks from a high-priority subscription per target, named <task subscription>~<suffix> (e.g. 'urgent'). Its tasks start before waiting tasks of the normal subscriptions. Requires a concurrency limit. Disabled if empty.")
+	fs.StringVar(&o.controlSubId, "control-sub", "", "the pubsub subscription to receive signed control messages (e.g. config updates) from. Disabled if empty.")
+	fs.StringVar(&o.signingKeyPath, "signing-key", "", "a file with the hex-encoded ed25519 private key (or 32 byte seed) to sign result messages with. The signature, public key and worker ID are added as message attributes. Results are not signed if empty.")
+	fs.StringVar(&o.controlPubKeyHex, "control-pubkey", "", "the hex-encoded ed25519 public key that control messages must be signed with")
+	fs.StringVar(&o.divergenceTopicName, "divergence-topic", "", "the pubsub topic to publish alerts to when a post hash disagrees with the consensus of other clients, e.g. 'divergences'. Disabled if empty.")
+	fs.StringVar(&o.resultsFeedSubId, "results-feed-sub", "", "the pubsub subscription to receive the results of other clients from, to mark results with consensus agreement. Disabled if empty.")
+	fs.StringVar(&o.httpAddr, "http-addr", "", "the address to serve the status endpoint (/status), expvar metrics (/debug/vars) and Prometheus metrics (/metrics) on, e.g. ':8080'. Disabled if empty.")
+	fs.StringVar(&o.cfg.OTLPEndpoint, "otlp-endpoint", "", "the OTLP/HTTP collector to export a trace of each task to (spans for the download, client execution, hashing, upload and result publish), e.g. 'http://localhost:4318'. The trace context is added to result messages as traceparent attribute. Disabled if empty.")
+	fs.StringVar(&o.adminAddr, "admin-addr", "", "the address to serve the admin API (/pause, /resume, /status, /tasks/inflight) on, e.g. '127.0.0.1:8081'. Requires --admin-token. Disabled if empty.")
+	fs.StringVar(&o.adminToken, "admin-token", "", "the bearer token that admin API requests must be authenticated with")
+	fs.StringVar(&o.updateBucket, "update-bucket", "", "the bucket with worker releases to self-update from, see the release command. Self-update is disabled if empty, unless update-url is set.")
+	fs.StringVar(&o.updateURL, "update-url", "", "the base URL of worker releases to self-update from, e.g. https://github.com/<owner>/<repo>/releases/latest/download. Self-update is disabled if empty, unless update-bucket is set.")
+	fs.StringVar(&o.updatePubKeyHex, "update-pubkey", "", "the hex-encoded ed25519 public key that release binaries must be signed with")
+	fs.DurationVar(&o.updateInterval, "update-interval", time.Hour, "how often to check for a newer worker release")
+	fs.DurationVar(&o.updateDrainTimeout, "update-drain-timeout", 30*time.Minute, "how long to wait for in-flight tasks to finish before installing a release. The update is retried on the next check on timeout.")
+	fs.String(configFlag, "", "a YAML (.yaml, .yml) or TOML (.toml) file with option values, keyed by option name. Flags take precedence over environment variables, which take precedence over the file.")
+	return fs, o
+}
+
+// parseServeFlags parses the arguments of a command with the serve options, and loads the options.
+// Exits on invalid flags, with status 0 for -help.
+func parseServeFlags(name string, args []string) *serveOptions {
+	fs, o := newServeFlags(name)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+	if err := o.load(fs); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	return o
+}
+
+// load applies the config file and the environment variables to the options that were not set by flags,
+// and parses the targets.
+func (o *serveOptions) load(fs *flag.FlagSet) error {
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	configPath := fs.Lookup(configFlag).Value.String()
+	if configPath == "" {
+		configPath = os.Getenv(envName(configFlag))
+	}
+	var file map[string]interface{}
+	if configPath != "" {
+		var err error
+		if file, err = LoadConfigFile(configPath); err != nil {
+			return fmt.Errorf("failed to load config: %v", err)
+		}
+	}
+	if err := ApplySettings(fs, file, os.LookupEnv); err != nil {
+		return err
+	}
+	for _, v := range o.targets {
+		t, err := worker.ParseTarget(v)
+		if err != nil {
+			return fmt.Errorf("invalid target: %v", err)
+		}
+		o.cfg.Targets = append(o.cfg.Targets, t)
+	}
+	return nil
+}
+
+// validate checks the options for unknown values and missing dependencies, without connecting to any service.
+// Local files that the options reference, like the signing key and the tenants file, are loaded.
+func (o *serveOptions) validate() error {
+	cfg := &o.cfg
+	if err := worker.ValidateAckPolicy(cfg.AckPolicy); err != nil {
+		return fmt.Errorf("invalid ack policy: %v", err)
+	}
+	for t := range cfg.TaskCliCmds {
+		if !worker.KnownTaskType(t) {
+			return fmt.Errorf("unknown task type of --task-cli-cmd: %s", t)
+		}
+	}
+	if cfg.ResultFormat != worker.ResultFormatJSON && cfg.ResultFormat != worker.ResultFormatProto {
+		return fmt.Errorf("unknown result format: %s", cfg.ResultFormat)
+	}
+	if cfg.ResultURLs != worker.ResultURLsPublic && cfg.ResultURLs != worker.ResultURLsSigned && cfg.ResultURLs != worker.ResultURLsPath {
+		return fmt.Errorf("unknown result URL mode: %s", cfg.ResultURLs)
+	}
+	if _, err := worker.ParseResultPathTemplate(cfg.ResultPathTemplate); err != nil {
+		return err
+	}
+	if cfg.ResultURLTTL <= 0 || cfg.ResultURLTTL > worker.MaxSignedURLTTL {
+		return fmt.Errorf("--result-url-ttl must be positive and at most %s", worker.MaxSignedURLTTL)
+	}
+	if cfg.BatchCliCmd != "" && cfg.BatchSize > 1 && cfg.Concurrency > 0 && cfg.Concurrency < cfg.BatchSize {
+		log.Printf("WARNING: batches of %d tasks cannot fill up with a concurrency of %d", cfg.BatchSize, cfg.Concurrency)
+	}
+	if err := worker.ValidateClientReport(cfg.ClientReport); err != nil {
+		return fmt.Errorf("invalid --client-report: %v", err)
+	}
+	if err := worker.ValidateUnsupportedAction(cfg.UnsupportedAction); err != nil {
+		return fmt.Errorf("invalid --unsupported-action: %v", err)
+	}
+	if cfg.UnsupportedAction == worker.UnsupportedForward && o.unclaimedTopicName == "" {
+		return fmt.Errorf("--unsupported-action=forward requires an --unclaimed-topic")
+	}
+	if err := cfg.PubsubReceive.Validate(); err != nil {
+		return fmt.Errorf("invalid Pub/Sub receive settings: %v", err)
+	}
+	if cfg.PubsubReceive.MaxOutstandingMessages > 0 && cfg.Concurrency > cfg.PubsubReceive.MaxOutstandingMessages {
+		log.Printf("WARNING: a concurrency of %d cannot be reached with at most %d outstanding Pub/Sub messages", cfg.Concurrency, cfg.PubsubReceive.MaxOutstandingMessages)
+	}
+	if cfg.RecoverMode != worker.RecoverReport && cfg.RecoverMode != worker.RecoverRerun {
+		return fmt.Errorf("unknown recover mode: %s", cfg.RecoverMode)
+	}
+	if cfg.OrphanMaxAge > 0 && cfg.WorkDir == "" {
+		return fmt.Errorf("--orphan-max-age requires a --work-dir, the system temp dir is shared with other programs")
+	}
+	switch o.execMode {
+	case "local":
+		if (o.maxMem > 0 || o.maxCPUSeconds > 0) && !worker.ResourceLimitsSupported {
+			return fmt.Errorf("--max-mem and --max-cpu-seconds are not supported on this platform")
+		}
+	case "docker":
+		if o.dockerImage == "" {
+			return fmt.Errorf("--exec=docker requires a --docker-image")
+		}
+	case "server":
+		if o.maxMem > 0 || o.maxCPUSeconds > 0 {
+			return fmt.Errorf("--max-mem and --max-cpu-seconds are not supported with --exec=server")
+		}
+	default:
+		return fmt.Errorf("unknown exec mode: %s", o.execMode)
+	}
+	switch o.runnerKind {
+	case "flags":
+	case "template":
+		if o.runnerTemplate == "" {
+			return fmt.Errorf("--runner=template requires a --runner-template")
+		}
+		if _, err := worker.NewTemplateBuilder(o.runnerTemplate, o.runnerEnv, o.runnerStdin); err != nil {
+			return fmt.Errorf("failed to parse runner templates: %v", err)
+		}
+	case "grpc":
+		if o.runnerAddr == "" {
+			return fmt.Errorf("--runner=grpc requires a --runner-addr")
+		}
+		if len(o.extraClients) > 0 {
+			return fmt.Errorf("--runner=grpc does not support extra clients")
+		}
+		if cfg.ReferenceCmd != "" {
+			return fmt.Errorf("--runner=grpc does not support a --reference-cmd")
+		}
+	default:
+		return fmt.Errorf("unknown runner: %s", o.runnerKind)
+	}
+	for name, v := range o.extraClients {
+		if _, err := worker.ParseExtraClient(name, v); err != nil {
+			return fmt.Errorf("invalid extra client: %v", err)
+		}
+	}
+	for name := range cfg.ClientEnv {
+		if !worker.ValidEnvName(name) {
+			return fmt.Errorf("invalid --client-env name %q", name)
+		}
+	}
+	if len(cfg.ClientEnv) > 0 && (o.execMode == "server" || o.runnerKind == "grpc") {
+		log.Printf("WARNING: --client-env is not applied with --exec=server or --runner=grpc")
+	}
+	if o.clientArtifact != "" {
+		a := &worker.ClientArtifact{Path: o.clientArtifact, SHA256: o.clientArtifactSHA256}
+		if err := a.Check(); err != nil {
+			return fmt.Errorf("invalid --client-artifact: %v", err)
+		}
+		if cfg.ArtifactDir == "" {
+			return fmt.Errorf("--client-artifact requires an --artifact-dir")
+		}
+		if o.execMode == "docker" || o.runnerKind == "grpc" {
+			return fmt.Errorf("--client-artifact is not supported with --exec=docker or --runner=grpc")
+		}
+		cfg.ClientArtifact = a
+	} else if o.clientArtifactSHA256 != "" {
+		return fmt.Errorf("--client-artifact-sha256 requires a --client-artifact")
+	}
+	switch o.storageKind {
+	case "gcs", "fs", "s3":
+	case "azure":
+		if o.azureConnectionString != "" {
+			if _, err := worker.ParseAzureConnectionString(o.azureConnectionString); err != nil {
+				return fmt.Errorf("invalid Azure connection string: %v", err)
+			}
+		} else if o.azureAccountName == "" {
+			return fmt.Errorf("--storage=azure requires --azure-connection-string or --azure-account")
+		}
+	default:
+		return fmt.Errorf("unknown storage backend: %s", o.storageKind)
+	}
+	if cfg.ResultURLs == worker.ResultURLsSigned {
+		if o.storageKind != "gcs" {
+			return fmt.Errorf("result-urls=signed requires storage=gcs")
+		}
+		if o.resultURLCredentials == "" {
+			return fmt.Errorf("result-urls=signed requires --result-url-credentials")
+		}
+		if _, err := worker.LoadGCSURLSigner(o.resultURLCredentials); err != nil {
+			return fmt.Errorf("failed to load result URL signing credentials: %v", err)
+		}
+	}
+	if o.tenantsPath != "" {
+		tenants, err := worker.LoadTenants(o.tenantsPath)
+		if err != nil {
+			return fmt.Errorf("failed to load tenants: %v", err)
+		}
+		if _, ok := tenants[cfg.ClientName]; !ok {
+			return fmt.Errorf("no tenant configured for client %s", cfg.ClientName)
+		}
+	}
+	switch o.queueKind {
+	case "pubsub", "sqs", "nats", "dir":
+	case "http":
+		if o.taskEndpoint == "" {
+			return fmt.Errorf("--queue=http requires a --task-endpoint")
+		}
+	default:
+		return fmt.Errorf("unknown queue backend: %s", o.queueKind)
+	}
+	if o.signingKeyPath != "" {
+		if _, err := worker.LoadSigningKey(o.signingKeyPath); err != nil {
+			return fmt.Errorf("failed to load signing key: %v", err)
+		}
+	}
+	if o.adminAddr != "" && o.adminToken == "" {
+		return fmt.Errorf("admin API requires --admin-token")
+	}
+	if o.prioritySubSuffix != "" && o.cfg.Concurrency <= 0 {
+		return fmt.Errorf("--priority-sub-suffix requires a --concurrency limit, to start urgent tasks first")
+	}
+	if o.updateBucket != "" || o.updateURL != "" {
+		if o.updateBucket != "" && o.updateURL != "" {
+			return fmt.Errorf("--update-bucket and --update-url are exclusive")
+		}
+		if pubKey, err := hex.DecodeString(o.updatePubKeyHex); err != nil || len(pubKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("self-update requires a valid hex-encoded ed25519 --update-pubkey")
+		}
+		if o.updateInterval <= 0 {
+			return fmt.Errorf("--update-interval must be positive")
+		}
+	}
+	if o.controlSubId != "" {
+		if pubKey, err := hex.DecodeString(o.controlPubKeyHex); err != nil || len(pubKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("control subscription requires a valid hex-encoded ed25519 --control-pubkey")
+		}
+	}
+	return nil
+}
+
+// serve connects the worker to the services of the options, and processes tasks until interrupted.
+func (o *serveOptions) serve() {
+	cfg := o.cfg
+	if cfg.WorkDir != "" {
+		if err := os.MkdirAll(cfg.WorkDir, os.ModePerm); err != nil {
+			log.Fatalf("failed to create work dir: %v", err)
+		}
+	}
+	if cfg.ResultSpool != "" {
+		if err := os.MkdirAll(cfg.ResultSpool, os.ModePerm); err != nil {
+			log.Fatalf("failed to create result spool: %v", err)
+		}
+	}
+	if cfg.ArtifactDir != "" {
+		if err := os.MkdirAll(cfg.ArtifactDir, os.ModePerm); err != nil {
+			log.Fatalf("failed to create artifact dir: %v", err)
+		}
+	}
+
+	mainContext, cancel := context.WithCancel(context.Background())
+
+	w := &worker.Worker{Config: cfg, Runner: worker.ExecRunner{}}
+	if o.signingKeyPath != "" {
+		key, err := worker.LoadSigningKey(o.signingKeyPath)
+		if err != nil {
+			log.Fatalf("failed to load signing key: %v", err)
+		}
+		w.SigningKey = key
+	}
+	switch o.execMode {
+	case "local":
+		w.Runner = worker.ExecRunner{MaxMem: o.maxMem, MaxCPU: time.Duration(o.maxCPUSeconds) * time.Second}
+	case "docker":
+		w.Runner = &worker.DockerRunner{Docker: o.dockerCmd, Image: o.dockerImage, CPUs: o.dockerCPUs, Memory: o.dockerMemory}
+	case "server":
+		w.Runner = &worker.ServerRunner{Fallback: worker.ExecRunner{}}
+	}
+	switch o.runnerKind {
+	case "template":
+		b, err := worker.NewTemplateBuilder(o.runnerTemplate, o.runnerEnv, o.runnerStdin)
+		if err != nil {
+			log.Fatalf("Failed to parse runner templates: %v", err)
+		}
+		w.Builder = b
+	case "grpc":
+		w.Runner = &worker.GRPCRunner{Addr: o.runnerAddr, Fallback: w.Runner}
+	}
+	if o.exportFile != "" {
+		w.Exporter = worker.NewResultExporter(o.exportFile)
+	}
+	if o.hashTreeRoot {
+		for _, t := range cfg.AllTargets() {
+			if err := worker.CheckSSZSupport(t.SpecVersion, t.SpecConfig); err != nil {
+				log.Printf("WARNING: cannot compute hash-tree-roots of %s states: %v", t, err)
+			}
+		}
+		w.TreeHasher = worker.SSZTreeHasher
+	}
+	if cfg.ValidateInputs {
+		for _, t := range cfg.AllTargets() {
+			if err := worker.CheckSSZSupport(t.SpecVersion, t.SpecConfig); err != nil {
+				log.Printf("WARNING: cannot validate inputs of %s tasks: %v", t, err)
+			}
+		}
+	}
+
+	// storage
+	{
+		var storageClient *storage.Client
+		var storageOpts []option.ClientOption
+		var openBucket func(bucketName string) worker.BlobStore
+		var urlSigner *worker.GCSURLSigner
+		if cfg.ResultURLs == worker.ResultURLsSigned {
+			var err error
+			if urlSigner, err = worker.LoadGCSURLSigner(o.resultURLCredentials); err != nil {
+				log.Fatalf("Failed to load result URL signing credentials: %v", err)
+			}
+		}
+		switch o.storageKind {
+		case "gcs":
+			if o.storageEndpoint != "" {
+				log.Printf("using GCS emulator at %s", o.storageEndpoint)
+				storageOpts = worker.GCSEmulatorOptions(o.storageEndpoint)
+			}
+			var err error
+			storageClient, err = storage.NewClient(mainContext, storageOpts...)
+			if err != nil {
+				log.Fatalf("Failed to create storage client: %v", err)
+			}
+			openBucket = func(bucketName string) worker.BlobStore {
+				return worker.NewGCSStore(storageClient, bucketName, urlSigner)
+			}
+		case "fs":
+			openBucket = func(bucketName string) worker.BlobStore {
+				return worker.NewDirStore(filepath.Join(o.fsRoot, bucketName))
+			}
+		case "s3":
+			awsConfig := aws.NewConfig().WithRegion(o.awsRegion)
+			if o.s3Endpoint != "" {
+				awsConfig = awsConfig.WithEndpoint(o.s3Endpoint).WithS3ForcePathStyle(true)
+			}
+			sess, err := session.NewSession(awsConfig)
+			if err != nil {
+				log.Fatalf("Failed to create AWS session: %v", err)
+			}
+			s3Client := s3.New(sess)
+			openBucket = func(bucketName string) worker.BlobStore {
+				return worker.NewS3Store(s3Client, bucketName, o.s3Endpoint)
+			}
+		case "azure":
+			var account *worker.AzureAccount
+			if o.azureConnectionString != "" {
+				var err error
+				if account, err = worker.ParseAzureConnectionString(o.azureConnectionString); err != nil {
+					log.Fatalf("Invalid Azure connection string: %v", err)
+				}
+			} else {
+				account = worker.NewAzureManagedIdentityAccount(o.azureAccountName, o.azureIdentityClientID)
+			}
+			openBucket = func(bucketName string) worker.BlobStore {
+				return worker.NewAzureStore(account, bucketName)
+			}
+		}
+		w.Inputs = openBucket(cfg.InputsBucket)
+		w.Results = openBucket(cfg.ResultsBucket)
+		w.OpenStore = openBucket
+		if len(o.inputsFallbackBuckets) > 0 {
+			w.OpenInputs = func(bucketName string) worker.BlobStore {
+				s := worker.NewFailoverStore(openBucket(bucketName), bucketName, o.inputsFailoverAfter)
+				for _, fallback := range o.inputsFallbackBuckets {
+					s.AddFallback(openBucket(fallback), fallback)
+				}
+				return s
+			}
+			w.Inputs = w.OpenInputs(cfg.InputsBucket)
+		}
+		if o.tenantsPath != "" {
+			tenants, err := worker.LoadTenants(o.tenantsPath)
+			if err != nil {
+				log.Fatalf("Failed to load tenants: %v", err)
+			}
+			tenant, ok := tenants[cfg.ClientName]
+			if !ok {
+				log.Fatalf("No tenant configured for client %s", cfg.ClientName)
+			}
+			openTenantBucket := openBucket
+			if storageClient != nil {
+				opts := storageOpts
+				if tenant.CredentialsFile != "" && o.storageEndpoint == "" {
+					opts = append(opts, option.WithCredentialsFile(tenant.CredentialsFile))
+				}
+				resultsClient, err := storage.NewClient(mainContext, opts...)
+				if err != nil {
+					log.Fatalf("Failed to create results storage client for tenant %s: %v", cfg.ClientName, err)
+				}
+				openTenantBucket = func(bucketName string) worker.BlobStore {
+					return worker.NewGCSStore(resultsClient, bucketName, urlSigner)
+				}
+			}
+			w.OpenResults = func(bucketName string) worker.BlobStore {
+				return worker.NewClientStore(openTenantBucket(bucketName), cfg.ClientName, w.ResultPaths())
+			}
+			w.ResultsBucket = tenant.ResultsBucket
+			w.Results = w.OpenResults(tenant.ResultsBucket)
+		}
+		if o.mirrorResultsBucket != "" {
+			if w.OpenResults != nil {
+				w.MirrorStore = w.OpenResults(o.mirrorResultsBucket)
+			} else {
+				w.MirrorStore = openBucket(o.mirrorResultsBucket)
+			}
+		}
+		if o.dynamicConfigLocation != "" {
+			src, err := worker.NewConfigSource(o.dynamicConfigLocation, storageClient)
+			if err != nil {
+				log.Fatalf("Invalid dynamic config location: %v", err)
+			}
+			if err := w.LoadDynamicConfig(src); err != nil {
+				log.Fatalf("Failed to load dynamic config: %v", err)
+			}
+			go w.RefreshDynamicConfig(mainContext, src, o.dynamicConfigInterval)
+		}
+	}
+
+	// Setup the queue backend
+	var backend worker.QueueBackend
+	var pubsubClient *pubsub.Client
+	switch o.queueKind {
+	case "pubsub":
+		if o.pubsubEndpoint != "" {
+			log.Printf("using Pub/Sub emulator at %s", o.pubsubEndpoint)
+			worker.UsePubsubEmulator(o.pubsubEndpoint)
+		}
+		var err error
+		pubsubClient, err = pubsub.NewClient(mainContext, cfg.GCPProjectID)
+		if err != nil {
+			log.Fatalf("Failed to create pubsub client: %v", err)
+		}
+		backend = worker.NewPubsubBackend(pubsubClient, cfg.Concurrency, cfg.PubsubReceive)
+	case "sqs":
+		sess, err := session.NewSession(aws.NewConfig().WithRegion(o.awsRegion))
+		if err != nil {
+			log.Fatalf("Failed to create AWS session: %v", err)
+		}
+		backend = worker.NewSQSBackend(sqs.New(sess), cfg.Concurrency)
+	case "nats":
+		natsBackend, err := worker.NewNATSBackend(o.natsURL, cfg.Concurrency)
+		if err != nil {
+			log.Fatalf("Failed to setup NATS: %v", err)
+		}
+		backend = natsBackend
+	case "dir":
+		backend = worker.NewDirBackend(o.watchDir, cfg.Concurrency)
+	case "http":
+		backend = worker.NewHTTPBackend(o.taskEndpoint, o.taskEndpointToken, o.taskPollInterval, cfg.Concurrency)
+	}
+	report := &worker.DryRunReport{}
+	openTopic := func(name string) worker.Publisher {
+		if o.dryRun && pubsubClient != nil {
+			report.Check("topic "+name, "", worker.CheckPubsubTopic(pubsubClient, name))
+		}
+		p, err := backend.Topic(name)
+		if err != nil {
+			log.Fatalf("Failed to open topic %s: %v", name, err)
+		}
+		return p
+	}
+
+	resultsTopicName := fmt.Sprintf("results~%s", cfg.ClientName)
+
+	if o.capabilitiesTopicName != "" && o.dryRun {
+		openTopic(o.capabilitiesTopicName)
+	} else if o.capabilitiesTopicName != "" {
+		if err := w.DeclareCapabilities(openTopic(o.capabilitiesTopicName)); err != nil {
+			log.Fatalf("Failed to declare capabilities to topic %s: %v", o.capabilitiesTopicName, err)
+		}
+	}
+
+	if o.statusTopicName != "" {
+		w.StatusTopic = openTopic(o.statusTopicName)
+	}
+
+	if o.heartbeatTopicName != "" {
+		w.HeartbeatTopic = openTopic(o.heartbeatTopicName)
+	}
+
+	if o.mirrorResultsTopic != "" {
+		w.MirrorTopic = openTopic(o.mirrorResultsTopic)
+	}
+
+	if o.quarantineTopicName != "" {
+		w.QuarantineTopic = openTopic(o.quarantineTopicName)
+	}
+
+	if o.unclaimedTopicName != "" {
+		w.UnclaimedTopic = openTopic(o.unclaimedTopicName)
+	}
+
+	if o.divergenceTopicName != "" {
+		w.DivergenceTopic = openTopic(o.divergenceTopicName)
+	}
+
+	var extraNames []string
+	for name := range o.extraClients {
+		extraNames = append(extraNames, name)
+	}
+	sort.Strings(extraNames)
+	for _, name := range extraNames {
+		c, err := worker.ParseExtraClient(name, o.extraClients[name])
+		if err != nil {
+			log.Fatalf("invalid extra client: %v", err)
+		}
+		c.Results = openTopic(fmt.Sprintf("results~%s", c.Name))
+		w.ExtraClients = append(w.ExtraClients, c)
+	}
+
+	var queues worker.MultiQueue
+	for _, t := range cfg.AllTargets() {
+		subId := fmt.Sprintf("%s~%s~%s~%s", t.SpecVersion, t.SpecConfig, cfg.ClientName, cfg.WorkerID)
+		urgentSubId := subId + "~" + o.prioritySubSuffix
+		q, err := backend.TaskQueue(subId, resultsTopicName)
+		if o.dryRun {
+			report.Check("task queue "+subId, "results to "+resultsTopicName, err)
+			if o.prioritySubSuffix != "" {
+				_, err := backend.TaskQueue(urgentSubId, "")
+				report.Check("priority task queue "+urgentSubId, "", err)
+			}
+			continue
+		}
+		if err != nil {
+			log.Fatalf("Failed to open task queue: %v", err)
+		}
+		queues = append(queues, q)
+		if o.prioritySubSuffix != "" {
+			// the results of urgent tasks are published through the first queue
+			uq, err := backend.TaskQueue(urgentSubId, "")
+			if err != nil {
+				log.Fatalf("Failed to open priority task queue: %v", err)
+			}
+			queues = append(queues, worker.PriorityQueue{TaskQueue: uq})
+		}
+	}
+	if o.dryRun {
+		for _, subId := range []string{o.controlSubId, o.resultsFeedSubId} {
+			if subId != "" {
+				_, err := backend.TaskQueue(subId, "")
+				report.Check("subscription "+subId, "", err)
+			}
+		}
+		w.DryRun(report)
+		cancel()
+		if !report.Print(os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+	if len(queues) == 1 {
+		w.Queue = queues[0]
+	} else {
+		w.Queue = queues
+	}
+	if err := w.CheckSigning(); err != nil {
+		log.Fatalf("cannot sign results: %v", err)
+	}
+
+	go func() {
+		c := make(chan os.Signal, 1)
+		// Catch SIGINT (Ctrl+C) and shutdown gracefully
+		signal.Notify(c, os.Interrupt)
+		<-c
+		log.Println("shutting down")
+		cancel()
+	}()
+
+	if err := w.Preflight(); err != nil {
+		log.Fatalf("client CLI preflight check failed: %v", err)
+	}
+
+	if cfg.SelfTestDir != "" {
+		if err := w.SelfTest(cfg.SelfTestDir); err != nil {
+			log.Fatalf("self-test with golden vector %s failed, refusing to consume tasks: %v", cfg.SelfTestDir, err)
+		}
+		log.Println("self-test passed")
+	}
+
+	if o.httpAddr != "" {
+		w.PublishDiskMetrics()
+		go func() {
+			if err := http.ListenAndServe(o.httpAddr, w.HTTPHandler()); err != nil {
+				log.Fatalf("failed to serve http: %v", err)
+			}
+		}()
+	}
+
+	if o.adminAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(o.adminAddr, w.AdminHandler(o.adminToken)); err != nil {
+				log.Fatalf("failed to serve admin API: %v", err)
+			}
+		}()
+	}
+
+	if o.controlSubId != "" {
+		pubKey, err := hex.DecodeString(o.controlPubKeyHex)
+		if err != nil || len(pubKey) != ed25519.PublicKeySize {
+			log.Fatalf("control subscription requires a valid hex-encoded ed25519 --control-pubkey")
+		}
+		controlQueue, err := backend.TaskQueue(o.controlSubId, "")
+		if err != nil {
+			log.Fatalf("Failed to open control queue: %v", err)
+		}
+		go func() {
+			if err := w.RunControl(mainContext, controlQueue, pubKey); err != nil {
+				log.Fatalf("failed to receive control messages: %v", err)
+			}
+		}()
+	}
+
+	if o.resultsFeedSubId != "" {
+		feedQueue, err := backend.TaskQueue(o.resultsFeedSubId, "")
+		if err != nil {
+			log.Fatalf("Failed to open results feed: %v", err)
+		}
+		go func() {
+			if err := w.RunResultsFeed(mainContext, feedQueue); err != nil {
+				log.Printf("failed to receive results feed: %v", err)
+			}
+		}()
+	}
+
+	if cfg.CanaryKey != "" {
+		go w.RunCanary(mainContext)
+	}
+
+	if cfg.JournalDir != "" {
+		if err := w.RecoverInterrupted(mainContext); err != nil {
+			log.Fatalf("failed to recover interrupted tasks: %v", err)
+		}
+	}
+
+	if o.updateBucket != "" || o.updateURL != "" {
+		exe, err := os.Executable()
+		if err == nil {
+			exe, err = filepath.EvalSymlinks(exe)
+		}
+		if err != nil {
+			log.Fatalf("self-update cannot find the worker binary: %v", err)
+		}
+		pubKey, _ := hex.DecodeString(o.updatePubKeyHex)
+		u := &worker.SelfUpdate{
+			PubKey:       pubKey,
+			Version:      version,
+			Executable:   exe,
+			Interval:     o.updateInterval,
+			DrainTimeout: o.updateDrainTimeout,
+		}
+		if o.updateBucket != "" {
+			u.Source = w.OpenStore(o.updateBucket)
+		} else {
+			u.Source = &worker.HTTPReleaseSource{BaseURL: o.updateURL, Client: &http.Client{Timeout: 10 * time.Minute}}
+		}
+		go func() {
+			if !w.RunSelfUpdate(mainContext, u) {
+				return
+			}
+			closeRunner(w.Runner)
+			log.Println("restarting with the new worker release")
+			if err := worker.RestartProcess(exe); err != nil {
+				log.Fatalf("failed to restart after self-update: %v", err)
+			}
+		}()
+	}
+
+	// try receiving messages
+	if err := w.Run(mainContext); err != nil {
+		log.Fatalf("failed to receive messages: %v", err)
+	}
+	closeRunner(w.Runner)
+	os.Exit(0)
+}
+
+// closeRunner stops the client processes that a runner keeps running.
+func closeRunner(runner worker.CommandRunner) {
+	switch r := runner.(type) {
+	case *worker.ServerRunner:
+		r.Close()
+	case *worker.GRPCRunner:
+		r.Close()
+	}
+}
+
+func serveMain(args []string) {
+	o := parseServeFlags("serve", args)
+	if err := o.validate(); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	o.serve()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func parseTestServeOptions(t *testing.T, args ...string) *serveOptions {
+	fs, o := newServeFlags("serve")
+	fs.SetOutput(ioutil.Discard)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.load(fs); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestServeOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muskoka-serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "worker.yaml")
+	if err := ioutil.WriteFile(configPath, []byte("client-name: lighthouse\nqueue: dir\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := parseTestServeOptions(t, "--config", configPath, "--queue=sqs", "--target", "v0.9.1/mainnet", "--exec", "docker", "--docker-image", "lighthouse:latest")
+	if o.cfg.ClientName != "lighthouse" {
+		t.Errorf("expected the client name of the config file, got %s", o.cfg.ClientName)
+	}
+	if o.queueKind != "sqs" {
+		t.Errorf("expected the flag to take precedence over the config file, got queue %s", o.queueKind)
+	}
+	if len(o.cfg.Targets) != 1 || o.cfg.Targets[0].String() != "v0.9.1/mainnet" {
+		t.Errorf("unexpected targets: %v", o.cfg.Targets)
+	}
+	if err := o.validate(); err != nil {
+		t.Errorf("expected valid options: %v", err)
+	}
+
+	fs, o := newServeFlags("serve")
+	fs.SetOutput(ioutil.Discard)
+	if err := fs.Parse([]string{"--no-such-option"}); err == nil {
+		t.Error("expected unknown options to fail")
+	}
+	if err := fs.Parse([]string{"extra"}); err != nil || o.load(fs) == nil {
+		t.Error("expected positional arguments to fail")
+	}
+}
+
+func TestValidateServeOptions(t *testing.T) {
+	if err := parseTestServeOptions(t).validate(); err != nil {
+		t.Fatalf("expected the defaults to be valid: %v", err)
+	}
+	invalid := map[string][]string{
+		"unknown exec mode":              {"--exec=vm"},
+		"requires a --docker-image":      {"--exec=docker"},
+		"requires a --runner-template":   {"--runner=template"},
+		"does not support extra clients": {"--runner=grpc", "--runner-addr=localhost:4000", "--extra-client", "zrnt=v0.1.0:zcli transition blocks"},
+		"unknown storage backend":        {"--storage=ftp"},
+		"requires storage=gcs":           {"--storage=s3", "--result-urls=signed"},
+		"requires a --task-endpoint":     {"--queue=http"},
+		"requires --admin-token":         {"--admin-addr=:8081"},
+		"--control-pubkey":               {"--control-sub=control", "--control-pubkey=00"},
+		"requires an --unclaimed-topic":  {"--unsupported-action=forward"},
+		"failed to load signing key":     {"--signing-key=/no/such/key"},
+	}
+	for expected, args := range invalid {
+		err := parseTestServeOptions(t, args...).validate()
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("options %v: expected error with %q, got %v", args, expected, err)
+		}
+	}
+}
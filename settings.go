@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// envPrefix is the prefix of the environment variables that set options,
+// e.g. MUSKOKA_INPUTS_BUCKET for --inputs-bucket.
+const envPrefix = "MUSKOKA_"
+
+// configFlag is the flag (and environment variable) that selects the config file.
+const configFlag = "config"
+
+// envName returns the environment variable that sets the option with the given flag name.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// isMapFlag returns true for flags of key=value entries, which are set once per entry.
+func isMapFlag(f *flag.Flag) bool {
+	switch f.Value.(type) {
+	case *stringMap, *intMap:
+		return true
+	default:
+		return false
+	}
+}
+
+// LoadConfigFile reads the option values from a YAML (.yaml, .yml) or TOML (.toml) file, keyed by flag name.
+func LoadConfigFile(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	out := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &out)
+	case ".toml":
+		err = toml.Unmarshal(data, &out)
+	default:
+		return nil, fmt.Errorf("unrecognized config file extension, expected .yaml, .yml or .toml: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode config file: %v", err)
+	}
+	return out, nil
+}
+
+// ApplySettings sets the options that were not set as flags on the command line:
+// first from environment variables, then from the config file values (which may be nil).
+// Entries of map options in environment variables are separated by ';'.
+func ApplySettings(fs *flag.FlagSet, file map[string]interface{}, lookupEnv func(string) (string, bool)) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] || f.Name == configFlag {
+			return
+		}
+		v, ok := lookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		set[f.Name] = true
+		values := []string{v}
+		if isMapFlag(f) {
+			values = strings.Split(v, ";")
+		}
+		for _, v := range values {
+			if v = strings.TrimSpace(v); v == "" && isMapFlag(f) {
+				continue
+			}
+			if err = f.Value.Set(v); err != nil {
+				err = fmt.Errorf("invalid value for %s: %v", envName(f.Name), err)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(file))
+	for k := range file {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f := fs.Lookup(k)
+		if f == nil || k == configFlag {
+			return fmt.Errorf("unknown option in config file: %s", k)
+		}
+		if set[k] {
+			continue
+		}
+		values, err := settingValues(f, file[k])
+		if err != nil {
+			return fmt.Errorf("invalid value for %s in config file: %v", k, err)
+		}
+		for _, v := range values {
+			if err := f.Value.Set(v); err != nil {
+				return fmt.Errorf("invalid value for %s in config file: %v", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// settingValues converts a config file value to the flag values to set.
+// Lists are comma-separated, maps are set as one key=value entry at a time.
+func settingValues(f *flag.Flag, v interface{}) ([]string, error) {
+	switch x := v.(type) {
+	case []interface{}:
+		items := make([]string, 0, len(x))
+		for _, item := range x {
+			items = append(items, fmt.Sprint(item))
+		}
+		return []string{strings.Join(items, ",")}, nil
+	case map[string]interface{}, map[interface{}]interface{}:
+		if !isMapFlag(f) {
+			return nil, fmt.Errorf("expected a single value, got a map")
+		}
+		var entries []string
+		if m, ok := x.(map[string]interface{}); ok {
+			for k, e := range m {
+				entries = append(entries, fmt.Sprintf("%s=%v", k, e))
+			}
+		} else {
+			for k, e := range x.(map[interface{}]interface{}) {
+				entries = append(entries, fmt.Sprintf("%v=%v", k, e))
+			}
+		}
+		sort.Strings(entries)
+		return entries, nil
+	default:
+		if isMapFlag(f) {
+			return nil, fmt.Errorf("expected a map of entries")
+		}
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"github.com/protolambda/muskoka-worker/worker"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApplySettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muskoka-settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		name string
+		data string
+	}{
+		{"worker.yaml", "inputs-bucket: file-inputs\ncli-cmd: file-cli\nspec-config: [minimal, mainnet]\nconcurrency: 4\nlive-log-after: 1m\nconfig-cli-args:\n  mainnet: --preset mainnet\n"},
+		{"worker.toml", "inputs-bucket = \"file-inputs\"\ncli-cmd = \"file-cli\"\nspec-config = [\"minimal\", \"mainnet\"]\nconcurrency = 4\nlive-log-after = \"1m\"\n[config-cli-args]\nmainnet = \"--preset mainnet\"\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := filepath.Join(dir, tc.name)
+			if err := ioutil.WriteFile(p, []byte(tc.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			file, err := LoadConfigFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var cfg worker.Config
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.StringVar(&cfg.InputsBucket, "inputs-bucket", "default-inputs", "")
+			fs.StringVar(&cfg.CliCmd, "cli-cmd", "default-cli", "")
+			fs.StringVar(&cfg.ClientName, "client-name", "default-client", "")
+			fs.Var((*stringList)(&cfg.SpecConfigs), "spec-config", "")
+			fs.Var((*stringMap)(&cfg.ConfigCliArgs), "config-cli-args", "")
+			fs.IntVar(&cfg.Concurrency, "concurrency", 0, "")
+			fs.DurationVar(&cfg.LiveLogAfter, "live-log-after", 0, "")
+			if err := fs.Parse([]string{"--inputs-bucket=flag-inputs"}); err != nil {
+				t.Fatal(err)
+			}
+			env := map[string]string{"MUSKOKA_CLI_CMD": "env-cli", "MUSKOKA_CLIENT_NAME": "env-client"}
+			lookupEnv := func(k string) (string, bool) {
+				v, ok := env[k]
+				return v, ok
+			}
+			if err := ApplySettings(fs, file, lookupEnv); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.InputsBucket != "flag-inputs" || cfg.CliCmd != "env-cli" || cfg.ClientName != "env-client" {
+				t.Errorf("unexpected precedence: %+v", cfg)
+			}
+			if len(cfg.SpecConfigs) != 2 || cfg.SpecConfigs[1] != "mainnet" || cfg.Concurrency != 4 ||
+				cfg.LiveLogAfter != time.Minute || cfg.ConfigCliArgs["mainnet"] != "--preset mainnet" {
+				t.Errorf("unexpected file settings: %+v", cfg)
+			}
+
+			file["unknown-option"] = "x"
+			if err := ApplySettings(fs, file, lookupEnv); err == nil {
+				t.Error("expected unknown option to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Error classes of failed tasks, to choose the ack action for.
+const (
+	// the task message could not be decoded
+	ErrorClassMalformed = "malformed"
+	// downloading inputs, uploading results or publishing the result failed
+	ErrorClassInfra = "infra"
+	// the client failed to run the transition
+	ErrorClassClient = "client"
+)
+
+// Ack actions for failed tasks.
+const (
+	ActionAck  = "ack"
+	ActionNack = "nack"
+	// nack after a delay that doubles with every failure of the same task
+	ActionNackBackoff = "nack-backoff"
+	// publish the message to the quarantine topic, and ack it
+	ActionQuarantine = "quarantine"
+	// publish the failure as result, and ack. Only for client and infra failures:
+	// failed downloads and uploads are published with the input-error and upload-failed statuses.
+	// Other infra failures, like failing to publish the result, are still nacked.
+	ActionResult = "result"
+)
+
+var defaultAckPolicy = map[string]string{
+	ErrorClassMalformed: ActionNack,
+	ErrorClassInfra:     ActionNack,
+	ErrorClassClient:    ActionResult,
+}
+
+const (
+	nackBackoffMin = time.Second * 10
+	nackBackoffMax = time.Minute * 10
+)
+
+// taskError is a task failure of a known error class.
+type taskError struct {
+	class string
+	err   error
+}
+
+func (e *taskError) Error() string {
+	return fmt.Sprintf("%s error: %v", e.class, e.err)
+}
+
+// ValidateAckPolicy checks if all error classes and actions in the policy are known.
+func ValidateAckPolicy(policy map[string]string) error {
+	for class, action := range policy {
+		if _, ok := defaultAckPolicy[class]; !ok {
+			return fmt.Errorf("unknown error class %q", class)
+		}
+		switch action {
+		case ActionAck, ActionNack, ActionNackBackoff, ActionQuarantine:
+		case ActionResult:
+			if class != ErrorClassClient && class != ErrorClassInfra {
+				return fmt.Errorf("action %q is only supported for %s and %s errors", action, ErrorClassClient, ErrorClassInfra)
+			}
+		default:
+			return fmt.Errorf("unknown action %q for error class %s", action, class)
+		}
+	}
+	return nil
+}
+
+// ackAction returns the configured action for the error class.
+func (w *Worker) ackAction(class string) string {
+	if action, ok := w.AckPolicy[class]; ok {
+		return action
+	}
+	return defaultAckPolicy[class]
+}
+
+// QuarantineMsg wraps a task message that was quarantined, with the reason.
+type QuarantineMsg struct {
+	Class    string `json:"class"`
+	Error    string `json:"error"`
+	WorkerID string `json:"worker-id"`
+	// the original message data
+	Data []byte `json:"data"`
+}
+
+// handleFailure acks or nacks the message of a failed task, as configured for the error class.
+// Errors without a class are nacked. So are errors of a class with the result action:
+// those failures are published as result instead of returned, an error means no result was published.
+func (w *Worker) handleFailure(ctx context.Context, message *QueueMessage, key string, err error) {
+	class := ""
+	if te, ok := err.(*taskError); ok {
+		class = te.class
+	}
+	action := ActionNack
+	if class != "" {
+		action = w.ackAction(class)
+	}
+	log.Printf("task %s failed: %v. Action: %s", key, err, action)
+	switch action {
+	case ActionAck:
+		message.Ack()
+	case ActionNackBackoff:
+		delay := w.failureBackoff(key)
+		log.Printf("delaying nack of %s by %s", key, delay)
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		w.nack(message)
+	case ActionQuarantine:
+		if err := w.quarantine(message, class, err); err != nil {
+			log.Printf("failed to quarantine task %s, nack instead: %v", key, err)
+			w.nack(message)
+			return
+		}
+		message.Ack()
+	default:
+		w.nack(message)
+	}
+}
+
+// failureBackoff counts a failure of the task, and returns how long to wait before nacking it.
+func (w *Worker) failureBackoff(key string) time.Duration {
+	w.tasksMu.Lock()
+	defer w.tasksMu.Unlock()
+	if w.failures == nil {
+		w.failures = make(map[string]int)
+	}
+	w.failures[key]++
+	delay := nackBackoffMin
+	for i := 1; i < w.failures[key] && delay < nackBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > nackBackoffMax {
+		delay = nackBackoffMax
+	}
+	return delay
+}
+
+// resetFailures forgets the failures of a task, after it succeeded.
+func (w *Worker) resetFailures(key string) {
+	w.tasksMu.Lock()
+	defer w.tasksMu.Unlock()
+	delete(w.failures, key)
+}
+
+func (w *Worker) quarantine(message *QueueMessage, class string, cause error) error {
+	if w.QuarantineTopic == nil {
+		return fmt.Errorf("no quarantine topic configured")
+	}
+	data, err := json.Marshal(&QuarantineMsg{Class: class, Error: cause.Error(), WorkerID: w.WorkerID, Data: message.Data})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return w.QuarantineTopic.Publish(ctx, data)
+}
@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAckPolicy(t *testing.T) {
+	h := newHarness(t, " --fail", ExecRunner{})
+	defer h.Close()
+	quarantine := NewMemQueue(1)
+	h.worker.QuarantineTopic = quarantine
+	h.worker.AckPolicy = map[string]string{ErrorClassMalformed: ActionQuarantine, ErrorClassClient: ActionNack}
+	h.start()
+
+	if !h.queue.Push([]byte("not json")).Wait() {
+		t.Fatal("expected quarantined message to be acked")
+	}
+	published := quarantine.Published()
+	if len(published) != 1 {
+		t.Fatalf("expected 1 quarantined message, got %d", len(published))
+	}
+	var msg QuarantineMsg
+	if err := json.Unmarshal(published[0], &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Class != ErrorClassMalformed || string(msg.Data) != "not json" {
+		t.Errorf("unexpected quarantine message: %+v", msg)
+	}
+
+	if h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected client failure to be nacked")
+	}
+	if len(h.queue.Published()) != 0 {
+		t.Error("expected no result for nacked client failure")
+	}
+}
+
+func TestValidateAckPolicy(t *testing.T) {
+	if err := ValidateAckPolicy(map[string]string{ErrorClassInfra: ActionNackBackoff, ErrorClassClient: ActionResult}); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateAckPolicy(map[string]string{ErrorClassInfra: ActionResult}); err != nil {
+		t.Errorf("expected result action to be accepted for infra errors: %v", err)
+	}
+	if err := ValidateAckPolicy(map[string]string{ErrorClassMalformed: ActionResult}); err == nil {
+		t.Error("expected result action to be refused for malformed messages")
+	}
+	if err := ValidateAckPolicy(map[string]string{"other": ActionAck}); err == nil {
+		t.Error("expected unknown error class to be refused")
+	}
+}
@@ -0,0 +1,121 @@
+package worker
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Pause stops receiving new tasks, until Resume. In-flight tasks continue.
+func (w *Worker) Pause() {
+	w.pauseMu.Lock()
+	defer w.pauseMu.Unlock()
+	if w.paused {
+		return
+	}
+	log.Println("pausing: not receiving new tasks until resumed")
+	w.paused = true
+	w.pausedSince = w.now()
+	w.resumed = make(chan struct{})
+	if w.stopReceive != nil {
+		w.stopReceive()
+	}
+}
+
+// Resume continues receiving tasks after Pause.
+func (w *Worker) Resume() {
+	w.pauseMu.Lock()
+	defer w.pauseMu.Unlock()
+	if !w.paused {
+		return
+	}
+	log.Println("resuming: receiving new tasks")
+	w.paused = false
+	close(w.resumed)
+}
+
+// PauseStatus returns if the worker is paused, and since when.
+func (w *Worker) PauseStatus() (bool, time.Time) {
+	w.pauseMu.Lock()
+	defer w.pauseMu.Unlock()
+	return w.paused, w.pausedSince
+}
+
+// InflightTaskStatus describes a task that is being processed.
+type InflightTaskStatus struct {
+	Key         string    `json:"key"`
+	ResultKey   string    `json:"result-key"`
+	SpecVersion string    `json:"spec-version"`
+	SpecConfig  string    `json:"spec-config"`
+	Blocks      int       `json:"blocks"`
+	Campaign    string    `json:"campaign,omitempty"`
+	Phase       string    `json:"phase"`
+	Started     time.Time `json:"started"`
+	Cancelled   bool      `json:"cancelled"`
+}
+
+// InflightTasks lists the tasks that are being processed, oldest first.
+func (w *Worker) InflightTasks() []InflightTaskStatus {
+	w.tasksMu.Lock()
+	defer w.tasksMu.Unlock()
+	tasks := make([]InflightTaskStatus, 0, len(w.inflight))
+	for _, t := range w.inflight {
+		tasks = append(tasks, InflightTaskStatus{
+			Key:         t.msg.Key,
+			ResultKey:   t.msg.ResultKey,
+			SpecVersion: t.msg.SpecVersion,
+			SpecConfig:  t.msg.SpecConfig,
+			Blocks:      t.msg.Blocks,
+			Campaign:    t.msg.Campaign,
+			Phase:       t.phase,
+			Started:     t.started,
+			Cancelled:   t.cancelled,
+		})
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Started.Before(tasks[j].Started)
+	})
+	return tasks
+}
+
+// AdminHandler serves the admin endpoints, for requests with the token as bearer token:
+//
+//	POST /pause: stop receiving new tasks, in-flight tasks continue.
+//	POST /resume: continue receiving tasks.
+//	GET /status: the worker status, see Status.
+//	GET /tasks/inflight: the tasks that are being processed, see InflightTasks.
+func (w *Worker) AdminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pause", func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Pause()
+		writeJSON(rw, w.Status())
+	})
+	mux.HandleFunc("/resume", func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Resume()
+		writeJSON(rw, w.Status())
+	})
+	mux.HandleFunc("/status", func(rw http.ResponseWriter, req *http.Request) {
+		writeJSON(rw, w.Status())
+	})
+	mux.HandleFunc("/tasks/inflight", func(rw http.ResponseWriter, req *http.Request) {
+		writeJSON(rw, w.InflightTasks())
+	})
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), expected) != 1 {
+			http.Error(rw, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdminPauseResume(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	srv := httptest.NewServer(h.worker.AdminHandler("secret"))
+	defer srv.Close()
+	h.start()
+
+	request := func(method string, path string, token string) *http.Response {
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := request("POST", "/pause", "wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected unauthorized, got %d", resp.StatusCode)
+	}
+	if paused, _ := h.worker.PauseStatus(); paused {
+		t.Fatal("unauthorized request paused the worker")
+	}
+
+	resp := request("POST", "/pause", "secret")
+	var status WorkerStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !status.Paused || status.PausedSince == nil {
+		t.Fatalf("expected paused status, got %+v", status)
+	}
+
+	msg := h.addTask("foo", []byte("pre"))
+	data, err := json.Marshal(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery := h.queue.Push(data)
+	select {
+	case <-delivery.done:
+		t.Fatal("paused worker processed a task")
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	request("POST", "/resume", "secret").Body.Close()
+	if !delivery.Wait() {
+		t.Fatal("expected task to be acked after resume")
+	}
+	if paused, _ := h.worker.PauseStatus(); paused {
+		t.Fatal("expected worker to be resumed")
+	}
+
+	resp = request("GET", "/tasks/inflight", "secret")
+	var inflight []InflightTaskStatus
+	if err := json.NewDecoder(resp.Body).Decode(&inflight); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(inflight) != 0 {
+		t.Errorf("expected no in-flight tasks, got %+v", inflight)
+	}
+}
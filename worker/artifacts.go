@@ -0,0 +1,193 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ClientArtifact is a build of the client to run a task with, instead of the configured client binary or image.
+// Exactly one of Path and Image is set.
+type ClientArtifact struct {
+	// the path of the client binary in the inputs bucket, e.g. "artifacts/zrnt/pr-123/zcli"
+	Path string `json:"path,omitempty"`
+	// the 0x-prefixed sha256 of the binary, required with Path
+	SHA256 string `json:"sha256,omitempty"`
+	// the container image of the client, pinned by digest, e.g. "ghcr.io/org/client@sha256:<digest>". Requires the docker exec mode.
+	Image string `json:"image,omitempty"`
+	// the client version reported in the results. The configured client version with the digest of the artifact if empty.
+	Version string `json:"version,omitempty"`
+}
+
+var (
+	artifactSHA256Pattern = regexp.MustCompile(`^0x[0-9a-f]{64}$`)
+	imageDigestPattern    = regexp.MustCompile(`@sha256:([0-9a-f]{64})$`)
+)
+
+// Check checks that the artifact is pinned to an exact build.
+func (a *ClientArtifact) Check() error {
+	switch {
+	case a.Path != "" && a.Image != "":
+		return fmt.Errorf("client artifact has both a path and an image")
+	case a.Path != "":
+		if path.IsAbs(a.Path) || path.Clean(a.Path) != a.Path || strings.HasPrefix(a.Path, "..") {
+			return fmt.Errorf("invalid client artifact path %q", a.Path)
+		}
+		if !artifactSHA256Pattern.MatchString(a.SHA256) {
+			return fmt.Errorf("client artifact %s requires a 0x-prefixed sha256", a.Path)
+		}
+	case a.Image != "":
+		if !imageDigestPattern.MatchString(a.Image) {
+			return fmt.Errorf("client image %s is not pinned by a sha256 digest", a.Image)
+		}
+	default:
+		return fmt.Errorf("client artifact has no path or image")
+	}
+	return nil
+}
+
+// digest returns the hex sha256 of the binary or image.
+func (a *ClientArtifact) digest() string {
+	if a.Image != "" {
+		return imageDigestPattern.FindStringSubmatch(a.Image)[1]
+	}
+	return strings.TrimPrefix(a.SHA256, "0x")
+}
+
+// version returns the client version to report for results of the artifact.
+func (a *ClientArtifact) version(clientVersion string) string {
+	if a.Version != "" {
+		return a.Version
+	}
+	return clientVersion + "+" + a.digest()[:12]
+}
+
+// clientArtifact returns the artifact to run the task with: the artifact of the task, or else the configured one. Nil if none.
+func (w *Worker) clientArtifact(tr *TransitionMsg) *ClientArtifact {
+	if tr.ClientArtifact != nil {
+		return tr.ClientArtifact
+	}
+	return w.ClientArtifact
+}
+
+// checkClientArtifact checks if the worker can run the client artifact of the task, if any.
+func (w *Worker) checkClientArtifact(tr *TransitionMsg) error {
+	if tr.ClientArtifact == nil {
+		return nil
+	}
+	if w.ArtifactDir == "" {
+		return fmt.Errorf("client artifacts of tasks are not accepted")
+	}
+	if err := tr.ClientArtifact.Check(); err != nil {
+		return err
+	}
+	_, docker := w.Runner.(*DockerRunner)
+	if tr.ClientArtifact.Image != "" && !docker {
+		return fmt.Errorf("client images require the docker exec mode")
+	}
+	if _, grpc := w.Runner.(*GRPCRunner); tr.ClientArtifact.Path != "" && (docker || grpc) {
+		return fmt.Errorf("client binaries require a local exec mode")
+	}
+	return nil
+}
+
+// provisionClientArtifact downloads the client binary of the task, if any, into the artifact cache,
+// and sets the path of the binary on the task. Binaries are cached by their checksum, and verified when downloaded.
+func (w *Worker) provisionClientArtifact(ctx context.Context, tr *TransitionMsg) error {
+	a := w.clientArtifact(tr)
+	if a == nil || a.Path == "" {
+		return nil
+	}
+	if w.ArtifactDir == "" {
+		return fmt.Errorf("no artifact dir to download client artifact %s to", a.Path)
+	}
+	dir := filepath.Join(w.ArtifactDir, a.digest())
+	binary := filepath.Join(dir, path.Base(a.Path))
+	if _, err := os.Stat(binary); err == nil {
+		tr.ClientBinary = binary
+		return nil
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create artifact cache dir: %v", err)
+	}
+	tmp := binary + "." + uniqueID() + ".tmp"
+	defer os.Remove(tmp)
+	err := w.retryStorage(ctx, "download client artifact "+a.Path, func() error {
+		r, err := w.inputs().NewReader(ctx, a.Path)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(io.MultiWriter(f, h), r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		if sum := fmt.Sprintf("0x%x", h.Sum(nil)); sum != a.SHA256 {
+			return fmt.Errorf("checksum mismatch of client artifact %s: expected %s, got %s", a.Path, a.SHA256, sum)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, binary); err != nil {
+		return fmt.Errorf("failed to cache client artifact: %v", err)
+	}
+	tr.ClientBinary = binary
+	return nil
+}
+
+// withClientArtifact returns the client of the worker, running the client artifact of the task if it has one.
+func (w *Worker) withClientArtifact(tr *TransitionMsg, c *taskClient) *taskClient {
+	a := w.clientArtifact(tr)
+	if a == nil || c.subDir != "" {
+		return c
+	}
+	out := *c
+	out.version = a.version(c.version)
+	out.binary = tr.ClientBinary
+	out.image = a.Image
+	return &out
+}
+
+// withProgram replaces the program of the cli cmd, keeping its arguments.
+func withProgram(cliCmd string, program string) (string, error) {
+	parts, err := splitCommand(cliCmd)
+	if err != nil {
+		return "", err
+	}
+	if len(parts) == 0 {
+		return quoteCommandArg(program), nil
+	}
+	parts[0] = program
+	quoted := make([]string, len(parts))
+	for i, p := range parts {
+		quoted[i] = quoteCommandArg(p)
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+// quoteCommandArg quotes the argument for splitCommand, if it needs quoting.
+func quoteCommandArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\r\n'\"") {
+		return s
+	}
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'"
+	}
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
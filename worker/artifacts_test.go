@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientArtifact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	runner := &FakeRunner{}
+	h := newHarness(t, "", runner)
+	defer h.Close()
+	h.worker.ArtifactDir = dir
+
+	binary := []byte("#!/bin/sh\n")
+	h.inputs.Put("artifacts/pr-1/zcli", binary)
+	sum := fmt.Sprintf("0x%x", sha256.Sum256(binary))
+	for i, key := range []string{"foo", "bar"} {
+		msg := h.addTask(key, []byte("pre"), []byte("block0"))
+		msg.ClientArtifact = &ClientArtifact{Path: "artifacts/pr-1/zcli", SHA256: sum}
+		if !h.process(msg) {
+			t.Fatalf("expected task %s to be acked", key)
+		}
+		calls := runner.Calls()
+		if len(calls) != i+1 {
+			t.Fatalf("expected %d runs, got %d", i+1, len(calls))
+		}
+		expected := filepath.Join(dir, sum[2:], "zcli")
+		if calls[i].Name != expected {
+			t.Errorf("expected artifact %s to run, got %s", expected, calls[i].Name)
+		}
+	}
+	for _, res := range h.published() {
+		if res.ClientVersion != "v0.0.1_abc+"+sum[2:14] {
+			t.Errorf("unexpected client version %q", res.ClientVersion)
+		}
+	}
+
+	// a corrupted artifact is not run
+	msg := h.addTask("baz", []byte("pre"), []byte("block0"))
+	msg.ClientArtifact = &ClientArtifact{Path: "artifacts/pr-1/zcli2", SHA256: sum}
+	h.inputs.Put("artifacts/pr-1/zcli2", []byte("#!/bin/sh\nexit 1\n"))
+	if h.process(msg) {
+		t.Error("expected task with a corrupted artifact to be nacked")
+	}
+	if len(runner.Calls()) != 2 {
+		t.Error("expected corrupted artifact not to run")
+	}
+}
+
+func TestClientArtifactRefused(t *testing.T) {
+	runner := &FakeRunner{}
+	h := newHarness(t, "", runner)
+	defer h.Close()
+
+	// without an artifact dir, tasks with artifacts are unsupported, and acked by default
+	msg := h.addTask("foo", []byte("pre"), []byte("block0"))
+	msg.ClientArtifact = &ClientArtifact{Path: "artifacts/zcli", SHA256: fmt.Sprintf("0x%x", sha256.Sum256(nil))}
+	if !h.process(msg) {
+		t.Fatal("expected unsupported task to be acked")
+	}
+	if len(runner.Calls()) != 0 || len(h.published()) != 0 {
+		t.Error("expected task with an artifact not to run")
+	}
+}
+
+func TestClientArtifactCheck(t *testing.T) {
+	digest := fmt.Sprintf("%x", sha256.Sum256(nil))
+	valid := []ClientArtifact{
+		{Path: "artifacts/zcli", SHA256: "0x" + digest},
+		{Image: "ghcr.io/org/zcli@sha256:" + digest},
+	}
+	for _, a := range valid {
+		if err := a.Check(); err != nil {
+			t.Errorf("expected %+v to be valid: %v", a, err)
+		}
+	}
+	invalid := []ClientArtifact{
+		{},
+		{Path: "artifacts/zcli"},
+		{Path: "../zcli", SHA256: "0x" + digest},
+		{Path: "/zcli", SHA256: "0x" + digest},
+		{Image: "ghcr.io/org/zcli:latest"},
+		{Path: "artifacts/zcli", SHA256: "0x" + digest, Image: "ghcr.io/org/zcli@sha256:" + digest},
+	}
+	for _, a := range invalid {
+		if err := a.Check(); err == nil {
+			t.Errorf("expected %+v to be invalid", a)
+		}
+	}
+}
+
+func TestWithProgram(t *testing.T) {
+	cases := map[string]string{
+		"zcli transition blocks":     "/cache/zcli transition blocks",
+		"sh 'my client.sh' --post x": "/cache/zcli 'my client.sh' --post x",
+		"":                           "/cache/zcli",
+	}
+	for in, expected := range cases {
+		out, err := withProgram(in, "/cache/zcli")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != expected {
+			t.Errorf("withProgram(%q) = %q, expected %q", in, out, expected)
+		}
+	}
+	out, err := withProgram("zcli", `C:\artifacts\my zcli.exe`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parts, _ := splitCommand(out); len(parts) != 1 || parts[0] != `C:\artifacts\my zcli.exe` {
+		t.Errorf("unexpected program %q", out)
+	}
+}
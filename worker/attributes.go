@@ -0,0 +1,58 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Routing attributes of result messages, for attribute-based subscriptions,
+// e.g. a Pub/Sub subscription filter `attributes.status != "success"`.
+// Task messages may carry the same attributes, to be skipped without decoding by workers of other clients or targets.
+const (
+	AttrClientName  = "client-name"
+	AttrSpecVersion = "spec-version"
+	AttrSpecConfig  = "spec-config"
+	AttrStatus      = "status"
+)
+
+// addRoutingAttributes adds the routing attributes of the result message to the attributes.
+// The attributes are returned unchanged if the result cannot be decoded.
+func addRoutingAttributes(attrs map[string]string, data []byte) map[string]string {
+	res, err := DecodeResult(data)
+	if err != nil {
+		return attrs
+	}
+	if attrs == nil {
+		attrs = make(map[string]string)
+	}
+	for k, v := range map[string]string{
+		AttrClientName:  res.ClientName,
+		AttrSpecVersion: res.SpecVersion,
+		AttrSpecConfig:  res.SpecConfig,
+		AttrStatus:      res.Status,
+	} {
+		if v != "" {
+			attrs[k] = v
+		}
+	}
+	return attrs
+}
+
+// attributeMismatch returns why the task of a message with routing attributes is not for this worker,
+// or an empty string if it may be. Missing attributes match anything, the task itself is checked after decoding.
+func (w *Worker) attributeMismatch(attrs map[string]string) string {
+	if c, ok := attrs[AttrClientName]; ok && c != w.ClientName {
+		return fmt.Sprintf("client attribute %s, but this worker runs %s", c, w.ClientName)
+	}
+	specVersion, hasVersion := attrs[AttrSpecVersion]
+	specConfig, hasConfig := attrs[AttrSpecConfig]
+	if !hasVersion && !hasConfig {
+		return ""
+	}
+	for _, t := range w.AllTargets() {
+		if (!hasConfig || t.SpecConfig == specConfig) && (!hasVersion || t.SpecVersion == specVersion || w.SpecVersions.Contains(specVersion)) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("target attributes %s/%s, but was expecting one of %s", specVersion, specConfig, strings.Join(w.targetNames(), ", "))
+}
@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestResultRoutingAttributes(t *testing.T) {
+	h := newHarness(t, "", &FakeRunner{})
+	defer h.Close()
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	attrs := h.queue.PublishedAttributes()
+	if len(attrs) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(attrs))
+	}
+	res := h.result()
+	expected := map[string]string{
+		AttrClientName:  "fakeclient",
+		AttrSpecVersion: "v0.8.3",
+		AttrSpecConfig:  "minimal",
+		AttrStatus:      res.Status,
+	}
+	for k, v := range expected {
+		if attrs[0][k] != v {
+			t.Errorf("expected attribute %s=%q, got %q", k, v, attrs[0][k])
+		}
+	}
+	if res.SpecConfig != "minimal" {
+		t.Errorf("expected spec config in result, got %q", res.SpecConfig)
+	}
+}
+
+func TestTaskAttributeFilter(t *testing.T) {
+	h := newHarness(t, "", &FakeRunner{})
+	defer h.Close()
+	h.worker.UnsupportedAction = UnsupportedNack
+	h.worker.UnsupportedNackDelay = 10 * time.Millisecond
+	h.start()
+
+	// the payload is not decoded if the attributes are for another client or target
+	for _, attrs := range []map[string]string{
+		{AttrSpecConfig: "mainnet"},
+		{AttrSpecVersion: "v0.9.1", AttrSpecConfig: "minimal"},
+		{AttrClientName: "otherclient"},
+	} {
+		if h.queue.PushWithAttributes([]byte("not a task"), attrs).Wait() {
+			t.Errorf("expected task with attributes %v to be nacked", attrs)
+		}
+	}
+
+	msg := h.addTask("foo", []byte("pre"), []byte("block0"))
+	data, err := json.Marshal(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := map[string]string{AttrClientName: "fakeclient", AttrSpecVersion: "v0.8.3", AttrSpecConfig: "minimal"}
+	if !h.queue.PushWithAttributes(data, attrs).Wait() {
+		t.Fatal("expected task with matching attributes to be acked")
+	}
+	if len(h.published()) != 1 {
+		t.Error("expected task with matching attributes to run")
+	}
+}
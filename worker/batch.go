@@ -0,0 +1,262 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchManifest describes a batch of tasks to the batch CLI of a client.
+// The batch CLI is run as '<batch-cli-cmd> --manifest <manifest.json> --results <dir>'.
+// For every task, it writes the post state to <dir>/<out>/post.ssz.
+// If the transition of a task fails, it writes the reason to <dir>/<out>/error instead.
+// A non-zero exit code fails all tasks of the batch.
+type BatchManifest struct {
+	SpecVersion string `json:"spec-version"`
+	SpecConfig  string `json:"spec-config"`
+	// the extra CLI arguments of the spec config, space separated. Empty if none.
+	ConfigArgs string      `json:"config-args,omitempty"`
+	Tasks      []BatchTask `json:"tasks"`
+}
+
+// BatchTask is a task in a BatchManifest.
+type BatchTask struct {
+	Key string `json:"key"`
+	// absolute paths of the input files
+	Pre    string   `json:"pre"`
+	Blocks []string `json:"blocks"`
+	// the directory for the outputs of the task, relative to the results dir
+	Out string `json:"out"`
+}
+
+// batchItem is a task waiting for its batch to run.
+type batchItem struct {
+	ctx    context.Context
+	tr     *TransitionMsg
+	outDir string
+	done   chan struct{}
+	out    *transitionOutput
+	err    error
+}
+
+// pendingBatch collects compatible tasks, until it is full or waited for long enough.
+type pendingBatch struct {
+	items []*batchItem
+	timer *time.Timer
+}
+
+// taskBatcher groups the tasks of the same spec version and config into batches for the batch CLI.
+type taskBatcher struct {
+	mu      sync.Mutex
+	pending map[string]*pendingBatch
+}
+
+func (w *Worker) batcher() *taskBatcher {
+	w.batchOnce.Do(func() {
+		w.batchState = &taskBatcher{pending: make(map[string]*pendingBatch)}
+	})
+	return w.batchState
+}
+
+// batchEnabled returns true if tasks of the client of the worker run in batches.
+func (w *Worker) batchEnabled() bool {
+	return w.BatchCliCmd != "" && w.BatchSize > 1
+}
+
+// runBatched runs the transition of the task as part of a batch of up to BatchSize compatible tasks,
+// which runs when it is full, or BatchWait after its first task was added.
+// A task that is canceled before its batch runs leaves the batch.
+func (w *Worker) runBatched(ctx context.Context, tr *TransitionMsg, c *taskClient) (*transitionOutput, error) {
+	item := &batchItem{ctx: ctx, tr: tr, outDir: c.outDir(tr), done: make(chan struct{})}
+	group := tr.SpecVersion + "/" + tr.SpecConfig
+	b := w.batcher()
+	b.mu.Lock()
+	p, ok := b.pending[group]
+	if !ok {
+		p = &pendingBatch{}
+		b.pending[group] = p
+		p.timer = time.AfterFunc(w.BatchWait, func() {
+			w.flushBatch(group, p)
+		})
+	}
+	p.items = append(p.items, item)
+	full := len(p.items) >= w.BatchSize
+	b.mu.Unlock()
+	if full {
+		w.flushBatch(group, p)
+	}
+	select {
+	case <-item.done:
+		return item.out, item.err
+	case <-ctx.Done():
+	}
+	b.mu.Lock()
+	if b.pending[group] == p {
+		for i, it := range p.items {
+			if it == item {
+				p.items = append(p.items[:i], p.items[i+1:]...)
+				break
+			}
+		}
+		b.mu.Unlock()
+		return nil, ctx.Err()
+	}
+	b.mu.Unlock()
+	// the batch is already running, it is stopped when all of its tasks are canceled
+	<-item.done
+	return item.out, item.err
+}
+
+// flushBatch runs the pending batch, if it did not run yet.
+func (w *Worker) flushBatch(group string, p *pendingBatch) {
+	b := w.batcher()
+	b.mu.Lock()
+	if b.pending[group] != p {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, group)
+	p.timer.Stop()
+	items := p.items
+	b.mu.Unlock()
+	if len(items) == 0 {
+		return
+	}
+	go func() {
+		out, err := w.runBatch(items)
+		for i, item := range items {
+			if err != nil {
+				item.err = err
+			} else {
+				item.out = out[i]
+			}
+			close(item.done)
+		}
+	}()
+}
+
+// batchContext returns a context that is canceled when the contexts of all the tasks of the batch are done.
+func batchContext(items []*batchItem) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for _, item := range items {
+			select {
+			case <-item.ctx.Done():
+			case <-ctx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// runBatch runs the batch CLI on the tasks, and returns the output of every task.
+// The tasks share the logs and resource usage of the batch, the transition timeout applies per task.
+func (w *Worker) runBatch(items []*batchItem) ([]*transitionOutput, error) {
+	ctx, cancel := batchContext(items)
+	defer cancel()
+	first := items[0].tr
+	batchDir, err := ioutil.TempDir("", "muskoka-batch-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch dir: %v", err)
+	}
+	defer os.RemoveAll(batchDir)
+	resultsDir := path.Join(batchDir, "results")
+	manifest := BatchManifest{
+		SpecVersion: first.SpecVersion,
+		SpecConfig:  first.SpecConfig,
+		ConfigArgs:  w.ConfigCliArgs[first.SpecConfig],
+	}
+	var keys []string
+	for i, item := range items {
+		dir := item.tr.DirPath()
+		task := BatchTask{Key: item.tr.Key, Pre: path.Join(dir, "pre.ssz"), Blocks: []string{}, Out: strconv.Itoa(i)}
+		for j := 0; j < item.tr.Blocks; j++ {
+			task.Blocks = append(task.Blocks, path.Join(dir, fmt.Sprintf("block_%d.ssz", j)))
+		}
+		if err := os.MkdirAll(path.Join(resultsDir, task.Out), os.ModePerm); err != nil {
+			return nil, fmt.Errorf("failed to create batch results dir: %v", err)
+		}
+		manifest.Tasks = append(manifest.Tasks, task)
+		keys = append(keys, item.tr.Key)
+	}
+	manifestPath := path.Join(batchDir, "manifest.json")
+	data, err := json.Marshal(&manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(manifestPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write batch manifest: %v", err)
+	}
+	cmdParts, err := splitCommand(w.BatchCliCmd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid batch cli cmd: %v", err)
+	}
+	if len(cmdParts) == 0 {
+		return nil, fmt.Errorf("empty batch cli cmd")
+	}
+	spec := CommandSpec{Name: cmdParts[0], Args: append(cmdParts[1:], "--manifest", manifestPath, "--results", resultsDir), Env: w.clientEnv(nil, nil)}
+	log.Printf("executing batch of %d tasks (spec version %s, config %s): %s", len(items), first.SpecVersion, first.SpecConfig, strings.Join(keys, ", "))
+	out, err := w.runClientCommand(ctx, spec, batchDir, nil, batchDir, w.transitionTimeout()*time.Duration(len(items)), nil)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("batch of %d tasks\nout (tail):\n%s\nerr (tail):\n%s\n", len(items), readTail(out.Stdout, logTailSize), readTail(out.Stderr, logTailSize))
+	outputs := make([]*transitionOutput, len(items))
+	for i, item := range items {
+		if outputs[i], err = w.batchTaskOutput(out, path.Join(resultsDir, manifest.Tasks[i].Out), item.outDir); err != nil {
+			return nil, fmt.Errorf("failed to collect the output of batch task %s: %v", item.tr.Key, err)
+		}
+	}
+	return outputs, nil
+}
+
+// batchTaskOutput moves the post state of a task from the batch results to the output dir of the task,
+// and copies the batch logs. The task failed if the batch failed, or if the client reported an error for it.
+func (w *Worker) batchTaskOutput(batch *transitionOutput, resultDir string, outDir string) (*transitionOutput, error) {
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	out := *batch
+	logs := []*string{&out.Stdout, &out.Stderr, &out.StdoutTimed, &out.StderrTimed, &out.Combined}
+	for _, p := range logs {
+		if *p == "" {
+			continue
+		}
+		dst := path.Join(outDir, path.Base(*p))
+		if err := copyFile(dst, *p); err != nil {
+			return nil, err
+		}
+		*p = dst
+	}
+	if reason, err := ioutil.ReadFile(path.Join(resultDir, "error")); err == nil {
+		out.Success = false
+		out.Rejected = true
+		f, err := os.OpenFile(out.Stderr, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		_, err = fmt.Fprintf(f, "batch task error: %s\n", reason)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.Rename(path.Join(resultDir, "post.ssz"), path.Join(outDir, "post.ssz")); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchRunner is a fake batch CLI: the post state of a task is its pre state with all blocks appended,
+// tasks with the key "bad" fail.
+type batchRunner struct {
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (r *batchRunner) Run(ctx context.Context, c Command) (CommandResult, error) {
+	var manifestPath, resultsDir string
+	for i := 0; i+1 < len(c.Args); i++ {
+		switch c.Args[i] {
+		case "--manifest":
+			manifestPath = c.Args[i+1]
+		case "--results":
+			resultsDir = c.Args[i+1]
+		}
+	}
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return CommandResult{}, err
+	}
+	var manifest BatchManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return CommandResult{}, err
+	}
+	var keys []string
+	for _, task := range manifest.Tasks {
+		keys = append(keys, task.Key)
+		if task.Key == "bad" {
+			if err := ioutil.WriteFile(path.Join(resultsDir, task.Out, "error"), []byte("invalid block"), 0644); err != nil {
+				return CommandResult{}, err
+			}
+			continue
+		}
+		var post []byte
+		for _, p := range append([]string{task.Pre}, task.Blocks...) {
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				return CommandResult{}, err
+			}
+			post = append(post, b...)
+		}
+		if err := ioutil.WriteFile(path.Join(resultsDir, task.Out, "post.ssz"), post, 0644); err != nil {
+			return CommandResult{}, err
+		}
+	}
+	fmt.Fprintf(c.Stdout, "processed batch of %d tasks\n", len(manifest.Tasks))
+	r.mu.Lock()
+	r.batches = append(r.batches, keys)
+	r.mu.Unlock()
+	return CommandResult{}, nil
+}
+
+func TestBatchMode(t *testing.T) {
+	runner := &batchRunner{}
+	h := newHarness(t, "", runner)
+	defer h.Close()
+	h.worker.BatchCliCmd = "fakeclient batch"
+	h.worker.BatchSize = 3
+	h.worker.BatchWait = time.Second * 5
+	h.worker.AckPolicy = map[string]string{ErrorClassClient: ActionResult}
+
+	tasks := []TransitionMsg{
+		h.addTask("foo", []byte("pre-foo"), []byte("b0")),
+		h.addTask("bar", []byte("pre-bar")),
+		h.addTask("bad", []byte("pre-bad")),
+	}
+	var wg sync.WaitGroup
+	acked := make([]bool, len(tasks))
+	for i, tr := range tasks {
+		data, err := json.Marshal(&tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			done := make(chan bool, 1)
+			h.worker.handleMessage(context.Background(), &QueueMessage{
+				Data: data,
+				ack:  func() { done <- true },
+				nack: func() { done <- false },
+			})
+			acked[i] = <-done
+		}(i)
+	}
+	wg.Wait()
+
+	if len(runner.batches) != 1 || len(runner.batches[0]) != 3 {
+		t.Fatalf("expected a single batch of 3 tasks, got %v", runner.batches)
+	}
+	results := make(map[string]ResultMsg)
+	for _, res := range h.published() {
+		results[res.Key] = res
+	}
+	for i, tr := range tasks {
+		if !acked[i] {
+			t.Errorf("expected task %s to be acked", tr.Key)
+		}
+	}
+	if foo := results["foo"]; !foo.Success || string(h.resultFile(foo.Files.PostState)) != "pre-foob0" {
+		t.Errorf("unexpected result of foo: %+v", foo)
+	}
+	if bar := results["bar"]; !bar.Success || string(h.resultFile(bar.Files.OutLog)) != "processed batch of 3 tasks\n" {
+		t.Errorf("unexpected result of bar: %+v", bar)
+	}
+	if bad := results["bad"]; bad.Success || bad.Status != StatusTransitionRejected {
+		t.Errorf("expected bad task to fail: %+v", bad)
+	}
+}
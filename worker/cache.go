@@ -0,0 +1,151 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inputCache is a least-recently-used cache of downloaded input files on local disk,
+// keyed by the URL and the version of the object, so an overwritten object is never served from the cache.
+// The last use of an entry is the modification time of its file, so the cache survives restarts of the worker.
+type inputCache struct {
+	dir      string
+	maxBytes int64
+	// mu guards eviction
+	mu sync.Mutex
+}
+
+// inputCache returns the input cache, or nil if caching is disabled.
+func (w *Worker) inputCache() *inputCache {
+	if w.CacheDir == "" {
+		return nil
+	}
+	w.cacheOnce.Do(func() {
+		w.cacheState = &inputCache{dir: w.CacheDir, maxBytes: w.CacheMaxBytes}
+	})
+	return w.cacheState
+}
+
+// cacheKey returns the name of the cache entry of an object version.
+func cacheKey(url string, version string) string {
+	h := sha256.Sum256([]byte(url + "\n" + version))
+	return hex.EncodeToString(h[:])
+}
+
+// inputCacheKey returns the cache key of the current version of the object,
+// or an empty key if the store does not support versions, or the version is unknown.
+func (w *Worker) inputCacheKey(ctx context.Context, store BlobStore, name string) string {
+	vs, ok := store.(versionedStore)
+	if !ok {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	version, err := vs.Version(ctx, name)
+	if err != nil {
+		log.Printf("failed to get the version of input %s, not using the cache: %v", name, err)
+		return ""
+	}
+	return cacheKey(store.URL(name), version)
+}
+
+// get copies the cached file of the key to dest, and returns its hash. False if the key is not cached.
+func (c *inputCache) get(key string, dest string) (hash [32]byte, ok bool) {
+	p := filepath.Join(c.dir, key)
+	in, err := os.Open(p)
+	if err != nil {
+		return hash, false
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return hash, false
+	}
+	defer out.Close()
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, h), in); err != nil {
+		log.Printf("failed to copy cached input %s to %s: %v", p, dest, err)
+		return hash, false
+	}
+	copy(hash[:], h.Sum(nil))
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	return hash, true
+}
+
+// add copies the file src into the cache under the key,
+// then evicts the least recently used entries that do not fit in the cache.
+func (c *inputCache) add(key string, src string) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// write to a temporary file first, so concurrent tasks never read a partial entry
+	tmp, err := ioutil.TempFile(c.dir, "."+key+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.dir, key))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	c.evict()
+	return nil
+}
+
+// evict removes the least recently used entries until the cache fits in maxBytes. The cache is unlimited if 0.
+func (c *inputCache) evict() {
+	if c.maxBytes <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		log.Printf("failed to list input cache %s: %v", c.dir, err)
+		return
+	}
+	var entries []os.FileInfo
+	var total int64
+	for _, info := range infos {
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		entries = append(entries, info)
+		total += info.Size()
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+	for _, info := range entries {
+		if total <= c.maxBytes {
+			return
+		}
+		if err := os.Remove(filepath.Join(c.dir, info.Name())); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to evict input cache entry %s: %v", info.Name(), err)
+			continue
+		}
+		total -= info.Size()
+	}
+}
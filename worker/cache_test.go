@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// countingStore counts the reads of every object.
+type countingStore struct {
+	*MemStore
+	reads map[string]int
+}
+
+func (s *countingStore) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	s.reads[name]++
+	return s.MemStore.NewReader(ctx, name)
+}
+
+func TestInputCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muskoka-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := &countingStore{MemStore: NewMemStore("inputs"), reads: map[string]int{}}
+	store.Put("pre.ssz", []byte("pre"))
+	w := &Worker{Config: Config{CacheDir: filepath.Join(dir, "cache")}, Inputs: store}
+
+	download := func(expected string) {
+		t.Helper()
+		p := filepath.Join(dir, "pre.ssz")
+		hash, err := w.downloadInputFile(context.Background(), p, "pre.ssz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != sha256.Sum256([]byte(expected)) {
+			t.Errorf("unexpected hash %x", hash)
+		}
+		if data, err := ioutil.ReadFile(p); err != nil || string(data) != expected {
+			t.Errorf("unexpected file contents %q (%v), expected %q", data, err, expected)
+		}
+	}
+	download("pre")
+	download("pre")
+	if n := store.reads["pre.ssz"]; n != 1 {
+		t.Errorf("expected 1 download, got %d", n)
+	}
+	// a new version of the object is downloaded again
+	store.Put("pre.ssz", []byte("changed"))
+	download("changed")
+	if n := store.reads["pre.ssz"]; n != 2 {
+		t.Errorf("expected 2 downloads, got %d", n)
+	}
+}
+
+func TestInputCacheEvict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muskoka-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := &inputCache{dir: dir, maxBytes: 10}
+	src := filepath.Join(dir, ".src")
+	if err := ioutil.WriteFile(src, []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []string{"a", "b"} {
+		if err := c.add(key, src); err != nil {
+			t.Fatal(err)
+		}
+		// order the entries by use
+		tm := time.Now().Add(time.Duration(i-10) * time.Minute)
+		if err := os.Chtimes(filepath.Join(dir, key), tm, tm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// using a makes b the least recently used entry
+	if _, ok := c.get("a", filepath.Join(dir, ".out")); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	if err := c.add("c", src); err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, err := os.Stat(filepath.Join(dir, key)); (err == nil) != expected {
+			t.Errorf("entry %s: expected cached %v, got error %v", key, expected, err)
+		}
+	}
+}
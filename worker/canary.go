@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// RunCanary periodically re-runs the pinned known-good canary task, until ctx is canceled,
+// and alerts when the result drifts. Canary results are not uploaded or published.
+func (w *Worker) RunCanary(ctx context.Context) {
+	ticker := time.NewTicker(w.CanaryInterval)
+	defer ticker.Stop()
+	last := w.CanaryPostHash
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		postHash, err := w.checkCanary(ctx, last)
+		if err != nil {
+			log.Printf("ALERT: canary %s: %v", w.CanaryKey, err)
+		} else {
+			log.Printf("canary %s ok: %s", w.CanaryKey, postHash)
+		}
+		if postHash != "" {
+			last = postHash
+		}
+	}
+}
+
+// checkCanary runs the canary task, and returns its post hash.
+// An error is returned if the task could not run, failed, or if the post hash is different from the expected one.
+func (w *Worker) checkCanary(ctx context.Context, expectedPostHash string) (string, error) {
+	tr := &TransitionMsg{
+		Blocks:      w.CanaryBlocks,
+		SpecVersion: w.AllTargets()[0].SpecVersion,
+		SpecConfig:  w.AllTargets()[0].SpecConfig,
+		Key:         w.CanaryKey,
+		ResultKey:   "canary-" + uniqueID(),
+		WorkDir:     w.workDir(),
+	}
+	// canary files are never interesting after the check, always remove them.
+	defer func() {
+		if err := os.RemoveAll(tr.DirPath()); err != nil {
+			log.Printf("cannot clean up temporary files of canary %s: %v", tr.Key, err)
+		}
+	}()
+	if err := w.LoadFromBucket(ctx, tr); err != nil {
+		return "", fmt.Errorf("failed to load canary inputs: %v", err)
+	}
+	out, err := w.runTransition(ctx, tr, w.primaryClient(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to run canary: %v", err)
+	}
+	postHash := fmt.Sprintf("0x%x", w.hashPostState(tr, tr.DirPath()).Flat)
+	if !out.Success {
+		return postHash, fmt.Errorf("known-good transition failed, post hash: %s", postHash)
+	}
+	if expectedPostHash != "" && postHash != expectedPostHash {
+		return postHash, fmt.Errorf("post hash changed from %s to %s", expectedPostHash, postHash)
+	}
+	return postHash, nil
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TaskTypeBlocks is a transition of a pre-state with a list of blocks.
+const TaskTypeBlocks = "blocks"
+
+// TaskTypeFinality is a blocks transition that also reports the finality fields of the post state.
+const TaskTypeFinality = "finality"
+
+// CapabilitiesMsg declares what tasks a worker can process, so the coordinator only routes compatible tasks to it.
+type CapabilitiesMsg struct {
+	WorkerID      string `json:"worker-id"`
+	ClientName    string `json:"client-name"`
+	ClientVersion string `json:"client-version"`
+	// supported task types, e.g. "blocks", "finality", "epoch"
+	TaskTypes []string `json:"task-types"`
+	// supported spec versions (forks)
+	SpecVersions []string `json:"spec-versions"`
+	// supported spec configs (presets)
+	SpecConfigs []string `json:"spec-configs"`
+	// supported combinations of spec version and config, as <spec-version>/<spec-config>
+	Targets []string `json:"targets"`
+	// the range of other spec versions that are also supported for the spec configs, e.g. ">=0.8.3 <0.9.0"
+	SpecVersionRange string `json:"spec-version-range,omitempty"`
+	// the maximum number of blocks in a task, 0 if unlimited
+	MaxBlocks int `json:"max-blocks"`
+}
+
+func (w *Worker) Capabilities() CapabilitiesMsg {
+	var specVersions, specConfigs []string
+	for _, t := range w.AllTargets() {
+		specVersions = append(specVersions, t.SpecVersion)
+		specConfigs = append(specConfigs, t.SpecConfig)
+	}
+	return CapabilitiesMsg{
+		WorkerID:         w.WorkerID,
+		ClientName:       w.ClientName,
+		ClientVersion:    w.ClientVersion,
+		TaskTypes:        w.taskTypes(),
+		SpecVersions:     uniqueStrings(specVersions),
+		SpecConfigs:      uniqueStrings(specConfigs),
+		Targets:          w.targetNames(),
+		SpecVersionRange: w.SpecVersions.String(),
+		MaxBlocks:        w.MaxBlocks,
+	}
+}
+
+// DeclareCapabilities publishes the capabilities of the worker.
+func (w *Worker) DeclareCapabilities(p Publisher) error {
+	data, err := json.Marshal(w.Capabilities())
+	if err != nil {
+		return fmt.Errorf("failed to encode capabilities: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return p.Publish(ctx, data)
+}
@@ -0,0 +1,30 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDeclareCapabilities(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.MaxBlocks = 1
+
+	capQueue := NewMemQueue(0)
+	if err := h.worker.DeclareCapabilities(capQueue); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(capQueue.Published()); n != 1 {
+		t.Fatalf("expected 1 capabilities message, got %d", n)
+	}
+	var caps CapabilitiesMsg
+	if err := json.Unmarshal(capQueue.Published()[0], &caps); err != nil {
+		t.Fatal(err)
+	}
+	if caps.MaxBlocks != 1 || caps.SpecVersions[0] != "v0.8.3" || caps.TaskTypes[0] != TaskTypeBlocks {
+		t.Errorf("unexpected capabilities: %+v", caps)
+	}
+	if caps.ClientName != "fakeclient" || caps.ClientVersion != "v0.0.1_abc" {
+		t.Errorf("unexpected client in capabilities: %+v", caps)
+	}
+}
@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"fmt"
+	"io"
+)
+
+// cappedWriter passes up to limit bytes of a captured output stream to the underlying writer.
+// The first write past the limit writes a truncation marker instead, and the rest of the output is discarded,
+// so a client that dumps gigabytes of logs does not fill the disk or memory of the worker.
+// Discarded writes still report success, so the client is not killed by a broken pipe.
+type cappedWriter struct {
+	out   io.Writer
+	limit int64
+	// bytes passed to out, excluding the marker
+	written   int64
+	truncated bool
+}
+
+// capOutput limits the output written to out to limit bytes. Unlimited if the limit is 0.
+func capOutput(out io.Writer, limit int64) io.Writer {
+	if limit <= 0 {
+		return out
+	}
+	return &cappedWriter{out: out, limit: limit}
+}
+
+func (w *cappedWriter) Write(p []byte) (int, error) {
+	if w.truncated {
+		return len(p), nil
+	}
+	n := len(p)
+	if space := w.limit - w.written; int64(len(p)) > space {
+		p = p[:space]
+		w.truncated = true
+	}
+	if len(p) > 0 {
+		written, err := w.out.Write(p)
+		w.written += int64(written)
+		if err != nil {
+			return written, err
+		}
+	}
+	if w.truncated {
+		if _, err := fmt.Fprintf(w.out, "\n[output truncated after %d bytes]\n", w.written); err != nil {
+			return len(p), err
+		}
+	}
+	return n, nil
+}
+
+// Truncated returns true if output was discarded.
+func (w *cappedWriter) Truncated() bool {
+	return w.truncated
+}
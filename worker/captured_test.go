@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCappedWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := capOutput(&out, 10)
+	for _, s := range []string{"0123", "456789ab", "cdef"} {
+		if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+			t.Fatalf("expected a full write of %q, got %d: %v", s, n, err)
+		}
+	}
+	if got := out.String(); got != "0123456789\n[output truncated after 10 bytes]\n" {
+		t.Errorf("unexpected output: %q", got)
+	}
+	if !w.(*cappedWriter).Truncated() {
+		t.Error("expected output to be truncated")
+	}
+	if w := capOutput(&out, 0); w != &out {
+		t.Error("expected unlimited output to not be wrapped")
+	}
+}
+
+func TestMaxCapturedOutput(t *testing.T) {
+	h := newHarness(t, "", &FakeRunner{Stdout: strings.Repeat("spam\n", 1000), Stderr: "err line\n"})
+	defer h.Close()
+	h.worker.MaxCapturedOutput = 100
+
+	if !h.process(h.addTask("foo", []byte("pre"))) {
+		t.Fatal("expected task to be acked")
+	}
+	res := h.result()
+	out := string(h.resultFile(res.Files.OutLog))
+	if out != strings.Repeat("spam\n", 20)+"\n[output truncated after 100 bytes]\n" {
+		t.Errorf("unexpected stdout log: %q", out)
+	}
+	if errLog := string(h.resultFile(res.Files.ErrLog)); errLog != "err line\n" {
+		t.Errorf("expected stderr to be below the limit, got %q", errLog)
+	}
+}
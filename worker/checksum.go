@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"log"
+	"strings"
+	"time"
+)
+
+// objectChecksums are the checksums of an object as reported by its store. Nil fields are unknown.
+type objectChecksums struct {
+	MD5    []byte
+	CRC32C *uint32
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// inputChecksums returns the checksums of the input object to verify the download with,
+// or nil if VerifyInputs is disabled, or the store does not report checksums.
+func (w *Worker) inputChecksums(ctx context.Context, store BlobStore, name string) *objectChecksums {
+	cs, ok := store.(checksumStore)
+	if !w.VerifyInputs || !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	sums, err := cs.Checksums(ctx, name)
+	if err != nil {
+		log.Printf("failed to get the checksums of input %s, not verifying the download: %v", name, err)
+		return nil
+	}
+	if sums.MD5 == nil && sums.CRC32C == nil {
+		return nil
+	}
+	return &sums
+}
+
+// checksumVerifier computes the checksums of the data written to it, to compare with the expected checksums.
+type checksumVerifier struct {
+	expected *objectChecksums
+	md5      hash.Hash
+	crc32c   hash.Hash32
+}
+
+func newChecksumVerifier(expected *objectChecksums) *checksumVerifier {
+	return &checksumVerifier{expected: expected, md5: md5.New(), crc32c: crc32.New(crc32cTable)}
+}
+
+func (v *checksumVerifier) Write(p []byte) (int, error) {
+	v.md5.Write(p)
+	v.crc32c.Write(p)
+	return len(p), nil
+}
+
+// verify returns an error if the data does not match the known expected checksums.
+func (v *checksumVerifier) verify() error {
+	if v.expected.MD5 != nil {
+		if got := v.md5.Sum(nil); !bytes.Equal(got, v.expected.MD5) {
+			return fmt.Errorf("MD5 mismatch: got %x, expected %x", got, v.expected.MD5)
+		}
+	}
+	if v.expected.CRC32C != nil {
+		if got := v.crc32c.Sum32(); got != *v.expected.CRC32C {
+			return fmt.Errorf("CRC32C mismatch: got %08x, expected %08x", got, *v.expected.CRC32C)
+		}
+	}
+	return nil
+}
+
+// verifyInputHashes returns an error if the hashes of the downloaded inputs do not match the checksums in the task.
+func verifyInputHashes(tr *TransitionMsg) error {
+	if tr.Checksums == nil || tr.Inputs == nil {
+		return nil
+	}
+	if tr.Checksums.Pre != "" && strings.ToLower(tr.Checksums.Pre) != tr.Inputs.Pre {
+		return fmt.Errorf("pre.ssz checksum mismatch: got %s, expected %s", tr.Inputs.Pre, tr.Checksums.Pre)
+	}
+	if len(tr.Checksums.Blocks) > 0 && len(tr.Checksums.Blocks) != len(tr.Inputs.Blocks) {
+		return fmt.Errorf("task has %d block checksums, but %d blocks", len(tr.Checksums.Blocks), len(tr.Inputs.Blocks))
+	}
+	names := tr.InputFiles()
+	for i, expected := range tr.Checksums.Blocks {
+		if expected != "" && strings.ToLower(expected) != tr.Inputs.Blocks[i] {
+			return fmt.Errorf("%s checksum mismatch: got %s, expected %s", names[i], tr.Inputs.Blocks[i], expected)
+		}
+	}
+	return nil
+}
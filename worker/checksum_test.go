@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// corruptingStore reports the MD5 of the objects, and corrupts the first reads of every object.
+type corruptingStore struct {
+	*MemStore
+	corruptions int
+	reads       map[string]int
+}
+
+func (s *corruptingStore) Checksums(ctx context.Context, name string) (objectChecksums, error) {
+	data, _ := s.Get(name)
+	sum := md5.Sum(data)
+	return objectChecksums{MD5: sum[:]}, nil
+}
+
+func (s *corruptingStore) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	s.reads[name]++
+	if s.reads[name] <= s.corruptions {
+		return ioutil.NopCloser(strings.NewReader("corrupted")), nil
+	}
+	return s.MemStore.NewReader(ctx, name)
+}
+
+func TestVerifyInputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muskoka-checksum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := &corruptingStore{MemStore: NewMemStore("inputs"), corruptions: 1, reads: map[string]int{}}
+	store.Put("pre.ssz", []byte("pre"))
+	w := &Worker{Config: Config{VerifyInputs: true, StorageAttempts: 2, StorageRetryDelay: time.Millisecond}, Inputs: store}
+
+	hash, err := w.downloadInputFile(context.Background(), filepath.Join(dir, "pre.ssz"), "pre.ssz")
+	if err != nil {
+		t.Fatalf("expected the corrupted download to be retried: %v", err)
+	}
+	if hash != sha256.Sum256([]byte("pre")) {
+		t.Errorf("unexpected hash %x", hash)
+	}
+
+	store.corruptions = 10
+	_, err = w.downloadInputFile(context.Background(), filepath.Join(dir, "other.ssz"), "pre.ssz")
+	if err == nil || !strings.Contains(err.Error(), "MD5 mismatch") {
+		t.Errorf("expected a checksum error, got %v", err)
+	}
+}
+
+func TestTaskChecksums(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+
+	msg := h.addTask("foo", []byte("pre"), []byte("block0"))
+	msg.Checksums = &InputHashes{
+		Pre:    fmt.Sprintf("0x%X", sha256.Sum256([]byte("pre"))),
+		Blocks: []string{fmt.Sprintf("0x%x", sha256.Sum256([]byte("other")))},
+	}
+	if h.process(msg) {
+		t.Fatal("expected task with a mismatching block to be nacked")
+	}
+	msg.Checksums.Blocks = []string{""}
+	if !h.process(msg) {
+		t.Fatal("expected task with matching checksums to be acked")
+	}
+}
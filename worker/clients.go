@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ExtraClient is an additional client to run every task with, after the client of the worker.
+// It publishes its own results, like a worker of the client would.
+type ExtraClient struct {
+	Name    string
+	Version string
+	CliCmd  string
+	// Results receives the result messages of the client.
+	Results Publisher
+}
+
+// ParseExtraClient parses a client formatted as <version>:<cli-cmd>.
+func ParseExtraClient(name string, s string) (ExtraClient, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if name == "" || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return ExtraClient{}, fmt.Errorf("expected <name>=<version>:<cli-cmd>, got %s=%s", name, s)
+	}
+	return ExtraClient{Name: name, Version: parts[0], CliCmd: parts[1]}, nil
+}
+
+// taskClient is a client to run a task with: the client of the worker, or an extra client.
+type taskClient struct {
+	name    string
+	version string
+	cliCmd  string
+	results Publisher
+	// the directory for the outputs of the client, relative to the work dir of the task.
+	// Empty for the work dir itself.
+	subDir string
+	// the client binary and container image of a client artifact, that replace the program of the cli cmd
+	// and the image of the runner. Empty if not set.
+	binary string
+	image  string
+}
+
+// outDir returns the directory for the outputs of the client for the task.
+func (c *taskClient) outDir(tr *TransitionMsg) string {
+	return filepath.Join(tr.DirPath(), c.subDir)
+}
+
+// primaryClient returns the client of the worker, publishing to the task queue.
+func (w *Worker) primaryClient() *taskClient {
+	return &taskClient{name: w.ClientName, version: w.ClientVersion, cliCmd: w.cliCmd(), results: w.Queue}
+}
+
+// taskClients returns the clients to run every task with: the client of the worker first, then the extra clients.
+func (w *Worker) taskClients() []*taskClient {
+	clients := []*taskClient{w.primaryClient()}
+	for _, c := range w.ExtraClients {
+		clients = append(clients, &taskClient{
+			name:    c.Name,
+			version: c.Version,
+			cliCmd:  c.CliCmd,
+			results: c.Results,
+			subDir:  "client-" + c.Name,
+		})
+	}
+	return clients
+}
@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtraClients(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	script, err := filepath.Abs("testdata/fake_client.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewMemQueue(10)
+	h.worker.ExtraClients = []ExtraClient{{Name: "other", Version: "v1.0.0", CliCmd: "sh " + script, Results: other}}
+
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	res := h.result()
+	if res.ClientName != "fakeclient" || !res.Success {
+		t.Errorf("unexpected result of the worker client: %+v", res)
+	}
+	published := other.Published()
+	if len(published) != 1 {
+		t.Fatalf("expected 1 result of the extra client, got %d", len(published))
+	}
+	var extra ResultMsg
+	if err := json.Unmarshal(published[0], &extra); err != nil {
+		t.Fatal(err)
+	}
+	if extra.ClientName != "other" || extra.ClientVersion != "v1.0.0" || !extra.Success {
+		t.Errorf("unexpected result of the extra client: %+v", extra)
+	}
+	if extra.PostHash != res.PostHash {
+		t.Errorf("post hash %s of the extra client, expected %s", extra.PostHash, res.PostHash)
+	}
+	if !strings.Contains(extra.Files.PostState, "/other/v1.0.0/") {
+		t.Errorf("unexpected post state path of the extra client: %s", extra.Files.PostState)
+	}
+	if post := h.resultFile(extra.Files.PostState); string(post) != "preblock0" {
+		t.Errorf("uploaded post state %q of the extra client", post)
+	}
+}
+
+func TestParseExtraClient(t *testing.T) {
+	c, err := ParseExtraClient("lighthouse", "v0.1.0:lcli transition --input {pre}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "lighthouse" || c.Version != "v0.1.0" || c.CliCmd != "lcli transition --input {pre}" {
+		t.Errorf("unexpected client: %+v", c)
+	}
+	for _, v := range []string{"", "v0.1.0", ":lcli", "v0.1.0:"} {
+		if _, err := ParseExtraClient("lighthouse", v); err == nil {
+			t.Errorf("expected %q to be invalid", v)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// splitCommand splits a cli cmd into the command name and arguments, on whitespace outside of quotes.
+// Single quotes keep everything up to the closing quote as-is. Double quotes keep whitespace,
+// and a backslash escapes a double quote within them. Outside of quotes, a backslash escapes a quote or whitespace.
+// Other backslashes are kept, so Windows paths like C:\clients\lighthouse.exe need no escaping.
+// A blank command has no arguments.
+func splitCommand(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	// an argument was started, possibly empty, e.g. ""
+	inArg := false
+	var quote rune
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && runes[i+1] == '"' {
+				arg.WriteRune('"')
+				i++
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == '\\' && i+1 < len(runes) && strings.ContainsRune("'\" \t", runes[i+1]):
+			arg.WriteRune(runes[i+1])
+			inArg = true
+			i++
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in command %q", quote, s)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// windowsCommandLine joins the arguments into a Windows command line, quoted as parsed by CommandLineToArgvW
+// and the Microsoft C runtime: arguments with whitespace or quotes are double quoted, quotes are escaped with a backslash,
+// and backslashes are only doubled where they precede a quote.
+func windowsCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = quoteWindowsArg(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func quoteWindowsArg(a string) string {
+	if a != "" && !strings.ContainsAny(a, " \t\n\v\"") {
+		return a
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	backslashes := 0
+	for i := 0; i < len(a); i++ {
+		c := a[i]
+		switch c {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			// the backslashes before a quote, and the quote itself, are escaped
+			b.WriteString(strings.Repeat(`\`, 2*backslashes+1))
+		default:
+			b.WriteString(strings.Repeat(`\`, backslashes))
+		}
+		backslashes = 0
+		b.WriteByte(c)
+	}
+	// the closing quote follows the trailing backslashes, so they are escaped too
+	b.WriteString(strings.Repeat(`\`, 2*backslashes))
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package worker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	cases := map[string][]string{
+		"lighthouse transition  --spec minimal":          {"lighthouse", "transition", "--spec", "minimal"},
+		`"C:\Program Files\zrnt\zrnt.exe" transition`:    {`C:\Program Files\zrnt\zrnt.exe`, "transition"},
+		`C:\clients\lighthouse.exe --flag`:               {`C:\clients\lighthouse.exe`, "--flag"},
+		`client --name 'two words' --quote "say \"hi\""`: {"client", "--name", "two words", "--quote", `say "hi"`},
+		`client with\ space ""`:                          {"client", "with space", ""},
+		"  ":                                             nil,
+	}
+	for in, expected := range cases {
+		got, err := splitCommand(in)
+		if err != nil {
+			t.Errorf("failed to split %q: %v", in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("split %q into %q, expected %q", in, got, expected)
+		}
+	}
+	if _, err := splitCommand(`client "unterminated`); err == nil {
+		t.Error("expected an unterminated quote to fail")
+	}
+}
+
+func TestWindowsCommandLine(t *testing.T) {
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{`C:\clients\zrnt.exe`, "--pre", `C:\tmp\pre.ssz`}, `C:\clients\zrnt.exe --pre C:\tmp\pre.ssz`},
+		{[]string{`C:\Program Files\zrnt.exe`, ""}, `"C:\Program Files\zrnt.exe" ""`},
+		{[]string{"client", `say "hi"`}, `client "say \"hi\""`},
+		// backslashes are only escaped before a quote, including the closing quote
+		{[]string{"client", `C:\my dir\`}, `client "C:\my dir\\"`},
+		{[]string{"client", `a\"b c`}, `client "a\\\"b c"`},
+	}
+	for _, c := range cases {
+		if got := windowsCommandLine(c.args); got != c.expected {
+			t.Errorf("command line of %q: got %s, expected %s", c.args, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// maxConsensusKeys is the number of most recent task keys to remember post hashes of.
+const maxConsensusKeys = 10000
+
+const (
+	ConsensusAgrees     = "agrees"
+	ConsensusDisagrees  = "disagrees"
+	ConsensusNoMajority = "no-majority"
+)
+
+// consensusCache is a small local matrix of recent task keys and the post hash per client.
+type consensusCache struct {
+	mu sync.Mutex
+	// key -> client -> post hash
+	hashes map[string]map[string]string
+	// keys in order of first observation, to evict the oldest
+	order []string
+}
+
+func (w *Worker) consensus() *consensusCache {
+	w.consensusOnce.Do(func() {
+		w.consensusState = &consensusCache{hashes: make(map[string]map[string]string)}
+	})
+	return w.consensusState
+}
+
+// Observe records the post hash of a client for a task.
+func (c *consensusCache) Observe(key string, client string, postHash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.hashes[key]
+	if !ok {
+		if len(c.order) >= maxConsensusKeys {
+			delete(c.hashes, c.order[0])
+			c.order = c.order[1:]
+		}
+		m = make(map[string]string)
+		c.hashes[key] = m
+		c.order = append(c.order, key)
+	}
+	m[client] = postHash
+}
+
+// Check compares the post hash of a client with the majority of the other clients that ran the task,
+// and returns the verdict and the majority post hash. The verdict is empty if no other client results were observed.
+func (c *consensusCache) Check(key string, client string, postHash string) (verdict string, majority string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	votes := make(map[string]int)
+	for other, h := range c.hashes[key] {
+		if other != client {
+			votes[h]++
+		}
+	}
+	if len(votes) == 0 {
+		return "", ""
+	}
+	best, tie := 0, false
+	for h, n := range votes {
+		if n > best {
+			majority, best, tie = h, n, false
+		} else if n == best {
+			tie = true
+		}
+	}
+	if tie {
+		return ConsensusNoMajority, ""
+	}
+	if majority == postHash {
+		return ConsensusAgrees, majority
+	}
+	return ConsensusDisagrees, majority
+}
+
+// DivergenceMsg is a compact alert, published when a post hash disagrees with the consensus of other clients.
+type DivergenceMsg struct {
+	Type          string    `json:"type"`
+	WorkerID      string    `json:"worker-id"`
+	ClientName    string    `json:"client-name"`
+	ClientVersion string    `json:"client-version"`
+	SpecVersion   string    `json:"spec-version"`
+	SpecConfig    string    `json:"spec-config"`
+	Key           string    `json:"key"`
+	PostHash      string    `json:"post-hash"`
+	Expected      string    `json:"expected"`
+	Time          time.Time `json:"time"`
+}
+
+// alertDivergence publishes a divergence alert, if a divergence topic is configured. Failures are only logged.
+func (w *Worker) alertDivergence(tr *TransitionMsg, postHash string, expected string) {
+	log.Printf("ALERT: post hash %s of %s diverges from consensus %s", postHash, tr.Key, expected)
+	if w.DivergenceTopic == nil {
+		return
+	}
+	data, err := json.Marshal(&DivergenceMsg{
+		Type:          "divergence",
+		WorkerID:      w.WorkerID,
+		ClientName:    w.ClientName,
+		ClientVersion: w.ClientVersion,
+		SpecVersion:   tr.SpecVersion,
+		SpecConfig:    tr.SpecConfig,
+		Key:           tr.Key,
+		PostHash:      postHash,
+		Expected:      expected,
+		Time:          w.now(),
+	})
+	if err != nil {
+		log.Printf("failed to encode divergence alert: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	if err := w.DivergenceTopic.Publish(ctx, data); err != nil {
+		log.Printf("failed to publish divergence alert of %s: %v", tr.Key, err)
+	}
+}
+
+// RunResultsFeed records the results of other clients, as published to their results topics, until ctx is done.
+// Every message is acked, the feed is best-effort.
+func (w *Worker) RunResultsFeed(ctx context.Context, q TaskQueue) error {
+	return q.Receive(ctx, func(ctx context.Context, msg *QueueMessage) {
+		defer msg.Ack()
+		res, err := DecodeResult(msg.Data)
+		if err != nil {
+			log.Printf("failed to decode result from feed: %v", err)
+			return
+		}
+		if res.Key == "" || res.ClientName == "" || !res.Success {
+			return
+		}
+		w.consensus().Observe(res.Key, res.ClientName, res.PostHash)
+	})
+}
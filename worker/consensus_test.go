@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestConsensusCheck(t *testing.T) {
+	c := &consensusCache{hashes: make(map[string]map[string]string)}
+	if res, _ := c.Check("foo", "zrnt", "0xaa"); res != "" {
+		t.Errorf("expected no consensus without observations, got %q", res)
+	}
+	c.Observe("foo", "lighthouse", "0xaa")
+	c.Observe("foo", "prysm", "0xbb")
+	if res, _ := c.Check("foo", "zrnt", "0xaa"); res != ConsensusNoMajority {
+		t.Errorf("expected no majority, got %q", res)
+	}
+	c.Observe("foo", "artemis", "0xaa")
+	if res, _ := c.Check("foo", "zrnt", "0xaa"); res != ConsensusAgrees {
+		t.Errorf("expected agreement, got %q", res)
+	}
+	if res, _ := c.Check("foo", "zrnt", "0xcc"); res != ConsensusDisagrees {
+		t.Errorf("expected disagreement, got %q", res)
+	}
+}
+
+func TestResultsFeed(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	feed := NewMemQueue(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.worker.RunResultsFeed(ctx, feed)
+	postHash := fmt.Sprintf("0x%x", sha256.Sum256([]byte("preblock0")))
+	data, _ := json.Marshal(&ResultMsg{Success: true, PostHash: postHash, ClientName: "lighthouse", Key: "foo"})
+	if !feed.Push(data).Wait() {
+		t.Fatal("expected feed message to be acked")
+	}
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	if res := h.result(); res.Consensus != ConsensusAgrees {
+		t.Errorf("expected result to agree with consensus, got %q", res.Consensus)
+	}
+}
+
+func TestDivergenceAlert(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	alerts := NewMemQueue(1)
+	h.worker.DivergenceTopic = alerts
+	h.worker.consensus().Observe("foo", "lighthouse", "0xaa")
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	if res := h.result(); res.Consensus != ConsensusDisagrees {
+		t.Errorf("expected result to disagree with consensus, got %q", res.Consensus)
+	}
+	published := alerts.Published()
+	if len(published) != 1 {
+		t.Fatalf("expected 1 divergence alert, got %d", len(published))
+	}
+	var alert DivergenceMsg
+	if err := json.Unmarshal(published[0], &alert); err != nil {
+		t.Fatal(err)
+	}
+	if alert.Key != "foo" || alert.Expected != "0xaa" || alert.ClientName != "fakeclient" {
+		t.Errorf("unexpected alert: %+v", alert)
+	}
+}
@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// ControlConfigUpdate changes the dynamic config of the worker.
+	ControlConfigUpdate = "config-update"
+	// ControlCancel aborts in-flight tasks with the given key or campaign, and drops matching tasks delivered later.
+	ControlCancel = "cancel"
+)
+
+const (
+	// controlMaxAge is how old a control message may be. Older messages are ignored as replays,
+	// also by a restarted worker that does not know which messages it accepted before.
+	controlMaxAge = 10 * time.Minute
+	// controlMaxSkew is how far a control message may be issued in the future, for clock differences.
+	controlMaxSkew = time.Minute
+)
+
+// ControlMsg is a command from the coordinator, received on the control subscription.
+// The message data is signed with the coordinator key, the base64 ed25519 signature is in the "signature" attribute.
+type ControlMsg struct {
+	Type string `json:"type"`
+	// when the message was issued, signed with the message, to refuse replays of old messages
+	IssuedAt time.Time      `json:"issued-at"`
+	Config   *DynamicConfig `json:"config,omitempty"`
+	// task key or campaign to cancel
+	Key      string `json:"key,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+}
+
+// RunControl handles control messages from the queue, until ctx is canceled or the queue fails.
+// Messages that are not signed by the given key are ignored,
+// and so are messages that are not issued after the last accepted message, or more than controlMaxAge ago.
+func (w *Worker) RunControl(ctx context.Context, q TaskQueue, pubKey ed25519.PublicKey) error {
+	return q.Receive(ctx, func(ctx context.Context, message *QueueMessage) {
+		// Invalid control messages will not become valid by retrying, always ack.
+		defer message.Ack()
+		if err := verifySignature(message, pubKey); err != nil {
+			log.Printf("WARNING: ignoring control message: %v", err)
+			return
+		}
+		var msg ControlMsg
+		if err := json.Unmarshal(message.Data, &msg); err != nil {
+			log.Printf("WARNING: failed to decode control message JSON: %v (msg: %s)", err, message.Data)
+			return
+		}
+		if err := w.acceptControl(&msg); err != nil {
+			log.Printf("WARNING: ignoring %s control message: %v", msg.Type, err)
+			return
+		}
+		if err := w.handleControl(&msg); err != nil {
+			log.Printf("WARNING: failed to apply %s control message: %v", msg.Type, err)
+		}
+	})
+}
+
+// verifySignature checks the base64 ed25519 signature of the message data in the "signature" attribute.
+func verifySignature(message *QueueMessage, pubKey ed25519.PublicKey) error {
+	sigStr, ok := message.Attributes["signature"]
+	if !ok {
+		return fmt.Errorf("message is not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigStr)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %v", err)
+	}
+	if !ed25519.Verify(pubKey, message.Data, sig) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// acceptControl checks that the control message is recent, and newer than the last accepted message.
+func (w *Worker) acceptControl(msg *ControlMsg) error {
+	if msg.IssuedAt.IsZero() {
+		return fmt.Errorf("missing issued-at time")
+	}
+	now := w.now()
+	if age := now.Sub(msg.IssuedAt); age > controlMaxAge {
+		return fmt.Errorf("issued at %s, more than %s ago", msg.IssuedAt, controlMaxAge)
+	} else if -age > controlMaxSkew {
+		return fmt.Errorf("issued at %s, in the future", msg.IssuedAt)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !msg.IssuedAt.After(w.lastControl) {
+		return fmt.Errorf("issued at %s, not after the last accepted message (issued at %s)", msg.IssuedAt, w.lastControl)
+	}
+	w.lastControl = msg.IssuedAt
+	return nil
+}
+
+func (w *Worker) handleControl(msg *ControlMsg) error {
+	switch msg.Type {
+	case ControlConfigUpdate:
+		if msg.Config == nil {
+			return fmt.Errorf("missing config")
+		}
+		return w.ApplyDynamicConfig(*msg.Config, "control")
+	case ControlCancel:
+		if msg.Key == "" && msg.Campaign == "" {
+			return fmt.Errorf("missing key or campaign to cancel")
+		}
+		n := w.CancelTasks(msg.Key, msg.Campaign)
+		log.Printf("cancelled %d in-flight tasks (key: %q, campaign: %q)", n, msg.Key, msg.Campaign)
+		return nil
+	default:
+		return fmt.Errorf("unknown control message type %q", msg.Type)
+	}
+}
@@ -0,0 +1,160 @@
+package worker
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestControlConfigUpdate(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	control := NewMemQueue(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.worker.RunControl(ctx, control, pub)
+
+	send := func(key ed25519.PrivateKey, issued time.Time, cliCmd string) {
+		data, _ := json.Marshal(&ControlMsg{Type: ControlConfigUpdate, IssuedAt: issued, Config: &DynamicConfig{CliCmd: cliCmd}})
+		d := control.PushWithAttributes(data, map[string]string{
+			"signature": base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)),
+		})
+		if !d.Wait() {
+			t.Fatal("expected control message to be acked")
+		}
+	}
+	now := time.Now()
+	send(otherPriv, now, "spoofed")
+	if cmd := h.worker.cliCmd(); cmd == "spoofed" {
+		t.Fatal("applied config update with invalid signature")
+	}
+	send(priv, now.Add(-time.Hour), "stale")
+	if cmd := h.worker.cliCmd(); cmd == "stale" {
+		t.Fatal("applied config update issued too long ago")
+	}
+	send(priv, now.Add(-time.Minute), "previous")
+	send(priv, now, "updated")
+	if cmd := h.worker.cliCmd(); cmd != "updated" {
+		t.Fatalf("expected config update to be applied, got cli cmd %q", cmd)
+	}
+	// replays of accepted messages, and older messages, are ignored
+	send(priv, now.Add(-time.Minute), "previous")
+	send(priv, now, "updated-again")
+	if cmd := h.worker.cliCmd(); cmd != "updated" {
+		t.Fatalf("expected replayed config update to be ignored, got cli cmd %q", cmd)
+	}
+
+	rec := httptest.NewRecorder()
+	h.worker.HTTPHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+	var status WorkerStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Config.CliCmd != "updated" || len(status.ConfigUpdates) != 2 || status.ConfigUpdates[1].Source != "control" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if time.Since(status.ConfigUpdates[1].Time) > time.Minute {
+		t.Error("unexpected config update time")
+	}
+}
+
+func TestControlConcurrency(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.Concurrency = 4
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	control := NewMemQueue(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.worker.RunControl(ctx, control, pub)
+
+	send := func(issued time.Time, dc DynamicConfig) {
+		data, _ := json.Marshal(&ControlMsg{Type: ControlConfigUpdate, IssuedAt: issued, Config: &dc})
+		d := control.PushWithAttributes(data, map[string]string{
+			"signature": base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data)),
+		})
+		if !d.Wait() {
+			t.Fatal("expected control message to be acked")
+		}
+	}
+	now := time.Now()
+	send(now.Add(-time.Minute), DynamicConfig{Concurrency: 1, TransitionTimeout: "30s"})
+	if active := h.worker.ActiveDynamicConfig(); active.Concurrency != 1 || active.TransitionTimeout != "30s" {
+		t.Fatalf("expected concurrency and timeout to change, got %+v", active)
+	}
+	// the concurrency can't be raised above the startup limit
+	send(now, DynamicConfig{Concurrency: 8, TransitionTimeout: "1m"})
+	if active := h.worker.ActiveDynamicConfig(); active.Concurrency != 1 || active.TransitionTimeout != "30s" {
+		t.Fatalf("expected invalid config update to be ignored, got %+v", active)
+	}
+
+	// tasks still run with the lower concurrency
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	if res := h.result(); !res.Success {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+// waitingRunner blocks until the command is aborted.
+type waitingRunner struct {
+	started chan struct{}
+}
+
+func (r *waitingRunner) Run(ctx context.Context, c Command) (CommandResult, error) {
+	close(r.started)
+	<-ctx.Done()
+	return CommandResult{}, ctx.Err()
+}
+
+func TestControlCancel(t *testing.T) {
+	runner := &waitingRunner{started: make(chan struct{})}
+	h := newHarness(t, "", runner)
+	defer h.Close()
+
+	task := h.addTask("foo", []byte("pre"))
+	task.Campaign = "fuzz-1"
+	data, _ := json.Marshal(task)
+	h.start()
+	delivery := h.queue.Push(data)
+	<-runner.started
+
+	msg := &ControlMsg{Type: ControlCancel, Campaign: "fuzz-1"}
+	if err := h.worker.handleControl(msg); err != nil {
+		t.Fatal(err)
+	}
+	if !delivery.Wait() {
+		t.Fatal("expected cancelled task to be acked")
+	}
+	if len(h.queue.Published()) != 0 {
+		t.Error("expected no result for cancelled task")
+	}
+	if names := h.results.Names(); len(names) != 0 {
+		t.Errorf("expected no uploads for cancelled task, got %v", names)
+	}
+
+	// tasks of the cancelled campaign that are delivered later are dropped
+	if !h.queue.Push(data).Wait() {
+		t.Fatal("expected cancelled task to be acked")
+	}
+	if len(h.queue.Published()) != 0 {
+		t.Error("expected no result for cancelled task")
+	}
+}
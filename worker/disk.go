@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+)
+
+// DiskStatus describes the disk usage of the task workspaces.
+type DiskStatus struct {
+	// total size of the workspaces of running and completed (not yet removed) tasks
+	WorkspaceBytes int64 `json:"workspace-bytes"`
+	// free space on the volume of the work dirs, 0 if unknown
+	FreeBytes uint64 `json:"free-bytes"`
+	// workspaces waiting to be removed
+	PendingCleanup int `json:"pending-cleanup"`
+	// number of failed workspace removals
+	CleanupFailures int64           `json:"cleanup-failures"`
+	Tasks           []TaskWorkspace `json:"tasks"`
+}
+
+// TaskWorkspace is the disk usage of the workspace of a running task.
+type TaskWorkspace struct {
+	Key       string `json:"key"`
+	ResultKey string `json:"result-key"`
+	Bytes     int64  `json:"bytes"`
+}
+
+func (w *Worker) DiskStatus() DiskStatus {
+	var status DiskStatus
+	w.tasksMu.Lock()
+	for _, t := range w.inflight {
+		status.Tasks = append(status.Tasks, TaskWorkspace{Key: t.msg.Key, ResultKey: t.msg.ResultKey})
+	}
+	w.tasksMu.Unlock()
+	for i := range status.Tasks {
+		tr := TransitionMsg{Key: status.Tasks[i].Key, ResultKey: status.Tasks[i].ResultKey, WorkDir: w.workDir()}
+		status.Tasks[i].Bytes = dirSize(tr.DirPath())
+		status.WorkspaceBytes += status.Tasks[i].Bytes
+	}
+	j := w.janitor()
+	j.mu.Lock()
+	for _, ws := range j.completed {
+		status.WorkspaceBytes += ws.size
+	}
+	status.PendingCleanup = len(j.completed)
+	status.CleanupFailures = j.failures
+	j.mu.Unlock()
+	if free, err := freeDiskBytes(w.workDir()); err != nil {
+		log.Printf("cannot get free disk space: %v", err)
+	} else {
+		status.FreeBytes = free
+	}
+	return status
+}
+
+// workDir returns the directory the task workspaces are in.
+func (w *Worker) workDir() string {
+	if w.WorkDir != "" {
+		return w.WorkDir
+	}
+	return os.TempDir()
+}
+
+// checkFreeDisk returns an error if the volume of the work dir has less than MinFreeDisk bytes free.
+// If the free space is unknown, the check passes.
+func (w *Worker) checkFreeDisk() error {
+	if w.MinFreeDisk <= 0 {
+		return nil
+	}
+	free, err := freeDiskBytes(w.workDir())
+	if err != nil {
+		log.Printf("cannot get free disk space, not checking it: %v", err)
+		return nil
+	}
+	if free < uint64(w.MinFreeDisk) {
+		return fmt.Errorf("work dir %s has %d bytes free, less than the minimum of %d bytes", w.workDir(), free, w.MinFreeDisk)
+	}
+	return nil
+}
+
+// PublishDiskMetrics exposes the disk usage as expvar metrics, served on /debug/vars.
+// Can only be called once per process.
+func (w *Worker) PublishDiskMetrics() {
+	expvar.Publish("workspace_bytes", expvar.Func(func() interface{} {
+		return w.DiskStatus().WorkspaceBytes
+	}))
+	expvar.Publish("disk_free_bytes", expvar.Func(func() interface{} {
+		free, _ := freeDiskBytes(w.workDir())
+		return free
+	}))
+	expvar.Publish("cleanup_failures", expvar.Func(func() interface{} {
+		j := w.janitor()
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		return j.failures
+	}))
+}
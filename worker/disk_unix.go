@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package worker
+
+import "syscall"
+
+// freeDiskBytes returns the space available to unprivileged users on the volume of the path.
+func freeDiskBytes(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
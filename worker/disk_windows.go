@@ -0,0 +1,27 @@
+package worker
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// freeDiskBytes returns the space available to the user on the volume of the path.
+func freeDiskBytes(path string) (uint64, error) {
+	kernel32, err := syscall.LoadDLL("kernel32.dll")
+	if err != nil {
+		return 0, err
+	}
+	proc, err := kernel32.FindProc("GetDiskFreeSpaceExW")
+	if err != nil {
+		return 0, err
+	}
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if r, _, err := proc.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&free)), 0, 0); r == 0 {
+		return 0, err
+	}
+	return free, nil
+}
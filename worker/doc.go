@@ -0,0 +1,5 @@
+// Package worker receives transition tasks, runs them with an Ethereum 2.0 client, and publishes the results.
+//
+// The Worker only depends on interfaces: BlobStore for inputs and results, TaskQueue and Publisher for tasks and results,
+// CommandRunner for client processes, and Clock for time. MemStore, MemQueue, FakeRunner and FakeClock implement them for tests.
+package worker
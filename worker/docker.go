@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// DockerRunner runs commands inside a container of a client image, without network access.
+// The work dir of the command is bind-mounted at the same path, so the paths in the arguments stay valid.
+type DockerRunner struct {
+	// the docker CLI binary
+	Docker string
+	Image  string
+	// CPU and memory limits of the container, in docker run notation (e.g. "2", "4g"). Unlimited if empty.
+	CPUs   string
+	Memory string
+}
+
+func (r *DockerRunner) args(name string, c Command) []string {
+	args := []string{"run", "--rm", "--name", name, "--network", "none"}
+	// write the outputs as the worker user, so the worker can clean them up
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 && gid >= 0 {
+		args = append(args, "--user", strconv.Itoa(uid)+":"+strconv.Itoa(gid))
+	}
+	if r.CPUs != "" {
+		args = append(args, "--cpus", r.CPUs)
+	}
+	if r.Memory != "" {
+		// no swap on top of the memory limit
+		args = append(args, "--memory", r.Memory, "--memory-swap", r.Memory)
+	}
+	if c.WorkDir != "" {
+		args = append(args, "--volume", c.WorkDir+":"+c.WorkDir)
+	}
+	for _, env := range c.Env {
+		args = append(args, "--env", env)
+	}
+	if c.Stdin != nil {
+		args = append(args, "--interactive")
+	}
+	image := r.Image
+	if c.Image != "" {
+		image = c.Image
+	}
+	args = append(args, image, c.Name)
+	return append(args, c.Args...)
+}
+
+func (r *DockerRunner) Run(ctx context.Context, c Command) (CommandResult, error) {
+	name := "muskoka-" + uniqueID()[:16]
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// killing the docker CLI does not stop the container
+			killCtx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+			defer cancel()
+			if err := exec.CommandContext(killCtx, r.Docker, "kill", name).Run(); err != nil {
+				log.Printf("failed to kill container %s: %v", name, err)
+			}
+		case <-stopped:
+		}
+	}()
+	res, err := ExecRunner{}.Run(ctx, Command{
+		Name:   r.Docker,
+		Args:   r.args(name, c),
+		Stdin:  c.Stdin,
+		Stdout: c.Stdout,
+		Stderr: c.Stderr,
+	})
+	// the usage of the docker CLI says nothing about the client in the container
+	res.Usage = nil
+	return res, err
+}
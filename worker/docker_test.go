@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDockerRunner(t *testing.T) {
+	// echo the docker arguments instead of running a container
+	r := &DockerRunner{Docker: "echo", Image: "zrnt:latest", CPUs: "2", Memory: "4g"}
+	var out strings.Builder
+	res, err := r.Run(context.Background(), Command{
+		Name: "zcli", Args: []string{"transition", "--pre", "/tmp/foo/pre.ssz"}, WorkDir: "/tmp/foo",
+		Stdout: &out, Stderr: &out,
+	})
+	if err != nil || res.ExitCode != 0 {
+		t.Fatalf("unexpected result: %v, %v", res, err)
+	}
+	args := out.String()
+	for _, expected := range []string{"run --rm --name muskoka-", "--network none", "--cpus 2", "--memory 4g --memory-swap 4g",
+		"--volume /tmp/foo:/tmp/foo zrnt:latest zcli transition --pre /tmp/foo/pre.ssz"} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("expected %q in docker arguments: %s", expected, args)
+		}
+	}
+}
+
+func TestDockerRunnerImage(t *testing.T) {
+	r := &DockerRunner{Docker: "echo", Image: "zrnt:latest"}
+	var out strings.Builder
+	image := "zrnt@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	if _, err := r.Run(context.Background(), Command{Name: "zcli", Image: image, Stdout: &out, Stderr: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), image+" zcli") || strings.Contains(out.String(), "zrnt:latest") {
+		t.Errorf("expected the image of the command to run: %s", out.String())
+	}
+}
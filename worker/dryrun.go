@@ -0,0 +1,159 @@
+package worker
+
+import (
+	"bytes"
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// dryRunCheck is the outcome of a single check of a dry run.
+type dryRunCheck struct {
+	name   string
+	detail string
+	err    error
+}
+
+// DryRunReport collects the checks of a dry run, see --dry-run.
+type DryRunReport struct {
+	checks []dryRunCheck
+}
+
+func (r *DryRunReport) Check(name string, detail string, err error) {
+	r.checks = append(r.checks, dryRunCheck{name: name, detail: detail, err: err})
+}
+
+// Print writes a line per check, and returns true if all checks passed.
+func (r *DryRunReport) Print(out io.Writer) bool {
+	ok := true
+	for _, c := range r.checks {
+		if c.err != nil {
+			ok = false
+			fmt.Fprintf(out, "FAIL %s: %v\n", c.name, c.err)
+		} else if c.detail != "" {
+			fmt.Fprintf(out, "OK   %s: %s\n", c.name, c.detail)
+		} else {
+			fmt.Fprintf(out, "OK   %s\n", c.name)
+		}
+	}
+	return ok
+}
+
+// dryRunProbe is the object written to the results bucket to check write permissions.
+const dryRunProbe = "_dry-run"
+
+// DryRun checks the storage permissions, the client CLIs and the temp dir of the worker, without processing tasks.
+// It writes a small probe object to the results bucket.
+func (w *Worker) DryRun(report *DryRunReport) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	// the inputs bucket must be readable: reading a missing object must fail with "not found", not with a permission error
+	inputs := w.inputs()
+	if r, err := inputs.NewReader(ctx, dryRunProbe); err == nil {
+		r.Close()
+		report.Check("read inputs bucket", inputs.URL(""), nil)
+	} else if isNotFound(err) {
+		report.Check("read inputs bucket", inputs.URL(""), nil)
+	} else {
+		report.Check("read inputs bucket", "", fmt.Errorf("%s: %v", inputs.URL(""), err))
+	}
+
+	results := w.results()
+	probe := fmt.Sprintf("%s/%s", dryRunProbe, w.WorkerID)
+	report.Check("write results bucket", results.URL(probe), w.writeProbe(ctx, results, probe))
+
+	// the binary of every client must resolve, and pass the preflight check
+	for _, c := range w.taskClients() {
+		detail := "version " + c.version
+		if _, docker := w.Runner.(*DockerRunner); !docker {
+			if fields, err := splitCommand(c.cliCmd); err == nil && len(fields) > 0 {
+				if p, err := exec.LookPath(fields[0]); err == nil {
+					detail = p + ", " + detail
+				}
+			}
+		}
+		report.Check("client "+c.name, detail, w.preflightCmd(c.cliCmd))
+	}
+
+	dirs := []string{w.workDir()}
+	if w.CacheDir != "" {
+		dirs = append(dirs, w.CacheDir)
+	}
+	for _, dir := range dirs {
+		report.Check("writable dir", dir, checkWritable(dir))
+	}
+}
+
+// writeProbe writes the probe object, and reads it back.
+func (w *Worker) writeProbe(ctx context.Context, store BlobStore, name string) error {
+	data := []byte(time.Now().UTC().Format(time.RFC3339))
+	out := store.NewWriter(ctx, name)
+	if _, err := out.Write(data); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("failed to write %s: %v", store.URL(name), err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", store.URL(name), err)
+	}
+	r, err := store.NewReader(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to read back %s: %v", store.URL(name), err)
+	}
+	defer r.Close()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read back %s: %v", store.URL(name), err)
+	}
+	if !bytes.Equal(got, data) {
+		return fmt.Errorf("read back different contents from %s", store.URL(name))
+	}
+	return nil
+}
+
+// checkWritable creates and removes a file in the dir, creating the dir if it does not exist.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".muskoka-dry-run")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// isNotFound returns true if the error of a storage read means the object does not exist.
+func isNotFound(err error) bool {
+	if err == storage.ErrObjectNotExist || os.IsNotExist(err) {
+		return true
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == "NoSuchKey" || aerr.Code() == "NotFound"
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "404") || strings.Contains(msg, "does not exist")
+}
+
+// CheckPubsubTopic checks that the topic exists.
+func CheckPubsubTopic(client *pubsub.Client, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+	ok, err := client.Topic(name).Exists(ctx)
+	if err != nil {
+		return fmt.Errorf("could not check if topic %s exists: %v", name, err)
+	}
+	if !ok {
+		return fmt.Errorf("topic %s does not exist", name)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muskoka-dry-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script, err := filepath.Abs("testdata/fake_client.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := NewMemStore("results")
+	w := &Worker{
+		Config: Config{
+			CliCmd:           "sh " + script,
+			CliPreflightArgs: "--help",
+			ClientName:       "fakeclient",
+			ClientVersion:    "v0.0.1_abc",
+			WorkerID:         "test",
+			CacheDir:         filepath.Join(dir, "cache"),
+		},
+		Inputs:  NewMemStore("inputs"),
+		Results: results,
+		Runner:  ExecRunner{},
+	}
+	report := &DryRunReport{}
+	w.DryRun(report)
+	var out bytes.Buffer
+	if !report.Print(&out) {
+		t.Fatalf("expected all checks to pass:\n%s", out.String())
+	}
+	if _, ok := results.Get("_dry-run/test"); !ok {
+		t.Error("expected a probe object in the results bucket")
+	}
+
+	w.Inputs = deniedStore{results}
+	w.CliCmd = "missing-client-binary"
+	report = &DryRunReport{}
+	w.DryRun(report)
+	out.Reset()
+	if report.Print(&out) {
+		t.Fatal("expected failed checks")
+	}
+	for _, check := range []string{"FAIL read inputs bucket", "FAIL client fakeclient"} {
+		if !strings.Contains(out.String(), check) {
+			t.Errorf("expected %q in the report:\n%s", check, out.String())
+		}
+	}
+}
+
+// deniedStore fails all reads with a permission error.
+type deniedStore struct {
+	BlobStore
+}
+
+func (deniedStore) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("403 Forbidden")
+}
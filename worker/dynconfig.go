@@ -0,0 +1,228 @@
+package worker
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DynamicConfig is the part of the worker configuration that the coordinator can change at runtime.
+// Empty fields are left unchanged.
+type DynamicConfig struct {
+	CliCmd        string `json:"cli-cmd,omitempty"`
+	InputsBucket  string `json:"inputs-bucket,omitempty"`
+	ResultsBucket string `json:"results-bucket,omitempty"`
+	// The maximum number of tasks to process at the same time, see Config.Concurrency.
+	// Can only be changed if the worker started with a concurrency limit, and not above that limit,
+	// since the number of messages received at a time is sized by it.
+	Concurrency int `json:"concurrency,omitempty"`
+	// The time limit of a transition, e.g. "5m", see Config.TransitionTimeout. "0s" for no limit.
+	TransitionTimeout string `json:"transition-timeout,omitempty"`
+}
+
+// ConfigSource loads the raw JSON of a DynamicConfig.
+type ConfigSource func(ctx context.Context) ([]byte, error)
+
+// NewConfigSource creates a source for the given location: a gs://<bucket>/<object> path, or a http(s) URL.
+func NewConfigSource(location string, storageClient *storage.Client) (ConfigSource, error) {
+	if strings.HasPrefix(location, "gs://") {
+		if storageClient == nil {
+			return nil, fmt.Errorf("gs:// config locations require gcs storage")
+		}
+		parts := strings.SplitN(strings.TrimPrefix(location, "gs://"), "/", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("expected gs://<bucket>/<object>, got %s", location)
+		}
+		obj := storageClient.Bucket(parts[0]).Object(parts[1])
+		return func(ctx context.Context) ([]byte, error) {
+			r, err := obj.NewReader(ctx)
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return ioutil.ReadAll(r)
+		}, nil
+	}
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return func(ctx context.Context) ([]byte, error) {
+			req, err := http.NewRequest("GET", location, nil)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+			}
+			return ioutil.ReadAll(resp.Body)
+		}, nil
+	}
+	return nil, fmt.Errorf("unrecognized config location: %s", location)
+}
+
+// LoadDynamicConfig fetches the config from the source, and applies it to the worker.
+func (w *Worker) LoadDynamicConfig(src ConfigSource) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	data, err := src(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch config: %v", err)
+	}
+	var dc DynamicConfig
+	if err := json.Unmarshal(data, &dc); err != nil {
+		return fmt.Errorf("failed to decode config: %v", err)
+	}
+	return w.ApplyDynamicConfig(dc, "dynamic-config")
+}
+
+// RefreshDynamicConfig reloads the config from the source every interval, until ctx is canceled.
+func (w *Worker) RefreshDynamicConfig(ctx context.Context, src ConfigSource, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.LoadDynamicConfig(src); err != nil {
+				log.Printf("failed to refresh dynamic config, keeping current config: %v", err)
+			}
+		}
+	}
+}
+
+// ConfigUpdate records a change of the dynamic config, for auditability.
+type ConfigUpdate struct {
+	Time   time.Time     `json:"time"`
+	Source string        `json:"source"`
+	Config DynamicConfig `json:"config"`
+}
+
+// maxConfigUpdates is the number of most recent config updates to remember.
+const maxConfigUpdates = 20
+
+// ApplyDynamicConfig changes the config of the worker. Tasks that are already running are not affected,
+// but a lower concurrency delays new tasks until enough running tasks are done.
+// Nothing is changed if any of the values is invalid. Updates that change a value are recorded,
+// the source describes where the update came from.
+func (w *Worker) ApplyDynamicConfig(dc DynamicConfig, source string) error {
+	sched := w.taskScheduler()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if (dc.InputsBucket != "" && dc.InputsBucket != w.InputsBucket && w.OpenStore == nil && w.OpenInputs == nil) ||
+		(dc.ResultsBucket != "" && dc.ResultsBucket != w.ResultsBucket && w.OpenStore == nil && w.OpenResults == nil) {
+		return fmt.Errorf("cannot change buckets, worker does not support opening stores")
+	}
+	if dc.Concurrency < 0 {
+		return fmt.Errorf("invalid concurrency %d", dc.Concurrency)
+	}
+	if dc.Concurrency > 0 && dc.Concurrency != w.Concurrency {
+		if sched == nil {
+			return fmt.Errorf("cannot change concurrency, worker was started without concurrency limit")
+		}
+		if dc.Concurrency > sched.limit {
+			return fmt.Errorf("cannot raise concurrency to %d, above the limit of %d the worker was started with", dc.Concurrency, sched.limit)
+		}
+	}
+	var timeout time.Duration
+	if dc.TransitionTimeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(dc.TransitionTimeout); err != nil {
+			return fmt.Errorf("invalid transition timeout: %v", err)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("invalid transition timeout %s", timeout)
+		}
+	}
+	changed := false
+	if dc.CliCmd != "" && dc.CliCmd != w.CliCmd {
+		log.Printf("dynamic config: changing cli cmd from %q to %q", w.CliCmd, dc.CliCmd)
+		w.CliCmd = dc.CliCmd
+		changed = true
+	}
+	if dc.InputsBucket != "" && dc.InputsBucket != w.InputsBucket {
+		log.Printf("dynamic config: changing inputs bucket from %s to %s", w.InputsBucket, dc.InputsBucket)
+		w.InputsBucket = dc.InputsBucket
+		if w.OpenInputs != nil {
+			w.Inputs = w.OpenInputs(dc.InputsBucket)
+		} else {
+			w.Inputs = w.OpenStore(dc.InputsBucket)
+		}
+		changed = true
+	}
+	if dc.ResultsBucket != "" && dc.ResultsBucket != w.ResultsBucket {
+		log.Printf("dynamic config: changing results bucket from %s to %s", w.ResultsBucket, dc.ResultsBucket)
+		w.ResultsBucket = dc.ResultsBucket
+		if w.OpenResults != nil {
+			w.Results = w.OpenResults(dc.ResultsBucket)
+		} else {
+			w.Results = w.OpenStore(dc.ResultsBucket)
+		}
+		changed = true
+	}
+	if dc.Concurrency > 0 && dc.Concurrency != w.Concurrency {
+		log.Printf("dynamic config: changing concurrency from %d to %d", w.Concurrency, dc.Concurrency)
+		w.Concurrency = dc.Concurrency
+		sched.setConcurrency(dc.Concurrency)
+		changed = true
+	}
+	if dc.TransitionTimeout != "" && timeout != w.TransitionTimeout {
+		log.Printf("dynamic config: changing transition timeout from %s to %s", w.TransitionTimeout, timeout)
+		w.TransitionTimeout = timeout
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	w.configUpdates = append(w.configUpdates, ConfigUpdate{Time: w.now(), Source: source, Config: dc})
+	if len(w.configUpdates) > maxConfigUpdates {
+		w.configUpdates = w.configUpdates[len(w.configUpdates)-maxConfigUpdates:]
+	}
+	return nil
+}
+
+// ActiveDynamicConfig returns the current values of the dynamic config.
+func (w *Worker) ActiveDynamicConfig() DynamicConfig {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return DynamicConfig{
+		CliCmd:            w.CliCmd,
+		InputsBucket:      w.InputsBucket,
+		ResultsBucket:     w.ResultsBucket,
+		Concurrency:       w.Concurrency,
+		TransitionTimeout: w.TransitionTimeout.String(),
+	}
+}
+
+func (w *Worker) cliCmd() string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.CliCmd
+}
+
+func (w *Worker) inputs() BlobStore {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.Inputs
+}
+
+func (w *Worker) results() BlobStore {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.Results
+}
+
+func (w *Worker) transitionTimeout() time.Duration {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.TransitionTimeout
+}
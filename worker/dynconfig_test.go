@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyDynamicConfig(t *testing.T) {
+	w := &Worker{Config: Config{CliCmd: "client", Concurrency: 4, TransitionTimeout: time.Minute}}
+	if err := w.ApplyDynamicConfig(DynamicConfig{Concurrency: 2, TransitionTimeout: "5m"}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if w.taskScheduler().capacity != 2 || w.transitionTimeout() != 5*time.Minute {
+		t.Errorf("expected concurrency and timeout to change, got %d and %s", w.taskScheduler().capacity, w.transitionTimeout())
+	}
+	// updates without changes are not recorded
+	if err := w.ApplyDynamicConfig(DynamicConfig{CliCmd: "client", Concurrency: 2}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(w.configUpdates); n != 1 {
+		t.Errorf("expected 1 recorded update, got %d", n)
+	}
+
+	// nothing is applied if any value is invalid
+	for _, dc := range []DynamicConfig{
+		{CliCmd: "other", Concurrency: 8},
+		{CliCmd: "other", Concurrency: -1},
+		{CliCmd: "other", TransitionTimeout: "soon"},
+		{CliCmd: "other", TransitionTimeout: "-1s"},
+	} {
+		if err := w.ApplyDynamicConfig(dc, "test"); err == nil {
+			t.Errorf("expected config %+v to be rejected", dc)
+		}
+	}
+	if active := w.ActiveDynamicConfig(); active.CliCmd != "client" || active.Concurrency != 2 || active.TransitionTimeout != "5m0s" {
+		t.Errorf("unexpected active config: %+v", active)
+	}
+
+	// a timeout of 0 removes the limit
+	if err := w.ApplyDynamicConfig(DynamicConfig{TransitionTimeout: "0s"}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if w.transitionTimeout() != 0 || len(w.configUpdates) != 2 {
+		t.Errorf("expected the timeout to be removed, got %s", w.transitionTimeout())
+	}
+
+	unlimited := &Worker{}
+	if err := unlimited.ApplyDynamicConfig(DynamicConfig{Concurrency: 2}, "test"); err == nil {
+		t.Error("expected concurrency change of a worker without concurrency limit to be rejected")
+	}
+}
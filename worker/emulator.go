@@ -0,0 +1,26 @@
+package worker
+
+import (
+	"fmt"
+	"google.golang.org/api/option"
+	"os"
+	"strings"
+)
+
+// UsePubsubEmulator makes the pubsub client connect to the Pub/Sub emulator at the host (e.g. "localhost:8085"),
+// without credentials. The client reads the host from PUBSUB_EMULATOR_HOST.
+func UsePubsubEmulator(host string) {
+	_ = os.Setenv("PUBSUB_EMULATOR_HOST", host)
+}
+
+// GCSEmulatorOptions returns the storage client options to use a GCS emulator (e.g. fake-gcs-server over http)
+// at the host, without credentials. The storage client reads objects from the STORAGE_EMULATOR_HOST,
+// and all other requests go to the JSON API endpoint of the emulator.
+func GCSEmulatorOptions(host string) []option.ClientOption {
+	host = strings.TrimPrefix(host, "http://")
+	_ = os.Setenv("STORAGE_EMULATOR_HOST", host)
+	return []option.ClientOption{
+		option.WithEndpoint(fmt.Sprintf("http://%s/storage/v1/", host)),
+		option.WithoutAuthentication(),
+	}
+}
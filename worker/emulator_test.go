@@ -0,0 +1,129 @@
+//go:build integration
+// +build integration
+
+package worker
+
+import (
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestEmulators runs the worker loop against the Pub/Sub emulator and a GCS emulator,
+// see `make emulators` and `make test-integration`.
+func TestEmulators(t *testing.T) {
+	pubsubHost, storageHost := os.Getenv("PUBSUB_EMULATOR_HOST"), os.Getenv("STORAGE_EMULATOR_HOST")
+	if pubsubHost == "" || storageHost == "" {
+		t.Skip("PUBSUB_EMULATOR_HOST and STORAGE_EMULATOR_HOST are required")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	suffix := uniqueID()[:8]
+
+	storageClient, err := storage.NewClient(ctx, GCSEmulatorOptions(storageHost)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs, results := "inputs-"+suffix, "results-"+suffix
+	for _, name := range []string{inputs, results} {
+		if err := storageClient.Bucket(name).Create(ctx, "muskoka", nil); err != nil {
+			t.Fatalf("failed to create bucket %s: %v", name, err)
+		}
+	}
+	task := TransitionMsg{Blocks: 1, SpecVersion: "v0.8.3", SpecConfig: "minimal", Key: "foo"}
+	for name, data := range map[string]string{"pre.ssz": "pre", "block_0.ssz": "block0"} {
+		out := storageClient.Bucket(inputs).Object(task.InputsBucketPathStart() + "/" + name).NewWriter(ctx)
+		if _, err := out.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pubsubClient, err := pubsub.NewClient(ctx, "muskoka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasksTopic, err := pubsubClient.CreateTopic(ctx, "tasks-"+suffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resultsTopic, err := pubsubClient.CreateTopic(ctx, "results~fakeclient-"+suffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subId := "v0.8.3~minimal~fakeclient~" + suffix
+	if _, err := pubsubClient.CreateSubscription(ctx, subId, pubsub.SubscriptionConfig{Topic: tasksTopic}); err != nil {
+		t.Fatal(err)
+	}
+	resultsSub, err := pubsubClient.CreateSubscription(ctx, "check-"+suffix, pubsub.SubscriptionConfig{Topic: resultsTopic})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &pubsubBackend{client: pubsubClient}
+	q, err := backend.TaskQueue(subId, resultsTopic.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := filepath.Abs("testdata/fake_client.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Worker{
+		Config: Config{
+			CliCmd:        "sh " + script,
+			SpecVersion:   "v0.8.3",
+			SpecConfigs:   []string{"minimal"},
+			ClientName:    "fakeclient",
+			ClientVersion: "v0.0.1_abc",
+			CleanupTmp:    true,
+		},
+		Inputs:  newGCSStore(storageClient, inputs),
+		Results: newGCSStore(storageClient, results),
+		Queue:   q,
+		Runner:  ExecRunner{},
+	}
+	workerCtx, stopWorker := context.WithCancel(ctx)
+	defer stopWorker()
+	go func() {
+		_ = w.Run(workerCtx)
+	}()
+
+	data, err := json.Marshal(&task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tasksTopic.Publish(ctx, &pubsub.Message{Data: data}).Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	resCh := make(chan ResultMsg, 1)
+	receiveCtx, stopReceive := context.WithCancel(ctx)
+	err = resultsSub.Receive(receiveCtx, func(ctx context.Context, m *pubsub.Message) {
+		m.Ack()
+		var res ResultMsg
+		if err := json.Unmarshal(m.Data, &res); err != nil {
+			t.Errorf("invalid result message: %v", err)
+		}
+		resCh <- res
+		stopReceive()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case res := <-resCh:
+		if !res.Success || res.Key != "foo" {
+			t.Errorf("unexpected result: %+v", res)
+		}
+	default:
+		t.Fatal("no result received")
+	}
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidEnvName checks if the name is a portable environment variable name.
+func ValidEnvName(name string) bool {
+	return envNamePattern.MatchString(name)
+}
+
+// envAllowed checks if tasks may set the environment variable: if it is in the TaskEnvAllowlist,
+// or matches an entry ending with "*" by prefix, e.g. "ZRNT_*".
+func (w *Worker) envAllowed(name string) bool {
+	for _, allowed := range w.TaskEnvAllowlist {
+		if name == allowed || (strings.HasSuffix(allowed, "*") && strings.HasPrefix(name, strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTaskEnv checks if the worker can run the client with the environment variables of the task, if any.
+func (w *Worker) checkTaskEnv(tr *TransitionMsg) error {
+	if len(tr.Env) == 0 {
+		return nil
+	}
+	switch w.Runner.(type) {
+	case *ServerRunner, *GRPCRunner:
+		return fmt.Errorf("the client runner does not support task environment variables")
+	}
+	for name := range tr.Env {
+		if !ValidEnvName(name) {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+		if !w.envAllowed(name) {
+			return fmt.Errorf("environment variable %s is not allowed", name)
+		}
+	}
+	return nil
+}
+
+// clientEnv returns the environment variables of a client command, as KEY=value:
+// the ClientEnv of the worker, overridden by the variables of the command builder, overridden by the variables of the task.
+func (w *Worker) clientEnv(specEnv []string, taskEnv map[string]string) []string {
+	var out []string
+	index := make(map[string]int)
+	set := func(kv string) {
+		name := kv
+		if i := strings.Index(kv, "="); i >= 0 {
+			name = kv[:i]
+		}
+		if i, ok := index[name]; ok {
+			out[i] = kv
+			return
+		}
+		index[name] = len(out)
+		out = append(out, kv)
+	}
+	for _, kv := range sortedEnv(w.ClientEnv) {
+		set(kv)
+	}
+	for _, kv := range specEnv {
+		set(kv)
+	}
+	for _, kv := range sortedEnv(taskEnv) {
+		set(kv)
+	}
+	return out
+}
+
+// sortedEnv returns the variables as KEY=value, sorted by name.
+func sortedEnv(env map[string]string) []string {
+	out := make([]string, 0, len(env))
+	for k, v := range env {
+		out = append(out, k+"="+v)
+	}
+	sort.Strings(out)
+	return out
+}
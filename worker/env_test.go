@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTaskEnv(t *testing.T) {
+	runner := &FakeRunner{}
+	h := newHarness(t, "", runner)
+	defer h.Close()
+	h.worker.ClientEnv = map[string]string{"LOG_LEVEL": "info", "PRESET": "minimal"}
+	h.worker.TaskEnvAllowlist = []string{"LOG_LEVEL", "ZRNT_*"}
+
+	msg := h.addTask("foo", []byte("pre"), []byte("block0"))
+	msg.Env = map[string]string{"LOG_LEVEL": "debug", "ZRNT_MEM": "2g"}
+	if !h.process(msg) {
+		t.Fatal("expected task to be acked")
+	}
+	calls := runner.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(calls))
+	}
+	expected := []string{"LOG_LEVEL=debug", "PRESET=minimal", "ZRNT_MEM=2g"}
+	if !reflect.DeepEqual(calls[0].Env, expected) {
+		t.Errorf("expected env %v, got %v", expected, calls[0].Env)
+	}
+
+	// variables outside of the allowlist are unsupported, and acked by default
+	msg = h.addTask("bar", []byte("pre"), []byte("block0"))
+	msg.Env = map[string]string{"PATH": "/tmp"}
+	if !h.process(msg) {
+		t.Fatal("expected unsupported task to be acked")
+	}
+	if len(runner.Calls()) != 1 {
+		t.Error("expected task with a disallowed variable not to run")
+	}
+}
+
+func TestClientEnv(t *testing.T) {
+	w := &Worker{Config: Config{ClientEnv: map[string]string{"B": "1", "A": "1"}}}
+	out := w.clientEnv([]string{"C=2", "A=2"}, map[string]string{"C": "3"})
+	expected := []string{"A=2", "B=1", "C=3"}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("expected %v, got %v", expected, out)
+	}
+	if out := (&Worker{}).clientEnv(nil, nil); len(out) != 0 {
+		t.Errorf("expected no env, got %v", out)
+	}
+}
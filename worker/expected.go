@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// hasExpectedPost returns true if the task carries an expected post state to compare the result with.
+func (tr *TransitionMsg) hasExpectedPost() bool {
+	return tr.ExpectedPostHash != "" || tr.ExpectedPost != ""
+}
+
+// matchesExpected compares the flat hash of the produced post state with the expected post state of the task.
+// Nil is returned if the task has no expected post state, or if the expected post state could not be loaded.
+func (w *Worker) matchesExpected(ctx context.Context, tr *TransitionMsg, post postHashes) *bool {
+	if !tr.hasExpectedPost() {
+		return nil
+	}
+	expected := strings.ToLower(tr.ExpectedPostHash)
+	if expected == "" {
+		h, err := w.hashInputObject(ctx, tr.ExpectedPost)
+		if err != nil {
+			log.Printf("failed to load expected post state %s of %s: %v", tr.ExpectedPost, tr.Key, err)
+			return nil
+		}
+		expected = fmt.Sprintf("0x%x", h)
+	}
+	// without a post state the flat hash is zero, which never matches
+	matches := post.Flat != [32]byte{} && fmt.Sprintf("0x%x", post.Flat) == expected
+	return &matches
+}
+
+// hashInputObject streams the object from the inputs store, and returns its sha256 hash.
+func (w *Worker) hashInputObject(ctx context.Context, bucketpath string) (hash [32]byte, err error) {
+	err = w.retryStorage(ctx, "download "+bucketpath, func() error {
+		release, err := w.storageLimits().acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+		defer cancel()
+		r, err := w.inputs().NewReader(ctx, bucketpath)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		copy(hash[:], h.Sum(nil))
+		return nil
+	})
+	return hash, err
+}
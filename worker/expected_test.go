@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+func TestMatchesExpected(t *testing.T) {
+	fake := &FakeRunner{OutputFiles: map[string][]byte{"--post": []byte("post")}}
+	h := newHarness(t, "", fake)
+	defer h.Close()
+
+	h.inputs.Put("expected/foo/post.ssz", []byte("post"))
+	h.inputs.Put("expected/bar/post.ssz", []byte("other"))
+	tasks := []struct {
+		key      string
+		hash     string
+		path     string
+		expected *bool
+	}{
+		{key: "none"},
+		{key: "hash", hash: fmt.Sprintf("0x%X", sha256.Sum256([]byte("post"))), expected: boolPtr(true)},
+		{key: "wrong-hash", hash: fmt.Sprintf("0x%x", sha256.Sum256([]byte("other"))), expected: boolPtr(false)},
+		{key: "path", path: "expected/foo/post.ssz", expected: boolPtr(true)},
+		{key: "wrong-path", path: "expected/bar/post.ssz", expected: boolPtr(false)},
+		{key: "missing-path", path: "expected/missing/post.ssz"},
+	}
+	for i, task := range tasks {
+		msg := h.addTask(task.key, []byte("pre"))
+		msg.ExpectedPostHash = task.hash
+		msg.ExpectedPost = task.path
+		if !h.process(msg) {
+			t.Fatalf("expected task %s to be acked", task.key)
+		}
+		res := h.published()[i]
+		if (res.MatchesExpected == nil) != (task.expected == nil) ||
+			(res.MatchesExpected != nil && *res.MatchesExpected != *task.expected) {
+			t.Errorf("task %s: unexpected matches-expected: %v", task.key, res.MatchesExpected)
+		}
+	}
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// exportColumns are the CSV columns of an exported result.
+var exportColumns = []string{
+	"key", "client-name", "client-version", "success", "interrupted", "status", "post-hash", "post-root", "consensus",
+	"pre-hash", "post-state", "err-log", "out-log", "duration-ms", "user-ms", "system-ms", "max-rss",
+}
+
+// ResultExporter appends result messages to a local file: as JSON lines,
+// or as CSV (with a header row) if the file name ends with ".csv".
+type ResultExporter struct {
+	mu   sync.Mutex
+	path string
+	csv  bool
+}
+
+func NewResultExporter(path string) *ResultExporter {
+	return &ResultExporter{path: path, csv: strings.HasSuffix(strings.ToLower(path), ".csv")}
+}
+
+// Export appends the result to the export file.
+func (e *ResultExporter) Export(res *ResultMsg) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	f, err := os.OpenFile(e.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open export file: %v", err)
+	}
+	defer f.Close()
+	if !e.csv {
+		return json.NewEncoder(f).Encode(res)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat export file: %v", err)
+	}
+	cw := csv.NewWriter(f)
+	if info.Size() == 0 {
+		if err := cw.Write(exportColumns); err != nil {
+			return err
+		}
+	}
+	preHash := ""
+	if res.Inputs != nil {
+		preHash = res.Inputs.Pre
+	}
+	var usage ResourceUsage
+	if res.Usage != nil {
+		usage = *res.Usage
+	}
+	if err := cw.Write([]string{
+		res.Key, res.ClientName, res.ClientVersion, strconv.FormatBool(res.Success), strconv.FormatBool(res.Interrupted),
+		res.Status, res.PostHash, res.PostRoot, res.Consensus, preHash, res.Files.PostState, res.Files.ErrLog, res.Files.OutLog,
+		strconv.FormatInt(usage.DurationMs, 10), strconv.FormatInt(usage.UserMs, 10), strconv.FormatInt(usage.SystemMs, 10),
+		strconv.FormatInt(usage.MaxRSS, 10),
+	}); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (w *Worker) exportResult(res *ResultMsg) {
+	if w.Exporter == nil {
+		return
+	}
+	if err := w.Exporter.Export(res); err != nil {
+		log.Printf("failed to export result of %s: %v", res.Key, err)
+	}
+}
+
+// ExportResults appends every result message received from the queue to the exporter, until ctx is done.
+// Messages that cannot be decoded or exported are nacked.
+func ExportResults(ctx context.Context, q TaskQueue, e *ResultExporter) error {
+	return q.Receive(ctx, func(ctx context.Context, msg *QueueMessage) {
+		res, err := DecodeResult(msg.Data)
+		if err != nil {
+			log.Printf("failed to decode result: %v", err)
+			msg.Nack()
+			return
+		}
+		if err := e.Export(res); err != nil {
+			log.Printf("failed to export result of %s: %v", res.Key, err)
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+	})
+}
@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muskoka-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	csvPath := filepath.Join(dir, "results.csv")
+	h.worker.Exporter = NewResultExporter(csvPath)
+	for _, key := range []string{"foo", "bar"} {
+		if !h.process(h.addTask(key, []byte("pre"))) {
+			t.Fatal("expected task to be acked")
+		}
+	}
+	f, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || strings.Join(rows[0], ",") != strings.Join(exportColumns, ",") {
+		t.Fatalf("expected header and 2 rows, got %v", rows)
+	}
+	if rows[1][0] != "foo" || rows[2][0] != "bar" || rows[1][3] != "true" {
+		t.Errorf("unexpected rows: %v", rows[1:])
+	}
+
+	jsonPath := filepath.Join(dir, "results.jsonl")
+	e := NewResultExporter(jsonPath)
+	for _, res := range h.published() {
+		if err := e.Export(&res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	var res ResultMsg
+	if err := json.Unmarshal([]byte(lines[1]), &res); err != nil || res.Key != "bar" {
+		t.Errorf("unexpected exported result %q: %v", lines[1], err)
+	}
+}
@@ -0,0 +1,129 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// failoverStore reads from the first of multiple mirrored stores that responds,
+// e.g. input buckets in different regions. Writes and URLs use the primary store.
+type failoverStore struct {
+	stores []BlobStore
+	names  []string
+	// how long to wait for a store to open an object, before also trying the next store
+	slowAfter time.Duration
+}
+
+func NewFailoverStore(primary BlobStore, primaryName string, slowAfter time.Duration) *failoverStore {
+	return &failoverStore{stores: []BlobStore{primary}, names: []string{primaryName}, slowAfter: slowAfter}
+}
+
+// AddFallback adds a store to fail over to, after the stores that were added before.
+func (s *failoverStore) AddFallback(store BlobStore, name string) {
+	s.stores = append(s.stores, store)
+	s.names = append(s.names, name)
+}
+
+type openResult struct {
+	index  int
+	r      io.ReadCloser
+	err    error
+	cancel context.CancelFunc
+}
+
+// NewReader opens the object in the primary store. If that fails, or takes longer than slowAfter,
+// the next store is tried too. The first store to open the object is used, the other attempts are canceled.
+func (s *failoverStore) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	results := make(chan openResult, len(s.stores))
+	cancels := make([]context.CancelFunc, len(s.stores))
+	start := func(i int) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels[i] = cancel
+		go func() {
+			r, err := s.stores[i].NewReader(attemptCtx, name)
+			results <- openResult{index: i, r: r, err: err, cancel: cancel}
+		}()
+	}
+	next := 0
+	start(next)
+	next++
+	pending := 1
+	var errs []error
+	for pending > 0 {
+		var timer *time.Timer
+		var slow <-chan time.Time
+		if next < len(s.stores) && s.slowAfter > 0 {
+			timer = time.NewTimer(s.slowAfter)
+			slow = timer.C
+		}
+		var res openResult
+		isSlow := false
+		select {
+		case res = <-results:
+		case <-slow:
+			isSlow = true
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if isSlow {
+			log.Printf("store %s is slow to read %s, also trying %s", s.names[next-1], name, s.names[next])
+			start(next)
+			next++
+			pending++
+			continue
+		}
+		pending--
+		if res.err == nil {
+			if res.index > 0 {
+				log.Printf("read %s from fallback store %s", name, s.names[res.index])
+			}
+			// cancel the other attempts, and close any reader they may still open
+			for i, cancel := range cancels {
+				if cancel != nil && i != res.index {
+					cancel()
+				}
+			}
+			go func(pending int) {
+				for ; pending > 0; pending-- {
+					if other := <-results; other.err == nil {
+						_ = other.r.Close()
+					}
+				}
+			}(pending)
+			return &cancelOnClose{ReadCloser: res.r, cancel: res.cancel}, nil
+		}
+		res.cancel()
+		log.Printf("failed to read %s from store %s: %v", name, s.names[res.index], res.err)
+		errs = append(errs, fmt.Errorf("%s: %v", s.names[res.index], res.err))
+		if next < len(s.stores) {
+			start(next)
+			next++
+			pending++
+		}
+	}
+	return nil, fmt.Errorf("failed to read %s from all stores: %v", name, errs)
+}
+
+func (s *failoverStore) NewWriter(ctx context.Context, name string) io.WriteCloser {
+	return s.stores[0].NewWriter(ctx, name)
+}
+
+func (s *failoverStore) URL(name string) string {
+	return s.stores[0].URL(name)
+}
+
+// cancelOnClose cancels the context of the reader when it is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.cancel()
+	return err
+}
@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// slowStore delays opening objects, until the context is canceled.
+type slowStore struct {
+	BlobStore
+	delay time.Duration
+}
+
+func (s *slowStore) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(s.delay):
+	}
+	return s.BlobStore.NewReader(ctx, name)
+}
+
+func TestFailoverStore(t *testing.T) {
+	primary, mirror := NewMemStore("primary"), NewMemStore("mirror")
+	mirror.Put("foo", []byte("mirrored"))
+
+	// primary fails
+	s := NewFailoverStore(primary, "primary", time.Minute)
+	s.AddFallback(mirror, "mirror")
+	r, err := s.NewReader(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(r); string(data) != "mirrored" {
+		t.Errorf("unexpected data: %q", data)
+	}
+	_ = r.Close()
+
+	// primary is slow
+	primary.Put("foo", []byte("primary"))
+	s = NewFailoverStore(&slowStore{BlobStore: primary, delay: time.Minute}, "primary", 10*time.Millisecond)
+	s.AddFallback(mirror, "mirror")
+	start := time.Now()
+	r, err = s.NewReader(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(r); string(data) != "mirrored" {
+		t.Errorf("unexpected data: %q", data)
+	}
+	_ = r.Close()
+	if time.Since(start) > 5*time.Second {
+		t.Error("expected slow primary to be failed over")
+	}
+
+	// all fail
+	s = NewFailoverStore(primary, "primary", time.Minute)
+	s.AddFallback(mirror, "mirror")
+	if _, err := s.NewReader(context.Background(), "missing"); err == nil {
+		t.Error("expected error when no store has the object")
+	}
+}
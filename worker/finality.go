@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+)
+
+// Checkpoint is an epoch and block root (0x-prefixed hex) of a justified or finalized checkpoint.
+type Checkpoint struct {
+	Epoch uint64 `json:"epoch"`
+	Root  string `json:"root"`
+}
+
+// FinalityInfo holds the finality-related fields of a post state.
+type FinalityInfo struct {
+	// the justification bits of the last 4 epochs, as 0x-prefixed hex byte
+	JustificationBits string     `json:"justification-bits"`
+	PreviousJustified Checkpoint `json:"previous-justified"`
+	CurrentJustified  Checkpoint `json:"current-justified"`
+	Finalized         Checkpoint `json:"finalized"`
+}
+
+// finalityFieldsSize is the size of the justification bits and the 3 checkpoints.
+// These are the last fixed-size fields of the BeaconState.
+const finalityFieldsSize = 1 + 3*(8+32)
+
+// historicalRootsOffsetPos returns the position of the offset of the historical_roots field in a BeaconState,
+// the first variable-size field. The offset value is the size of the fixed-size part of the state.
+func historicalRootsOffsetPos(specVersion string, specConfig string) (int, error) {
+	p, err := statePresetFor(specVersion, specConfig)
+	if err != nil {
+		return 0, err
+	}
+	// genesis_time, slot, fork, latest_block_header, block_roots, state_roots
+	return 8 + 8 + forkSize + blockHeaderSize + 2*32*int(p.slotsPerHistoricalRoot), nil
+}
+
+// decodeFinality extracts the finality fields from a SSZ encoded BeaconState.
+func decodeFinality(specVersion string, specConfig string, state []byte) (*FinalityInfo, error) {
+	pos, err := historicalRootsOffsetPos(specVersion, specConfig)
+	if err != nil {
+		return nil, err
+	}
+	if len(state) < pos+4 {
+		return nil, fmt.Errorf("state too short: %d bytes", len(state))
+	}
+	fixedSize := int(binary.LittleEndian.Uint32(state[pos : pos+4]))
+	if fixedSize > len(state) || fixedSize < pos+4+finalityFieldsSize {
+		return nil, fmt.Errorf("invalid historical roots offset: %d", fixedSize)
+	}
+	data := state[fixedSize-finalityFieldsSize : fixedSize]
+	checkpoint := func(i int) Checkpoint {
+		start := 1 + i*40
+		return Checkpoint{
+			Epoch: binary.LittleEndian.Uint64(data[start : start+8]),
+			Root:  fmt.Sprintf("0x%x", data[start+8:start+40]),
+		}
+	}
+	return &FinalityInfo{
+		JustificationBits: fmt.Sprintf("0x%02x", data[0]),
+		PreviousJustified: checkpoint(0),
+		CurrentJustified:  checkpoint(1),
+		Finalized:         checkpoint(2),
+	}, nil
+}
+
+// readFinality reads the finality fields of the post state at the given path.
+func readFinality(specVersion string, specConfig string, p string) (*FinalityInfo, error) {
+	state, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read post state: %v", err)
+	}
+	return decodeFinality(specVersion, specConfig, state)
+}
+
+// checkTaskType checks if the worker can process tasks of the type of the task.
+func (w *Worker) checkTaskType(tr *TransitionMsg) error {
+	switch tr.TaskType() {
+	case TaskTypeBlocks:
+		return nil
+	case TaskTypeFinality:
+		_, err := historicalRootsOffsetPos(tr.SpecVersion, tr.SpecConfig)
+		return err
+	case TaskTypeEpoch, TaskTypeOperation, TaskTypeSlots:
+		if w.TaskCliCmds[tr.TaskType()] == "" {
+			return fmt.Errorf("no cli cmd for %s tasks", tr.TaskType())
+		}
+		return tr.checkTaskParams()
+	default:
+		return fmt.Errorf("unknown task type: %s", tr.Type)
+	}
+}
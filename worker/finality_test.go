@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// testFinalityState builds a minimal-config state with the given finality fields, and a variable-size part.
+func testFinalityState(t *testing.T, bits byte, epochs [3]uint64) []byte {
+	pos, err := historicalRootsOffsetPos("v0.8.3", "minimal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixedSize := pos + 4 + 300 + finalityFieldsSize
+	state := make([]byte, fixedSize+64)
+	binary.LittleEndian.PutUint32(state[pos:], uint32(fixedSize))
+	fields := state[fixedSize-finalityFieldsSize : fixedSize]
+	fields[0] = bits
+	for i, epoch := range epochs {
+		binary.LittleEndian.PutUint64(fields[1+i*40:], epoch)
+		fields[1+i*40+8] = byte(0xa0 + i)
+	}
+	return state
+}
+
+func TestFinalityTask(t *testing.T) {
+	state := testFinalityState(t, 0x07, [3]uint64{3, 4, 2})
+	h := newHarness(t, "", &FakeRunner{OutputFiles: map[string][]byte{"--post": state}})
+	defer h.Close()
+
+	msg := h.addTask("foo", []byte("pre"))
+	msg.Type = TaskTypeFinality
+	if !h.process(msg) {
+		t.Fatal("expected task to be acked")
+	}
+	f := h.result().Finality
+	if f == nil {
+		t.Fatal("expected finality fields in result")
+	}
+	if f.JustificationBits != "0x07" || f.PreviousJustified.Epoch != 3 || f.CurrentJustified.Epoch != 4 || f.Finalized.Epoch != 2 {
+		t.Errorf("unexpected finality: %+v", f)
+	}
+	if f.Finalized.Root[:4] != "0xa2" || len(f.Finalized.Root) != 66 {
+		t.Errorf("unexpected finalized root: %s", f.Finalized.Root)
+	}
+
+	unknown := h.addTask("bar", []byte("pre"))
+	unknown.Type = "unknown"
+	if !h.process(unknown) {
+		t.Fatal("expected task of unknown type to be acked")
+	}
+	if n := len(h.published()); n != 1 {
+		t.Fatalf("expected no result for task of unknown type, got %d results", n)
+	}
+}
+
+func TestDecodeFinalityErrors(t *testing.T) {
+	state := testFinalityState(t, 0, [3]uint64{})
+	if _, err := decodeFinality("v0.12.1", "minimal", state); err == nil {
+		t.Error("expected unsupported spec version to fail")
+	}
+	if _, err := decodeFinality("v0.8.3", "minimal", state[:100]); err == nil {
+		t.Error("expected truncated state to fail")
+	}
+	binary.LittleEndian.PutUint32(state[len(state)-64-finalityFieldsSize-300-4:], 10)
+	if _, err := decodeFinality("v0.8.3", "minimal", state); err == nil {
+		t.Error("expected invalid offset to fail")
+	}
+}
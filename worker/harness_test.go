@@ -0,0 +1,363 @@
+package worker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// harness runs a Worker against in-memory storage and queue fakes.
+// With the execRunner, the fake client script in testdata is used as transition CLI.
+// The worker is configured by the test, and started by the first task, or by start.
+type harness struct {
+	t       *testing.T
+	inputs  *MemStore
+	results *MemStore
+	queue   *MemQueue
+	worker  *Worker
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	cancel    context.CancelFunc
+	done      chan error
+}
+
+func newHarness(t *testing.T, cliArgs string, runner CommandRunner) *harness {
+	script, err := filepath.Abs("testdata/fake_client.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &harness{
+		t:       t,
+		inputs:  NewMemStore("inputs"),
+		results: NewMemStore("results"),
+		queue:   NewMemQueue(10),
+		done:    make(chan error, 1),
+	}
+	h.worker = &Worker{
+		Config: Config{
+			CliCmd:        "sh " + script + cliArgs,
+			SpecVersion:   "v0.8.3",
+			SpecConfigs:   []string{"minimal"},
+			ClientName:    "fakeclient",
+			ClientVersion: "v0.0.1_abc",
+			CleanupTmp:    true,
+			// like the default of --reject-exit-codes
+			RejectExitCodes: []int{1},
+		},
+		Inputs:  h.inputs,
+		Results: h.results,
+		Queue:   h.queue,
+		Runner:  runner,
+	}
+	return h
+}
+
+// start runs the worker, if it is not running yet. The worker must not be configured after it is started.
+func (h *harness) start() {
+	h.startOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		h.cancel = cancel
+		go func() {
+			h.done <- h.worker.Run(ctx)
+		}()
+	})
+}
+
+// Close stops the worker, and waits for it to stop, if it was started.
+func (h *harness) Close() {
+	h.closeOnce.Do(func() {
+		if h.cancel == nil {
+			return
+		}
+		h.cancel()
+		if err := <-h.done; err != nil {
+			h.t.Errorf("worker stopped with error: %v", err)
+		}
+	})
+}
+
+// addTask stores the inputs of a task, and returns the message to trigger it.
+func (h *harness) addTask(key string, pre []byte, blocks ...[]byte) TransitionMsg {
+	msg := TransitionMsg{Blocks: len(blocks), SpecVersion: "v0.8.3", SpecConfig: "minimal", Key: key}
+	start := msg.InputsBucketPathStart()
+	h.inputs.Put(start+"/pre.ssz", pre)
+	for i, b := range blocks {
+		h.inputs.Put(fmt.Sprintf("%s/block_%d.ssz", start, i), b)
+	}
+	return msg
+}
+
+// process sends the task to the worker, starting it if needed, and returns true if it was acked.
+func (h *harness) process(msg TransitionMsg) bool {
+	data, err := json.Marshal(&msg)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	h.start()
+	return h.queue.Push(data).Wait()
+}
+
+func (h *harness) published() []ResultMsg {
+	var out []ResultMsg
+	for _, data := range h.queue.Published() {
+		var res ResultMsg
+		if err := json.Unmarshal(data, &res); err != nil {
+			h.t.Fatalf("invalid result message: %v", err)
+		}
+		out = append(out, res)
+	}
+	return out
+}
+
+// result expects exactly one published result, and returns it.
+func (h *harness) result() ResultMsg {
+	results := h.published()
+	if len(results) != 1 {
+		h.t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	return results[0]
+}
+
+func (h *harness) resultFile(url string) []byte {
+	prefix := h.results.URL("")
+	data, ok := h.results.Get(url[len(prefix):])
+	if !ok {
+		h.t.Fatalf("missing result file %s", url)
+	}
+	return data
+}
+
+func TestPipelineSuccess(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+
+	pre, b0, b1 := []byte("pre"), []byte("block0"), []byte("block1")
+	if !h.process(h.addTask("foo", pre, b0, b1)) {
+		t.Fatal("expected task to be acked")
+	}
+	res := h.result()
+	if !res.Success {
+		t.Error("expected success")
+	}
+	if res.Key != "foo" || res.ClientName != "fakeclient" || res.ClientVersion != "v0.0.1_abc" {
+		t.Errorf("unexpected result identity: %+v", res)
+	}
+	expectedPost := []byte("preblock0block1")
+	if expected := fmt.Sprintf("0x%x", sha256.Sum256(expectedPost)); res.PostHash != expected {
+		t.Errorf("post hash %s, expected %s", res.PostHash, expected)
+	}
+	if post := h.resultFile(res.Files.PostState); string(post) != string(expectedPost) {
+		t.Errorf("uploaded post state %q, expected %q", post, expectedPost)
+	}
+	if res.Inputs == nil || res.Inputs.Pre != fmt.Sprintf("0x%x", sha256.Sum256(pre)) ||
+		len(res.Inputs.Blocks) != 2 || res.Inputs.Blocks[1] != fmt.Sprintf("0x%x", sha256.Sum256(b1)) {
+		t.Errorf("unexpected input hashes: %+v", res.Inputs)
+	}
+	if out := h.resultFile(res.Files.OutLog); string(out) != "processing 2 blocks\n" {
+		t.Errorf("unexpected out log: %q", out)
+	}
+}
+
+func TestPipelineClientFailure(t *testing.T) {
+	h := newHarness(t, " --fail", ExecRunner{})
+	defer h.Close()
+
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("failed transitions should still be acked")
+	}
+	res := h.result()
+	if res.Success {
+		t.Error("expected failure")
+	}
+	if errLog := h.resultFile(res.Files.ErrLog); string(errLog) != "invalid block\n" {
+		t.Errorf("unexpected err log: %q", errLog)
+	}
+}
+
+func TestPipelineMissingInputs(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+
+	msg := h.addTask("foo", []byte("pre"))
+	msg.Blocks = 1
+	if h.process(msg) {
+		t.Fatal("expected task with missing inputs to be nacked")
+	}
+	if n := len(h.published()); n != 0 {
+		t.Fatalf("expected no results, got %d", n)
+	}
+}
+
+func TestPipelineIgnoresOtherSpec(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+
+	msg := h.addTask("foo", []byte("pre"))
+	msg.SpecConfig = "mainnet"
+	if !h.process(msg) {
+		t.Fatal("expected mismatching task to be acked")
+	}
+	if n := len(h.published()); n != 0 {
+		t.Fatalf("expected no results, got %d", n)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	if err := h.worker.SelfTest("testdata/selftest"); err != nil {
+		t.Fatalf("expected self-test to pass: %v", err)
+	}
+	h.worker.Runner = &FakeRunner{OutputFiles: map[string][]byte{"--post": []byte("broken")}}
+	if err := h.worker.SelfTest("testdata/selftest"); err == nil {
+		t.Fatal("expected self-test to fail on mismatching post state")
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.CliPreflightArgs = "--help"
+	if err := h.worker.Preflight(); err != nil {
+		t.Fatalf("expected preflight to pass: %v", err)
+	}
+	h.worker.CliCmd = "muskoka-missing-client transition blocks"
+	if err := h.worker.Preflight(); err == nil {
+		t.Fatal("expected preflight to fail for missing binary")
+	}
+}
+
+func TestMaxBlocks(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.MaxBlocks = 1
+
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"), []byte("block1"))) {
+		t.Fatal("expected unsupported task to be acked")
+	}
+	if n := len(h.published()); n != 0 {
+		t.Fatalf("expected no results, got %d", n)
+	}
+}
+
+func TestCombinedLog(t *testing.T) {
+	h := newHarness(t, "", &FakeRunner{Stdout: "out line\n", Stderr: "err line\n"})
+	defer h.Close()
+	h.worker.CombinedLog = true
+
+	if !h.process(h.addTask("foo", []byte("pre"))) {
+		t.Fatal("expected task to be acked")
+	}
+	combined := string(h.resultFile(h.result().Files.CombinedLog))
+	if !strings.Contains(combined, "out| out line\n") || !strings.Contains(combined, "err| err line\n") {
+		t.Errorf("unexpected combined log: %q", combined)
+	}
+}
+
+func TestCompressResults(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.CompressResults = true
+
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	res := h.result()
+	if expected := fmt.Sprintf("0x%x", sha256.Sum256([]byte("preblock0"))); res.PostHash != expected {
+		t.Errorf("post hash %s, expected the hash of the uncompressed post state %s", res.PostHash, expected)
+	}
+	name := strings.TrimPrefix(res.Files.PostState, h.results.URL(""))
+	if enc := h.results.Encoding(name); enc != "gzip" {
+		t.Errorf("unexpected content encoding %q", enc)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(h.resultFile(res.Files.PostState)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post, err := ioutil.ReadAll(gz); err != nil || string(post) != "preblock0" {
+		t.Errorf("unexpected decompressed post state %q: %v", post, err)
+	}
+}
+
+func TestProgressEvents(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	status := NewMemQueue(0)
+	h.worker.StatusTopic = status
+
+	if !h.process(h.addTask("foo", []byte("pre"))) {
+		t.Fatal("expected task to be acked")
+	}
+	var phases []string
+	for _, data := range status.Published() {
+		var ev ProgressMsg
+		if err := json.Unmarshal(data, &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Key != "foo" {
+			t.Errorf("unexpected progress key: %s", ev.Key)
+		}
+		phases = append(phases, ev.Phase)
+	}
+	if strings.Join(phases, ",") != "downloading,executing,uploading,done" {
+		t.Errorf("unexpected phases: %v", phases)
+	}
+}
+
+// concurrencyStore delays every read, and records the maximum number of concurrent reads.
+type concurrencyStore struct {
+	*MemStore
+	mu      sync.Mutex
+	active  int
+	maxSeen int
+}
+
+func (s *concurrencyStore) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	s.active++
+	if s.active > s.maxSeen {
+		s.maxSeen = s.active
+	}
+	s.mu.Unlock()
+	time.Sleep(time.Millisecond * 50)
+	s.mu.Lock()
+	s.active--
+	s.mu.Unlock()
+	return s.MemStore.NewReader(ctx, name)
+}
+
+func TestParallelDownloads(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	store := &concurrencyStore{MemStore: h.inputs}
+	h.worker.Inputs = store
+	h.worker.DownloadParallelism = 3
+
+	blocks := [][]byte{[]byte("b0"), []byte("b1"), []byte("b2"), []byte("b3"), []byte("b4")}
+	if !h.process(h.addTask("foo", []byte("pre"), blocks...)) {
+		t.Fatal("expected task to be acked")
+	}
+	if store.maxSeen != 3 {
+		t.Errorf("expected 3 concurrent downloads, got %d", store.maxSeen)
+	}
+	res := h.result()
+	if !res.Success || len(res.Inputs.Blocks) != len(blocks) {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	for i, b := range blocks {
+		if res.Inputs.Blocks[i] != fmt.Sprintf("0x%x", sha256.Sum256(b)) {
+			t.Errorf("block %d hash is out of order: %s", i, res.Inputs.Blocks[i])
+		}
+	}
+}
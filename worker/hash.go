@@ -0,0 +1,137 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// StateHasher computes a hash of a state, while the serialized state is written to it.
+type StateHasher interface {
+	io.Writer
+	// Sum returns the hash of everything written so far.
+	Sum() ([32]byte, error)
+}
+
+// postHashes are the hashes of the post state of a task.
+type postHashes struct {
+	// sha256 of the post state bytes. Zero if there is no post state.
+	Flat [32]byte
+	// hash-tree-root, if a tree hasher is available for the spec version and config of the task
+	Root *[32]byte
+}
+
+// postHasher computes the flat hash and the tree-root of a post state in the same pass, while it is written to it.
+type postHasher struct {
+	tr   *TransitionMsg
+	flat hash.Hash
+	tree StateHasher
+	// complete is set once the whole post state is written
+	complete bool
+}
+
+func (w *Worker) newPostHasher(tr *TransitionMsg) *postHasher {
+	h := &postHasher{tr: tr, flat: sha256.New()}
+	if w.TreeHasher != nil {
+		h.tree = w.TreeHasher(tr.SpecVersion, tr.SpecConfig)
+	}
+	return h
+}
+
+func (h *postHasher) Write(p []byte) (int, error) {
+	h.flat.Write(p)
+	if h.tree != nil {
+		if _, err := h.tree.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// sum returns the hashes of the post state. Zero hashes if the post state was not completely written.
+func (h *postHasher) sum() (out postHashes) {
+	if !h.complete {
+		return out
+	}
+	copy(out.Flat[:], h.flat.Sum(nil))
+	if h.tree != nil {
+		if root, err := h.tree.Sum(); err != nil {
+			log.Printf("failed to compute hash-tree-root of post state of %s: %v", h.tr.Key, err)
+		} else {
+			out.Root = &root
+		}
+	}
+	return out
+}
+
+// hashPostState reads the post state of the task in the output dir, and returns its hashes.
+// Zero hashes if there is no post state. See hashingReader to hash the post state while uploading it.
+func (w *Worker) hashPostState(tr *TransitionMsg, outDir string) postHashes {
+	h := w.newPostHasher(tr)
+	postF, err := os.Open(filepath.Join(outDir, "post.ssz"))
+	if err != nil {
+		log.Printf("failed to open post state to compute hash: %v", err)
+		return h.sum()
+	}
+	defer postF.Close()
+	if _, err := io.Copy(h, postF); err != nil {
+		log.Printf("failed to hash post state: %v", err)
+		return h.sum()
+	}
+	h.complete = true
+	return h.sum()
+}
+
+// hashingReader writes everything that is read from r to the hasher exactly once:
+// data that is read again after seeking back, e.g. to retry an upload, is not hashed again.
+type hashingReader struct {
+	r io.ReadSeeker
+	h *postHasher
+	// the current position, and the number of bytes hashed so far
+	pos    int64
+	hashed int64
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if end := r.pos + int64(n); end > r.hashed && r.pos <= r.hashed {
+		if _, err := r.h.Write(p[r.hashed-r.pos : n]); err != nil {
+			return n, err
+		}
+		r.hashed = end
+	}
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *hashingReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.r.Seek(offset, whence)
+	if err == nil {
+		r.pos = pos
+	}
+	return pos, err
+}
+
+// finish hashes the remainder that was not read yet, and completes the hash.
+func (r *hashingReader) finish() error {
+	if _, err := r.Seek(r.hashed, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return err
+	}
+	r.h.complete = true
+	return nil
+}
+
+func optionalRoot(root *[32]byte) string {
+	if root == nil {
+		return ""
+	}
+	return fmt.Sprintf("0x%x", *root)
+}
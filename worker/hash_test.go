@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"testing"
+	"time"
+)
+
+func TestHashingReaderUploadRetries(t *testing.T) {
+	store := &flakyStore{MemStore: NewMemStore("flaky"), failures: 2, reads: map[string]int{}, writes: map[string]int{}}
+	w := &Worker{Config: Config{StorageAttempts: 3, StorageRetryDelay: time.Millisecond}}
+	post := bytes.Repeat([]byte("post"), 10000)
+	h := w.newPostHasher(&TransitionMsg{Key: "foo"})
+	r := &hashingReader{r: bytes.NewReader(post), h: h}
+	if err := w.uploadResult(context.Background(), store, "post.ssz", r); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := store.Get("post.ssz"); !bytes.Equal(data, post) {
+		t.Errorf("unexpected uploaded post state of %d bytes", len(data))
+	}
+	if err := r.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.sum().Flat; got != sha256.Sum256(post) {
+		t.Errorf("post state was not hashed exactly once: %x", got)
+	}
+}
+
+func TestHashingReaderFinish(t *testing.T) {
+	w := &Worker{}
+	h := w.newPostHasher(&TransitionMsg{Key: "foo"})
+	r := &hashingReader{r: bytes.NewReader([]byte("partial read")), h: h}
+	if _, err := r.Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.sum().Flat; got != [32]byte{} {
+		t.Errorf("expected no hash before the post state is complete, got %x", got)
+	}
+	if err := r.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.sum().Flat; got != sha256.Sum256([]byte("partial read")) {
+		t.Errorf("unexpected hash %x", got)
+	}
+}
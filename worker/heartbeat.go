@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// HeartbeatMsg is published periodically to the heartbeat topic, to show the health of the worker fleet.
+// A worker without recent heartbeats is gone, a worker with heartbeats but without recent tasks may be stuck.
+type HeartbeatMsg struct {
+	Type          string    `json:"type"`
+	WorkerID      string    `json:"worker-id"`
+	ClientName    string    `json:"client-name"`
+	ClientVersion string    `json:"client-version"`
+	SpecVersion   string    `json:"spec-version"`
+	Targets       []string  `json:"targets"`
+	Started       time.Time `json:"started"`
+	UptimeSeconds int64     `json:"uptime-seconds"`
+	// tasks that completed, and tasks that failed (and were not acked with a result)
+	TasksProcessed int64 `json:"tasks-processed"`
+	TasksFailed    int64 `json:"tasks-failed"`
+	InFlight       int   `json:"in-flight"`
+	// the time the last task completed or failed, if any
+	LastTaskTime  *time.Time `json:"last-task-time,omitempty"`
+	LastError     string     `json:"last-error,omitempty"`
+	LastErrorTime *time.Time `json:"last-error-time,omitempty"`
+	Time          time.Time  `json:"time"`
+}
+
+// heartbeatState tracks the task counters of the heartbeat.
+type heartbeatState struct {
+	mu            sync.Mutex
+	started       time.Time
+	processed     int64
+	failed        int64
+	lastTaskTime  time.Time
+	lastError     string
+	lastErrorTime time.Time
+}
+
+func (w *Worker) heartbeat() *heartbeatState {
+	w.heartbeatOnce.Do(func() {
+		w.heartbeatState = &heartbeatState{started: w.now()}
+	})
+	return w.heartbeatState
+}
+
+// recordTask counts a processed task, or a failed task with its error.
+func (h *heartbeatState) recordTask(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	h.lastTaskTime = now
+	if err != nil {
+		h.failed++
+		h.lastError = err.Error()
+		h.lastErrorTime = now
+	} else {
+		h.processed++
+	}
+}
+
+// HeartbeatMsg returns the current heartbeat of the worker.
+func (w *Worker) HeartbeatMsg() HeartbeatMsg {
+	h := w.heartbeat()
+	now := w.now()
+	msg := HeartbeatMsg{
+		Type:          "heartbeat",
+		WorkerID:      w.WorkerID,
+		ClientName:    w.ClientName,
+		ClientVersion: w.ClientVersion,
+		SpecVersion:   w.SpecVersion,
+		Targets:       w.targetNames(),
+		Time:          now,
+	}
+	w.tasksMu.Lock()
+	msg.InFlight = len(w.inflight)
+	w.tasksMu.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	msg.Started = h.started
+	msg.UptimeSeconds = int64(now.Sub(h.started) / time.Second)
+	msg.TasksProcessed = h.processed
+	msg.TasksFailed = h.failed
+	if !h.lastTaskTime.IsZero() {
+		t := h.lastTaskTime
+		msg.LastTaskTime = &t
+	}
+	if h.lastError != "" {
+		t := h.lastErrorTime
+		msg.LastError = h.lastError
+		msg.LastErrorTime = &t
+	}
+	return msg
+}
+
+// RunHeartbeat publishes a heartbeat to the heartbeat topic every HeartbeatInterval, until ctx is done.
+// Failures are only logged.
+func (w *Worker) RunHeartbeat(ctx context.Context) {
+	w.heartbeat()
+	ticker := time.NewTicker(w.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		w.publishHeartbeat()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) publishHeartbeat() {
+	msg := w.HeartbeatMsg()
+	data, err := json.Marshal(&msg)
+	if err != nil {
+		log.Printf("failed to encode heartbeat: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := w.HeartbeatTopic.Publish(ctx, data); err != nil {
+		log.Printf("failed to publish heartbeat: %v", err)
+	}
+}
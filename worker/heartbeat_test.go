@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	h := newHarness(t, " --fail", ExecRunner{})
+	defer h.Close()
+	h.worker.AckPolicy = map[string]string{ErrorClassClient: ActionAck}
+
+	h.process(h.addTask("foo", []byte("pre")))
+	msg := h.worker.HeartbeatMsg()
+	if msg.WorkerID != h.worker.WorkerID || msg.ClientName != "fakeclient" {
+		t.Errorf("unexpected heartbeat identity: %+v", msg)
+	}
+	if msg.TasksFailed != 1 || msg.TasksProcessed != 0 || msg.LastError == "" || msg.LastTaskTime == nil {
+		t.Errorf("expected a failed task in the heartbeat: %+v", msg)
+	}
+
+	topic := NewMemQueue(1)
+	h.worker.HeartbeatTopic = topic
+	h.worker.publishHeartbeat()
+	published := topic.Published()
+	if len(published) != 1 {
+		t.Fatalf("expected 1 heartbeat, got %d", len(published))
+	}
+	var got HeartbeatMsg
+	if err := json.Unmarshal(published[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != "heartbeat" || got.TasksFailed != 1 || time.Since(got.Time) > time.Minute {
+		t.Errorf("unexpected heartbeat: %+v", got)
+	}
+}
@@ -0,0 +1,231 @@
+package worker
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Invocation describes a transition task to a CommandBuilder: the files of the task, and what it runs on.
+type Invocation struct {
+	// the configured cli cmd, e.g. "zcli transition blocks"
+	CliCmd string
+	// the extra CLI arguments of the spec config of the task, space separated. Empty if none.
+	ConfigArgs  string
+	SpecVersion string
+	SpecConfig  string
+	Key         string
+	// the task type, and its parameters, see TransitionMsg
+	Type      string
+	Operation string
+	Slots     uint64
+	// the work dir of the task, with the input files, and where the output files go
+	Dir string
+	// the input and output file paths
+	Pre    string
+	Post   string
+	Blocks []string
+	// the input files besides the pre state: the blocks, or the other input files of the task type
+	Inputs []string
+	// the file the client may write a JSON report to, see Config.ClientReport
+	Report string
+}
+
+// CommandSpec is the client command of a task, as built by a CommandBuilder.
+type CommandSpec struct {
+	Name string
+	Args []string
+	// extra environment variables, as KEY=value
+	Env []string
+	// a file to pipe to the standard input of the command, if not empty
+	Stdin string
+	// the container image to run the command in, see Command.Image
+	Image string
+}
+
+// CommandBuilder builds the client command to run a transition task with.
+type CommandBuilder interface {
+	Build(inv *Invocation) (CommandSpec, error)
+}
+
+// cliCmdBuilder runs the cli cmd with the config args, the --pre and --post flags, the --operation and --slots flags of the task if any,
+// and the block files (or the other input files of the task type) as positional args.
+// If the cli cmd has placeholders, these are substituted instead, see expandPlaceholders.
+type cliCmdBuilder struct{}
+
+func (cliCmdBuilder) Build(inv *Invocation) (CommandSpec, error) {
+	if hasPlaceholders(inv.CliCmd) {
+		args, err := expandPlaceholders(inv)
+		if err != nil {
+			return CommandSpec{}, err
+		}
+		return CommandSpec{Name: args[0], Args: args[1:]}, nil
+	}
+	cmdParts, err := splitCommand(inv.CliCmd)
+	if err != nil {
+		return CommandSpec{}, err
+	}
+	if len(cmdParts) == 0 {
+		// left to the runner to reject, e.g. a runner that keeps the client running has no use for it
+		cmdParts = []string{""}
+	}
+	var args []string
+	args = append(args, cmdParts[1:]...)
+	if inv.ConfigArgs != "" {
+		args = append(args, strings.Split(inv.ConfigArgs, " ")...)
+	}
+	args = append(args, "--pre", inv.Pre, "--post", inv.Post)
+	args = append(args, taskArgs(inv)...)
+	args = append(args, inv.Inputs...)
+	return CommandSpec{Name: cmdParts[0], Args: args}, nil
+}
+
+// templateBuilder builds commands with Go text/templates over the Invocation, e.g.
+// '{{.CliCmd}} --input {{.Pre}} --output {{.Post}} {{join .Blocks " "}}'.
+// The command template output is split on whitespace into the command name and arguments.
+// Each environment variable and the stdin file are templates too.
+type templateBuilder struct {
+	cmd   *template.Template
+	env   map[string]*template.Template
+	stdin *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// NewTemplateBuilder parses the templates of the command, the environment variables (by name), and the stdin file.
+// The env and stdin templates are optional.
+func NewTemplateBuilder(cmd string, env map[string]string, stdin string) (*templateBuilder, error) {
+	parse := func(name string, text string) (*template.Template, error) {
+		t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s template: %v", name, err)
+		}
+		return t, nil
+	}
+	b := &templateBuilder{env: make(map[string]*template.Template)}
+	var err error
+	if b.cmd, err = parse("command", cmd); err != nil {
+		return nil, err
+	}
+	for k, v := range env {
+		if b.env[k], err = parse("env "+k, v); err != nil {
+			return nil, err
+		}
+	}
+	if stdin != "" {
+		if b.stdin, err = parse("stdin", stdin); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (b *templateBuilder) Build(inv *Invocation) (CommandSpec, error) {
+	exec := func(t *template.Template) (string, error) {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, inv); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	out, err := exec(b.cmd)
+	if err != nil {
+		return CommandSpec{}, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return CommandSpec{}, fmt.Errorf("command template produced an empty command")
+	}
+	spec := CommandSpec{Name: fields[0], Args: fields[1:]}
+	var names []string
+	for k := range b.env {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		v, err := exec(b.env[k])
+		if err != nil {
+			return CommandSpec{}, err
+		}
+		spec.Env = append(spec.Env, k+"="+v)
+	}
+	if b.stdin != nil {
+		if spec.Stdin, err = exec(b.stdin); err != nil {
+			return CommandSpec{}, err
+		}
+	}
+	return spec, nil
+}
+
+func (w *Worker) commandBuilder() CommandBuilder {
+	if w.Builder != nil {
+		return w.Builder
+	}
+	return cliCmdBuilder{}
+}
+
+var placeholderPattern = regexp.MustCompile(`\{[a-z.-]+\}`)
+
+// hasPlaceholders returns true if the cli cmd has placeholders like {pre}.
+func hasPlaceholders(cliCmd string) bool {
+	return placeholderPattern.MatchString(cliCmd)
+}
+
+// expandPlaceholders splits the cli cmd as described by splitCommand, and substitutes the placeholders in the arguments:
+// {pre}, {post}, {spec-version}, {spec-config}, {key}, {dir}, {type}, {operation} and {slots} anywhere in an argument,
+// and {blocks...}, {inputs...} and {config-args...} as whole arguments, which expand to any number of arguments.
+// E.g. 'lighthouse transition --input {pre} --output {post} {blocks...}'.
+func expandPlaceholders(inv *Invocation) ([]string, error) {
+	values := map[string]string{
+		"{pre}":          inv.Pre,
+		"{post}":         inv.Post,
+		"{report}":       inv.Report,
+		"{spec-version}": inv.SpecVersion,
+		"{spec-config}":  inv.SpecConfig,
+		"{key}":          inv.Key,
+		"{dir}":          inv.Dir,
+		"{type}":         inv.Type,
+		"{operation}":    inv.Operation,
+		"{slots}":        strconv.FormatUint(inv.Slots, 10),
+	}
+	parts, err := splitCommand(inv.CliCmd)
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	for _, part := range parts {
+		switch part {
+		case "{blocks...}":
+			args = append(args, inv.Blocks...)
+			continue
+		case "{inputs...}":
+			args = append(args, inv.Inputs...)
+			continue
+		case "{config-args...}":
+			args = append(args, strings.Fields(inv.ConfigArgs)...)
+			continue
+		}
+		var err error
+		arg := placeholderPattern.ReplaceAllStringFunc(part, func(p string) string {
+			v, ok := values[p]
+			if !ok && err == nil {
+				err = fmt.Errorf("unknown placeholder %s in cli cmd argument %q", p, part)
+			}
+			return v
+		})
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty cli cmd")
+	}
+	return args, nil
+}
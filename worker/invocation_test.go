@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTemplateBuilder(t *testing.T) {
+	b, err := NewTemplateBuilder(`{{.CliCmd}} --input {{.Pre}} --output {{.Post}} {{range .Blocks}}--block {{.}} {{end}}`,
+		map[string]string{"PRESET": "{{.SpecConfig}}", "KEY": "{{.Key}}"}, "{{.Dir}}/stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := b.Build(&Invocation{
+		CliCmd: "client transition", SpecConfig: "minimal", Key: "foo", Dir: "/tmp/foo",
+		Pre: "/tmp/foo/pre.ssz", Post: "/tmp/foo/post.ssz", Blocks: []string{"/tmp/foo/block_0.ssz", "/tmp/foo/block_1.ssz"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Name != "client" || strings.Join(spec.Args, " ") != "transition --input /tmp/foo/pre.ssz --output /tmp/foo/post.ssz --block /tmp/foo/block_0.ssz --block /tmp/foo/block_1.ssz" {
+		t.Errorf("unexpected command: %s %q", spec.Name, spec.Args)
+	}
+	if strings.Join(spec.Env, ",") != "KEY=foo,PRESET=minimal" {
+		t.Errorf("unexpected env: %q", spec.Env)
+	}
+	if spec.Stdin != "/tmp/foo/stdin" {
+		t.Errorf("unexpected stdin: %s", spec.Stdin)
+	}
+
+	if _, err := NewTemplateBuilder("{{.Pre", nil, ""); err == nil {
+		t.Error("expected invalid template to fail")
+	}
+	b, err = NewTemplateBuilder("{{.Unknown}}", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Build(&Invocation{}); err == nil {
+		t.Error("expected unknown field to fail")
+	}
+}
+
+func TestExecuteTemplateBuilder(t *testing.T) {
+	fake := &FakeRunner{OutputFiles: map[string][]byte{"--output": []byte("post")}}
+	h := newHarness(t, "", fake)
+	defer h.Close()
+	b, err := NewTemplateBuilder(`client --output {{.Post}} --input {{.Pre}} {{join .Blocks " "}}`, map[string]string{"PRESET": "{{.SpecConfig}}"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.worker.Builder = b
+
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	if res := h.result(); !res.Success || res.PostHash == "" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	calls := fake.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	if c := calls[0]; c.Name != "client" || len(c.Args) != 5 || c.Args[0] != "--output" || !strings.HasSuffix(c.Args[4], "block_0.ssz") {
+		t.Errorf("unexpected command: %s %q", c.Name, c.Args)
+	}
+	if c := calls[0]; len(c.Env) != 1 || c.Env[0] != "PRESET=minimal" {
+		t.Errorf("unexpected env: %q", c.Env)
+	}
+}
+
+func TestExpandPlaceholders(t *testing.T) {
+	inv := &Invocation{
+		CliCmd:     "lighthouse transition --input {pre} --output={post} {config-args...} --spec {spec-version}/{spec-config} {blocks...}",
+		ConfigArgs: "--preset minimal", SpecVersion: "v0.8.3", SpecConfig: "minimal",
+		Pre: "/tmp/pre.ssz", Post: "/tmp/post.ssz", Blocks: []string{"/tmp/block_0.ssz", "/tmp/block_1.ssz"},
+	}
+	spec, err := cliCmdBuilder{}.Build(inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "transition --input /tmp/pre.ssz --output=/tmp/post.ssz --preset minimal --spec v0.8.3/minimal /tmp/block_0.ssz /tmp/block_1.ssz"
+	if spec.Name != "lighthouse" || strings.Join(spec.Args, " ") != expected {
+		t.Errorf("unexpected command: %s %q", spec.Name, spec.Args)
+	}
+
+	inv.CliCmd = "client --input {input}"
+	if _, err := (cliCmdBuilder{}).Build(inv); err == nil {
+		t.Error("expected unknown placeholder to fail")
+	}
+}
@@ -0,0 +1,206 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// janitorRetryInterval is how often the janitor retries failed removals, and re-checks the disk quota.
+const janitorRetryInterval = time.Minute
+
+// workspace is the directory of a completed task, waiting to be removed.
+type workspace struct {
+	dir       string
+	completed time.Time
+	size      int64
+	failures  int
+}
+
+// janitor removes the workspaces of completed tasks in the background. Removals that fail are retried.
+// If the temporary files are kept (no CleanupTmp), the oldest completed workspaces are still removed
+// when the work dirs exceed the quota.
+type janitor struct {
+	mu sync.Mutex
+	// completed workspaces, oldest first
+	completed []*workspace
+	// number of failed removals
+	failures int64
+	kick     chan struct{}
+}
+
+func (w *Worker) janitor() *janitor {
+	w.janitorOnce.Do(func() {
+		w.janitorState = &janitor{kick: make(chan struct{}, 1)}
+	})
+	return w.janitorState
+}
+
+// cleanup hands the workspace of the task to the janitor.
+func (w *Worker) cleanup(tr *TransitionMsg) {
+	j := w.janitor()
+	dir := tr.DirPath()
+	size := dirSize(dir)
+	log.Printf("workspace of task %s (%s) uses %d bytes", tr.Key, tr.ResultKey, size)
+	j.mu.Lock()
+	j.completed = append(j.completed, &workspace{dir: dir, completed: w.now(), size: size})
+	j.mu.Unlock()
+	select {
+	case j.kick <- struct{}{}:
+	default:
+	}
+}
+
+// RunJanitor removes completed workspaces until ctx is done.
+func (w *Worker) RunJanitor(ctx context.Context) {
+	j := w.janitor()
+	ticker := time.NewTicker(janitorRetryInterval)
+	defer ticker.Stop()
+	for {
+		w.sweep()
+		if w.OrphanMaxAge > 0 {
+			w.sweepOrphans(w.now())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.kick:
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep removes the completed workspaces that should not be kept, oldest first.
+func (w *Worker) sweep() {
+	j := w.janitor()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var total int64
+	if w.WorkDirQuota > 0 {
+		total = w.inflightSize()
+		for _, ws := range j.completed {
+			total += ws.size
+		}
+	}
+	remaining := j.completed[:0]
+	for _, ws := range j.completed {
+		overQuota := w.WorkDirQuota > 0 && total > w.WorkDirQuota
+		if !w.CleanupTmp && !overQuota {
+			remaining = append(remaining, ws)
+			continue
+		}
+		if err := os.RemoveAll(ws.dir); err != nil {
+			ws.failures++
+			j.failures++
+			log.Printf("cannot clean up workspace %s (attempt %d), retrying later: %v", ws.dir, ws.failures, err)
+			remaining = append(remaining, ws)
+			continue
+		}
+		// remove the parent (task key) dir too, if no other workspaces are left in it
+		_ = os.Remove(filepath.Dir(ws.dir))
+		total -= ws.size
+	}
+	j.completed = remaining
+	if w.WorkDirQuota > 0 && total > w.WorkDirQuota {
+		log.Printf("WARNING: work dirs use %d bytes, exceeding the quota of %d bytes", total, w.WorkDirQuota)
+	}
+}
+
+// sweepOrphans removes the workspaces in the work dir that the janitor does not know of,
+// and that were not modified for OrphanMaxAge: left behind by a crashed run, or kept by a previous run.
+func (w *Worker) sweepOrphans(now time.Time) {
+	j := w.janitor()
+	known := make(map[string]bool)
+	w.tasksMu.Lock()
+	for _, t := range w.inflight {
+		known[t.msg.DirPath()] = true
+	}
+	w.tasksMu.Unlock()
+	j.mu.Lock()
+	for _, ws := range j.completed {
+		known[ws.dir] = true
+	}
+	j.mu.Unlock()
+
+	keys, err := ioutil.ReadDir(w.workDir())
+	if err != nil {
+		log.Printf("cannot list work dir for orphaned workspaces: %v", err)
+		return
+	}
+	for _, key := range keys {
+		if !key.IsDir() {
+			continue
+		}
+		keyDir := filepath.Join(w.workDir(), key.Name())
+		workspaces, err := ioutil.ReadDir(keyDir)
+		if err != nil {
+			log.Printf("cannot list workspaces of %s: %v", keyDir, err)
+			continue
+		}
+		for _, ws := range workspaces {
+			dir := filepath.Join(keyDir, ws.Name())
+			if !ws.IsDir() || known[dir] {
+				continue
+			}
+			age := now.Sub(lastModified(dir))
+			if age < w.OrphanMaxAge {
+				continue
+			}
+			size := dirSize(dir)
+			if err := os.RemoveAll(dir); err != nil {
+				j.mu.Lock()
+				j.failures++
+				j.mu.Unlock()
+				log.Printf("cannot remove orphaned workspace %s: %v", dir, err)
+				continue
+			}
+			log.Printf("removed orphaned workspace %s (%d bytes, not modified for %s)", dir, size, age)
+			w.metrics().orphanBytes.Add(float64(size))
+		}
+		// only removed if no workspaces are left in it
+		_ = os.Remove(keyDir)
+	}
+}
+
+// lastModified returns the latest modification time of the directory and anything in it.
+func lastModified(dir string) time.Time {
+	var last time.Time
+	_ = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+		return nil
+	})
+	return last
+}
+
+// inflightSize is the disk usage of the workspaces of the tasks that are still running.
+func (w *Worker) inflightSize() int64 {
+	w.tasksMu.Lock()
+	dirs := make([]string, 0, len(w.inflight))
+	for _, t := range w.inflight {
+		dirs = append(dirs, t.msg.DirPath())
+	}
+	w.tasksMu.Unlock()
+	var total int64
+	for _, dir := range dirs {
+		total += dirSize(dir)
+	}
+	return total
+}
+
+// dirSize sums the sizes of the files in the directory. Unreadable entries are skipped.
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
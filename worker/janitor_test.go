@@ -0,0 +1,131 @@
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestJanitorQuota(t *testing.T) {
+	w := &Worker{Config: Config{CleanupTmp: false, WorkDirQuota: 10}}
+	var tasks []*TransitionMsg
+	for i := 0; i < 2; i++ {
+		tr := &TransitionMsg{Key: "janitor-test", ResultKey: uniqueID()}
+		if err := os.MkdirAll(tr.DirPath(), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(tr.DirPath(), "post.ssz"), []byte("8 bytes!"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		w.cleanup(tr)
+		tasks = append(tasks, tr)
+	}
+	defer os.RemoveAll(path.Dir(tasks[0].DirPath()))
+	w.sweep()
+	if _, err := os.Stat(tasks[0].DirPath()); !os.IsNotExist(err) {
+		t.Error("expected oldest workspace to be removed")
+	}
+	if _, err := os.Stat(tasks[1].DirPath()); err != nil {
+		t.Errorf("expected newest workspace to be kept within quota: %v", err)
+	}
+
+	w.CleanupTmp = true
+	w.sweep()
+	if _, err := os.Stat(path.Dir(tasks[1].DirPath())); !os.IsNotExist(err) {
+		t.Error("expected all workspaces to be removed")
+	}
+}
+
+func TestDiskStatus(t *testing.T) {
+	w := &Worker{}
+	tr := &TransitionMsg{Key: "disk-status-test", ResultKey: uniqueID()}
+	if err := os.MkdirAll(tr.DirPath(), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path.Dir(tr.DirPath()))
+	if err := ioutil.WriteFile(path.Join(tr.DirPath(), "pre.ssz"), []byte("8 bytes!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.cleanup(tr)
+	status := w.DiskStatus()
+	if status.WorkspaceBytes != 8 || status.PendingCleanup != 1 {
+		t.Errorf("unexpected disk status: %+v", status)
+	}
+	if status.FreeBytes == 0 {
+		t.Error("expected free disk space to be reported")
+	}
+}
+
+func TestWorkDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "work-dir-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	h := newHarness(t, "", &FakeRunner{OutputFiles: map[string][]byte{"--post": []byte("post")}})
+	defer h.Close()
+	h.worker.WorkDir = dir
+	h.worker.CleanupTmp = false
+
+	if !h.process(h.addTask("foo", []byte("pre"))) {
+		t.Fatal("expected task to be acked")
+	}
+	workspaces, err := ioutil.ReadDir(path.Join(dir, "foo"))
+	if err != nil || len(workspaces) != 1 {
+		t.Fatalf("expected a workspace in the work dir, got %d: %v", len(workspaces), err)
+	}
+	if _, err := os.Stat(path.Join(dir, "foo", workspaces[0].Name(), "pre.ssz")); err != nil {
+		t.Errorf("expected pre state in the workspace: %v", err)
+	}
+
+	h.worker.MinFreeDisk = 1 << 62
+	if h.process(h.addTask("bar", []byte("pre"))) {
+		t.Error("expected task to be refused without enough free disk space")
+	}
+	if _, err := os.Stat(path.Join(dir, "bar")); !os.IsNotExist(err) {
+		t.Error("expected refused task to not download inputs")
+	}
+}
+
+func TestOrphanedWorkspaces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "orphans-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	w := &Worker{Config: Config{WorkDir: dir, OrphanMaxAge: time.Hour}}
+	old := time.Now().Add(-2 * time.Hour)
+	newWorkspace := func(key string, age time.Time) string {
+		ws := path.Join(dir, key, uniqueID())
+		if err := os.MkdirAll(ws, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		p := path.Join(ws, "pre.ssz")
+		if err := ioutil.WriteFile(p, []byte("8 bytes!"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range []string{p, ws} {
+			if err := os.Chtimes(f, age, age); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return ws
+	}
+	orphan := newWorkspace("crashed", old)
+	recent := newWorkspace("recent", time.Now())
+	kept := newWorkspace("kept", old)
+	w.janitor().completed = append(w.janitor().completed, &workspace{dir: kept})
+
+	w.sweepOrphans(time.Now())
+	if _, err := os.Stat(path.Dir(orphan)); !os.IsNotExist(err) {
+		t.Error("expected old orphaned workspace to be removed")
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("expected recently modified workspace to be kept: %v", err)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("expected workspace known to the janitor to be kept: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// RecoverReport publishes an interrupted result for tasks that were running when the worker stopped.
+	RecoverReport = "report"
+	// RecoverRerun runs tasks that were running when the worker stopped again.
+	RecoverRerun = "rerun"
+)
+
+// journalEntry is written when a task starts, and removed when it completes.
+type journalEntry struct {
+	Task      TransitionMsg `json:"task"`
+	ResultKey string        `json:"result-key"`
+	Started   time.Time     `json:"started"`
+}
+
+func (w *Worker) journalPath(tr *TransitionMsg) string {
+	return filepath.Join(w.JournalDir, tr.ResultKey+".json")
+}
+
+// journalStart records the task as running, if a journal dir is configured.
+func (w *Worker) journalStart(tr *TransitionMsg) {
+	if w.JournalDir == "" {
+		return
+	}
+	data, err := json.Marshal(&journalEntry{Task: *tr, ResultKey: tr.ResultKey, Started: w.now()})
+	if err != nil {
+		log.Printf("failed to encode journal entry of %s: %v", tr.Key, err)
+		return
+	}
+	if err := ioutil.WriteFile(w.journalPath(tr), data, 0644); err != nil {
+		log.Printf("failed to write journal entry of %s: %v", tr.Key, err)
+	}
+}
+
+// journalDone removes the task from the journal.
+func (w *Worker) journalDone(tr *TransitionMsg) {
+	if w.JournalDir == "" {
+		return
+	}
+	if err := os.Remove(w.journalPath(tr)); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to remove journal entry of %s: %v", tr.Key, err)
+	}
+}
+
+// RecoverInterrupted handles the tasks left in the journal by a previous run of the worker that did not complete,
+// as configured by RecoverMode. The workspaces of the interrupted tasks are cleaned up.
+func (w *Worker) RecoverInterrupted(ctx context.Context) error {
+	if err := os.MkdirAll(w.JournalDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create journal dir: %v", err)
+	}
+	files, err := ioutil.ReadDir(w.JournalDir)
+	if err != nil {
+		return fmt.Errorf("failed to read journal dir: %v", err)
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		p := filepath.Join(w.JournalDir, f.Name())
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to read journal entry %s: %v", p, err)
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			log.Printf("removing invalid journal entry %s: %v", p, err)
+			_ = os.Remove(p)
+			continue
+		}
+		tr := entry.Task
+		tr.ResultKey = entry.ResultKey
+		log.Printf("recovering task %s (%s), interrupted after starting at %s", tr.Key, tr.ResultKey, entry.Started)
+		w.cleanup(&tr)
+		switch w.RecoverMode {
+		case RecoverRerun:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err := w.processTask(ctx, &tr); err != nil {
+				log.Printf("failed to re-run interrupted task %s: %v", tr.Key, err)
+			}
+		default:
+			if err := w.publishInterrupted(&tr); err != nil {
+				log.Printf("failed to publish interrupted result of %s: %v", tr.Key, err)
+				// keep the entry, to retry on the next start
+				continue
+			}
+		}
+		_ = os.Remove(p)
+	}
+	return nil
+}
+
+// publishInterrupted publishes a result that marks the task as interrupted, without any result files.
+func (w *Worker) publishInterrupted(tr *TransitionMsg) error {
+	res := ResultMsg{
+		Success:       false,
+		Interrupted:   true,
+		PostHash:      fmt.Sprintf("0x%x", [32]byte{}),
+		ClientName:    w.ClientName,
+		ClientVersion: w.ClientVersion,
+		Key:           tr.Key,
+		SpecVersion:   tr.SpecVersion,
+		SpecConfig:    tr.SpecConfig,
+	}
+	data, err := w.encodeResult(&res)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := w.publishResult(ctx, w.Queue, data); err != nil {
+		return err
+	}
+	w.exportResult(&res)
+	return nil
+}
@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestRecoverInterrupted(t *testing.T) {
+	for _, mode := range []string{RecoverReport, RecoverRerun} {
+		t.Run(mode, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "journal-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			h := newHarness(t, "", ExecRunner{})
+			defer h.Close()
+			h.worker.JournalDir = dir
+			h.worker.RecoverMode = mode
+
+			// a task that was running when the previous worker crashed
+			tr := h.addTask("foo", []byte("pre"), []byte("block0"))
+			tr.ResultKey = uniqueID()
+			h.worker.journalStart(&tr)
+
+			if err := h.worker.RecoverInterrupted(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			res := h.result()
+			if mode == RecoverReport && (!res.Interrupted || res.Success || res.Key != "foo") {
+				t.Errorf("expected interrupted result, got %+v", res)
+			}
+			if mode == RecoverRerun && (res.Interrupted || !res.Success) {
+				t.Errorf("expected re-run result, got %+v", res)
+			}
+			if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+				t.Errorf("expected journal to be empty, got %d entries", len(files))
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package worker
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ledgerEntry is a task that was completed by the worker: its results were published and the task was acked.
+type ledgerEntry struct {
+	// the inputs path start of the task (spec version, config and key), see TransitionMsg.InputsBucketPathStart
+	Task          string `json:"task"`
+	ClientName    string `json:"client-name"`
+	ClientVersion string `json:"client-version"`
+	// hashes of the inputs the task ran with, nil if unknown
+	Inputs    *InputHashes `json:"inputs,omitempty"`
+	Completed time.Time    `json:"completed"`
+}
+
+func (e *ledgerEntry) id() string {
+	return e.Task + " " + e.ClientName + " " + e.ClientVersion
+}
+
+// taskLedger records the recently completed tasks, so redeliveries of a task are not executed and uploaded again.
+// The entries are appended to a JSON-lines file, to survive restarts. The file is compacted when it is loaded,
+// and when it has grown to hold mostly expired or overwritten entries.
+type taskLedger struct {
+	path   string
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*ledgerEntry
+	// lines in the file, including expired and overwritten entries
+	lines int
+}
+
+func (w *Worker) ledger() *taskLedger {
+	if w.DedupLedger == "" || w.DedupWindow <= 0 {
+		return nil
+	}
+	w.ledgerOnce.Do(func() {
+		l := &taskLedger{path: w.DedupLedger, window: w.DedupWindow, entries: make(map[string]*ledgerEntry)}
+		if err := l.load(w.now()); err != nil {
+			log.Printf("failed to load dedup ledger %s, starting empty: %v", l.path, err)
+		}
+		w.ledgerState = l
+	})
+	return w.ledgerState
+}
+
+// ledgerEntryOf returns the ledger entry of the task, as completed by the client of the worker.
+func (w *Worker) ledgerEntryOf(tr *TransitionMsg) *ledgerEntry {
+	return &ledgerEntry{
+		Task:          tr.InputsBucketPathStart(),
+		ClientName:    w.ClientName,
+		ClientVersion: w.ClientVersion,
+		Inputs:        tr.Inputs,
+	}
+}
+
+// completed returns the entry of the task if it was completed within the dedup window,
+// with the same inputs if the task has checksums of them. Nil otherwise.
+func (l *taskLedger) completed(e *ledgerEntry, checksums *InputHashes, now time.Time) *ledgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	prev, ok := l.entries[e.id()]
+	if !ok || now.Sub(prev.Completed) > l.window {
+		return nil
+	}
+	if checksums != nil && prev.Inputs != nil && !sameInputs(checksums, prev.Inputs) {
+		return nil
+	}
+	return prev
+}
+
+// sameInputs returns false if any of the known checksums differs from the hash of the input.
+func sameInputs(checksums *InputHashes, inputs *InputHashes) bool {
+	if checksums.Pre != "" && checksums.Pre != inputs.Pre {
+		return false
+	}
+	for i, c := range checksums.Blocks {
+		if c != "" && (i >= len(inputs.Blocks) || c != inputs.Blocks[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// record adds the completed task to the ledger. Failures to write the file are logged,
+// the entry is still kept in memory.
+func (l *taskLedger) record(e *ledgerEntry, now time.Time) {
+	e.Completed = now
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[e.id()] = e
+	l.expire(now)
+	if l.lines > 2*len(l.entries)+100 {
+		if err := l.rewrite(); err != nil {
+			log.Printf("failed to compact dedup ledger %s: %v", l.path, err)
+		}
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("failed to encode dedup ledger entry of %s: %v", e.Task, err)
+		return
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("failed to open dedup ledger %s: %v", l.path, err)
+		return
+	}
+	_, err = f.Write(append(data, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Printf("failed to write dedup ledger %s: %v", l.path, err)
+		return
+	}
+	l.lines++
+}
+
+// expire removes the entries older than the window.
+func (l *taskLedger) expire(now time.Time) {
+	for id, e := range l.entries {
+		if now.Sub(e.Completed) > l.window {
+			delete(l.entries, id)
+		}
+	}
+}
+
+// load reads the entries of the ledger file, and compacts it. A missing file is an empty ledger.
+func (l *taskLedger) load(now time.Time) error {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e ledgerEntry
+		// skip lines that are partially written, e.g. by a crash
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		l.entries[e.id()] = &e
+	}
+	err = scanner.Err()
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	l.expire(now)
+	return l.rewrite()
+}
+
+// rewrite replaces the ledger file with the current entries.
+func (l *taskLedger) rewrite() error {
+	var data []byte
+	for _, e := range l.entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	tmp := l.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return err
+	}
+	l.lines = len(l.entries)
+	return nil
+}
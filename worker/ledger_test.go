@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestDedupLedger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ledger-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ledgerPath := path.Join(dir, "ledger.jsonl")
+	run := func(keys ...string) int {
+		h := newHarness(t, "", &FakeRunner{OutputFiles: map[string][]byte{"--post": []byte("post")}})
+		defer h.Close()
+		h.worker.DedupLedger = ledgerPath
+		h.worker.DedupWindow = time.Hour
+		for _, key := range keys {
+			if !h.process(h.addTask(key, []byte("pre"))) {
+				t.Fatalf("expected task %s to be acked", key)
+			}
+		}
+		return len(h.published())
+	}
+	if n := run("foo", "foo"); n != 1 {
+		t.Errorf("expected the duplicate to be skipped, got %d results", n)
+	}
+	// the ledger is kept across restarts
+	if n := run("foo", "bar"); n != 1 {
+		t.Errorf("expected only the new task to run after a restart, got %d results", n)
+	}
+}
+
+func TestLedgerWindow(t *testing.T) {
+	l := &taskLedger{path: path.Join(os.TempDir(), "ledger-window-test-"+uniqueID()), window: time.Minute, entries: make(map[string]*ledgerEntry)}
+	defer os.Remove(l.path)
+	now := time.Now()
+	l.record(&ledgerEntry{Task: "v0.8.3/minimal/foo", ClientVersion: "v1", Inputs: &InputHashes{Pre: "0xaa"}}, now)
+
+	if l.completed(&ledgerEntry{Task: "v0.8.3/minimal/foo", ClientVersion: "v1"}, nil, now.Add(30*time.Second)) == nil {
+		t.Error("expected task to be completed within the window")
+	}
+	if l.completed(&ledgerEntry{Task: "v0.8.3/minimal/foo", ClientVersion: "v1"}, nil, now.Add(2*time.Minute)) != nil {
+		t.Error("expected task to expire after the window")
+	}
+	if l.completed(&ledgerEntry{Task: "v0.8.3/minimal/foo", ClientVersion: "v2"}, nil, now) != nil {
+		t.Error("expected a new client version to run the task again")
+	}
+	if l.completed(&ledgerEntry{Task: "v0.8.3/minimal/foo", ClientVersion: "v1"}, &InputHashes{Pre: "0xbb"}, now) != nil {
+		t.Error("expected different inputs to run the task again")
+	}
+}
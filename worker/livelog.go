@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// liveLogTarget is where the output of a running transition is streamed to.
+type liveLogTarget struct {
+	store BlobStore
+	files ResultFilesDataPaths
+}
+
+// streamLiveLogs uploads the output so far to the final log locations of the task, once the transition runs for
+// longer than LiveLogAfter, and then every LiveLogInterval. The final upload of the logs overwrites the partial logs.
+// The returned function stops the streaming, and waits for any upload in progress.
+func (w *Worker) streamLiveLogs(ctx context.Context, key string, target *liveLogTarget, stdout *syncWriter, stdoutPath string,
+	stderr *syncWriter, stderrPath string) (stop func()) {
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		timer := time.NewTimer(w.LiveLogAfter)
+		defer timer.Stop()
+		select {
+		case <-stopCh:
+			return
+		case <-timer.C:
+		}
+		log.Printf("transition %s is taking longer than %s, streaming partial logs", key, w.LiveLogAfter)
+		ticker := time.NewTicker(w.LiveLogInterval)
+		defer ticker.Stop()
+		for {
+			if err := w.uploadPartial(ctx, target.store, target.files.OutLog, stdout, stdoutPath); err != nil {
+				log.Printf("could not upload partial std-out of %s: %v", key, err)
+			}
+			if err := w.uploadPartial(ctx, target.store, target.files.ErrLog, stderr, stderrPath); err != nil {
+				log.Printf("could not upload partial std-err of %s: %v", key, err)
+			}
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(stopCh)
+		<-done
+	}
+}
+
+// uploadPartial uploads the log file as far as it was written, while the client may still be writing to it.
+func (w *Worker) uploadPartial(ctx context.Context, store BlobStore, bucketpath string, writer *syncWriter, p string) error {
+	var size int64
+	var err error
+	writer.Do(func() {
+		var info os.FileInfo
+		if info, err = os.Stat(p); err == nil {
+			size = info.Size()
+		}
+	})
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return w.uploadResult(ctx, store, bucketpath, io.NewSectionReader(f, 0, size))
+}
@@ -0,0 +1,199 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// MemStore is an in-memory BlobStore, to run the worker without any cloud storage.
+type MemStore struct {
+	name      string
+	mu        sync.Mutex
+	objects   map[string][]byte
+	encodings map[string]string
+}
+
+func NewMemStore(name string) *MemStore {
+	return &MemStore{name: name, objects: make(map[string][]byte), encodings: make(map[string]string)}
+}
+
+// Put stores a copy of data under the given object name.
+func (s *MemStore) Put(name string, data []byte) {
+	s.put(name, data, "")
+}
+
+func (s *MemStore) put(name string, data []byte, contentEncoding string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[name] = append([]byte(nil), data...)
+	if contentEncoding != "" {
+		s.encodings[name] = contentEncoding
+	} else {
+		delete(s.encodings, name)
+	}
+}
+
+// Encoding returns the Content-Encoding of the named object, empty if none.
+func (s *MemStore) Encoding(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encodings[name]
+}
+
+// Get returns the contents of the named object, if it exists.
+func (s *MemStore) Get(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[name]
+	return data, ok
+}
+
+// Names lists all stored object names, sorted.
+func (s *MemStore) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.objects))
+	for name := range s.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *MemStore) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	data, ok := s.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("object %s does not exist in %s", name, s.name)
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Version is the hash of the contents of the object.
+func (s *MemStore) Version(ctx context.Context, name string) (string, error) {
+	data, ok := s.Get(name)
+	if !ok {
+		return "", fmt.Errorf("object %s does not exist in %s", name, s.name)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+func (s *MemStore) NewWriter(ctx context.Context, name string) io.WriteCloser {
+	return &memWriter{store: s, name: name}
+}
+
+func (s *MemStore) NewEncodedWriter(ctx context.Context, name string, contentEncoding string) io.WriteCloser {
+	return &memWriter{store: s, name: name, contentEncoding: contentEncoding}
+}
+
+func (s *MemStore) URL(name string) string {
+	return fmt.Sprintf("mem://%s/%s", s.name, name)
+}
+
+type memWriter struct {
+	store           *MemStore
+	name            string
+	contentEncoding string
+	buf             bytes.Buffer
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *memWriter) Close() error {
+	w.store.put(w.name, w.buf.Bytes(), w.contentEncoding)
+	return nil
+}
+
+// MemDelivery tracks the outcome of a task pushed into a MemQueue.
+type MemDelivery struct {
+	once  sync.Once
+	done  chan struct{}
+	acked bool
+}
+
+func (d *MemDelivery) finish(acked bool) {
+	d.once.Do(func() {
+		d.acked = acked
+		close(d.done)
+	})
+}
+
+// Wait blocks until the task is acked or nacked, and returns true if it was acked.
+func (d *MemDelivery) Wait() bool {
+	<-d.done
+	return d.acked
+}
+
+// MemQueue is an in-memory TaskQueue. Tasks are delivered one at a time, in push order.
+type MemQueue struct {
+	tasks     chan *QueueMessage
+	mu        sync.Mutex
+	published [][]byte
+	// attributes per published message
+	publishedAttrs []map[string]string
+}
+
+func NewMemQueue(capacity int) *MemQueue {
+	return &MemQueue{tasks: make(chan *QueueMessage, capacity)}
+}
+
+// Push queues a task message for delivery.
+func (q *MemQueue) Push(data []byte) *MemDelivery {
+	return q.PushWithAttributes(data, nil)
+}
+
+// PushWithAttributes queues a task message with message attributes for delivery.
+func (q *MemQueue) PushWithAttributes(data []byte, attributes map[string]string) *MemDelivery {
+	d := &MemDelivery{done: make(chan struct{})}
+	q.tasks <- &QueueMessage{
+		Data:       data,
+		Attributes: attributes,
+		ack:        func() { d.finish(true) },
+		nack:       func() { d.finish(false) },
+	}
+	return d
+}
+
+// Published returns all result messages published so far.
+func (q *MemQueue) Published() [][]byte {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([][]byte(nil), q.published...)
+}
+
+func (q *MemQueue) Receive(ctx context.Context, f func(ctx context.Context, msg *QueueMessage)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-q.tasks:
+			f(ctx, msg)
+		}
+	}
+}
+
+func (q *MemQueue) Publish(ctx context.Context, data []byte) error {
+	return q.PublishWithAttributes(ctx, data, nil)
+}
+
+func (q *MemQueue) PublishWithAttributes(ctx context.Context, data []byte, attributes map[string]string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.published = append(q.published, append([]byte(nil), data...))
+	q.publishedAttrs = append(q.publishedAttrs, attributes)
+	return nil
+}
+
+// PublishedAttributes returns the attributes of all messages published so far, nil for messages without attributes.
+func (q *MemQueue) PublishedAttributes() []map[string]string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]map[string]string(nil), q.publishedAttrs...)
+}
@@ -0,0 +1,234 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type TransitionMsg struct {
+	Blocks      int    `json:"blocks"`
+	SpecVersion string `json:"spec-version"`
+	SpecConfig  string `json:"spec-config"`
+	Key         string `json:"key"`
+	// the task type, "blocks" if empty. See TaskTypeFinality, TaskTypeEpoch, TaskTypeOperation and TaskTypeSlots.
+	Type string `json:"type,omitempty"`
+	// the epoch sub-transition or operation type, for epoch and operation tasks
+	Operation string `json:"operation,omitempty"`
+	// the number of slots to process, for slots tasks
+	Slots uint64 `json:"slots,omitempty"`
+	// optional label of the campaign the task is part of, to cancel a campaign at once
+	Campaign string `json:"campaign,omitempty"`
+	// optional results bucket and path prefix to route the results to, e.g. for private fuzzing runs.
+	// Only accepted if allowed by the worker operator.
+	ResultsBucket string `json:"results-bucket,omitempty"`
+	ResultsPrefix string `json:"results-prefix,omitempty"`
+	// optional expected post state, to compare the result with: the flat-hash (0x-prefixed sha256) of the post state,
+	// or else the path of the post state in the inputs bucket
+	ExpectedPostHash string `json:"expected-post-hash,omitempty"`
+	ExpectedPost     string `json:"expected-post,omitempty"`
+	// optional sha256 checksums (0x-prefixed hex) of the input files, to verify the downloads with.
+	// Empty checksums are not verified.
+	Checksums *InputHashes `json:"checksums,omitempty"`
+	// optional build of the client to run the task with, e.g. the binary of a pull request.
+	// Only accepted if the worker has an artifact dir.
+	ClientArtifact *ClientArtifact `json:"client-artifact,omitempty"`
+	// optional environment variables of the client command, e.g. a log level.
+	// Only accepted if allowed by the worker operator, they override the environment of the worker config.
+	Env       map[string]string `json:"env,omitempty"`
+	ResultKey string            `json:"-"`
+	// hashes of the downloaded inputs, set when loading the task
+	Inputs *InputHashes `json:"-"`
+	// why the inputs failed to download or are invalid, empty if the inputs are ok or not checked
+	InputError string `json:"-"`
+	// the directory the workspaces of the worker are in, os.TempDir() if empty
+	WorkDir string `json:"-"`
+	// received from a priority subscription, see PriorityQueue
+	Urgent bool `json:"-"`
+	// the local path of the client binary of the client artifact, set when loading the task
+	ClientBinary string `json:"-"`
+}
+
+// InputHashes are the sha256 hashes (0x-prefixed hex) of the input files of a task, computed while downloading.
+type InputHashes struct {
+	Pre string `json:"pre"`
+	// the blocks, or the other input files of the task type, see TransitionMsg.InputFiles
+	Blocks []string `json:"blocks"`
+}
+
+// TaskType returns the type of the task, defaulting to TaskTypeBlocks.
+func (tr *TransitionMsg) TaskType() string {
+	if tr.Type == "" {
+		return TaskTypeBlocks
+	}
+	return tr.Type
+}
+
+func (tr *TransitionMsg) DirPath() string {
+	root := tr.WorkDir
+	if root == "" {
+		root = os.TempDir()
+	}
+	return filepath.Join(root, tr.Key, tr.ResultKey)
+}
+
+func (tr *TransitionMsg) InputsBucketPathStart() string {
+	return fmt.Sprintf("%s/%s/%s", tr.SpecVersion, tr.SpecConfig, tr.Key)
+}
+
+// ResultsBucketPathStart returns the path of the result files of the client, in the default layout.
+// Workers place results with their ResultPathLayout, see Config.ResultPathTemplate.
+func (tr *TransitionMsg) ResultsBucketPathStart(clientName string, clientVersion string) string {
+	return DefaultResultPathLayout.Path(tr, clientName, clientVersion)
+}
+
+// Result statuses, see ResultMsg.Status.
+const (
+	StatusSuccess = "success"
+	// the client exited with one of the RejectExitCodes, e.g. for an invalid block
+	StatusTransitionRejected = "transition-rejected"
+	// the client exited with another error code, was killed by a signal, or could not run
+	StatusClientCrash = "client-crash"
+	// the client was killed after the transition timeout
+	StatusTimeout = "timeout"
+	// the client was killed for exceeding a resource limit
+	StatusResourceExceeded = "resource-exceeded"
+	// the client exited successfully, but did not write a post state
+	StatusMissingPost = "missing-post"
+	// the results could not be uploaded, with the result ack action for infra errors
+	StatusUploadFailed = "upload-failed"
+	// the inputs could not be downloaded (with the result ack action for infra errors),
+	// or are not a valid state and blocks (see Config.ValidateInputs). The client did not run.
+	StatusInputError = "input-error"
+)
+
+type ResultMsg struct {
+	// the version of the result message schema, see ResultSchemaVersion. 0 for workers without schema versioning.
+	SchemaVersion int `json:"schema-version"`
+	// if the transition was successful: the status is "success"
+	Success bool `json:"success"`
+	// how the transition ended: "success", "transition-rejected", "client-crash", "timeout", "resource-exceeded",
+	// "missing-post", "upload-failed" or "input-error". See StatusSuccess and the other statuses.
+	Status string `json:"status,omitempty"`
+	// the resource limit the client exceeded: "memory" or "cpu", for the resource-exceeded status
+	Exceeded string `json:"exceeded,omitempty"`
+	// if the worker stopped while running the transition, there are no result files
+	Interrupted bool `json:"interrupted,omitempty"`
+	// the flat-hash of the post-state SSZ bytes, for quickly finding different results.
+	PostHash string `json:"post-hash"`
+	// the SSZ hash-tree-root of the post state, if computed for the spec version and config
+	PostRoot string `json:"post-root,omitempty"`
+	// the name of the client; 'zrnt', 'lighthouse', etc.
+	ClientName string `json:"client-name"`
+	// the version number of the client, may contain a git commit hash
+	ClientVersion string `json:"client-version"`
+	// identifies the transition task
+	Key string `json:"key"`
+	// the spec version of the task, which may differ from the configured one with a spec version range
+	SpecVersion string `json:"spec-version,omitempty"`
+	// the spec config of the task
+	SpecConfig string `json:"spec-config,omitempty"`
+	// if the post hash agrees with the majority of other client results for the task seen by the worker:
+	// "agrees", "disagrees" or "no-majority". Empty if no other results were seen.
+	Consensus string `json:"consensus,omitempty"`
+	// if the post hash matches the expected post state of the task. Nil if the task has no expected post state,
+	// or if it could not be loaded.
+	MatchesExpected *bool `json:"matches-expected,omitempty"`
+	// the finality fields of the post state, for finality tasks
+	Finality *FinalityInfo `json:"finality,omitempty"`
+	// the time and resources the client used for the transition
+	Usage *ResourceUsage `json:"usage,omitempty"`
+	// how the client process ended, nil if the client did not run
+	Exit *ExitInfo `json:"exit,omitempty"`
+	// the flat-hashes of the inputs the transition ran on
+	Inputs *InputHashes `json:"inputs,omitempty"`
+	// the flat-hashes of the post states after every block but the last, for transitions that ran block by block.
+	// The post state after the last block is the post-hash. See Config.PerBlockPosts.
+	BlockPostHashes []string `json:"block-post-hashes,omitempty"`
+	// the JSON object the client reported about the transition (e.g. state root, slot, error reason), as-is.
+	// Nil if the worker does not read client reports, or the client did not report one. See Config.ClientReport.
+	ClientReport json.RawMessage `json:"client-report,omitempty"`
+	// Result files
+	Files ResultFilesDataURLS `json:"files"`
+}
+
+// ExitInfo describes how the client process of a transition ended. It is also uploaded as the exit-info result file.
+type ExitInfo struct {
+	// the exit code of the client, or -1 if it did not exit by itself
+	ExitCode int `json:"exit-code"`
+	// the name of the signal that killed the client, e.g. "killed". Empty if it exited by itself.
+	Signal string `json:"signal,omitempty"`
+	// if the client was killed because the transition timeout fired
+	TimedOut bool `json:"timed-out"`
+}
+
+// ResourceUsage describes the time and resources used by the client process for a transition.
+type ResourceUsage struct {
+	// wall-clock time, in milliseconds
+	DurationMs int64 `json:"duration-ms"`
+	// user and system CPU time of the client and its waited-for children, in milliseconds. 0 if unknown.
+	UserMs   int64 `json:"user-ms"`
+	SystemMs int64 `json:"system-ms"`
+	// the maximum resident set size, in bytes. 0 if unknown.
+	MaxRSS int64 `json:"max-rss"`
+}
+
+type ResultFilesDataURLS struct {
+	PostState string `json:"post-state"`
+	ErrLog    string `json:"err-log"`
+	OutLog    string `json:"out-log"`
+	// logs with a worker-side timestamp per line
+	ErrLogTimed string `json:"err-log-timed"`
+	OutLogTimed string `json:"out-log-timed"`
+	// stdout and stderr interleaved, empty if not enabled
+	CombinedLog string `json:"combined-log,omitempty"`
+	// the ExitInfo of the client as JSON, empty if the client did not run
+	ExitInfo string `json:"exit-info,omitempty"`
+	// the StateDiff of the post state with the reference client, empty if they match or there is no reference client
+	PostDiff string `json:"post-diff,omitempty"`
+	// the post states after every block but the last, for transitions that ran block by block
+	BlockPostStates []string `json:"block-post-states,omitempty"`
+	// a gzipped tarball with the inputs, post state, logs, command line and environment of a failed transition,
+	// to reproduce it with. Empty for successful transitions.
+	Repro string `json:"repro,omitempty"`
+}
+
+type ResultFilesDataPaths struct {
+	PostState   string
+	ErrLog      string
+	OutLog      string
+	ErrLogTimed string
+	OutLogTimed string
+	CombinedLog string
+	ExitInfo    string
+	PostDiff    string
+	// the post states after every block but the last, see runPerBlock
+	BlockPostStates []string
+	Repro           string
+}
+
+func (rd ResultFilesDataPaths) URLs(store BlobStore) ResultFilesDataURLS {
+	urls := ResultFilesDataURLS{
+		PostState:   store.URL(rd.PostState),
+		ErrLog:      store.URL(rd.ErrLog),
+		OutLog:      store.URL(rd.OutLog),
+		ErrLogTimed: store.URL(rd.ErrLogTimed),
+		OutLogTimed: store.URL(rd.OutLogTimed),
+		CombinedLog: optionalURL(store, rd.CombinedLog),
+		ExitInfo:    optionalURL(store, rd.ExitInfo),
+		PostDiff:    optionalURL(store, rd.PostDiff),
+		Repro:       optionalURL(store, rd.Repro),
+	}
+	for _, name := range rd.BlockPostStates {
+		urls.BlockPostStates = append(urls.BlockPostStates, store.URL(name))
+	}
+	return urls
+}
+
+func optionalURL(store BlobStore, name string) string {
+	if name == "" {
+		return ""
+	}
+	return store.URL(name)
+}
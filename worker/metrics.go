@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+// workerMetrics are the Prometheus metrics of a worker, served on /metrics.
+type workerMetrics struct {
+	registry *prometheus.Registry
+
+	transitions        *prometheus.CounterVec
+	transitionDuration prometheus.Histogram
+	downloadDuration   prometheus.Histogram
+	downloadBytes      prometheus.Counter
+	uploadDuration     prometheus.Histogram
+	uploadBytes        prometheus.Counter
+	nacks              prometheus.Counter
+	cacheHits          prometheus.Counter
+	cacheMisses        prometheus.Counter
+	orphanBytes        prometheus.Counter
+}
+
+func newWorkerMetrics() *workerMetrics {
+	m := &workerMetrics{
+		registry: prometheus.NewRegistry(),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "muskoka_transitions_total",
+			Help: "Transitions that were processed, by result status (success, transition-rejected, client-crash, timeout, resource-exceeded, missing-post, upload-failed, input-error).",
+		}, []string{"status"}),
+		transitionDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "muskoka_transition_duration_seconds",
+			Help:    "Execution time of the client per transition.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 14),
+		}),
+		downloadDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "muskoka_download_duration_seconds",
+			Help:    "Download time per input file.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+		}),
+		downloadBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "muskoka_download_bytes_total",
+			Help: "Bytes of input files that were downloaded.",
+		}),
+		uploadDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "muskoka_upload_duration_seconds",
+			Help:    "Upload time per result file.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+		}),
+		uploadBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "muskoka_upload_bytes_total",
+			Help: "Bytes of result files that were uploaded.",
+		}),
+		nacks: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "muskoka_nacks_total",
+			Help: "Task messages that were nacked, to be redelivered.",
+		}),
+		cacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "muskoka_input_cache_hits_total",
+			Help: "Input files that were copied from the input cache instead of downloaded.",
+		}),
+		cacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "muskoka_input_cache_misses_total",
+			Help: "Input files that were not in the input cache, and were downloaded.",
+		}),
+		orphanBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "muskoka_orphan_bytes_reclaimed_total",
+			Help: "Bytes of orphaned workspaces, left behind by crashed runs, that were removed.",
+		}),
+	}
+	m.registry.MustRegister(m.transitions, m.transitionDuration, m.downloadDuration, m.downloadBytes,
+		m.uploadDuration, m.uploadBytes, m.nacks, m.cacheHits, m.cacheMisses, m.orphanBytes)
+	return m
+}
+
+func (w *Worker) metrics() *workerMetrics {
+	w.metricsOnce.Do(func() {
+		w.metricsState = newWorkerMetrics()
+	})
+	return w.metricsState
+}
+
+// MetricsHandler serves the Prometheus metrics of the worker.
+func (w *Worker) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(w.metrics().registry, promhttp.HandlerOpts{})
+}
+
+func (m *workerMetrics) observeTransition(out *transitionOutput) {
+	m.transitions.WithLabelValues(out.Status()).Inc()
+	m.transitionDuration.Observe(out.Duration.Seconds())
+}
+
+func (m *workerMetrics) observeDownload(start time.Time, n int64) {
+	m.downloadDuration.Observe(time.Since(start).Seconds())
+	m.downloadBytes.Add(float64(n))
+}
+
+func (m *workerMetrics) observeUpload(start time.Time, n int64) {
+	m.uploadDuration.Observe(time.Since(start).Seconds())
+	m.uploadBytes.Add(float64(n))
+}
+
+// nack nacks the message, and counts it.
+func (w *Worker) nack(message *QueueMessage) {
+	w.metrics().nacks.Inc()
+	message.Nack()
+}
@@ -0,0 +1,35 @@
+package worker
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	fake := &FakeRunner{OutputFiles: map[string][]byte{"--post": []byte("post")}}
+	h := newHarness(t, "", fake)
+	defer h.Close()
+
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	rec := httptest.NewRecorder()
+	h.worker.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`muskoka_transitions_total{status="success"} 1`,
+		`muskoka_transition_duration_seconds_count 1`,
+		`muskoka_download_bytes_total 9`,
+		`muskoka_download_duration_seconds_count 2`,
+		`muskoka_nacks_total 0`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("expected metric %q, got:\n%s", line, body)
+		}
+	}
+}
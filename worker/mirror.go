@@ -0,0 +1,142 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// mirrorRetryInterval is how often failed mirror copies are retried.
+	mirrorRetryInterval = time.Minute
+	// maxMirrorAttempts is the number of attempts before a mirror job is dropped.
+	maxMirrorAttempts = 60
+)
+
+// mirrorJob copies the result files of a task to the mirror store, and publishes the result to the mirror topic.
+type mirrorJob struct {
+	key      string
+	src      BlobStore
+	files    []string
+	message  []byte
+	attempts int
+}
+
+// mirrorQueue holds the mirror jobs that are not completed yet.
+type mirrorQueue struct {
+	mu      sync.Mutex
+	pending []*mirrorJob
+	kick    chan struct{}
+}
+
+func (w *Worker) mirrors() *mirrorQueue {
+	w.mirrorOnce.Do(func() {
+		w.mirrorState = &mirrorQueue{kick: make(chan struct{}, 1)}
+	})
+	return w.mirrorState
+}
+
+func (w *Worker) mirrorEnabled() bool {
+	return w.MirrorStore != nil || w.MirrorTopic != nil
+}
+
+// mirrorResult schedules the mirroring of the uploaded result files and the published result message of a task.
+func (w *Worker) mirrorResult(key string, src BlobStore, files []string, message []byte) {
+	if !w.mirrorEnabled() {
+		return
+	}
+	m := w.mirrors()
+	m.mu.Lock()
+	m.pending = append(m.pending, &mirrorJob{key: key, src: src, files: files, message: message})
+	m.mu.Unlock()
+	select {
+	case m.kick <- struct{}{}:
+	default:
+	}
+}
+
+// RunMirror runs the mirror jobs in the background, and retries failed jobs, until ctx is done.
+func (w *Worker) RunMirror(ctx context.Context) {
+	m := w.mirrors()
+	ticker := time.NewTicker(mirrorRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			m.mu.Lock()
+			if len(m.pending) > 0 {
+				log.Printf("WARNING: stopping with %d results that are not mirrored yet", len(m.pending))
+			}
+			m.mu.Unlock()
+			return
+		case <-m.kick:
+		case <-ticker.C:
+		}
+		m.mu.Lock()
+		jobs := m.pending
+		m.pending = nil
+		m.mu.Unlock()
+		var failed []*mirrorJob
+		for _, job := range jobs {
+			if err := w.runMirrorJob(ctx, job); err != nil {
+				job.attempts++
+				if job.attempts >= maxMirrorAttempts {
+					log.Printf("ALERT: giving up mirroring results of %s after %d attempts: %v", job.key, job.attempts, err)
+					continue
+				}
+				log.Printf("failed to mirror results of %s (attempt %d), retrying later: %v", job.key, job.attempts, err)
+				failed = append(failed, job)
+			}
+		}
+		m.mu.Lock()
+		m.pending = append(failed, m.pending...)
+		m.mu.Unlock()
+	}
+}
+
+// runMirrorJob copies the remaining files of the job, and then publishes the message.
+// Completed parts are removed from the job, so a retry continues where it failed.
+func (w *Worker) runMirrorJob(ctx context.Context, job *mirrorJob) error {
+	if w.MirrorStore != nil {
+		for len(job.files) > 0 {
+			if err := w.copyObject(ctx, job.src, w.MirrorStore, job.files[0]); err != nil {
+				return fmt.Errorf("failed to copy %s: %v", job.files[0], err)
+			}
+			job.files = job.files[1:]
+		}
+	}
+	if w.MirrorTopic != nil && job.message != nil {
+		publishCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+		defer cancel()
+		if err := w.publishResult(publishCtx, w.MirrorTopic, job.message); err != nil {
+			return fmt.Errorf("failed to publish result: %v", err)
+		}
+		job.message = nil
+	}
+	return nil
+}
+
+func (w *Worker) copyObject(ctx context.Context, src BlobStore, dst BlobStore, name string) error {
+	limits := w.storageLimits()
+	release, err := limits.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	r, err := src.NewReader(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	wr := dst.NewWriter(ctx, name)
+	if _, err := io.Copy(wr, limits.throttleUpload(ctx, r)); err != nil {
+		_ = wr.Close()
+		return err
+	}
+	return wr.Close()
+}
@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMirrorResults(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	mirror := NewMemStore("mirror")
+	topic := NewMemQueue(0)
+	h.worker.MirrorStore = mirror
+	h.worker.MirrorTopic = topic
+
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	res := h.result()
+	postPath := res.Files.PostState[len(h.results.URL("")):]
+	deadline := time.Now().Add(5 * time.Second)
+	for len(topic.Published()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected result to be published to the mirror topic")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if post, ok := mirror.Get(postPath); !ok || string(post) != "preblock0" {
+		t.Errorf("unexpected mirrored post state %q (found: %v)", post, ok)
+	}
+	if string(topic.Published()[0]) != string(h.queue.Published()[0]) {
+		t.Error("expected mirrored result message to equal the published one")
+	}
+}
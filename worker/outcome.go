@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// rejectsTransition returns true if the exit code of the client means it rejected the transition,
+// e.g. because of an invalid block, rather than that it crashed. See Config.RejectExitCodes.
+func (w *Worker) rejectsTransition(exitCode int) bool {
+	for _, c := range w.RejectExitCodes {
+		if c == exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// ExitInfo returns the ResultMsg exit info of the transition, or nil if the client did not run.
+func (out *transitionOutput) ExitInfo() *ExitInfo {
+	if out.InputError != "" {
+		return nil
+	}
+	return &ExitInfo{ExitCode: out.ExitCode, Signal: out.Signal, TimedOut: out.TimedOut}
+}
+
+// writeExitInfo writes the exit info of the transition as exit.json to the output dir, to upload next to the logs.
+// Nothing is written if the client did not run.
+func writeExitInfo(out *transitionOutput, outDir string) error {
+	info := out.ExitInfo()
+	if info == nil {
+		return nil
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(outDir, "exit.json")
+	if err := ioutil.WriteFile(p, data, 0644); err != nil {
+		return fmt.Errorf("failed to write exit info: %v", err)
+	}
+	out.ExitFile = p
+	return nil
+}
+
+// inputErrorOutput writes the logs of a task with inputs that failed to download or are invalid,
+// in place of running the client. The reason is the err log.
+func (w *Worker) inputErrorOutput(tr *TransitionMsg, outDir string) (*transitionOutput, error) {
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to make output directory %s: %v", outDir, err)
+	}
+	out := &transitionOutput{
+		InputError:  tr.InputError,
+		Stdout:      filepath.Join(outDir, "stdout.log"),
+		Stderr:      filepath.Join(outDir, "stderr.log"),
+		StdoutTimed: filepath.Join(outDir, "stdout_timed.log"),
+		StderrTimed: filepath.Join(outDir, "stderr_timed.log"),
+	}
+	msg := []byte("input error: " + tr.InputError + "\n")
+	var timed bytes.Buffer
+	if _, err := newTimedLineWriter(&timed, "", time.Now).Write(msg); err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{
+		out.Stdout:      nil,
+		out.Stderr:      msg,
+		out.StdoutTimed: nil,
+		out.StderrTimed: timed.Bytes(),
+	}
+	if w.CombinedLog {
+		out.Combined = filepath.Join(outDir, "combined.log")
+		files[out.Combined] = msg
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(name, data, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestResultStatuses(t *testing.T) {
+	post := map[string][]byte{"--post": []byte("post")}
+	cases := []struct {
+		name   string
+		runner *FakeRunner
+		status string
+	}{
+		{"success", &FakeRunner{OutputFiles: post}, StatusSuccess},
+		{"rejected", &FakeRunner{ExitCode: 1, Stderr: "invalid block\n"}, StatusTransitionRejected},
+		{"crash", &FakeRunner{ExitCode: 2, Stderr: "panic: nil pointer dereference\n"}, StatusClientCrash},
+		{"killed", &FakeRunner{ExitCode: -1}, StatusClientCrash},
+		{"missing post", &FakeRunner{}, StatusMissingPost},
+	}
+	for _, c := range cases {
+		h := newHarness(t, "", c.runner)
+		if !h.process(h.addTask("foo", []byte("pre"))) {
+			t.Errorf("%s: expected task to be acked", c.name)
+		} else if res := h.result(); res.Status != c.status || res.Success != (c.status == StatusSuccess) {
+			t.Errorf("%s: expected status %s, got %+v", c.name, c.status, res)
+		}
+		h.Close()
+	}
+}
+
+func TestExitInfo(t *testing.T) {
+	h := newHarness(t, "", &FakeRunner{ExitCode: -1, Signal: "killed"})
+	defer h.Close()
+
+	if !h.process(h.addTask("foo", []byte("pre"))) {
+		t.Fatal("expected task to be acked")
+	}
+	res := h.result()
+	if res.Exit == nil || *res.Exit != (ExitInfo{ExitCode: -1, Signal: "killed"}) {
+		t.Fatalf("unexpected exit info: %+v", res.Exit)
+	}
+	var uploaded ExitInfo
+	if err := json.Unmarshal(h.resultFile(res.Files.ExitInfo), &uploaded); err != nil {
+		t.Fatalf("failed to read uploaded exit info: %v", err)
+	}
+	if uploaded != *res.Exit {
+		t.Errorf("uploaded exit info %+v does not match result %+v", uploaded, res.Exit)
+	}
+
+	h.worker.Runner = &FakeRunner{Delay: 10 * time.Second}
+	h.worker.TransitionTimeout = 50 * time.Millisecond
+	if !h.process(h.addTask("bar", []byte("pre"))) {
+		t.Fatal("expected task to be acked")
+	}
+	published := h.published()
+	if res := published[len(published)-1]; res.Exit == nil || !res.Exit.TimedOut || res.Exit.ExitCode != -1 {
+		t.Errorf("expected timed out exit info: %+v", res.Exit)
+	}
+}
+
+func TestInfraFailureResults(t *testing.T) {
+	h := newHarness(t, "", &FakeRunner{OutputFiles: map[string][]byte{"--post": []byte("post")}})
+	defer h.Close()
+	h.worker.AckPolicy = map[string]string{ErrorClassInfra: ActionResult}
+
+	// the inputs of the task are missing
+	if !h.process(TransitionMsg{Blocks: 1, SpecVersion: "v0.8.3", SpecConfig: "minimal", Key: "missing"}) {
+		t.Fatal("expected task with missing inputs to be acked")
+	}
+	res := h.result()
+	if res.Status != StatusInputError || res.Success {
+		t.Fatalf("expected input-error result: %+v", res)
+	}
+	if res.Exit != nil || res.Files.ExitInfo != "" {
+		t.Errorf("expected no exit info without running the client: %+v", res)
+	}
+
+	h.worker.Results = &flakyStore{MemStore: h.results, failures: 100, reads: map[string]int{}, writes: map[string]int{}}
+	if !h.process(h.addTask("foo", []byte("pre"))) {
+		t.Fatal("expected task with failed uploads to be acked")
+	}
+	published := h.published()
+	if res := published[len(published)-1]; res.Status != StatusUploadFailed || res.Success || res.Key != "foo" {
+		t.Fatalf("expected upload-failed result: %+v", res)
+	}
+
+	// a result that cannot be published is not acked
+	h.worker.Results = h.results
+	h.worker.Queue = failingPublishQueue{h.queue}
+	if h.process(h.addTask("bar", []byte("pre"))) {
+		t.Error("expected task with a failed result publish to be nacked")
+	}
+}
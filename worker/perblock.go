@@ -0,0 +1,145 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// runsPerBlock returns true if the client runs the task block by block, see Config.PerBlockPosts.
+func (w *Worker) runsPerBlock(tr *TransitionMsg) bool {
+	return w.PerBlockPosts && tr.isBlockTransition() && tr.Blocks > 1
+}
+
+// blockPostName is the name of the intermediate post state after the block with the given index,
+// in the output dir of a client. The post state after the last block is post.ssz.
+func blockPostName(i int) string {
+	return fmt.Sprintf("post_%d.ssz", i)
+}
+
+// runPerBlock runs the client once per block of the invocation, with the post state of the previous block as pre state,
+// and stops at the first block that fails. Every run logs to its own block_<i> dir in the output dir,
+// and the logs are joined into the logs of the transition. The exit of the transition is the exit of the last run.
+func (w *Worker) runPerBlock(ctx context.Context, tr *TransitionMsg, c *taskClient, inv *Invocation, live *liveLogTarget) (*transitionOutput, error) {
+	outDir := c.outDir(tr)
+	var runs []*transitionOutput
+	for i, block := range inv.Blocks {
+		blockInv := *inv
+		blockInv.Blocks = []string{block}
+		blockInv.Inputs = blockInv.Blocks
+		if i > 0 {
+			blockInv.Pre = filepath.Join(outDir, blockPostName(i-1))
+		}
+		if i < len(inv.Blocks)-1 {
+			blockInv.Post = filepath.Join(outDir, blockPostName(i))
+		}
+		runDir := filepath.Join(outDir, fmt.Sprintf("block_%d", i))
+		if err := os.MkdirAll(runDir, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("failed to make output directory %s: %v", runDir, err)
+		}
+		out, err := w.runInvocation(ctx, tr, c, &blockInv, runDir, live)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, out)
+		if !out.Success || ctx.Err() != nil {
+			break
+		}
+		// the transition has no post state if the last block has none, see executeClient
+		if _, err := os.Stat(blockInv.Post); os.IsNotExist(err) {
+			break
+		}
+	}
+	return joinBlockRuns(runs, outDir)
+}
+
+// joinBlockRuns joins the outputs of the runs of a transition block by block into the output of the transition,
+// with the logs of the runs concatenated into the output dir.
+func joinBlockRuns(runs []*transitionOutput, outDir string) (*transitionOutput, error) {
+	last := runs[len(runs)-1]
+	out := *last
+	out.Duration = 0
+	out.Usage = nil
+	for _, run := range runs {
+		out.Duration += run.Duration
+		if run.Usage != nil {
+			if out.Usage == nil {
+				out.Usage = &ResourceUsage{}
+			}
+			out.Usage.UserMs += run.Usage.UserMs
+			out.Usage.SystemMs += run.Usage.SystemMs
+			if run.Usage.MaxRSS > out.Usage.MaxRSS {
+				out.Usage.MaxRSS = run.Usage.MaxRSS
+			}
+		}
+	}
+	logs := []func(run *transitionOutput) *string{
+		func(run *transitionOutput) *string { return &run.Stdout },
+		func(run *transitionOutput) *string { return &run.Stderr },
+		func(run *transitionOutput) *string { return &run.StdoutTimed },
+		func(run *transitionOutput) *string { return &run.StderrTimed },
+		func(run *transitionOutput) *string { return &run.Combined },
+	}
+	for _, logFile := range logs {
+		p := logFile(&out)
+		if *p == "" {
+			continue
+		}
+		joined := filepath.Join(outDir, filepath.Base(*p))
+		if err := joinBlockLogs(joined, runs, logFile); err != nil {
+			return nil, err
+		}
+		*p = joined
+	}
+	return &out, nil
+}
+
+// joinBlockLogs writes the log files of the runs to the destination, each after a header line with the block index.
+func joinBlockLogs(dest string, runs []*transitionOutput, logFile func(run *transitionOutput) *string) error {
+	f, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create log file: %v", err)
+	}
+	defer f.Close()
+	for i, run := range runs {
+		if _, err := fmt.Fprintf(f, "=== block %d ===\n", i); err != nil {
+			return err
+		}
+		in, err := os.Open(*logFile(run))
+		if err != nil {
+			return fmt.Errorf("failed to open log of block %d: %v", i, err)
+		}
+		_, err = io.Copy(f, in)
+		_ = in.Close()
+		if err != nil {
+			return fmt.Errorf("failed to join log of block %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// blockPostStates returns the intermediate post states of a transition that ran block by block,
+// in the order of the blocks, until the first block without a post state, and their flat-hashes.
+func blockPostStates(tr *TransitionMsg, outDir string) (files []string, hashes []string, err error) {
+	for i := 0; i < tr.Blocks-1; i++ {
+		p := filepath.Join(outDir, blockPostName(i))
+		f, err := os.Open(p)
+		if os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		_ = f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to hash %s: %v", p, err)
+		}
+		files = append(files, p)
+		hashes = append(hashes, fmt.Sprintf("0x%x", h.Sum(nil)))
+	}
+	return files, hashes, nil
+}
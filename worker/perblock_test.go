@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPerBlockPosts(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.PerBlockPosts = true
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"), []byte("block1"), []byte("block2"))) {
+		t.Fatal("expected task to be acked")
+	}
+	res := h.result()
+	if !res.Success {
+		t.Fatalf("expected success, got %s", res.Status)
+	}
+	// the fake client appends the blocks to the pre state
+	expected := []string{"preblock0", "preblock0block1"}
+	if len(res.BlockPostHashes) != 2 || len(res.Files.BlockPostStates) != 2 {
+		t.Fatalf("expected 2 intermediate post states, got %v, %v", res.BlockPostHashes, res.Files.BlockPostStates)
+	}
+	for i, post := range expected {
+		if data := string(h.resultFile(res.Files.BlockPostStates[i])); data != post {
+			t.Errorf("expected post state %q after block %d, got %q", post, i, data)
+		}
+		if hash := fmt.Sprintf("0x%x", sha256.Sum256([]byte(post))); res.BlockPostHashes[i] != hash {
+			t.Errorf("unexpected hash of post state after block %d: %s", i, res.BlockPostHashes[i])
+		}
+	}
+	if data := string(h.resultFile(res.Files.PostState)); data != "preblock0block1block2" {
+		t.Errorf("unexpected post state %q", data)
+	}
+	stdout := string(h.resultFile(res.Files.OutLog))
+	for i := 0; i < 3; i++ {
+		if !strings.Contains(stdout, fmt.Sprintf("=== block %d ===\nprocessing 1 blocks\n", i)) {
+			t.Errorf("expected the log of block %d in stdout: %q", i, stdout)
+		}
+	}
+
+	// single-block transitions run as usual
+	if !h.process(h.addTask("bar", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	if res := h.published()[1]; len(res.BlockPostHashes) != 0 || len(res.Files.BlockPostStates) != 0 {
+		t.Errorf("expected no intermediate post states, got %v", res.BlockPostHashes)
+	}
+}
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Preflight checks that the configured CLI binary, and that of every extra client, exists, is executable,
+// and responds to the preflight arguments (e.g. --help) with a zero exit code.
+// In a docker image, the binary is only checked by running it with the preflight arguments.
+func (w *Worker) Preflight() error {
+	for _, c := range w.taskClients() {
+		if err := w.preflightCmd(c.cliCmd); err != nil {
+			return fmt.Errorf("client %s: %v", c.name, err)
+		}
+	}
+	for _, t := range w.taskTypes() {
+		if cmd := w.TaskCliCmds[t]; cmd != "" {
+			if err := w.preflightCmd(cmd); err != nil {
+				return fmt.Errorf("%s tasks: %v", t, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (w *Worker) preflightCmd(cliCmd string) error {
+	if r, ok := w.Runner.(*GRPCRunner); ok {
+		return r.Check(time.Second * 10)
+	}
+	cmdParts, err := splitCommand(cliCmd)
+	if err != nil {
+		return err
+	}
+	if len(cmdParts) == 0 {
+		return fmt.Errorf("empty cli cmd")
+	}
+	if _, ok := w.Runner.(*DockerRunner); !ok {
+		if err := checkExecutable(cmdParts[0]); err != nil {
+			return err
+		}
+	}
+	if w.CliPreflightArgs == "" {
+		return nil
+	}
+	args := append(cmdParts[1:], strings.Split(w.CliPreflightArgs, " ")...)
+	// the arguments of a cli cmd with placeholders only make sense for a task
+	if hasPlaceholders(cliCmd) {
+		args = strings.Split(w.CliPreflightArgs, " ")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	var out bytes.Buffer
+	capped := capOutput(&out, 64<<10)
+	res, err := w.Runner.Run(ctx, Command{Name: cmdParts[0], Args: args, Env: w.clientEnv(nil, nil), Stdout: capped, Stderr: capped})
+	if err != nil {
+		return fmt.Errorf("failed to run %s %s: %v", cmdParts[0], strings.Join(args, " "), err)
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("%s %s exited with code %d, output:\n%s", cmdParts[0], strings.Join(args, " "), res.ExitCode, out.String())
+	}
+	return nil
+}
+
+func checkExecutable(name string) error {
+	binPath, err := exec.LookPath(name)
+	if err != nil {
+		return fmt.Errorf("cannot find executable %q of --cli-cmd: %v", name, err)
+	}
+	info, err := os.Stat(binPath)
+	if err != nil {
+		return fmt.Errorf("cannot stat executable %s: %v", binPath, err)
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return fmt.Errorf("%s is not an executable file", binPath)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup starts the command in a new process group, and sets its command line explicitly,
+// quoted as described by windowsCommandLine.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+		CmdLine:       windowsCommandLine(cmd.Args),
+	}
+}
+
+// killProcessGroup kills the process tree of the started command with taskkill,
+// Windows has no process group signals. Falls back to killing only the process if taskkill fails.
+func killProcessGroup(cmd *exec.Cmd) error {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+// exitSignal is always empty on Windows, processes are not killed by signals.
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
+
+// maxRSS is not reported on Windows.
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecRunnerQuotedArgs(t *testing.T) {
+	var out strings.Builder
+	res, err := ExecRunner{}.Run(context.Background(), Command{Name: "cmd", Args: []string{"/c", "echo", "two words"}, Stdout: &out, Stderr: &out})
+	if err != nil || res.ExitCode != 0 {
+		t.Fatalf("expected command to succeed, got exit code %d: %v", res.ExitCode, err)
+	}
+	if got := strings.TrimSpace(out.String()); got != `"two words"` {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
+
+func TestExecRunnerTaskkill(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var out strings.Builder
+	start := time.Now()
+	// the child keeps the output pipe open, unless the process tree is killed
+	_, err := ExecRunner{}.Run(ctx, Command{Name: "cmd", Args: []string{"/c", "ping -n 30 127.0.0.1"}, Stdout: &out, Stderr: &out})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("expected command to be killed at the deadline, took %s", d)
+	}
+}
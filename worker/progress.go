@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Task phases, reported in progress events.
+const (
+	PhaseDownloading = "downloading"
+	PhaseExecuting   = "executing"
+	PhaseUploading   = "uploading"
+	PhaseDone        = "done"
+)
+
+// ProgressMsg is a lightweight event published to the status topic while a task is processed.
+type ProgressMsg struct {
+	Type      string    `json:"type"`
+	WorkerID  string    `json:"worker-id"`
+	Key       string    `json:"key"`
+	ResultKey string    `json:"result-key"`
+	Phase     string    `json:"phase"`
+	Blocks    int       `json:"blocks"`
+	Time      time.Time `json:"time"`
+}
+
+// progress records the phase of the task, and publishes a progress event of the task, if a status topic is configured.
+// Failures are only logged.
+func (w *Worker) progress(tr *TransitionMsg, phase string) {
+	w.setPhase(tr, phase)
+	if w.StatusTopic == nil {
+		return
+	}
+	data, err := json.Marshal(&ProgressMsg{
+		Type:      "progress",
+		WorkerID:  w.WorkerID,
+		Key:       tr.Key,
+		ResultKey: tr.ResultKey,
+		Phase:     phase,
+		Blocks:    tr.Blocks,
+		Time:      w.now(),
+	})
+	if err != nil {
+		log.Printf("failed to encode progress event: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	if err := w.StatusTopic.Publish(ctx, data); err != nil {
+		log.Printf("failed to publish %s progress of %s: %v", phase, tr.Key, err)
+	}
+}
@@ -0,0 +1,264 @@
+package worker
+
+import (
+	"cloud.google.com/go/pubsub"
+	"context"
+	"fmt"
+	"time"
+)
+
+// QueueMessage is a single task delivery. Exactly one of Ack or Nack should be called when done with it.
+type QueueMessage struct {
+	Data       []byte
+	Attributes map[string]string
+	// received from a PriorityQueue
+	urgent bool
+	ack    func()
+	nack   func()
+}
+
+// Ack marks the task as handled, it will not be delivered again.
+func (m *QueueMessage) Ack() {
+	if m.ack != nil {
+		m.ack()
+	}
+}
+
+// Nack marks the task as not handled, it may be redelivered.
+func (m *QueueMessage) Nack() {
+	if m.nack != nil {
+		m.nack()
+	}
+}
+
+// TaskQueue delivers transition tasks to the worker, and takes the results back.
+type TaskQueue interface {
+	// Receive calls f for every task, until ctx is canceled or the queue fails.
+	Receive(ctx context.Context, f func(ctx context.Context, msg *QueueMessage)) error
+	// Publish sends a result message.
+	Publish(ctx context.Context, data []byte) error
+}
+
+// defaultMaxOutstanding is the maximum number of messages being handled at the same time, per queue,
+// if the backend is not limited to a specific number.
+const defaultMaxOutstanding = 20
+
+// outstandingLimit returns the maximum number of messages being handled at the same time,
+// for a backend limited to max messages, or unlimited if 0.
+func outstandingLimit(max int) int {
+	if max > 0 {
+		return max
+	}
+	return defaultMaxOutstanding
+}
+
+// QueueBackend opens the queues and topics of a messaging service.
+type QueueBackend interface {
+	// TaskQueue opens a queue that receives from the subscription, and publishes results to the topic.
+	// Publishing is not supported if the results topic is empty.
+	TaskQueue(subId string, resultsTopic string) (TaskQueue, error)
+	// Topic opens a publisher for the topic.
+	Topic(name string) (Publisher, error)
+}
+
+// PubsubReceiveSettings configures how Pub/Sub subscriptions receive messages, see pubsub.ReceiveSettings.
+type PubsubReceiveSettings struct {
+	// The maximum number of messages being handled at the same time, per subscription.
+	// The worker concurrency (or the default, if unlimited) if 0.
+	MaxOutstandingMessages int
+	// The maximum size of the messages being handled at the same time, per subscription. Unlimited if -1.
+	MaxOutstandingBytes int
+	// The number of goroutines pulling messages, per subscription.
+	NumGoroutines int
+	// Pull messages with synchronous pull requests instead of a streaming pull.
+	Synchronous bool
+}
+
+// DefaultPubsubReceiveSettings fits small task messages, handled at the worker concurrency.
+var DefaultPubsubReceiveSettings = PubsubReceiveSettings{
+	MaxOutstandingBytes: 10 << 20,
+	NumGoroutines:       4,
+	Synchronous:         true,
+}
+
+// Validate checks that the settings are in range.
+func (s PubsubReceiveSettings) Validate() error {
+	if s.MaxOutstandingMessages < 0 {
+		return fmt.Errorf("max outstanding messages must not be negative, got %d", s.MaxOutstandingMessages)
+	}
+	if s.MaxOutstandingBytes == 0 || s.MaxOutstandingBytes < -1 {
+		return fmt.Errorf("max outstanding bytes must be positive, or -1 for unlimited, got %d", s.MaxOutstandingBytes)
+	}
+	if s.NumGoroutines < 1 {
+		return fmt.Errorf("the number of goroutines must be at least 1, got %d", s.NumGoroutines)
+	}
+	return nil
+}
+
+// receiveSettings returns the Pub/Sub settings, with at most maxOutstanding messages at a time if not configured,
+// or the default if 0.
+func (s PubsubReceiveSettings) receiveSettings(maxOutstanding int) pubsub.ReceiveSettings {
+	messages := s.MaxOutstandingMessages
+	if messages == 0 {
+		messages = outstandingLimit(maxOutstanding)
+	}
+	return pubsub.ReceiveSettings{
+		MaxExtension:           -1,
+		MaxOutstandingMessages: messages,
+		MaxOutstandingBytes:    s.MaxOutstandingBytes,
+		NumGoroutines:          s.NumGoroutines,
+		Synchronous:            s.Synchronous,
+	}
+}
+
+// pubsubBackend opens GCP Pub/Sub subscriptions and topics.
+type pubsubBackend struct {
+	client *pubsub.Client
+	// the maximum number of messages being handled at the same time, per subscription. The default if 0.
+	maxOutstanding int
+	settings       PubsubReceiveSettings
+}
+
+// NewPubsubBackend opens subscriptions with the receive settings, handling up to maxOutstanding messages per subscription.
+func NewPubsubBackend(client *pubsub.Client, maxOutstanding int, settings PubsubReceiveSettings) QueueBackend {
+	return &pubsubBackend{client: client, maxOutstanding: maxOutstanding, settings: settings}
+}
+
+func (b *pubsubBackend) TaskQueue(subId string, resultsTopic string) (TaskQueue, error) {
+	sub, err := openSubscription(b.client, subId, b.settings.receiveSettings(b.maxOutstanding))
+	if err != nil {
+		return nil, err
+	}
+	q := &pubsubQueue{sub: sub}
+	if resultsTopic != "" {
+		q.results = b.client.Topic(resultsTopic)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		ok, err := q.results.Exists(ctx)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("could not check if results topic %s exists: %v", resultsTopic, err)
+		} else if !ok {
+			return nil, fmt.Errorf("results topic %s does not exist", resultsTopic)
+		}
+	}
+	return q, nil
+}
+
+func (b *pubsubBackend) Topic(name string) (Publisher, error) {
+	return &topicPublisher{topic: b.client.Topic(name)}, nil
+}
+
+type pubsubQueue struct {
+	sub     *pubsub.Subscription
+	results *pubsub.Topic
+}
+
+func (q *pubsubQueue) Receive(ctx context.Context, f func(ctx context.Context, msg *QueueMessage)) error {
+	return q.sub.Receive(ctx, func(ctx context.Context, message *pubsub.Message) {
+		f(ctx, &QueueMessage{
+			Data:       message.Data,
+			Attributes: message.Attributes,
+			ack:        message.Ack,
+			nack:       message.Nack,
+		})
+	})
+}
+
+func (q *pubsubQueue) Publish(ctx context.Context, data []byte) error {
+	if q.results == nil {
+		return fmt.Errorf("subscription %s does not publish results", q.sub.ID())
+	}
+	return q.PublishWithAttributes(ctx, data, nil)
+}
+
+func (q *pubsubQueue) PublishWithAttributes(ctx context.Context, data []byte, attributes map[string]string) error {
+	if q.results == nil {
+		return fmt.Errorf("subscription %s does not publish results", q.sub.ID())
+	}
+	_, err := q.results.Publish(ctx, &pubsub.Message{Data: data, Attributes: attributes}).Get(ctx)
+	return err
+}
+
+// Publisher sends messages to a topic, e.g. for worker status or capabilities.
+type Publisher interface {
+	Publish(ctx context.Context, data []byte) error
+}
+
+type topicPublisher struct {
+	topic *pubsub.Topic
+}
+
+func (p *topicPublisher) Publish(ctx context.Context, data []byte) error {
+	return p.PublishWithAttributes(ctx, data, nil)
+}
+
+func (p *topicPublisher) PublishWithAttributes(ctx context.Context, data []byte, attributes map[string]string) error {
+	_, err := p.topic.Publish(ctx, &pubsub.Message{Data: data, Attributes: attributes}).Get(ctx)
+	return err
+}
+
+// MultiQueue receives tasks from all of its queues concurrently, and publishes results to the first.
+type MultiQueue []TaskQueue
+
+func (q MultiQueue) Receive(ctx context.Context, f func(ctx context.Context, msg *QueueMessage)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(q))
+	for _, sub := range q {
+		go func(sub TaskQueue) {
+			errs <- sub.Receive(ctx, f)
+		}(sub)
+	}
+	var firstErr error
+	for range q {
+		// stop all other queues if one of them fails
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	return firstErr
+}
+
+func (q MultiQueue) Publish(ctx context.Context, data []byte) error {
+	return q[0].Publish(ctx, data)
+}
+
+func (q MultiQueue) PublishWithAttributes(ctx context.Context, data []byte, attributes map[string]string) error {
+	ap, ok := q[0].(AttributePublisher)
+	if !ok {
+		return fmt.Errorf("queue does not support message attributes")
+	}
+	return ap.PublishWithAttributes(ctx, data, attributes)
+}
+
+// PriorityQueue marks the tasks it receives as urgent: they get the next free task slot
+// before any waiting task of a normal queue, see Config.Concurrency. Results are published to the wrapped queue.
+type PriorityQueue struct {
+	TaskQueue
+}
+
+func (q PriorityQueue) Receive(ctx context.Context, f func(ctx context.Context, msg *QueueMessage)) error {
+	return q.TaskQueue.Receive(ctx, func(ctx context.Context, msg *QueueMessage) {
+		msg.urgent = true
+		f(ctx, msg)
+	})
+}
+
+// openSubscription checks if the subscription exists, and configures it to receive tasks with the settings.
+func openSubscription(pubsubClient *pubsub.Client, subId string, settings pubsub.ReceiveSettings) (*pubsub.Subscription, error) {
+	sub := pubsubClient.Subscription(subId)
+	// check if the subscription exists
+	{
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+		exists, err := sub.Exists(ctx)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("could not check if pubsub subscription exists: %v", err)
+		} else if !exists {
+			return nil, fmt.Errorf("subscription %s does not exist. Either the worker was misconfigured (try --spec-version, --spec-config, --client-name, --worker-id) or a new subscription needs to be created and permissioned", subId)
+		}
+	}
+	sub.ReceiveSettings = settings
+	return sub, nil
+}
@@ -0,0 +1,162 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// dirPollInterval is how often a watched directory is checked for new task files.
+	dirPollInterval = time.Second
+	// task files are renamed with these suffixes while they are processed, and after they are acked.
+	dirProcessingSuffix = ".processing"
+	dirDoneSuffix       = ".done"
+	// results are written next to the task files, with this suffix.
+	dirResultSuffix = ".result.json"
+)
+
+// dirBackend uses a local directory as queue: task files are picked up from the directory itself,
+// other subscriptions are subdirectories named after the subscription,
+// and topics are files named after the topic, with a JSON message per line.
+type dirBackend struct {
+	dir string
+	// the maximum number of tasks being handled at the same time, per directory. The default if 0.
+	maxOutstanding int
+}
+
+// NewDirBackend uses the directory as queue, handling up to maxOutstanding tasks per directory.
+func NewDirBackend(dir string, maxOutstanding int) QueueBackend {
+	return &dirBackend{dir: dir, maxOutstanding: maxOutstanding}
+}
+
+func (b *dirBackend) TaskQueue(subId string, resultsTopic string) (TaskQueue, error) {
+	dir := b.dir
+	// only task subscriptions publish results, other subscriptions get their own directory
+	if resultsTopic == "" {
+		dir = filepath.Join(b.dir, natsName(subId))
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create watch dir: %v", err)
+	}
+	return &dirQueue{dir: dir, maxOutstanding: outstandingLimit(b.maxOutstanding)}, nil
+}
+
+func (b *dirBackend) Topic(name string) (Publisher, error) {
+	return &filePublisher{path: filepath.Join(b.dir, natsName(name)+".jsonl")}, nil
+}
+
+// dirQueue picks up JSON task files (*.json) that are dropped into a directory.
+// A task file is renamed to <file>.processing while the task is processed,
+// to <file>.done when the task is acked, and back to <file> when the task is nacked, to retry it.
+type dirQueue struct {
+	dir            string
+	maxOutstanding int
+}
+
+func (q *dirQueue) Receive(ctx context.Context, f func(ctx context.Context, msg *QueueMessage)) error {
+	// tasks that were being processed when the worker stopped are picked up again
+	leftovers, err := filepath.Glob(filepath.Join(q.dir, "*.json"+dirProcessingSuffix))
+	if err != nil {
+		return err
+	}
+	for _, p := range leftovers {
+		if err := os.Rename(p, strings.TrimSuffix(p, dirProcessingSuffix)); err != nil {
+			log.Printf("failed to reset task file %s: %v", p, err)
+		}
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	slots := make(chan struct{}, q.maxOutstanding)
+	ticker := time.NewTicker(dirPollInterval)
+	defer ticker.Stop()
+	for {
+		paths, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			if strings.HasSuffix(p, dirResultSuffix) {
+				continue
+			}
+			// leave the remaining task files for the next poll if all slots are taken
+			if len(slots) == cap(slots) {
+				break
+			}
+			processing := p + dirProcessingSuffix
+			// claim the task file, another receiver may have claimed it first
+			if err := os.Rename(p, processing); err != nil {
+				continue
+			}
+			data, err := ioutil.ReadFile(processing)
+			if err != nil {
+				log.Printf("failed to read task file %s: %v", processing, err)
+				_ = os.Rename(processing, p)
+				continue
+			}
+			var once sync.Once
+			finish := func(dest string) func() {
+				return func() {
+					once.Do(func() {
+						if err := os.Rename(processing, dest); err != nil {
+							log.Printf("failed to rename task file %s: %v", processing, err)
+						}
+					})
+				}
+			}
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(msg *QueueMessage) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				f(ctx, msg)
+			}(&QueueMessage{Data: data, ack: finish(p + dirDoneSuffix), nack: finish(p)})
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Publish writes the result to <key>.result.json in the directory, next to the task files.
+func (q *dirQueue) Publish(ctx context.Context, data []byte) error {
+	res, err := DecodeResult(data)
+	if err != nil || res.Key == "" {
+		return fmt.Errorf("expected a result message with a key")
+	}
+	p := filepath.Join(q.dir, natsName(res.Key)+dirResultSuffix)
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// filePublisher appends every message to a file, as a line.
+type filePublisher struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (p *filePublisher) Publish(ctx context.Context, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, err := os.OpenFile(p.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if !strings.HasSuffix(string(data), "\n") {
+		data = append(append([]byte(nil), data...), '\n')
+	}
+	_, err = f.Write(data)
+	return err
+}
@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muskoka-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script, err := filepath.Abs("testdata/fake_client.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := NewDirStore(filepath.Join(dir, "inputs"))
+	for name, data := range map[string]string{"v0.8.3/minimal/foo/pre.ssz": "pre", "v0.8.3/minimal/foo/block_0.ssz": "block0"} {
+		wr := inputs.NewWriter(context.Background(), name)
+		if _, err := wr.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if err := wr.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backend := &dirBackend{dir: filepath.Join(dir, "tasks")}
+	q, err := backend.TaskQueue("v0.8.3~minimal~fakeclient~test", "results~fakeclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := []byte(`{"blocks": 1, "spec-version": "v0.8.3", "spec-config": "minimal", "key": "foo"}`)
+	if err := ioutil.WriteFile(filepath.Join(backend.dir, "foo.json"), task, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &Worker{
+		Config: Config{
+			CliCmd:        "sh " + script,
+			SpecVersion:   "v0.8.3",
+			SpecConfigs:   []string{"minimal"},
+			ClientName:    "fakeclient",
+			ClientVersion: "v0.0.1_abc",
+			CleanupTmp:    true,
+		},
+		Inputs:  inputs,
+		Results: NewDirStore(filepath.Join(dir, "results")),
+		Queue:   q,
+		Runner:  ExecRunner{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("worker stopped with error: %v", err)
+		}
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(backend.dir, "foo.json.done")); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected task file to be marked as done")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(backend.dir, "foo.result.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res ResultMsg
+	if err := json.Unmarshal(data, &res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Success || res.Key != "foo" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	post, err := ioutil.ReadFile(res.Files.PostState[len("file://"):])
+	if err != nil || string(post) != "preblock0" {
+		t.Errorf("unexpected post state %q: %v", post, err)
+	}
+}
+
+func TestDirQueueMaxOutstanding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muskoka-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	backend := &dirBackend{dir: dir, maxOutstanding: 2}
+	q, err := backend.TaskQueue("tasks", "results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.json", "b.json", "c.json"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(`{}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan *QueueMessage, 3)
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Receive(ctx, func(ctx context.Context, msg *QueueMessage) {
+			received <- msg
+			<-ctx.Done()
+			msg.Nack()
+		})
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected a task to be received")
+		}
+	}
+	select {
+	case <-received:
+		t.Error("expected no more than 2 tasks at a time")
+	case <-time.After(3 * dirPollInterval):
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("receive stopped with error: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// httpTaskIDHeader is the response header with the ID of a task, to ack or nack it with.
+	httpTaskIDHeader = "Task-Id"
+)
+
+// httpBackend polls a task endpoint of the coordinator for tasks, and posts results and events back:
+//
+//	GET  <endpoint>?subscription=<sub>: a task message, or 204 No Content if there is none.
+//	POST <endpoint>?topic=<topic>: publish the message in the request body.
+//	POST <endpoint>?ack=<task id>, POST <endpoint>?nack=<task id>: for tasks with a Task-Id response header.
+type httpBackend struct {
+	endpoint     string
+	token        string
+	pollInterval time.Duration
+	client       *http.Client
+	// the maximum number of tasks being handled at the same time, per subscription. The default if 0.
+	maxOutstanding int
+}
+
+func NewHTTPBackend(endpoint string, token string, pollInterval time.Duration, maxOutstanding int) *httpBackend {
+	return &httpBackend{endpoint: endpoint, token: token, pollInterval: pollInterval, client: &http.Client{Timeout: time.Minute}, maxOutstanding: maxOutstanding}
+}
+
+func (b *httpBackend) TaskQueue(subId string, resultsTopic string) (TaskQueue, error) {
+	return &httpQueue{backend: b, subId: subId, results: resultsTopic}, nil
+}
+
+func (b *httpBackend) Topic(name string) (Publisher, error) {
+	return &httpQueue{backend: b, results: name}, nil
+}
+
+// do sends a request to the endpoint, with the given query parameter, and returns the response status and body.
+func (b *httpBackend) do(ctx context.Context, method string, param string, value string, body []byte) (int, http.Header, []byte, error) {
+	req, err := http.NewRequest(method, b.endpoint+"?"+url.Values{param: {value}}.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := b.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return resp.StatusCode, nil, nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return resp.StatusCode, resp.Header, data, nil
+}
+
+// httpQueue polls the task endpoint for tasks of a subscription, and posts results to a topic.
+type httpQueue struct {
+	backend *httpBackend
+	subId   string
+	results string
+}
+
+func (q *httpQueue) Receive(ctx context.Context, f func(ctx context.Context, msg *QueueMessage)) error {
+	return receivePulled(ctx, outstandingLimit(q.backend.maxOutstanding), 0, q.fetch, f)
+}
+
+func (q *httpQueue) fetch(ctx context.Context, max int) ([]*pulledMessage, error) {
+	status, header, data, err := q.backend.do(ctx, "GET", "subscription", q.subId, nil)
+	if err != nil || status == http.StatusNoContent || len(data) == 0 {
+		if err != nil && ctx.Err() == nil {
+			log.Printf("failed to poll task endpoint for %s, retrying: %v", q.subId, err)
+		}
+		// wait before polling again
+		select {
+		case <-ctx.Done():
+		case <-time.After(q.backend.pollInterval):
+		}
+		return nil, nil
+	}
+	id := header.Get(httpTaskIDHeader)
+	report := func(param string) func() {
+		return func() {
+			if id == "" {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			defer cancel()
+			if _, _, _, err := q.backend.do(ctx, "POST", param, id, nil); err != nil {
+				log.Printf("failed to %s task %s: %v", param, id, err)
+			}
+		}
+	}
+	return []*pulledMessage{{
+		id:  id,
+		msg: &QueueMessage{Data: data, ack: report("ack"), nack: report("nack")},
+	}}, nil
+}
+
+func (q *httpQueue) Publish(ctx context.Context, data []byte) error {
+	if q.results == "" {
+		return fmt.Errorf("subscription %s does not publish results", q.subId)
+	}
+	_, _, _, err := q.backend.do(ctx, "POST", "topic", q.results, data)
+	return err
+}
@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPQueue(t *testing.T) {
+	var mu sync.Mutex
+	tasks := [][]byte{[]byte(`{"blocks": 0, "spec-version": "v0.8.3", "spec-config": "minimal", "key": "foo"}`)}
+	var posted []string
+	acked := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer secret" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		q := req.URL.Query()
+		switch {
+		case req.Method == "GET" && q.Get("subscription") == "v0.8.3~minimal~fakeclient~test":
+			if len(tasks) == 0 {
+				rw.WriteHeader(http.StatusNoContent)
+				return
+			}
+			rw.Header().Set(httpTaskIDHeader, "task-1")
+			_, _ = rw.Write(tasks[0])
+			tasks = tasks[1:]
+		case req.Method == "POST" && q.Get("topic") != "":
+			data, _ := ioutil.ReadAll(req.Body)
+			posted = append(posted, q.Get("topic")+" "+string(data))
+		case req.Method == "POST" && q.Get("ack") != "":
+			acked <- q.Get("ack")
+		default:
+			rw.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	q, err := NewHTTPBackend(srv.URL, "secret", 10*time.Millisecond, 0).TaskQueue("v0.8.3~minimal~fakeclient~test", "results~fakeclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := NewMemStore("inputs")
+	inputs.Put("v0.8.3/minimal/foo/pre.ssz", []byte("pre"))
+	w := &Worker{
+		Config: Config{
+			SpecVersion:   "v0.8.3",
+			SpecConfigs:   []string{"minimal"},
+			ClientName:    "fakeclient",
+			ClientVersion: "v0.0.1_abc",
+			CleanupTmp:    true,
+		},
+		Inputs:  inputs,
+		Results: NewMemStore("results"),
+		Queue:   q,
+		Runner:  &FakeRunner{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("worker stopped with error: %v", err)
+		}
+	}()
+
+	select {
+	case id := <-acked:
+		if id != "task-1" {
+			t.Errorf("unexpected acked task: %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected task to be acked")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(posted) != 1 || posted[0][:len("results~fakeclient {")] != "results~fakeclient {" {
+		t.Errorf("unexpected posted results: %v", posted)
+	}
+}
@@ -0,0 +1,140 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"log"
+	"regexp"
+	"time"
+)
+
+const (
+	// natsFetchWait is how long a fetch waits for messages.
+	natsFetchWait = time.Second * 20
+	// natsProgressInterval is how often a message that is being handled is marked as in progress,
+	// to reset the ack wait of the consumer (30s by default).
+	natsProgressInterval = time.Second * 10
+)
+
+var natsInvalidNameChars = regexp.MustCompile("[^a-zA-Z0-9_~-]")
+
+// natsName converts a subscription or topic name to a subject and durable consumer name without separators,
+// e.g. "v0.8.3~minimal~zrnt~poc" to "v0-8-3~minimal~zrnt~poc".
+func natsName(name string) string {
+	return natsInvalidNameChars.ReplaceAllString(name, "-")
+}
+
+// natsBackend receives from durable JetStream pull consumers, and publishes to JetStream subjects.
+// The streams that capture the subjects are managed by the operator.
+type natsBackend struct {
+	js nats.JetStreamContext
+	// the maximum number of messages being handled at the same time, per consumer. The default if 0.
+	maxOutstanding int
+}
+
+func NewNATSBackend(url string, maxOutstanding int) (*natsBackend, error) {
+	nc, err := nats.Connect(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %v", err)
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open JetStream context: %v", err)
+	}
+	return &natsBackend{js: js, maxOutstanding: maxOutstanding}, nil
+}
+
+func (b *natsBackend) TaskQueue(subId string, resultsTopic string) (TaskQueue, error) {
+	name := natsName(subId)
+	sub, err := b.js.PullSubscribe(name, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s: %v", name, err)
+	}
+	q := &natsQueue{js: b.js, sub: sub, maxOutstanding: outstandingLimit(b.maxOutstanding)}
+	if resultsTopic != "" {
+		q.results = natsName(resultsTopic)
+	}
+	return q, nil
+}
+
+func (b *natsBackend) Topic(name string) (Publisher, error) {
+	return &natsQueue{js: b.js, results: natsName(name)}, nil
+}
+
+// natsQueue receives tasks from a pull consumer, and publishes results to a subject.
+type natsQueue struct {
+	js             nats.JetStreamContext
+	sub            *nats.Subscription
+	results        string
+	maxOutstanding int
+}
+
+func (q *natsQueue) Receive(ctx context.Context, f func(ctx context.Context, msg *QueueMessage)) error {
+	return receivePulled(ctx, q.maxOutstanding, natsProgressInterval, q.fetch, f)
+}
+
+func (q *natsQueue) fetch(ctx context.Context, max int) ([]*pulledMessage, error) {
+	fetchCtx, cancel := context.WithTimeout(ctx, natsFetchWait)
+	defer cancel()
+	msgs, err := q.sub.Fetch(max, nats.Context(fetchCtx))
+	if err != nil {
+		if ctx.Err() == nil && (err == nats.ErrTimeout || err == context.DeadlineExceeded) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to fetch from %s: %v", q.sub.Subject, err)
+	}
+	out := make([]*pulledMessage, 0, len(msgs))
+	for _, m := range msgs {
+		out = append(out, natsPulled(m))
+	}
+	return out, nil
+}
+
+func natsPulled(m *nats.Msg) *pulledMessage {
+	attrs := make(map[string]string)
+	for k := range m.Header {
+		attrs[k] = m.Header.Get(k)
+	}
+	return &pulledMessage{
+		id: m.Subject,
+		msg: &QueueMessage{
+			Data:       m.Data,
+			Attributes: attrs,
+			ack: func() {
+				if err := m.Ack(); err != nil {
+					log.Printf("failed to ack NATS message on %s: %v", m.Subject, err)
+				}
+			},
+			nack: func() {
+				if err := m.Nak(); err != nil {
+					log.Printf("failed to nack NATS message on %s: %v", m.Subject, err)
+				}
+			},
+		},
+		extend: func() error {
+			return m.InProgress()
+		},
+	}
+}
+
+func (q *natsQueue) Publish(ctx context.Context, data []byte) error {
+	if q.results == "" {
+		return fmt.Errorf("consumer %s does not publish results", q.sub.Subject)
+	}
+	_, err := q.js.Publish(q.results, data, nats.Context(ctx))
+	return err
+}
+
+// PublishWithAttributes publishes the result with the attributes as message headers.
+func (q *natsQueue) PublishWithAttributes(ctx context.Context, data []byte, attributes map[string]string) error {
+	if q.results == "" {
+		return fmt.Errorf("consumer %s does not publish results", q.sub.Subject)
+	}
+	m := &nats.Msg{Subject: q.results, Data: data, Header: make(nats.Header)}
+	for k, v := range attributes {
+		m.Header[k] = []string{v}
+	}
+	_, err := q.js.PublishMsg(m, nats.Context(ctx))
+	return err
+}
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// pullBatchSize is the maximum number of messages to fetch at once from a pull-based queue.
+const pullBatchSize = 10
+
+// pulledMessage is a message fetched from a pull-based queue.
+type pulledMessage struct {
+	msg *QueueMessage
+	// id identifies the message in logs
+	id string
+	// extend keeps the message from being redelivered while it is handled. Optional.
+	extend func() error
+}
+
+// receivePulled fetches messages and calls f for each of them concurrently, with at most maxOutstanding messages at a time,
+// until ctx is canceled or fetching fails. A message is extended every extendInterval until it is acked or nacked.
+// Fetch should return no messages, not an error, if none are available before it times out.
+func receivePulled(ctx context.Context, maxOutstanding int, extendInterval time.Duration,
+	fetch func(ctx context.Context, max int) ([]*pulledMessage, error), f func(ctx context.Context, msg *QueueMessage)) error {
+	slots := make(chan struct{}, maxOutstanding)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		// wait for at least one free slot
+		select {
+		case <-ctx.Done():
+			return nil
+		case slots <- struct{}{}:
+		}
+		max := 1 + maxOutstanding - len(slots)
+		if max > pullBatchSize {
+			max = pullBatchSize
+		}
+		msgs, err := fetch(ctx, max)
+		if err != nil {
+			<-slots
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if len(msgs) == 0 {
+			<-slots
+			continue
+		}
+		for i, m := range msgs {
+			// the first message uses the slot acquired before fetching
+			if i > 0 {
+				slots <- struct{}{}
+			}
+			wg.Add(1)
+			go func(m *pulledMessage) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				handlePulled(ctx, m, extendInterval, f)
+			}(m)
+		}
+	}
+}
+
+// handlePulled calls f with the message, and extends the message until it is acked or nacked.
+func handlePulled(ctx context.Context, m *pulledMessage, extendInterval time.Duration, f func(ctx context.Context, msg *QueueMessage)) {
+	var once sync.Once
+	done := make(chan struct{})
+	finish := func(action func()) func() {
+		return func() {
+			once.Do(func() {
+				close(done)
+				action()
+			})
+		}
+	}
+	if m.extend != nil {
+		go extendPulled(m, extendInterval, done)
+	}
+	msg := *m.msg
+	msg.ack = finish(m.msg.Ack)
+	msg.nack = finish(m.msg.Nack)
+	f(ctx, &msg)
+	// stop extending the message if it was neither acked nor nacked
+	once.Do(func() { close(done) })
+}
+
+// extendPulled extends the message every interval, until done is closed.
+func extendPulled(m *pulledMessage, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := m.extend(); err != nil {
+				log.Printf("failed to extend message %s: %v", m.id, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"log"
+	"regexp"
+	"time"
+)
+
+const (
+	// sqsVisibilityTimeout is how long a received message stays invisible to other workers.
+	// It is extended while the message is being handled.
+	sqsVisibilityTimeout = 60
+	// sqsWaitTimeSeconds is the long-polling duration of a receive call.
+	sqsWaitTimeSeconds = 20
+)
+
+var sqsInvalidNameChars = regexp.MustCompile("[^a-zA-Z0-9_-]")
+
+// sqsQueueName converts a subscription or topic name to a valid SQS queue name,
+// e.g. "v0.8.3~minimal~zrnt~poc" to "v0-8-3-minimal-zrnt-poc".
+func sqsQueueName(name string) string {
+	return sqsInvalidNameChars.ReplaceAllString(name, "-")
+}
+
+// sqsBackend opens SQS queues by name, for both receiving and publishing.
+type sqsBackend struct {
+	client sqsiface.SQSAPI
+	// the maximum number of messages being handled at the same time, per queue. The default if 0.
+	maxOutstanding int
+}
+
+// NewSQSBackend opens SQS queues with the client, handling up to maxOutstanding messages per queue.
+func NewSQSBackend(client sqsiface.SQSAPI, maxOutstanding int) QueueBackend {
+	return &sqsBackend{client: client, maxOutstanding: maxOutstanding}
+}
+
+func (b *sqsBackend) queueURL(name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+	out, err := b.client.GetQueueUrlWithContext(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(sqsQueueName(name))})
+	if err != nil {
+		return "", fmt.Errorf("could not find SQS queue %s: %v", sqsQueueName(name), err)
+	}
+	return aws.StringValue(out.QueueUrl), nil
+}
+
+func (b *sqsBackend) TaskQueue(subId string, resultsTopic string) (TaskQueue, error) {
+	url, err := b.queueURL(subId)
+	if err != nil {
+		return nil, err
+	}
+	q := &sqsQueue{client: b.client, url: url, maxOutstanding: outstandingLimit(b.maxOutstanding)}
+	if resultsTopic != "" {
+		if q.resultsURL, err = b.queueURL(resultsTopic); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+func (b *sqsBackend) Topic(name string) (Publisher, error) {
+	url, err := b.queueURL(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqsQueue{client: b.client, resultsURL: url}, nil
+}
+
+// sqsQueue receives tasks from an SQS queue, and publishes results to another SQS queue.
+// Acking deletes the message, nacking makes it visible again immediately.
+type sqsQueue struct {
+	client         sqsiface.SQSAPI
+	url            string
+	resultsURL     string
+	maxOutstanding int
+}
+
+func (q *sqsQueue) Receive(ctx context.Context, f func(ctx context.Context, msg *QueueMessage)) error {
+	return receivePulled(ctx, q.maxOutstanding, time.Second*sqsVisibilityTimeout/2, q.fetch, f)
+}
+
+func (q *sqsQueue) fetch(ctx context.Context, max int) ([]*pulledMessage, error) {
+	out, err := q.client.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(q.url),
+		MaxNumberOfMessages:   aws.Int64(int64(max)),
+		VisibilityTimeout:     aws.Int64(sqsVisibilityTimeout),
+		WaitTimeSeconds:       aws.Int64(sqsWaitTimeSeconds),
+		MessageAttributeNames: []*string{aws.String("All")},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive from SQS queue %s: %v", q.url, err)
+	}
+	msgs := make([]*pulledMessage, 0, len(out.Messages))
+	for _, m := range out.Messages {
+		msgs = append(msgs, q.pulled(m))
+	}
+	return msgs, nil
+}
+
+// pulled wraps the SQS message: acking deletes it, nacking and extending change its visibility timeout.
+func (q *sqsQueue) pulled(m *sqs.Message) *pulledMessage {
+	id := aws.StringValue(m.MessageId)
+	attrs := make(map[string]string)
+	for k, v := range m.MessageAttributes {
+		if v.StringValue != nil {
+			attrs[k] = *v.StringValue
+		}
+	}
+	setVisibility := func(seconds int64) error {
+		_, err := q.client.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(q.url),
+			ReceiptHandle:     m.ReceiptHandle,
+			VisibilityTimeout: aws.Int64(seconds),
+		})
+		return err
+	}
+	return &pulledMessage{
+		id: id,
+		msg: &QueueMessage{
+			Data:       []byte(aws.StringValue(m.Body)),
+			Attributes: attrs,
+			ack: func() {
+				if _, err := q.client.DeleteMessage(&sqs.DeleteMessageInput{QueueUrl: aws.String(q.url), ReceiptHandle: m.ReceiptHandle}); err != nil {
+					log.Printf("failed to ack SQS message %s: %v", id, err)
+				}
+			},
+			nack: func() {
+				if err := setVisibility(0); err != nil {
+					log.Printf("failed to nack SQS message %s: %v", id, err)
+				}
+			},
+		},
+		extend: func() error {
+			return setVisibility(sqsVisibilityTimeout)
+		},
+	}
+}
+
+func (q *sqsQueue) Publish(ctx context.Context, data []byte) error {
+	if q.resultsURL == "" {
+		return fmt.Errorf("queue %s does not publish results", q.url)
+	}
+	return q.PublishWithAttributes(ctx, data, nil)
+}
+
+// PublishWithAttributes publishes the result with the attributes as string message attributes.
+func (q *sqsQueue) PublishWithAttributes(ctx context.Context, data []byte, attributes map[string]string) error {
+	if q.resultsURL == "" {
+		return fmt.Errorf("queue %s does not publish results", q.url)
+	}
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.resultsURL),
+		MessageBody: aws.String(string(data)),
+	}
+	if len(attributes) > 0 {
+		input.MessageAttributes = make(map[string]*sqs.MessageAttributeValue)
+		for k, v := range attributes {
+			input.MessageAttributes[k] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+		}
+	}
+	_, err := q.client.SendMessageWithContext(ctx, input)
+	return err
+}
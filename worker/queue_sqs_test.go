@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"sync"
+	"testing"
+)
+
+// fakeSQS is an in-memory SQS with a single pending batch of messages per queue.
+type fakeSQS struct {
+	sqsiface.SQSAPI
+	mu        sync.Mutex
+	pending   map[string][]*sqs.Message
+	deleted   []string
+	visible   []string
+	sent      map[string][]string
+	delivered chan struct{}
+}
+
+func (f *fakeSQS) GetQueueUrlWithContext(ctx aws.Context, in *sqs.GetQueueUrlInput, opts ...request.Option) (*sqs.GetQueueUrlOutput, error) {
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs/" + *in.QueueName)}, nil
+}
+
+func (f *fakeSQS) ReceiveMessageWithContext(ctx aws.Context, in *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	msgs := f.pending[*in.QueueUrl]
+	delete(f.pending, *in.QueueUrl)
+	f.mu.Unlock()
+	if len(msgs) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &sqs.ReceiveMessageOutput{Messages: msgs}, nil
+}
+
+func (f *fakeSQS) DeleteMessage(in *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	f.mu.Lock()
+	f.deleted = append(f.deleted, *in.ReceiptHandle)
+	f.mu.Unlock()
+	f.delivered <- struct{}{}
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibility(in *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
+	if *in.VisibilityTimeout == 0 {
+		f.mu.Lock()
+		f.visible = append(f.visible, *in.ReceiptHandle)
+		f.mu.Unlock()
+		f.delivered <- struct{}{}
+	}
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (f *fakeSQS) SendMessageWithContext(ctx aws.Context, in *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent[*in.QueueUrl] = append(f.sent[*in.QueueUrl], *in.MessageBody)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func TestSQSQueue(t *testing.T) {
+	if name := sqsQueueName("v0.8.3~minimal~zrnt~poc"); name != "v0-8-3-minimal-zrnt-poc" {
+		t.Errorf("unexpected queue name: %s", name)
+	}
+	fake := &fakeSQS{
+		pending: map[string][]*sqs.Message{"https://sqs/tasks": {
+			{Body: aws.String("ok"), ReceiptHandle: aws.String("r0"), MessageId: aws.String("m0")},
+			{Body: aws.String("retry"), ReceiptHandle: aws.String("r1"), MessageId: aws.String("m1"),
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{"signature": {StringValue: aws.String("sig")}}},
+		}},
+		sent:      make(map[string][]string),
+		delivered: make(chan struct{}, 2),
+	}
+	backend := &sqsBackend{client: fake}
+	q, err := backend.TaskQueue("tasks", "results~zrnt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Receive(ctx, func(ctx context.Context, msg *QueueMessage) {
+			if string(msg.Data) == "ok" {
+				if err := q.Publish(ctx, []byte("result")); err != nil {
+					t.Error(err)
+				}
+				msg.Ack()
+			} else {
+				if msg.Attributes["signature"] != "sig" {
+					t.Errorf("unexpected attributes: %v", msg.Attributes)
+				}
+				msg.Nack()
+			}
+		})
+	}()
+	<-fake.delivered
+	<-fake.delivered
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.deleted) != 1 || fake.deleted[0] != "r0" || len(fake.visible) != 1 || fake.visible[0] != "r1" {
+		t.Errorf("unexpected acks: deleted %v, nacked %v", fake.deleted, fake.visible)
+	}
+	if sent := fake.sent["https://sqs/results-zrnt"]; len(sent) != 1 || sent[0] != "result" {
+		t.Errorf("unexpected published results: %v", fake.sent)
+	}
+}
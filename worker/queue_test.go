@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPubsubReceiveSettings(t *testing.T) {
+	if err := DefaultPubsubReceiveSettings.Validate(); err != nil {
+		t.Fatalf("expected default settings to be valid: %v", err)
+	}
+	rs := DefaultPubsubReceiveSettings.receiveSettings(0)
+	if rs.MaxOutstandingMessages != defaultMaxOutstanding || rs.MaxOutstandingBytes != 10<<20 || rs.NumGoroutines != 4 || !rs.Synchronous {
+		t.Errorf("unexpected default receive settings: %+v", rs)
+	}
+	// the worker concurrency, unless configured
+	if rs := DefaultPubsubReceiveSettings.receiveSettings(3); rs.MaxOutstandingMessages != 3 {
+		t.Errorf("expected the concurrency as max outstanding messages, got %d", rs.MaxOutstandingMessages)
+	}
+	s := DefaultPubsubReceiveSettings
+	s.MaxOutstandingMessages = 50
+	if rs := s.receiveSettings(3); rs.MaxOutstandingMessages != 50 {
+		t.Errorf("expected the configured max outstanding messages, got %d", rs.MaxOutstandingMessages)
+	}
+
+	for _, invalid := range []PubsubReceiveSettings{
+		{MaxOutstandingMessages: -1, MaxOutstandingBytes: -1, NumGoroutines: 1},
+		{MaxOutstandingBytes: 0, NumGoroutines: 1},
+		{MaxOutstandingBytes: -2, NumGoroutines: 1},
+		{MaxOutstandingBytes: -1, NumGoroutines: 0},
+	} {
+		if invalid.Validate() == nil {
+			t.Errorf("expected invalid settings: %+v", invalid)
+		}
+	}
+}
+
+func TestPriorityQueue(t *testing.T) {
+	normal := NewMemQueue(1)
+	urgent := NewMemQueue(1)
+	q := MultiQueue{normal, PriorityQueue{urgent}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan bool, 2)
+	go func() {
+		_ = q.Receive(ctx, func(ctx context.Context, msg *QueueMessage) {
+			received <- msg.urgent
+			msg.Ack()
+		})
+	}()
+	normal.Push([]byte("{}")).Wait()
+	urgent.Push([]byte("{}")).Wait()
+	if <-received || !<-received {
+		t.Error("expected only the task of the priority queue to be urgent")
+	}
+	if err := q.Publish(ctx, []byte("result")); err != nil || len(normal.Published()) != 1 {
+		t.Errorf("expected results to be published to the normal queue: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+)
+
+// postDiffName is the file in the output dir of a client with the diff of its post state with the reference client.
+const postDiffName = "post_diff.json"
+
+// referenceClient returns the reference client, see Config.ReferenceCmd. It runs in its own sub dir of the task.
+func (w *Worker) referenceClient() *taskClient {
+	return &taskClient{name: "reference", cliCmd: w.ReferenceCmd, subDir: "reference"}
+}
+
+// compareWithReference runs the reference client on the inputs of the task, and if its post state differs from
+// the post state of the client, writes the diff to the output dir of the client.
+// It returns the diff file, or an empty path if the post states match, or if the reference client failed.
+func (w *Worker) compareWithReference(ctx context.Context, tr *TransitionMsg, c *taskClient) string {
+	ref := w.referenceClient()
+	refOut, err := w.runTransition(ctx, tr, ref, nil)
+	if err != nil {
+		log.Printf("failed to run reference client on %s: %v", tr.Key, err)
+		return ""
+	}
+	if !refOut.Success {
+		log.Printf("reference client failed on %s, with exit code %d, no post diff", tr.Key, refOut.ExitCode)
+		return ""
+	}
+	post, err := ioutil.ReadFile(filepath.Join(c.outDir(tr), "post.ssz"))
+	if err != nil {
+		log.Printf("failed to read post state of %s: %v", tr.Key, err)
+		return ""
+	}
+	refPost, err := ioutil.ReadFile(filepath.Join(ref.outDir(tr), "post.ssz"))
+	if err != nil {
+		log.Printf("reference client wrote no post state for %s: %v", tr.Key, err)
+		return ""
+	}
+	if bytes.Equal(post, refPost) {
+		return ""
+	}
+	diff := StateDiff{
+		Key:               tr.Key,
+		SpecVersion:       tr.SpecVersion,
+		SpecConfig:        tr.SpecConfig,
+		Client:            c.name,
+		ClientVersion:     c.version,
+		PostHash:          fmt.Sprintf("0x%x", sha256.Sum256(post)),
+		ReferencePostHash: fmt.Sprintf("0x%x", sha256.Sum256(refPost)),
+	}
+	if p, err := statePresetFor(tr.SpecVersion, tr.SpecConfig); err != nil {
+		diff.Error = err.Error()
+	} else if diff.Fields, err = diffStates(p, post, refPost); err != nil {
+		diff.Error = err.Error()
+	}
+	log.Printf("post state of %s differs from the reference client in %d fields", tr.Key, len(diff.Fields))
+	data, err := json.MarshalIndent(&diff, "", "  ")
+	if err != nil {
+		log.Printf("failed to encode post diff of %s: %v", tr.Key, err)
+		return ""
+	}
+	p := filepath.Join(c.outDir(tr), postDiffName)
+	if err := ioutil.WriteFile(p, data, 0644); err != nil {
+		log.Printf("failed to write post diff of %s: %v", tr.Key, err)
+		return ""
+	}
+	return p
+}
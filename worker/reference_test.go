@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+func TestReferenceDiff(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.SpecVersion = "v0.9.1"
+	// the reference client copies the pre state, the fake client appends the block to it
+	h.worker.ReferenceCmd = `sh -c 'cp "$0" "$1"' {pre} {post}`
+
+	addTask := func(key string, pre []byte, block []byte) TransitionMsg {
+		msg := TransitionMsg{Blocks: 1, SpecVersion: "v0.9.1", SpecConfig: "minimal", Key: key}
+		h.inputs.Put(msg.InputsBucketPathStart()+"/pre.ssz", pre)
+		h.inputs.Put(msg.InputsBucketPathStart()+"/block_0.ssz", block)
+		return msg
+	}
+	if !h.process(addTask("foo", testState(1), []byte("block000"))) {
+		t.Fatal("expected task to be acked")
+	}
+	res := h.result()
+	if res.Files.PostDiff == "" {
+		t.Fatal("expected a post diff")
+	}
+	var diff StateDiff
+	if err := json.Unmarshal(h.resultFile(res.Files.PostDiff), &diff); err != nil {
+		t.Fatal(err)
+	}
+	if diff.PostHash != res.PostHash || diff.Client != "fakeclient" || diff.Error != "" {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+	if len(diff.Fields) != 1 || diff.Fields[0].Field != "current_epoch_attestations" {
+		t.Errorf("expected the last field to differ, got %+v", diff.Fields)
+	}
+
+	// the same post state has no diff
+	h.worker.ReferenceCmd = `sh -c 'cat "$0" "$1" > "$2"' {pre} {blocks...} {post}`
+	if !h.process(addTask("bar", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	if res := h.published()[1]; res.Files.PostDiff != "" {
+		t.Errorf("expected no post diff for matching post states, got %s", res.Files.PostDiff)
+	}
+}
+
+func TestDiffStates(t *testing.T) {
+	p, err := statePresetFor("v0.9.1", "minimal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := testState(1), testState(2)
+	// the balance of the single validator
+	binary.LittleEndian.PutUint64(b[len(b)-8:], 31000000000)
+	binary.LittleEndian.PutUint64(b[8:], 3) // slot
+	diffs, err := diffStates(p, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, d := range diffs {
+		names = append(names, d.Field)
+	}
+	if len(diffs) != 3 || names[0] != "slot" || names[1] != "balances" || names[2] != "finalized_checkpoint" {
+		t.Fatalf("unexpected differing fields: %v", names)
+	}
+	if diffs[0].Value != "0" || diffs[0].ReferenceValue != "3" {
+		t.Errorf("unexpected slot diff: %+v", diffs[0])
+	}
+	if len(diffs[1].Elements) != 1 || diffs[1].Elements[0] != 0 || diffs[1].Length != nil {
+		t.Errorf("unexpected balances diff: %+v", diffs[1])
+	}
+	if _, err := diffStates(p, a, b[:10]); err == nil {
+		t.Error("expected a truncated state to fail")
+	}
+}
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Sources of the client report, see Config.ClientReport.
+const (
+	// the last line of stdout of the client
+	ClientReportStdout = "stdout"
+	// the report file of the client, see Invocation.Report
+	ClientReportFile = "file"
+)
+
+const (
+	// the file in the output dir that clients write their report to, with ClientReportFile
+	clientReportName = "report.json"
+	// reports are embedded in the result message, larger reports are dropped
+	maxClientReportSize = 64 << 10
+)
+
+// ValidateClientReport checks the client report source.
+func ValidateClientReport(source string) error {
+	switch source {
+	case "", ClientReportStdout, ClientReportFile:
+		return nil
+	default:
+		return fmt.Errorf("unknown client report source %q", source)
+	}
+}
+
+// readClientReport reads the JSON report of the client of a transition from the configured source.
+// Nil if disabled, or if the client did not report a JSON object.
+func (w *Worker) readClientReport(tr *TransitionMsg, out *transitionOutput, outDir string) json.RawMessage {
+	var data []byte
+	var err error
+	switch w.ClientReport {
+	case ClientReportStdout:
+		if out.Stdout == "" {
+			return nil
+		}
+		data, err = readLastLine(out.Stdout, maxClientReportSize)
+	case ClientReportFile:
+		data, err = ioutil.ReadFile(filepath.Join(outDir, clientReportName))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err == nil && len(data) > maxClientReportSize {
+			err = fmt.Errorf("report of %d bytes is larger than %d bytes", len(data), maxClientReportSize)
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		log.Printf("failed to read client report of %s: %v", tr.Key, err)
+		return nil
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil
+	}
+	var report bytes.Buffer
+	if data[0] != '{' || json.Compact(&report, data) != nil {
+		log.Printf("client report of %s is not a JSON object, ignoring it", tr.Key)
+		return nil
+	}
+	return json.RawMessage(report.Bytes())
+}
+
+// readLastLine returns the last non-empty line of the file, if it ends within the last n bytes of the file.
+func readLastLine(p string, n int64) ([]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	truncated := false
+	if size := info.Size(); size > n {
+		if _, err := f.Seek(size-n, io.SeekStart); err != nil {
+			return nil, err
+		}
+		truncated = true
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimRight(data, "\r\n")
+	i := bytes.LastIndexByte(data, '\n')
+	if i < 0 && truncated {
+		return nil, fmt.Errorf("last line of stdout is longer than %d bytes", n)
+	}
+	return data[i+1:], nil
+}
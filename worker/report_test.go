@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientReportStdout(t *testing.T) {
+	h := newHarness(t, "", &FakeRunner{Stdout: "processing 1 blocks\n{\"slot\": 3, \"state-root\": \"0x01\"}\n"})
+	defer h.Close()
+	h.worker.ClientReport = ClientReportStdout
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	if report := string(h.result().ClientReport); report != `{"slot":3,"state-root":"0x01"}` {
+		t.Errorf("unexpected client report %q", report)
+	}
+}
+
+func TestClientReportFile(t *testing.T) {
+	runner := &FakeRunner{OutputFiles: map[string][]byte{"--report": []byte(`{"error": "invalid signature"}`)}}
+	h := newHarness(t, " --pre {pre} --post {post} --report {report} {blocks...}", runner)
+	defer h.Close()
+	h.worker.ClientReport = ClientReportFile
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	if report := string(h.result().ClientReport); report != `{"error":"invalid signature"}` {
+		t.Errorf("unexpected client report %q", report)
+	}
+}
+
+func TestClientReportInvalid(t *testing.T) {
+	h := newHarness(t, "", &FakeRunner{Stdout: "[1, 2]\n"})
+	defer h.Close()
+	h.worker.ClientReport = ClientReportStdout
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	if report := h.result().ClientReport; report != nil {
+		t.Errorf("expected no report for output that is not a JSON object, got %s", report)
+	}
+}
+
+func TestReadLastLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "stdout.log")
+	cases := map[string]string{
+		"":                   "",
+		"one":                "one",
+		"one\ntwo\n\n":       "two",
+		"one\r\ntwo\r\n":     "two",
+		"long line\nshort\n": "short",
+	}
+	for content, expected := range cases {
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		line, err := readLastLine(p, 8)
+		if err != nil {
+			t.Fatalf("%q: %v", content, err)
+		}
+		if string(line) != expected {
+			t.Errorf("%q: expected %q, got %q", content, expected, line)
+		}
+	}
+	if err := ioutil.WriteFile(p, []byte("a line that is too long\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readLastLine(p, 8); err == nil {
+		t.Error("expected a line longer than the limit to fail")
+	}
+}
@@ -0,0 +1,142 @@
+package worker
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// reproName is the file in the output dir of a client with the repro bundle of a failed transition.
+const reproName = "repro.tar.gz"
+
+// ReproMetadata describes a failed transition, and where it ran. It is the metadata.json of a repro bundle.
+type ReproMetadata struct {
+	Key         string `json:"key"`
+	SpecVersion string `json:"spec-version"`
+	SpecConfig  string `json:"spec-config"`
+	// the task type, and its parameters, see TransitionMsg
+	Type      string `json:"type"`
+	Operation string `json:"operation,omitempty"`
+	Slots     uint64 `json:"slots,omitempty"`
+	// the client, and the status the transition ended with
+	ClientName    string    `json:"client-name"`
+	ClientVersion string    `json:"client-version"`
+	Status        string    `json:"status"`
+	Exit          *ExitInfo `json:"exit,omitempty"`
+	// the client command, with the paths of the work dir relative to the root of the bundle, and its extra environment variables
+	Command []string `json:"command,omitempty"`
+	Env     []string `json:"env,omitempty"`
+	// the worker and its platform
+	WorkerID  string    `json:"worker-id,omitempty"`
+	GoVersion string    `json:"go-version"`
+	OS        string    `json:"os"`
+	Arch      string    `json:"arch"`
+	Time      time.Time `json:"time"`
+}
+
+// writeReproBundle writes a gzipped tarball to reproduce a failed transition of the client with to its output dir:
+// the inputs, the post state (if any), the logs and exit info, and a metadata.json with the command line
+// and the environment of the run. The files have their path relative to the work dir of the task.
+// It returns the path of the bundle.
+func (w *Worker) writeReproBundle(tr *TransitionMsg, c *taskClient, out *transitionOutput) (string, error) {
+	taskDir := tr.DirPath()
+	outDir := c.outDir(tr)
+	var files []string
+	files = append(files, filepath.Join(taskDir, "pre.ssz"))
+	for _, name := range tr.InputFiles() {
+		files = append(files, filepath.Join(taskDir, name))
+	}
+	files = append(files, filepath.Join(outDir, "post.ssz"))
+	files = append(files, out.Stdout, out.Stderr, out.StdoutTimed, out.StderrTimed, out.Combined, out.ExitFile)
+
+	meta := ReproMetadata{
+		Key:           tr.Key,
+		SpecVersion:   tr.SpecVersion,
+		SpecConfig:    tr.SpecConfig,
+		Type:          tr.TaskType(),
+		Operation:     tr.Operation,
+		Slots:         tr.Slots,
+		ClientName:    c.name,
+		ClientVersion: c.version,
+		Status:        out.Status(),
+		Exit:          out.ExitInfo(),
+		Env:           out.Env,
+		WorkerID:      w.WorkerID,
+		GoVersion:     runtime.Version(),
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		Time:          w.now().UTC(),
+	}
+	// the bundle is extracted elsewhere, the command refers to the files in it
+	for _, arg := range out.Command {
+		meta.Command = append(meta.Command, strings.Replace(arg, taskDir+string(filepath.Separator), "./", -1))
+	}
+	metaData, err := json.MarshalIndent(&meta, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	p := filepath.Join(outDir, reproName)
+	f, err := os.Create(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to create repro bundle: %v", err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "metadata.json", Mode: 0644, Size: int64(len(metaData)), ModTime: meta.Time}); err != nil {
+		return "", err
+	}
+	if _, err := tw.Write(metaData); err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		name, err := filepath.Rel(taskDir, file)
+		if err != nil {
+			return "", err
+		}
+		if err := addTarFile(tw, filepath.ToSlash(name), file); err != nil {
+			return "", fmt.Errorf("failed to add %s to repro bundle: %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// addTarFile adds the file to the tarball with the given name, if the file exists.
+func addTarFile(tw *tar.Writer, name string, p string) error {
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
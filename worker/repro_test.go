@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReproBundle(t *testing.T) {
+	h := newHarness(t, " --fail", ExecRunner{})
+	defer h.Close()
+	h.worker.ReproBundles = true
+	h.worker.WorkerID = "worker-1"
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected failed task to be acked with a result")
+	}
+	res := h.result()
+	if res.Files.Repro == "" || !strings.Contains(res.Files.Repro, "repro/") {
+		t.Fatalf("expected a repro bundle under repro/, got %q", res.Files.Repro)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(h.resultFile(res.Files.Repro)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = data
+	}
+	if string(files["pre.ssz"]) != "pre" || string(files["block_0.ssz"]) != "block0" {
+		t.Error("expected the inputs in the bundle")
+	}
+	if !strings.Contains(string(files["stderr.log"]), "invalid block") {
+		t.Errorf("expected the logs in the bundle, got %q", files["stderr.log"])
+	}
+	if _, ok := files["exit.json"]; !ok {
+		t.Error("expected the exit info in the bundle")
+	}
+	if _, ok := files["post.ssz"]; ok {
+		t.Error("expected no post state in the bundle")
+	}
+	var meta ReproMetadata
+	if err := json.Unmarshal(files["metadata.json"], &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Key != "foo" || meta.Status != StatusTransitionRejected || meta.WorkerID != "worker-1" || meta.Exit == nil || meta.Exit.ExitCode != 1 {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+	cmd := strings.Join(meta.Command, " ")
+	if !strings.Contains(cmd, "--pre ./pre.ssz --post ./post.ssz ./block_0.ssz") {
+		t.Errorf("expected the command with paths in the bundle, got %q", cmd)
+	}
+}
+
+func TestNoReproBundleOnSuccess(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.ReproBundles = true
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	if res := h.result(); res.Files.Repro != "" {
+		t.Errorf("expected no repro bundle for a successful transition, got %s", res.Files.Repro)
+	}
+	for _, name := range h.results.Names() {
+		if strings.HasPrefix(name, "repro/") {
+			t.Errorf("unexpected repro bundle %s", name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResourceLimitsSupported is true if the resource usage of process groups can be measured.
+const ResourceLimitsSupported = true
+
+// clockTicks is the unit of the CPU times in /proc/<pid>/stat (USER_HZ).
+const clockTicks = 100
+
+// groupUsage returns the total resident memory and CPU time of the running processes in the process group.
+func groupUsage(pgid int) (rss int64, cpu time.Duration, err error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return 0, 0, err
+	}
+	pageSize := int64(os.Getpagesize())
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		data, err := ioutil.ReadFile("/proc/" + e.Name() + "/stat")
+		if err != nil {
+			// the process exited
+			continue
+		}
+		// the command name may contain spaces, the other fields follow the last ')'
+		s := string(data)
+		i := strings.LastIndex(s, ")")
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(s[i+1:])
+		// fields[0] is field 3 (state) of proc(5)
+		if len(fields) < 22 {
+			return 0, 0, fmt.Errorf("unexpected stat format of process %s", e.Name())
+		}
+		if fields[2] != strconv.Itoa(pgid) {
+			continue
+		}
+		utime, _ := strconv.ParseInt(fields[11], 10, 64)
+		stime, _ := strconv.ParseInt(fields[12], 10, 64)
+		pages, _ := strconv.ParseInt(fields[21], 10, 64)
+		cpu += time.Duration(utime+stime) * time.Second / clockTicks
+		rss += pages * pageSize
+	}
+	return rss, cpu, nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package worker
+
+import (
+	"errors"
+	"time"
+)
+
+// ResourceLimitsSupported is true if the resource usage of process groups can be measured.
+const ResourceLimitsSupported = false
+
+func groupUsage(pgid int) (rss int64, cpu time.Duration, err error) {
+	return 0, 0, errors.New("resource usage is only measured on linux")
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package worker
+
+import (
+	"os"
+	"syscall"
+)
+
+// RestartProcess replaces the worker process with the executable, with the same arguments and environment.
+// It only returns on error.
+func RestartProcess(executable string) error {
+	return syscall.Exec(executable, os.Args, os.Environ())
+}
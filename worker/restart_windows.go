@@ -0,0 +1,20 @@
+package worker
+
+import (
+	"os"
+	"os/exec"
+)
+
+// RestartProcess starts the executable with the same arguments, environment and output, and exits the worker process.
+// Windows cannot replace a running process. It only returns on error.
+func RestartProcess(executable string) error {
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
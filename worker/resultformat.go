@@ -0,0 +1,180 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	muskoka "github.com/protolambda/muskoka-worker/proto"
+)
+
+// ResultSchemaVersion is the version of the result message schema, see proto/result.proto.
+// Increase it on incompatible changes, so consumers can handle old and new workers during an upgrade.
+const ResultSchemaVersion = 2
+
+// Result message formats, see Config.ResultFormat.
+const (
+	ResultFormatJSON  = "json"
+	ResultFormatProto = "proto"
+)
+
+// encodeResult encodes the result message in the configured format, JSON by default.
+func (w *Worker) encodeResult(res *ResultMsg) ([]byte, error) {
+	res.SchemaVersion = ResultSchemaVersion
+	switch w.ResultFormat {
+	case "", ResultFormatJSON:
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(res); err != nil {
+			return nil, fmt.Errorf("failed to encode result to JSON message: %v", err)
+		}
+		return buf.Bytes(), nil
+	case ResultFormatProto:
+		data, err := proto.Marshal(resultToProto(res))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode result to proto message: %v", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unknown result format %q", w.ResultFormat)
+	}
+}
+
+// DecodeResult decodes a result message in either format.
+// JSON messages start with '{', which is never the first byte of an encoded proto result.
+func DecodeResult(data []byte) (*ResultMsg, error) {
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		var res ResultMsg
+		if err := json.Unmarshal(data, &res); err != nil {
+			return nil, err
+		}
+		return &res, nil
+	}
+	var pb muskoka.ResultMsg
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return nil, err
+	}
+	return resultFromProto(&pb), nil
+}
+
+func checkpointToProto(c Checkpoint) *muskoka.Checkpoint {
+	return &muskoka.Checkpoint{Epoch: c.Epoch, Root: c.Root}
+}
+
+func checkpointFromProto(c *muskoka.Checkpoint) Checkpoint {
+	if c == nil {
+		return Checkpoint{}
+	}
+	return Checkpoint{Epoch: c.Epoch, Root: c.Root}
+}
+
+func resultToProto(res *ResultMsg) *muskoka.ResultMsg {
+	pb := &muskoka.ResultMsg{
+		SchemaVersion:   uint32(res.SchemaVersion),
+		Success:         res.Success,
+		Status:          res.Status,
+		Exceeded:        res.Exceeded,
+		Interrupted:     res.Interrupted,
+		PostHash:        res.PostHash,
+		PostRoot:        res.PostRoot,
+		ClientName:      res.ClientName,
+		ClientVersion:   res.ClientVersion,
+		Key:             res.Key,
+		SpecVersion:     res.SpecVersion,
+		SpecConfig:      res.SpecConfig,
+		Consensus:       res.Consensus,
+		ClientReport:    string(res.ClientReport),
+		BlockPostHashes: res.BlockPostHashes,
+		Files: &muskoka.ResultFiles{
+			PostState:       res.Files.PostState,
+			ErrLog:          res.Files.ErrLog,
+			OutLog:          res.Files.OutLog,
+			ErrLogTimed:     res.Files.ErrLogTimed,
+			OutLogTimed:     res.Files.OutLogTimed,
+			CombinedLog:     res.Files.CombinedLog,
+			ExitInfo:        res.Files.ExitInfo,
+			PostDiff:        res.Files.PostDiff,
+			BlockPostStates: res.Files.BlockPostStates,
+			Repro:           res.Files.Repro,
+		},
+	}
+	if res.MatchesExpected != nil {
+		pb.MatchesExpected = &wrappers.BoolValue{Value: *res.MatchesExpected}
+	}
+	if f := res.Finality; f != nil {
+		pb.Finality = &muskoka.FinalityInfo{
+			JustificationBits: f.JustificationBits,
+			PreviousJustified: checkpointToProto(f.PreviousJustified),
+			CurrentJustified:  checkpointToProto(f.CurrentJustified),
+			Finalized:         checkpointToProto(f.Finalized),
+		}
+	}
+	if u := res.Usage; u != nil {
+		pb.Usage = &muskoka.ResourceUsage{DurationMs: u.DurationMs, UserMs: u.UserMs, SystemMs: u.SystemMs, MaxRss: u.MaxRSS}
+	}
+	if in := res.Inputs; in != nil {
+		pb.Inputs = &muskoka.InputHashes{Pre: in.Pre, Blocks: in.Blocks}
+	}
+	if e := res.Exit; e != nil {
+		pb.Exit = &muskoka.ExitInfo{ExitCode: int64(e.ExitCode), Signal: e.Signal, TimedOut: e.TimedOut}
+	}
+	return pb
+}
+
+func resultFromProto(pb *muskoka.ResultMsg) *ResultMsg {
+	res := &ResultMsg{
+		SchemaVersion:   int(pb.SchemaVersion),
+		Success:         pb.Success,
+		Status:          pb.Status,
+		Exceeded:        pb.Exceeded,
+		Interrupted:     pb.Interrupted,
+		PostHash:        pb.PostHash,
+		PostRoot:        pb.PostRoot,
+		ClientName:      pb.ClientName,
+		ClientVersion:   pb.ClientVersion,
+		Key:             pb.Key,
+		SpecVersion:     pb.SpecVersion,
+		SpecConfig:      pb.SpecConfig,
+		Consensus:       pb.Consensus,
+		BlockPostHashes: pb.BlockPostHashes,
+	}
+	if pb.ClientReport != "" {
+		res.ClientReport = json.RawMessage(pb.ClientReport)
+	}
+	if pb.MatchesExpected != nil {
+		matches := pb.MatchesExpected.Value
+		res.MatchesExpected = &matches
+	}
+	if f := pb.Finality; f != nil {
+		res.Finality = &FinalityInfo{
+			JustificationBits: f.JustificationBits,
+			PreviousJustified: checkpointFromProto(f.PreviousJustified),
+			CurrentJustified:  checkpointFromProto(f.CurrentJustified),
+			Finalized:         checkpointFromProto(f.Finalized),
+		}
+	}
+	if u := pb.Usage; u != nil {
+		res.Usage = &ResourceUsage{DurationMs: u.DurationMs, UserMs: u.UserMs, SystemMs: u.SystemMs, MaxRSS: u.MaxRss}
+	}
+	if in := pb.Inputs; in != nil {
+		res.Inputs = &InputHashes{Pre: in.Pre, Blocks: in.Blocks}
+	}
+	if e := pb.Exit; e != nil {
+		res.Exit = &ExitInfo{ExitCode: int(e.ExitCode), Signal: e.Signal, TimedOut: e.TimedOut}
+	}
+	if f := pb.Files; f != nil {
+		res.Files = ResultFilesDataURLS{
+			PostState:       f.PostState,
+			ErrLog:          f.ErrLog,
+			OutLog:          f.OutLog,
+			ErrLogTimed:     f.ErrLogTimed,
+			OutLogTimed:     f.OutLogTimed,
+			CombinedLog:     f.CombinedLog,
+			ExitInfo:        f.ExitInfo,
+			PostDiff:        f.PostDiff,
+			BlockPostStates: f.BlockPostStates,
+			Repro:           f.Repro,
+		}
+	}
+	return res
+}
@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestResultFormats(t *testing.T) {
+	matches := false
+	res := ResultMsg{
+		Success:         true,
+		Status:          StatusSuccess,
+		PostHash:        "0x1234",
+		PostRoot:        "0xabcd",
+		ClientName:      "zrnt",
+		ClientVersion:   "v0.8.3_abc",
+		Key:             "foo",
+		Consensus:       ConsensusAgrees,
+		MatchesExpected: &matches,
+		Finality:        &FinalityInfo{JustificationBits: "0x0f", Finalized: Checkpoint{Epoch: 3, Root: "0x01"}},
+		Usage:           &ResourceUsage{DurationMs: 1200, MaxRSS: 1 << 30},
+		Exit:            &ExitInfo{ExitCode: -1, Signal: "killed", TimedOut: true},
+		Inputs:          &InputHashes{Pre: "0xaa", Blocks: []string{"0xbb", "0xcc"}},
+		ClientReport:    json.RawMessage(`{"slot":3,"error":null}`),
+		BlockPostHashes: []string{"0xdd"},
+		Files: ResultFilesDataURLS{PostState: "mem://post.ssz", ErrLog: "mem://err.log", OutLog: "mem://out.log",
+			BlockPostStates: []string{"mem://post_0.ssz"}, Repro: "mem://repro.tar.gz"},
+	}
+	for _, format := range []string{ResultFormatJSON, ResultFormatProto} {
+		w := &Worker{Config: Config{ResultFormat: format}}
+		data, err := w.encodeResult(&res)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		got, err := DecodeResult(data)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if got.SchemaVersion != ResultSchemaVersion {
+			t.Errorf("%s: expected schema version %d, got %d", format, ResultSchemaVersion, got.SchemaVersion)
+		}
+		if !reflect.DeepEqual(*got, res) {
+			t.Errorf("%s: result changed:\n%+v\n%+v", format, *got, res)
+		}
+	}
+
+	w := &Worker{Config: Config{ResultFormat: "xml"}}
+	if _, err := w.encodeResult(&res); err == nil {
+		t.Error("expected unknown format to fail")
+	}
+}
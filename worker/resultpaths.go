@@ -0,0 +1,104 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultResultPathTemplate is the layout of result files in the results bucket, see Config.ResultPathTemplate.
+const DefaultResultPathTemplate = "{spec-version}/{spec-config}/{key}/{client}/{client-version}/{result-key}"
+
+// ResultPathLayout places the result files of a task in the results bucket, see ParseResultPathTemplate.
+type ResultPathLayout struct {
+	template string
+	// matches the path of a result file, capturing the client name
+	pattern *regexp.Regexp
+}
+
+// DefaultResultPathLayout is the layout of DefaultResultPathTemplate.
+var DefaultResultPathLayout = mustParseResultPathTemplate(DefaultResultPathTemplate)
+
+func mustParseResultPathTemplate(template string) *ResultPathLayout {
+	l, err := ParseResultPathTemplate(template)
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// ParseResultPathTemplate parses a slash-separated path template with the placeholders
+// {spec-version}, {spec-config}, {key}, {client}, {client-version} and {result-key}, anywhere in a segment.
+// E.g. "{client}/{spec-version}-{spec-config}/{key}/{result-key}" shards the results per client.
+// The template must contain {client} and {result-key}, so runs of different clients and runs never share files.
+func ParseResultPathTemplate(template string) (*ResultPathLayout, error) {
+	if template == "" || path.IsAbs(template) || path.Clean(template) != template || strings.HasPrefix(template, "..") {
+		return nil, fmt.Errorf("invalid result path template %q", template)
+	}
+	clients := 0
+	pattern := "^(?:.*/)?"
+	last := 0
+	for _, loc := range placeholderPattern.FindAllStringIndex(template, -1) {
+		pattern += regexp.QuoteMeta(template[last:loc[0]])
+		last = loc[1]
+		switch p := template[loc[0]:loc[1]]; p {
+		case "{client}":
+			clients++
+			pattern += "([^/]+)"
+		case "{spec-version}", "{spec-config}", "{key}", "{client-version}", "{result-key}":
+			pattern += "[^/]+"
+		default:
+			return nil, fmt.Errorf("unknown placeholder %s in result path template %q", p, template)
+		}
+	}
+	pattern += regexp.QuoteMeta(template[last:]) + "/[^/]+$"
+	if clients != 1 || !strings.Contains(template, "{result-key}") {
+		return nil, fmt.Errorf("result path template %q must contain {client} once, and {result-key}", template)
+	}
+	return &ResultPathLayout{template: template, pattern: regexp.MustCompile(pattern)}, nil
+}
+
+// Path returns the path of the result files of the client for the task, under the results prefix of the task.
+func (l *ResultPathLayout) Path(tr *TransitionMsg, clientName string, clientVersion string) string {
+	start := strings.NewReplacer(
+		"{spec-version}", tr.SpecVersion,
+		"{spec-config}", tr.SpecConfig,
+		"{key}", tr.Key,
+		"{client}", clientName,
+		"{client-version}", clientVersion,
+		"{result-key}", tr.ResultKey,
+	).Replace(l.template)
+	if tr.ResultsPrefix != "" {
+		return path.Join(tr.ResultsPrefix, start)
+	}
+	return start
+}
+
+// Client returns the client name in the path of a result file, or an empty string if the path does not match the layout.
+// The path is matched from the end, as results may be routed under a prefix.
+func (l *ResultPathLayout) Client(name string) string {
+	m := l.pattern.FindStringSubmatch(name)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// ResultPaths returns the layout of ResultPathTemplate, or the default layout if the template is empty.
+func (w *Worker) ResultPaths() *ResultPathLayout {
+	w.resultPathsOnce.Do(func() {
+		w.resultPathsState = DefaultResultPathLayout
+		if w.ResultPathTemplate == "" {
+			return
+		}
+		l, err := ParseResultPathTemplate(w.ResultPathTemplate)
+		if err != nil {
+			log.Printf("WARNING: %v, using the default result path layout", err)
+			return
+		}
+		w.resultPathsState = l
+	})
+	return w.resultPathsState
+}
@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestResultPathTemplate(t *testing.T) {
+	tr := &TransitionMsg{SpecVersion: "v0.8.3", SpecConfig: "minimal", Key: "foo", ResultKey: "abc"}
+	if got, expected := tr.ResultsBucketPathStart("zrnt", "v1"), "v0.8.3/minimal/foo/zrnt/v1/abc"; got != expected {
+		t.Errorf("expected default path %s, got %s", expected, got)
+	}
+	l, err := ParseResultPathTemplate("{client}/{spec-version}-{spec-config}/{key}/{result-key}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.ResultsPrefix = "fuzz/run1"
+	p := l.Path(tr, "zrnt", "v1")
+	if expected := "fuzz/run1/zrnt/v0.8.3-minimal/foo/abc"; p != expected {
+		t.Errorf("expected path %s, got %s", expected, p)
+	}
+	if c := l.Client(p + "/post.ssz"); c != "zrnt" {
+		t.Errorf("expected client zrnt, got %q", c)
+	}
+	if c := l.Client("zrnt/post.ssz"); c != "" {
+		t.Errorf("expected no client for a path outside the layout, got %q", c)
+	}
+
+	for _, invalid := range []string{"", "/{client}/{result-key}", "{client}/{key}", "{spec-version}/{result-key}",
+		"{client}/{client}/{result-key}", "{client}/{bucket}/{result-key}", "../{client}/{result-key}"} {
+		if _, err := ParseResultPathTemplate(invalid); err == nil {
+			t.Errorf("expected template %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestResultPathLayout(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.ResultPathTemplate = "{client}/{client-version}/{spec-version}/{key}/{result-key}"
+	h.worker.Results = NewClientStore(h.results, "fakeclient", h.worker.ResultPaths())
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	names := h.results.Names()
+	if len(names) == 0 {
+		t.Fatal("expected result files")
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, "fakeclient/v0.0.1_abc/v0.8.3/foo/") {
+			t.Errorf("result file %s is not in the configured layout", name)
+		}
+	}
+
+	w := h.worker.Results.NewWriter(context.Background(), "otherclient/v1/v0.8.3/foo/abc/post.ssz")
+	_, _ = w.Write([]byte("spoofed"))
+	if err := w.Close(); err == nil {
+		t.Fatal("expected write to the result path of another client to fail")
+	}
+}
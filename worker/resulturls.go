@@ -0,0 +1,121 @@
+package worker
+
+import (
+	"cloud.google.com/go/storage"
+	"fmt"
+	"golang.org/x/oauth2/google"
+	"io/ioutil"
+	"time"
+)
+
+// How result files are referenced in result messages, see Config.ResultURLs.
+const (
+	// the public URL of the object, for publicly readable result buckets
+	ResultURLsPublic = "public"
+	// a signed URL that expires after ResultURLTTL, for private result buckets
+	ResultURLsSigned = "signed"
+	// the object path in the results bucket
+	ResultURLsPath = "path"
+)
+
+// MaxSignedURLTTL is the longest validity of a V4 signed URL.
+const MaxSignedURLTTL = time.Hour * 24 * 7
+
+// signedURLStore is a BlobStore that can sign URLs, to give temporary read access to private objects.
+type signedURLStore interface {
+	SignedURL(name string, expires time.Time) (string, error)
+}
+
+// GCSURLSigner signs V4 GCS URLs with the key of a service account.
+type GCSURLSigner struct {
+	accessID   string
+	privateKey []byte
+}
+
+// LoadGCSURLSigner reads the email and private key of a service account from its JSON key file.
+func LoadGCSURLSigner(credentialsFile string) (*GCSURLSigner, error) {
+	data, err := ioutil.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := google.JWTConfigFromJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("expected a service account key: %v", err)
+	}
+	return &GCSURLSigner{accessID: cfg.Email, privateKey: cfg.PrivateKey}, nil
+}
+
+func (s *GCSURLSigner) sign(bucket string, name string, expires time.Time) (string, error) {
+	return storage.SignedURL(bucket, name, &storage.SignedURLOptions{
+		GoogleAccessID: s.accessID,
+		PrivateKey:     s.privateKey,
+		Method:         "GET",
+		Expires:        expires,
+		Scheme:         storage.SigningSchemeV4,
+	})
+}
+
+// resultURLs references the result files in the results store, as configured by ResultURLs.
+func (w *Worker) resultURLs(rd ResultFilesDataPaths, store BlobStore) (ResultFilesDataURLS, error) {
+	switch w.ResultURLs {
+	case "", ResultURLsPublic:
+		return rd.URLs(store), nil
+	case ResultURLsPath:
+		return ResultFilesDataURLS{
+			PostState:       rd.PostState,
+			ErrLog:          rd.ErrLog,
+			OutLog:          rd.OutLog,
+			ErrLogTimed:     rd.ErrLogTimed,
+			OutLogTimed:     rd.OutLogTimed,
+			CombinedLog:     rd.CombinedLog,
+			ExitInfo:        rd.ExitInfo,
+			PostDiff:        rd.PostDiff,
+			BlockPostStates: rd.BlockPostStates,
+			Repro:           rd.Repro,
+		}, nil
+	case ResultURLsSigned:
+		signer, ok := store.(signedURLStore)
+		if !ok {
+			return ResultFilesDataURLS{}, fmt.Errorf("results store cannot sign URLs")
+		}
+		ttl := w.ResultURLTTL
+		if ttl <= 0 || ttl > MaxSignedURLTTL {
+			ttl = MaxSignedURLTTL
+		}
+		expires := w.now().Add(ttl)
+		var out ResultFilesDataURLS
+		for _, f := range []struct {
+			name string
+			url  *string
+		}{
+			{rd.PostState, &out.PostState},
+			{rd.ErrLog, &out.ErrLog},
+			{rd.OutLog, &out.OutLog},
+			{rd.ErrLogTimed, &out.ErrLogTimed},
+			{rd.OutLogTimed, &out.OutLogTimed},
+			{rd.CombinedLog, &out.CombinedLog},
+			{rd.ExitInfo, &out.ExitInfo},
+			{rd.PostDiff, &out.PostDiff},
+			{rd.Repro, &out.Repro},
+		} {
+			if f.name == "" {
+				continue
+			}
+			u, err := signer.SignedURL(f.name, expires)
+			if err != nil {
+				return ResultFilesDataURLS{}, fmt.Errorf("failed to sign URL of %s: %v", f.name, err)
+			}
+			*f.url = u
+		}
+		for _, name := range rd.BlockPostStates {
+			u, err := signer.SignedURL(name, expires)
+			if err != nil {
+				return ResultFilesDataURLS{}, fmt.Errorf("failed to sign URL of %s: %v", name, err)
+			}
+			out.BlockPostStates = append(out.BlockPostStates, u)
+		}
+		return out, nil
+	default:
+		return ResultFilesDataURLS{}, fmt.Errorf("unknown result URL mode %q", w.ResultURLs)
+	}
+}
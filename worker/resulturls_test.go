@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultURLPaths(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.ResultURLs = ResultURLsPath
+
+	h.process(h.addTask("foo", []byte("pre")))
+	files := h.result().Files
+	if strings.Contains(files.PostState, "://") || !strings.HasSuffix(files.PostState, "/post.ssz") {
+		t.Fatalf("expected an object path, got %s", files.PostState)
+	}
+	if string(h.resultFile(h.worker.Results.URL(files.PostState))) != "pre" {
+		t.Error("expected the path to reference the post state")
+	}
+}
+
+func TestSignedResultURLs(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	store := &gcsStore{bucketName: "results", signer: &GCSURLSigner{accessID: "worker@example.iam.gserviceaccount.com", privateKey: keyPEM}}
+	w := &Worker{Config: Config{ResultURLs: ResultURLsSigned, ResultURLTTL: time.Hour}}
+
+	urls, err := w.resultURLs(ResultFilesDataPaths{PostState: "a/post.ssz", ErrLog: "a/err_log.txt"}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(urls.PostState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/results/a/post.ssz" || u.Query().Get("X-Goog-Expires") == "" || u.Query().Get("X-Goog-Signature") == "" {
+		t.Errorf("unexpected signed URL: %s", urls.PostState)
+	}
+	if urls.ErrLog == "" || urls.CombinedLog != "" {
+		t.Errorf("expected only the uploaded files to be signed: %+v", urls)
+	}
+
+	if _, err := w.resultURLs(ResultFilesDataPaths{PostState: "a/post.ssz"}, NewMemStore("results")); err == nil {
+		t.Error("expected a store without signing to fail")
+	}
+}
@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// storageRetryMaxDelay caps the backoff between attempts of a storage operation.
+const storageRetryMaxDelay = time.Second * 30
+
+// retryDelay returns the backoff before the given retry (1 for the first retry):
+// the base delay doubled for every earlier retry, capped at storageRetryMaxDelay,
+// randomly shortened by up to half, to spread out the retries of concurrent tasks.
+func retryDelay(base time.Duration, retry int) time.Duration {
+	delay := base
+	for i := 1; i < retry && delay < storageRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > storageRetryMaxDelay {
+		delay = storageRetryMaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryStorage calls f until it succeeds, at most StorageAttempts times (once if 0),
+// with exponential backoff between attempts. The last error is returned.
+// Waiting for the next attempt stops early, with the last error, when ctx is done.
+func (w *Worker) retryStorage(ctx context.Context, desc string, f func() error) error {
+	attempts := w.StorageAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for i := 1; ; i++ {
+		if err = f(); err == nil {
+			return nil
+		}
+		if i >= attempts || ctx.Err() != nil {
+			return err
+		}
+		delay := retryDelay(w.StorageRetryDelay, i)
+		log.Printf("failed to %s (attempt %d of %d), retrying in %s: %v", desc, i, attempts, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// flakyStore fails the first reads and writes of every object.
+type flakyStore struct {
+	*MemStore
+	failures int
+	reads    map[string]int
+	writes   map[string]int
+}
+
+func (s *flakyStore) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	s.reads[name]++
+	if s.reads[name] <= s.failures {
+		return nil, fmt.Errorf("transient read error")
+	}
+	return s.MemStore.NewReader(ctx, name)
+}
+
+func (s *flakyStore) NewWriter(ctx context.Context, name string) io.WriteCloser {
+	s.writes[name]++
+	if s.writes[name] <= s.failures {
+		return &failingWriter{}
+	}
+	return s.MemStore.NewWriter(ctx, name)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (failingWriter) Close() error                { return fmt.Errorf("transient write error") }
+
+func TestRetryStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muskoka-retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := &flakyStore{MemStore: NewMemStore("flaky"), failures: 2, reads: map[string]int{}, writes: map[string]int{}}
+	store.Put("pre.ssz", []byte("pre"))
+	w := &Worker{Config: Config{StorageAttempts: 3, StorageRetryDelay: time.Millisecond}, Inputs: store}
+
+	p := filepath.Join(dir, "pre.ssz")
+	hash, err := w.downloadInputFile(context.Background(), p, "pre.ssz")
+	if err != nil {
+		t.Fatalf("expected download to succeed on the last attempt: %v", err)
+	}
+	if hash != sha256.Sum256([]byte("pre")) {
+		t.Error("unexpected hash")
+	}
+	if err := w.uploadResult(context.Background(), store, "post.ssz", bytes.NewReader([]byte("post"))); err != nil {
+		t.Fatalf("expected upload to succeed on the last attempt: %v", err)
+	}
+	if data, _ := store.Get("post.ssz"); string(data) != "post" {
+		t.Errorf("unexpected upload: %q", data)
+	}
+
+	w.StorageAttempts = 2
+	if _, err := w.downloadInputFile(context.Background(), filepath.Join(dir, "block_0.ssz"), "block_0.ssz"); err == nil {
+		t.Error("expected download to fail after the last attempt")
+	}
+	if store.reads["block_0.ssz"] != 2 {
+		t.Errorf("expected 2 attempts, got %d", store.reads["block_0.ssz"])
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for retry, max := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: storageRetryMaxDelay} {
+		if d := retryDelay(time.Second, retry); d < max/2 || d > max {
+			t.Errorf("retry %d: delay %s not within [%s, %s]", retry, d, max/2, max)
+		}
+	}
+}
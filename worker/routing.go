@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// checkResultRoute checks if the results bucket and prefix of the task are allowed by the operator.
+// Tasks without routing always use the configured results bucket.
+func (w *Worker) checkResultRoute(tr *TransitionMsg) error {
+	if tr.ResultsBucket == "" && tr.ResultsPrefix == "" {
+		return nil
+	}
+	if tr.ResultsPrefix != "" && (path.IsAbs(tr.ResultsPrefix) || path.Clean(tr.ResultsPrefix) != tr.ResultsPrefix ||
+		strings.HasPrefix(tr.ResultsPrefix, "..")) {
+		return fmt.Errorf("invalid results prefix %q", tr.ResultsPrefix)
+	}
+	bucket := tr.ResultsBucket
+	if bucket == "" {
+		bucket = w.ActiveDynamicConfig().ResultsBucket
+	}
+	for _, allowed := range w.ResultRoutes {
+		allowedBucket, allowedPrefix := allowed, ""
+		if i := strings.Index(allowed, "/"); i >= 0 {
+			allowedBucket, allowedPrefix = allowed[:i], allowed[i+1:]
+		}
+		if bucket != allowedBucket {
+			continue
+		}
+		if allowedPrefix == "" || tr.ResultsPrefix == allowedPrefix || strings.HasPrefix(tr.ResultsPrefix, allowedPrefix+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("results route %s/%s is not allowed", bucket, tr.ResultsPrefix)
+}
+
+// resultsFor returns the store to upload the results of the task to.
+func (w *Worker) resultsFor(tr *TransitionMsg) (BlobStore, error) {
+	if tr.ResultsBucket == "" || tr.ResultsBucket == w.ActiveDynamicConfig().ResultsBucket {
+		return w.results(), nil
+	}
+	switch {
+	case w.OpenResults != nil:
+		return w.OpenResults(tr.ResultsBucket), nil
+	case w.OpenStore != nil:
+		return w.OpenStore(tr.ResultsBucket), nil
+	default:
+		return nil, fmt.Errorf("cannot route results to bucket %s, worker does not support opening stores", tr.ResultsBucket)
+	}
+}
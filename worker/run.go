@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+)
+
+// RunOnce runs the task with the local pre state and block files through the worker,
+// and returns the published result message. The inputs are served from memory, the worker queue is replaced.
+func RunOnce(ctx context.Context, w *Worker, tr TransitionMsg, pre string, blocks []string) ([]byte, error) {
+	inputs := NewMemStore("local")
+	files := map[string]string{"pre.ssz": pre}
+	for i, b := range blocks {
+		files[fmt.Sprintf("block_%d.ssz", i)] = b
+	}
+	for name, p := range files {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", name, err)
+		}
+		inputs.Put(path.Join(tr.InputsBucketPathStart(), name), data)
+	}
+	q := NewMemQueue(1)
+	w.Inputs = inputs
+	w.Queue = q
+
+	data, err := json.Marshal(&tr)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+	acked := q.Push(data).Wait()
+	cancel()
+	if err := <-done; err != nil {
+		return nil, err
+	}
+	published := q.Published()
+	if len(published) == 0 {
+		if !acked {
+			return nil, fmt.Errorf("task failed without a result, see the log")
+		}
+		return nil, fmt.Errorf("task was ignored, see the log")
+	}
+	return published[0], nil
+}
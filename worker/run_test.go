@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muskoka-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{"pre.ssz": "pre", "b0.ssz": "block0", "b1.ssz": "block1"}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script, err := filepath.Abs("testdata/fake_client.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Worker{
+		Config: Config{
+			CliCmd:        "sh " + script,
+			SpecVersion:   "v0.8.3",
+			SpecConfigs:   []string{"minimal"},
+			ClientName:    "local",
+			ClientVersion: "local",
+		},
+		Results: NewDirStore(filepath.Join(dir, "results")),
+		Runner:  ExecRunner{},
+	}
+	tr := TransitionMsg{Blocks: 2, SpecVersion: "v0.8.3", SpecConfig: "minimal", Key: "local"}
+	data, err := RunOnce(context.Background(), w, tr, filepath.Join(dir, "pre.ssz"),
+		[]string{filepath.Join(dir, "b0.ssz"), filepath.Join(dir, "b1.ssz")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res ResultMsg
+	if err := json.Unmarshal(data, &res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Success {
+		t.Errorf("expected success: %+v", res)
+	}
+	if expected := fmt.Sprintf("0x%x", sha256.Sum256([]byte("preblock0block1"))); res.PostHash != expected {
+		t.Errorf("post hash %s, expected %s", res.PostHash, expected)
+	}
+	if _, err := os.Stat(res.Files.PostState[len("file://"):]); err != nil {
+		t.Errorf("expected the post state in the results dir: %v", err)
+	}
+
+	if _, err := RunOnce(context.Background(), w, tr, filepath.Join(dir, "missing.ssz"), nil); err == nil {
+		t.Error("expected an error for a missing pre state")
+	}
+}
@@ -0,0 +1,216 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Command is a transition CLI invocation.
+type Command struct {
+	Name string
+	Args []string
+	// extra environment variables, as KEY=value, on top of the environment of the worker
+	Env []string
+	// the directory with the input and output files of the command, if any
+	WorkDir string
+	// the container image to run the command in, for runners that run containers. The image of the runner if empty.
+	Image  string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// the transition task the command runs, nil for other commands (e.g. the preflight check or a batch).
+	// Runners that keep the client running use it instead of the name and arguments.
+	Task *Invocation
+}
+
+// CommandResult describes how a command ended.
+type CommandResult struct {
+	// ExitCode of the process, or -1 if it did not exit by itself.
+	ExitCode int
+	// the name of the signal that killed the process, e.g. "killed". Empty if it exited by itself, or unknown.
+	Signal string
+	// the resource limit the process was killed for: ResourceMemory or ResourceCPU. Empty if none.
+	ResourceExceeded string
+	// the CPU time and memory used by the process, nil if unknown. DurationMs is not set by runners.
+	Usage *ResourceUsage
+}
+
+// Resources that can be limited, see CommandResult.ResourceExceeded.
+const (
+	ResourceMemory = "memory"
+	ResourceCPU    = "cpu"
+)
+
+// resourcePollInterval is how often the resource usage of a limited process is measured.
+const resourcePollInterval = time.Millisecond * 200
+
+// CommandRunner runs transition CLI commands.
+type CommandRunner interface {
+	// Run executes the command until it exits. An error is returned if it could not run to completion,
+	// a non-zero exit code alone is not an error.
+	Run(ctx context.Context, cmd Command) (CommandResult, error)
+}
+
+// ExecRunner runs commands as local processes.
+// If the context is done before the process exits, the process and its children are killed.
+type ExecRunner struct {
+	// the maximum resident memory in bytes and CPU time of the process and its children,
+	// they are killed when exceeding either. Unlimited if 0. Only supported on linux.
+	MaxMem int64
+	MaxCPU time.Duration
+}
+
+func (r ExecRunner) Run(ctx context.Context, c Command) (CommandResult, error) {
+	cmd := exec.Command(c.Name, c.Args...)
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = killProcessGroup(cmd)
+		case <-exited:
+		}
+	}()
+	exceeded := make(chan string, 1)
+	if r.MaxMem > 0 || r.MaxCPU > 0 {
+		go r.enforceLimits(cmd, exited, exceeded)
+	}
+	err := cmd.Wait()
+	close(exited)
+	var usage *ResourceUsage
+	signal := ""
+	if state := cmd.ProcessState; state != nil {
+		usage = &ResourceUsage{
+			UserMs:   int64(state.UserTime() / time.Millisecond),
+			SystemMs: int64(state.SystemTime() / time.Millisecond),
+			MaxRSS:   maxRSS(state),
+		}
+		signal = exitSignal(state)
+	}
+	if ctx.Err() != nil {
+		return CommandResult{ExitCode: -1, Signal: signal, Usage: usage}, ctx.Err()
+	}
+	select {
+	case resource := <-exceeded:
+		return CommandResult{ExitCode: -1, Signal: signal, ResourceExceeded: resource, Usage: usage}, nil
+	default:
+	}
+	// the last measurement may have been before the CPU limit was reached
+	if r.MaxCPU > 0 && cmd.ProcessState != nil && cmd.ProcessState.UserTime()+cmd.ProcessState.SystemTime() > r.MaxCPU {
+		return CommandResult{ExitCode: -1, Signal: signal, ResourceExceeded: ResourceCPU, Usage: usage}, nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return CommandResult{ExitCode: exitErr.ExitCode(), Signal: signal, Usage: usage}, nil
+	}
+	if err != nil {
+		return CommandResult{ExitCode: -1, Usage: usage}, err
+	}
+	return CommandResult{ExitCode: 0, Usage: usage}, nil
+}
+
+// enforceLimits measures the resource usage of the process group of the command,
+// and kills the group if it exceeds a limit, until the command exited.
+func (r ExecRunner) enforceLimits(cmd *exec.Cmd, exited <-chan struct{}, exceeded chan<- string) {
+	ticker := time.NewTicker(resourcePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+			rss, cpu, err := groupUsage(cmd.Process.Pid)
+			if err != nil {
+				log.Printf("failed to measure resource usage of process %d: %v", cmd.Process.Pid, err)
+				continue
+			}
+			resource := ""
+			if r.MaxMem > 0 && rss > r.MaxMem {
+				resource = ResourceMemory
+			} else if r.MaxCPU > 0 && cpu > r.MaxCPU {
+				resource = ResourceCPU
+			}
+			if resource != "" {
+				log.Printf("process %d exceeded the %s limit (memory: %d bytes, cpu: %s), killing it", cmd.Process.Pid, resource, rss, cpu)
+				exceeded <- resource
+				_ = killProcessGroup(cmd)
+				return
+			}
+		}
+	}
+}
+
+// FakeRunner is a scriptable CommandRunner, to test transition handling without a client binary.
+type FakeRunner struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	// Signal is reported as the signal that killed the command, if not empty.
+	Signal string
+	// ResourceExceeded is reported as the resource limit the command was killed for, if not empty.
+	ResourceExceeded string
+	// Delay before the command completes. If the context is done first, the context error is returned.
+	Delay time.Duration
+	// Err is returned instead of a result, as if the command could not run.
+	Err error
+	// OutputFiles maps an argument flag (e.g. "--post") to the contents to write to the path that follows it.
+	OutputFiles map[string][]byte
+
+	mu    sync.Mutex
+	calls []Command
+}
+
+// Calls returns all commands run so far.
+func (f *FakeRunner) Calls() []Command {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Command(nil), f.calls...)
+}
+
+func (f *FakeRunner) Run(ctx context.Context, c Command) (CommandResult, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, c)
+	f.mu.Unlock()
+	if f.Delay > 0 {
+		select {
+		case <-time.After(f.Delay):
+		case <-ctx.Done():
+			return CommandResult{ExitCode: -1}, ctx.Err()
+		}
+	}
+	if f.Err != nil {
+		return CommandResult{ExitCode: -1}, f.Err
+	}
+	for i := 0; i+1 < len(c.Args); i++ {
+		if data, ok := f.OutputFiles[c.Args[i]]; ok {
+			if err := ioutil.WriteFile(c.Args[i+1], data, 0644); err != nil {
+				return CommandResult{ExitCode: -1}, fmt.Errorf("fake runner failed to write %s: %v", c.Args[i+1], err)
+			}
+		}
+	}
+	if c.Stdout != nil {
+		_, _ = io.WriteString(c.Stdout, f.Stdout)
+	}
+	if c.Stderr != nil {
+		_, _ = io.WriteString(c.Stderr, f.Stderr)
+	}
+	if f.ResourceExceeded != "" {
+		return CommandResult{ExitCode: -1, ResourceExceeded: f.ResourceExceeded}, nil
+	}
+	return CommandResult{ExitCode: f.ExitCode, Signal: f.Signal}, nil
+}
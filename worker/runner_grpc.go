@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	muskoka "github.com/protolambda/muskoka-worker/proto"
+	"google.golang.org/grpc"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// grpcMaxMessageSize bounds the states and blocks sent to and received from a client daemon.
+const grpcMaxMessageSize = 1 << 30
+
+// GRPCRunner runs transition tasks on a client daemon, with the TransitionRunner service of proto/runner.proto.
+// The input files are sent to the daemon, and the post state it returns is written to the output file.
+// Commands without a task, like a batch, are run by the fallback runner.
+type GRPCRunner struct {
+	Addr     string
+	Fallback CommandRunner
+
+	connLock sync.Mutex
+	conn     *grpc.ClientConn
+}
+
+// dial connects to the daemon on first use, and reuses the connection after that.
+func (r *GRPCRunner) dial() (*grpc.ClientConn, error) {
+	r.connLock.Lock()
+	defer r.connLock.Unlock()
+	if r.conn != nil {
+		return r.conn, nil
+	}
+	conn, err := grpc.Dial(r.Addr, grpc.WithInsecure(),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(grpcMaxMessageSize), grpc.MaxCallSendMsgSize(grpcMaxMessageSize)))
+	if err != nil {
+		return nil, err
+	}
+	r.conn = conn
+	return conn, nil
+}
+
+// Check waits until the daemon accepts connections, or the timeout passes.
+func (r *GRPCRunner) Check(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, r.Addr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return fmt.Errorf("cannot connect to client daemon at %s: %v", r.Addr, err)
+	}
+	return conn.Close()
+}
+
+func (r *GRPCRunner) Run(ctx context.Context, c Command) (CommandResult, error) {
+	if c.Task == nil {
+		return r.Fallback.Run(ctx, c)
+	}
+	conn, err := r.dial()
+	if err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	req := &muskoka.TransitionRequest{
+		Key:         c.Task.Key,
+		SpecVersion: c.Task.SpecVersion,
+		SpecConfig:  c.Task.SpecConfig,
+		ConfigArgs:  c.Task.ConfigArgs,
+		Type:        c.Task.Type,
+		Operation:   c.Task.Operation,
+		Slots:       c.Task.Slots,
+	}
+	if req.Pre, err = ioutil.ReadFile(c.Task.Pre); err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	for _, p := range c.Task.Inputs {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return CommandResult{ExitCode: -1}, err
+		}
+		req.Blocks = append(req.Blocks, b)
+	}
+	resp, err := muskoka.NewTransitionRunnerClient(conn).RunTransition(ctx, req)
+	if err != nil {
+		return CommandResult{ExitCode: -1}, fmt.Errorf("client daemon failed to run task: %v", err)
+	}
+	if c.Stdout != nil && len(resp.Logs) > 0 {
+		_, _ = c.Stdout.Write(resp.Logs)
+	}
+	if !resp.Success {
+		if c.Stderr != nil && resp.Error != "" {
+			_, _ = fmt.Fprintf(c.Stderr, "%s\n", resp.Error)
+		}
+		return CommandResult{ExitCode: 1}, nil
+	}
+	if err := ioutil.WriteFile(c.Task.Post, resp.Post, 0644); err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	return CommandResult{ExitCode: 0}, nil
+}
+
+// Close closes the connection to the daemon, if any task connected to it.
+func (r *GRPCRunner) Close() {
+	r.connLock.Lock()
+	defer r.connLock.Unlock()
+	if r.conn != nil {
+		_ = r.conn.Close()
+		r.conn = nil
+	}
+}
@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	muskoka "github.com/protolambda/muskoka-worker/proto"
+	"google.golang.org/grpc"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeDaemon appends the blocks to the pre state, and fails the "bad" task.
+type fakeDaemon struct{}
+
+func (fakeDaemon) RunTransition(ctx context.Context, req *muskoka.TransitionRequest) (*muskoka.TransitionResponse, error) {
+	logs := []byte(fmt.Sprintf("processing %s with %d blocks\n", req.Key, len(req.Blocks)))
+	if req.Key == "bad" {
+		return &muskoka.TransitionResponse{Logs: logs, Error: "invalid block"}, nil
+	}
+	post := append([]byte{}, req.Pre...)
+	for _, b := range req.Blocks {
+		post = append(post, b...)
+	}
+	return &muskoka.TransitionResponse{Success: true, Post: post, Logs: logs}, nil
+}
+
+func TestGRPCRunner(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	muskoka.RegisterTransitionRunnerServer(srv, fakeDaemon{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	runner := &GRPCRunner{Addr: lis.Addr().String(), Fallback: ExecRunner{}}
+	defer runner.Close()
+	if err := runner.Check(time.Second * 5); err != nil {
+		t.Fatal(err)
+	}
+	h := newHarness(t, "", runner)
+	defer h.Close()
+	h.worker.AckPolicy = map[string]string{ErrorClassClient: ActionResult}
+
+	if !h.process(h.addTask("foo", []byte("pre-foo"), []byte("b0"), []byte("b1"))) {
+		t.Fatal("expected foo to be acked")
+	}
+	foo := h.result()
+	if !foo.Success || string(h.resultFile(foo.Files.PostState)) != "pre-foob0b1" {
+		t.Fatalf("unexpected result of foo: %+v", foo)
+	}
+	if out := string(h.resultFile(foo.Files.OutLog)); out != "processing foo with 2 blocks\n" {
+		t.Errorf("unexpected out log of foo: %q", out)
+	}
+
+	if !h.process(h.addTask("bad", []byte("pre-bad"))) {
+		t.Fatal("expected bad to be acked")
+	}
+	published := h.published()
+	bad := published[len(published)-1]
+	if bad.Success || bad.Status != StatusTransitionRejected {
+		t.Fatalf("expected bad to fail: %+v", bad)
+	}
+	if errLog := string(h.resultFile(bad.Files.ErrLog)); errLog != "invalid block\n" {
+		t.Errorf("unexpected err log of bad: %q", errLog)
+	}
+}
+
+func TestGRPCRunnerUnavailable(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	runner := &GRPCRunner{Addr: addr}
+	if err := runner.Check(time.Millisecond * 200); err == nil {
+		t.Fatal("expected the check to fail without a daemon")
+	}
+	// no task connected, so there is nothing to close
+	runner.Close()
+	if runner.conn != nil {
+		t.Error("expected Close not to connect to the daemon")
+	}
+}
@@ -0,0 +1,248 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ServerRequest is a transition task sent to a client in server mode, as a line of JSON on its stdin.
+type ServerRequest struct {
+	ID          int    `json:"id"`
+	Key         string `json:"key"`
+	SpecVersion string `json:"spec-version"`
+	SpecConfig  string `json:"spec-config"`
+	// the extra CLI arguments of the spec config, space separated. Empty if none.
+	ConfigArgs string `json:"config-args,omitempty"`
+	// the task type, and its parameters, see TransitionMsg
+	Type      string `json:"type"`
+	Operation string `json:"operation,omitempty"`
+	Slots     uint64 `json:"slots,omitempty"`
+	// absolute paths of the input files, and of the post state to write.
+	// Blocks has the other input files of the task type, for tasks that are not block transitions.
+	Pre    string   `json:"pre"`
+	Blocks []string `json:"blocks"`
+	Post   string   `json:"post"`
+	// absolute path of the JSON report the client may write, see Config.ClientReport
+	Report string `json:"report,omitempty"`
+}
+
+// ServerResponse is the outcome of a ServerRequest, as a line of JSON on the stdout of the client.
+type ServerResponse struct {
+	ID int `json:"id"`
+	// "ok" if the transition succeeded and the post state was written, "error" otherwise
+	Status string `json:"status"`
+	// why the transition failed
+	Error string `json:"error,omitempty"`
+}
+
+// ServerRunner keeps a client process running per cli cmd, and sends it transition tasks
+// over stdin, one at a time, see ServerRequest and ServerResponse.
+// Other lines on the stdout of the client are logged with the task that is running, and the error of a failed task
+// is its error log. The stderr of the client process is not framed per task, and goes to the worker log instead.
+// Commands without a task, like the preflight check, are run by the fallback runner.
+type ServerRunner struct {
+	Fallback CommandRunner
+
+	mu      sync.Mutex
+	servers map[string]*clientServer
+}
+
+func (r *ServerRunner) Run(ctx context.Context, c Command) (CommandResult, error) {
+	if c.Task == nil {
+		return r.Fallback.Run(ctx, c)
+	}
+	r.mu.Lock()
+	if r.servers == nil {
+		r.servers = make(map[string]*clientServer)
+	}
+	s, ok := r.servers[c.Task.CliCmd]
+	if !ok {
+		s = &clientServer{cliCmd: c.Task.CliCmd}
+		r.servers[c.Task.CliCmd] = s
+	}
+	r.mu.Unlock()
+	return s.run(ctx, c)
+}
+
+// Close stops the client processes.
+func (r *ServerRunner) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.servers {
+		s.mu.Lock()
+		s.stop()
+		s.mu.Unlock()
+	}
+}
+
+// clientServer is a running client process.
+type clientServer struct {
+	cliCmd string
+
+	// held while a task runs
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	lines  chan string
+	stderr *logLineWriter
+	nextID int
+}
+
+// start starts the client process, if it is not running.
+func (s *clientServer) start() error {
+	if s.cmd != nil {
+		return nil
+	}
+	parts, err := splitCommand(s.cliCmd)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("empty cli cmd")
+	}
+	cmd := exec.Command(parts[0], parts[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr := &logLineWriter{prefix: fmt.Sprintf("client server %s: ", s.cliCmd)}
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start client %s: %v", s.cliCmd, err)
+	}
+	log.Printf("started client server %s (pid %d)", s.cliCmd, cmd.Process.Pid)
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		r := bufio.NewReader(stdout)
+		for {
+			line, err := r.ReadString('\n')
+			if line != "" {
+				lines <- line
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	s.cmd, s.stdin, s.lines, s.stderr = cmd, stdin, lines, stderr
+	return nil
+}
+
+// stop kills the client process, if it is running.
+func (s *clientServer) stop() {
+	if s.cmd == nil {
+		return
+	}
+	_ = s.stdin.Close()
+	_ = killProcessGroup(s.cmd)
+	// drain the output, so the reader can exit
+	for range s.lines {
+	}
+	_ = s.cmd.Wait()
+	s.stderr.flush()
+	s.cmd = nil
+}
+
+// run sends the task of the command to the client process, starting it if needed, and waits for the response.
+// If the context is done first, or the process exits, it is stopped, and restarted for the next task.
+func (s *clientServer) run(ctx context.Context, c Command) (CommandResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.start(); err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	s.nextID++
+	req := ServerRequest{
+		ID:          s.nextID,
+		Key:         c.Task.Key,
+		SpecVersion: c.Task.SpecVersion,
+		SpecConfig:  c.Task.SpecConfig,
+		ConfigArgs:  c.Task.ConfigArgs,
+		Type:        c.Task.Type,
+		Operation:   c.Task.Operation,
+		Slots:       c.Task.Slots,
+		Pre:         c.Task.Pre,
+		Blocks:      append([]string{}, c.Task.Inputs...),
+		Post:        c.Task.Post,
+		Report:      c.Task.Report,
+	}
+	data, err := json.Marshal(&req)
+	if err != nil {
+		return CommandResult{ExitCode: -1}, err
+	}
+	if _, err := s.stdin.Write(append(data, '\n')); err != nil {
+		s.stop()
+		return CommandResult{ExitCode: -1}, fmt.Errorf("failed to send task to client server: %v", err)
+	}
+	stdout := c.Stdout
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			s.stop()
+			return CommandResult{ExitCode: -1}, ctx.Err()
+		case line, ok := <-s.lines:
+			if !ok {
+				s.stop()
+				return CommandResult{ExitCode: -1}, fmt.Errorf("client server exited while running task %s", req.Key)
+			}
+			var resp ServerResponse
+			if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &resp) != nil || resp.ID != req.ID {
+				_, _ = io.WriteString(stdout, line)
+				continue
+			}
+			if resp.Status == "ok" {
+				return CommandResult{ExitCode: 0}, nil
+			}
+			if c.Stderr != nil {
+				_, _ = fmt.Fprintf(c.Stderr, "%s\n", resp.Error)
+			}
+			return CommandResult{ExitCode: 1}, nil
+		}
+	}
+}
+
+// logLineWriter logs every line written to it, with the prefix.
+// It is only written to by the process output copy of exec.Cmd, which is done before the process Wait returns.
+type logLineWriter struct {
+	prefix string
+	buf    []byte
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		log.Printf("%s%s", w.prefix, w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush logs the last line, if it did not end with a newline.
+func (w *logLineWriter) flush() {
+	if len(w.buf) > 0 {
+		log.Printf("%s%s", w.prefix, w.buf)
+		w.buf = nil
+	}
+}
@@ -0,0 +1,393 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecuteSuccess(t *testing.T) {
+	fake := &FakeRunner{Stdout: "ok", OutputFiles: map[string][]byte{"--post": []byte("post")}}
+	h := newHarness(t, "", fake)
+	defer h.Close()
+
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	res := h.result()
+	if !res.Success || res.Status != StatusSuccess {
+		t.Error("expected success")
+	}
+	if res.Usage == nil || res.Usage.DurationMs < 0 {
+		t.Errorf("expected usage, got %+v", res.Usage)
+	}
+	if expected := fmt.Sprintf("0x%x", sha256.Sum256([]byte("post"))); res.PostHash != expected {
+		t.Errorf("post hash %s, expected %s", res.PostHash, expected)
+	}
+	calls := fake.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	// "sh <script>" and the --pre, --post and block arguments
+	if c := calls[0]; c.Name != "sh" || len(c.Args) != 6 || c.Args[1] != "--pre" || c.Args[3] != "--post" {
+		t.Errorf("unexpected command: %s %q", c.Name, c.Args)
+	}
+}
+
+func TestExecuteCrash(t *testing.T) {
+	fake := &FakeRunner{Stderr: "panic: oops", ExitCode: 2}
+	h := newHarness(t, "", fake)
+	defer h.Close()
+
+	if !h.process(h.addTask("foo", []byte("pre"))) {
+		t.Fatal("crashed transitions should still be acked")
+	}
+	res := h.result()
+	if res.Success {
+		t.Error("expected failure")
+	}
+	if errLog := h.resultFile(res.Files.ErrLog); string(errLog) != "panic: oops" {
+		t.Errorf("unexpected err log: %q", errLog)
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	fake := &FakeRunner{Delay: 10 * time.Second}
+	h := newHarness(t, "", fake)
+	defer h.Close()
+	h.worker.TransitionTimeout = 50 * time.Millisecond
+
+	if !h.process(h.addTask("foo", []byte("pre"))) {
+		t.Fatal("timed out transitions should still be acked")
+	}
+	res := h.result()
+	if res.Success || res.Status != StatusTimeout {
+		t.Errorf("expected timeout, got success: %v, status: %q", res.Success, res.Status)
+	}
+}
+
+func TestExecRunnerKillsChildren(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var out strings.Builder
+	start := time.Now()
+	// the background child keeps the output pipe open, unless it is killed too
+	_, err := ExecRunner{}.Run(ctx, Command{Name: "sh", Args: []string{"-c", "sleep 30 & sleep 30"}, Stdout: &out, Stderr: &out})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("expected command to be killed at the deadline, took %s", d)
+	}
+}
+
+func TestExecuteResourceExceeded(t *testing.T) {
+	fake := &FakeRunner{ResourceExceeded: ResourceMemory}
+	h := newHarness(t, "", fake)
+	defer h.Close()
+
+	if !h.process(h.addTask("foo", []byte("pre"))) {
+		t.Fatal("transitions exceeding a resource limit should still be acked")
+	}
+	res := h.result()
+	if res.Success || res.Status != StatusResourceExceeded || res.Exceeded != ResourceMemory {
+		t.Errorf("expected exceeded memory, got success: %v, status: %q, exceeded: %q", res.Success, res.Status, res.Exceeded)
+	}
+}
+
+func TestExecRunnerMaxCPU(t *testing.T) {
+	if !ResourceLimitsSupported {
+		t.Skip("resource limits are not supported on this platform")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	r := ExecRunner{MaxCPU: 300 * time.Millisecond}
+	res, err := r.Run(ctx, Command{Name: "sh", Args: []string{"-c", "while :; do :; done"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.ResourceExceeded != ResourceCPU {
+		t.Errorf("expected exceeded cpu, got %q", res.ResourceExceeded)
+	}
+}
+
+func TestExecRunnerUsage(t *testing.T) {
+	res, err := ExecRunner{}.Run(context.Background(), Command{Name: "sh", Args: []string{"-c", "exit 3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode != 3 || res.Usage == nil {
+		t.Fatalf("expected exit code 3 with usage, got %+v", res)
+	}
+	if runtime.GOOS != "windows" && res.Usage.MaxRSS <= 0 {
+		t.Errorf("expected max rss, got %d", res.Usage.MaxRSS)
+	}
+}
+
+func TestExecRunnerSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not reported on windows")
+	}
+	res, err := ExecRunner{}.Run(context.Background(), Command{Name: "sh", Args: []string{"-c", "kill -9 $$"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode != -1 || res.Signal != "killed" {
+		t.Errorf("expected to be killed by a signal, got %+v", res)
+	}
+}
+
+func TestExecuteMissingPost(t *testing.T) {
+	h := newHarness(t, "", &FakeRunner{})
+	defer h.Close()
+
+	if !h.process(h.addTask("foo", []byte("pre"))) {
+		t.Fatal("expected task to be acked")
+	}
+	res := h.result()
+	if res.PostHash != fmt.Sprintf("0x%x", [32]byte{}) {
+		t.Errorf("expected zero post hash, got %s", res.PostHash)
+	}
+	if _, ok := h.results.Get(res.Files.PostState[len(h.results.URL("")):]); ok {
+		t.Error("expected no post state upload")
+	}
+}
+
+func TestCanaryDrift(t *testing.T) {
+	fake := &FakeRunner{OutputFiles: map[string][]byte{"--post": []byte("post")}}
+	h := newHarness(t, "", fake)
+	defer h.Close()
+	h.addTask("canary", []byte("pre"), []byte("block0"))
+	h.worker.CanaryKey = "canary"
+	h.worker.CanaryBlocks = 1
+
+	postHash, err := h.worker.checkCanary(context.Background(), "")
+	if err != nil {
+		t.Fatalf("unexpected canary failure: %v", err)
+	}
+	if _, err := h.worker.checkCanary(context.Background(), postHash); err != nil {
+		t.Fatalf("unexpected canary failure: %v", err)
+	}
+	fake.OutputFiles["--post"] = []byte("drifted")
+	if _, err := h.worker.checkCanary(context.Background(), postHash); err == nil {
+		t.Fatal("expected canary to detect drift")
+	}
+	if n := len(h.published()); n != 0 {
+		t.Fatalf("canary results should not be published, got %d", n)
+	}
+}
+
+func TestMultiConfig(t *testing.T) {
+	fake := &FakeRunner{OutputFiles: map[string][]byte{"--post": []byte("post")}}
+	h := newHarness(t, "", fake)
+	defer h.Close()
+	h.worker.SpecConfigs = []string{"minimal", "mainnet"}
+	h.worker.ConfigCliArgs = map[string]string{"mainnet": "--preset mainnet"}
+
+	msg := h.addTask("foo", []byte("pre"))
+	msg.SpecConfig = "mainnet"
+	h.inputs.Put(msg.InputsBucketPathStart()+"/pre.ssz", []byte("pre"))
+	if !h.process(msg) {
+		t.Fatal("expected task to be acked")
+	}
+	if !h.result().Success {
+		t.Error("expected success")
+	}
+	if c := fake.Calls()[0]; c.Args[1] != "--preset" || c.Args[2] != "mainnet" {
+		t.Errorf("expected preset args, got %q", c.Args)
+	}
+}
+
+func TestDynamicConfig(t *testing.T) {
+	fake := &FakeRunner{OutputFiles: map[string][]byte{"--post": []byte("post")}}
+	h := newHarness(t, "", fake)
+	defer h.Close()
+	otherResults := NewMemStore("other-results")
+	h.worker.OpenStore = func(bucketName string) BlobStore {
+		if bucketName != "other-results" {
+			t.Fatalf("unexpected bucket %s", bucketName)
+		}
+		return otherResults
+	}
+	src := func(ctx context.Context) ([]byte, error) {
+		return []byte(`{"cli-cmd": "newclient transition", "results-bucket": "other-results"}`), nil
+	}
+	if err := h.worker.LoadDynamicConfig(src); err != nil {
+		t.Fatal(err)
+	}
+	if !h.process(h.addTask("foo", []byte("pre"))) {
+		t.Fatal("expected task to be acked")
+	}
+	if c := fake.Calls()[0]; c.Name != "newclient" || c.Args[0] != "transition" {
+		t.Errorf("expected new cli cmd, got %s %q", c.Name, c.Args)
+	}
+	if len(otherResults.Names()) == 0 || len(h.results.Names()) != 0 {
+		t.Error("expected results in the new results bucket only")
+	}
+}
+
+// blockingRunner writes a line of output, and blocks until released.
+type blockingRunner struct {
+	release chan struct{}
+}
+
+func (r *blockingRunner) Run(ctx context.Context, c Command) (CommandResult, error) {
+	_, _ = io.WriteString(c.Stdout, "partial\n")
+	<-r.release
+	_, _ = io.WriteString(c.Stdout, "done\n")
+	return CommandResult{}, nil
+}
+
+func TestLiveLogs(t *testing.T) {
+	runner := &blockingRunner{release: make(chan struct{})}
+	h := newHarness(t, "", runner)
+	defer h.Close()
+	h.worker.LiveLogAfter = time.Millisecond
+	h.worker.LiveLogInterval = time.Millisecond
+
+	data, _ := json.Marshal(h.addTask("foo", []byte("pre")))
+	h.start()
+	delivery := h.queue.Push(data)
+	partialOut := func() string {
+		for _, name := range h.results.Names() {
+			if strings.HasSuffix(name, "/std_out_log.txt") {
+				out, _ := h.results.Get(name)
+				return string(out)
+			}
+		}
+		return ""
+	}
+	for start := time.Now(); partialOut() != "partial\n"; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("partial log was not streamed")
+		}
+	}
+	close(runner.release)
+	if !delivery.Wait() {
+		t.Fatal("expected task to be acked")
+	}
+	if out := partialOut(); out != "partial\ndone\n" {
+		t.Errorf("expected final log to replace partial log, got %q", out)
+	}
+}
+
+func TestResultRouting(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	private := NewMemStore("private")
+	h.worker.OpenStore = func(bucketName string) BlobStore {
+		if bucketName != "private" {
+			t.Fatalf("unexpected bucket %s", bucketName)
+		}
+		return private
+	}
+	h.worker.ResultRoutes = []string{"private/fuzz"}
+
+	msg := h.addTask("foo", []byte("pre"), []byte("block0"))
+	msg.ResultsBucket = "private"
+	msg.ResultsPrefix = "fuzz/run1"
+	if !h.process(msg) {
+		t.Fatal("expected task to be acked")
+	}
+	if names := h.results.Names(); len(names) != 0 {
+		t.Errorf("expected no results in the default bucket, got %v", names)
+	}
+	res := h.result()
+	if !strings.HasPrefix(res.Files.PostState, "mem://private/fuzz/run1/v0.8.3/minimal/foo/") {
+		t.Errorf("unexpected post state location: %s", res.Files.PostState)
+	}
+
+	msg.ResultsPrefix = "other"
+	if !h.process(msg) {
+		t.Fatal("expected task with disallowed route to be acked")
+	}
+	if len(h.queue.Published()) != 1 {
+		t.Error("expected task with disallowed route to be ignored")
+	}
+
+	h.worker.UnsupportedAction = UnsupportedNack
+	if h.process(msg) {
+		t.Error("expected task with disallowed route to be nacked as unsupported")
+	}
+}
+
+// lengthHasher is a StateHasher that "hashes" to the number of bytes written.
+type lengthHasher struct {
+	n int
+}
+
+func (h *lengthHasher) Write(p []byte) (int, error) {
+	h.n += len(p)
+	return len(p), nil
+}
+
+func (h *lengthHasher) Sum() (out [32]byte, err error) {
+	out[0] = byte(h.n)
+	return out, nil
+}
+
+func TestPostTreeHash(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.TreeHasher = func(specVersion string, specConfig string) StateHasher {
+		if specConfig != "minimal" {
+			return nil
+		}
+		return &lengthHasher{}
+	}
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	res := h.result()
+	if expected := fmt.Sprintf("0x%x", [32]byte{byte(len("preblock0"))}); res.PostRoot != expected {
+		t.Errorf("post root %s, expected %s", res.PostRoot, expected)
+	}
+	if expected := fmt.Sprintf("0x%x", sha256.Sum256([]byte("preblock0"))); res.PostHash != expected {
+		t.Errorf("post hash %s, expected %s", res.PostHash, expected)
+	}
+}
+
+type failingPublishQueue struct {
+	*MemQueue
+}
+
+func (q failingPublishQueue) Publish(ctx context.Context, data []byte) error {
+	return fmt.Errorf("publish unavailable")
+}
+
+func (q failingPublishQueue) PublishWithAttributes(ctx context.Context, data []byte, attributes map[string]string) error {
+	return q.Publish(ctx, data)
+}
+
+func TestNackUntilPublished(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	msg := h.addTask("foo", []byte("pre"), []byte("block0"))
+
+	// uploads fail
+	h.worker.Results = &clientStore{BlobStore: h.results, clientName: "otherclient"}
+	if h.process(msg) {
+		t.Fatal("expected task to be nacked when uploads fail")
+	}
+	if len(h.queue.Published()) != 0 {
+		t.Fatal("expected no result to be published when uploads fail")
+	}
+
+	// publishing fails
+	h.worker.Results = h.results
+	h.worker.Queue = failingPublishQueue{h.queue}
+	if h.process(msg) {
+		t.Fatal("expected task to be nacked when publishing fails")
+	}
+
+	h.worker.Queue = h.queue
+	if !h.process(msg) {
+		t.Fatal("expected task to be acked once published")
+	}
+}
@@ -0,0 +1,182 @@
+package worker
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// taskScheduler limits how many tasks run at the same time.
+// Waiting tasks of different classes (subscriptions) share the slots weighted-fairly, so a flood of tasks
+// in one subscription can't starve the others. Within a class, tasks are started smallest first (fewest blocks),
+// so a stream of small tasks is not blocked by a huge one. Large tasks are capped separately, to fit memory.
+// Urgent tasks (of priority subscriptions) go before all others, with the same fairness among them.
+type taskScheduler struct {
+	mu sync.Mutex
+	// free slots, negative while more tasks run than the capacity, after it was lowered
+	slots      int
+	largeSlots int
+	// the current number of slots, and the maximum it can be raised to
+	capacity int
+	limit    int
+	// tasks with at least this many blocks are large. No separate cap if 0.
+	largeBlocks int
+	// relative share of the slots per class, 1 if not specified
+	weights map[string]int
+	// weighted number of started tasks per class
+	served map[string]float64
+	// the served value of the last started task, new active classes start from here
+	vtime float64
+	// sorted by blocks, in order of arrival for tasks of the same size
+	waiting []*scheduledTask
+}
+
+type scheduledTask struct {
+	class   string
+	blocks  int
+	urgent  bool
+	ready   chan struct{}
+	granted bool
+}
+
+func newTaskScheduler(concurrency int, largeBlocks int, maxLarge int, weights map[string]int) *taskScheduler {
+	if maxLarge <= 0 || maxLarge > concurrency {
+		maxLarge = concurrency
+	}
+	return &taskScheduler{
+		slots:       concurrency,
+		capacity:    concurrency,
+		limit:       concurrency,
+		largeSlots:  maxLarge,
+		largeBlocks: largeBlocks,
+		weights:     weights,
+		served:      make(map[string]float64),
+	}
+}
+
+func (s *taskScheduler) isLarge(blocks int) bool {
+	return s.largeBlocks > 0 && blocks >= s.largeBlocks
+}
+
+func (s *taskScheduler) weight(class string) float64 {
+	if w, ok := s.weights[class]; ok && w > 0 {
+		return float64(w)
+	}
+	return 1
+}
+
+// acquire waits for a slot to run a task of the given class, with the given number of blocks.
+// The returned function releases the slot, and must be called when the task is done.
+func (s *taskScheduler) acquire(ctx context.Context, class string, blocks int, urgent bool) (release func(), err error) {
+	s.mu.Lock()
+	t := &scheduledTask{class: class, blocks: blocks, urgent: urgent, ready: make(chan struct{})}
+	if !s.hasWaiting(class) && s.served[class] < s.vtime {
+		// don't let a class that was idle catch up on its share all at once
+		s.served[class] = s.vtime
+	}
+	i := sort.Search(len(s.waiting), func(i int) bool {
+		return s.waiting[i].blocks > blocks
+	})
+	s.waiting = append(s.waiting, nil)
+	copy(s.waiting[i+1:], s.waiting[i:])
+	s.waiting[i] = t
+	s.dispatch()
+	s.mu.Unlock()
+
+	release = func() {
+		s.mu.Lock()
+		s.slots++
+		if s.isLarge(blocks) {
+			s.largeSlots++
+		}
+		s.dispatch()
+		s.mu.Unlock()
+	}
+	select {
+	case <-t.ready:
+		return release, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		granted := t.granted
+		if !granted {
+			for i, w := range s.waiting {
+				if w == t {
+					s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+					break
+				}
+			}
+		}
+		s.mu.Unlock()
+		if granted {
+			// raced with the grant, give the slot back
+			release()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (s *taskScheduler) hasWaiting(class string) bool {
+	for _, t := range s.waiting {
+		if t.class == class {
+			return true
+		}
+	}
+	return false
+}
+
+// setConcurrency changes the number of slots. Running tasks keep their slot,
+// with a lower concurrency new tasks wait until enough of them are done.
+func (s *taskScheduler) setConcurrency(concurrency int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slots += concurrency - s.capacity
+	s.capacity = concurrency
+	s.dispatch()
+}
+
+// dispatch starts waiting tasks while there are free slots: urgent tasks first,
+// then the smallest task of the least served class. Must be called with the lock held.
+func (s *taskScheduler) dispatch() {
+	for s.slots > 0 {
+		next := -1
+		for i, t := range s.waiting {
+			if s.isLarge(t.blocks) && s.largeSlots <= 0 {
+				continue
+			}
+			if next < 0 {
+				next = i
+				continue
+			}
+			if n := s.waiting[next]; t.urgent != n.urgent {
+				if t.urgent {
+					next = i
+				}
+			} else if s.served[t.class] < s.served[n.class] {
+				next = i
+			}
+		}
+		if next < 0 {
+			return
+		}
+		t := s.waiting[next]
+		s.waiting = append(s.waiting[:next], s.waiting[next+1:]...)
+		s.slots--
+		if s.isLarge(t.blocks) {
+			s.largeSlots--
+		}
+		s.vtime = s.served[t.class]
+		s.served[t.class] += 1 / s.weight(t.class)
+		t.granted = true
+		close(t.ready)
+	}
+}
+
+// taskScheduler returns the scheduler of the worker, or nil if the concurrency is unlimited.
+func (w *Worker) taskScheduler() *taskScheduler {
+	w.schedulerOnce.Do(func() {
+		if w.Concurrency > 0 {
+			w.scheduler = newTaskScheduler(w.Concurrency, w.LargeTaskBlocks, w.MaxLargeTasks, w.ConfigWeights)
+		}
+	})
+	return w.scheduler
+}
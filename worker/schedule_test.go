@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulerSmallFirst(t *testing.T) {
+	s := newTaskScheduler(1, 0, 0, nil)
+	release, err := s.acquire(context.Background(), "minimal", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := make(chan int, 2)
+	start := func(blocks int) {
+		go func() {
+			release, err := s.acquire(context.Background(), "minimal", blocks, false)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- blocks
+			release()
+		}()
+	}
+	start(128)
+	time.Sleep(20 * time.Millisecond)
+	start(2)
+	time.Sleep(20 * time.Millisecond)
+	release()
+	if first, second := <-order, <-order; first != 2 || second != 128 {
+		t.Errorf("expected small task first, got order %d, %d", first, second)
+	}
+}
+
+func TestSchedulerLargeCap(t *testing.T) {
+	s := newTaskScheduler(3, 64, 1, nil)
+	releaseLarge, err := s.acquire(context.Background(), "minimal", 128, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.acquire(ctx, "minimal", 64, false); err == nil {
+		t.Fatal("expected second large task to wait")
+	}
+	releaseSmall, err := s.acquire(context.Background(), "minimal", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseSmall()
+	releaseLarge()
+	releaseLarge, err = s.acquire(context.Background(), "minimal", 64, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseLarge()
+	if s.slots != 3 || s.largeSlots != 1 || len(s.waiting) != 0 {
+		t.Errorf("unexpected scheduler state: %d slots, %d large slots, %d waiting", s.slots, s.largeSlots, len(s.waiting))
+	}
+}
+
+func TestSchedulerFairShare(t *testing.T) {
+	s := newTaskScheduler(1, 0, 0, map[string]int{"mainnet": 2})
+	release, err := s.acquire(context.Background(), "minimal", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flood one subscription, before the other gets any tasks
+	order := make(chan string, 20)
+	start := func(class string) {
+		go func() {
+			release, err := s.acquire(context.Background(), class, 1, false)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- class
+			release()
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		start("minimal")
+	}
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		start("mainnet")
+	}
+	time.Sleep(20 * time.Millisecond)
+	release()
+	counts := make(map[string]int)
+	for i := 0; i < 9; i++ {
+		counts[<-order]++
+	}
+	if counts["mainnet"] != 6 || counts["minimal"] != 3 {
+		t.Errorf("expected tasks to be shared 2:1, got %v", counts)
+	}
+}
+
+func TestSchedulerUrgentFirst(t *testing.T) {
+	s := newTaskScheduler(1, 0, 0, nil)
+	release, err := s.acquire(context.Background(), "minimal", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := make(chan bool, 10)
+	start := func(urgent bool, blocks int) {
+		go func() {
+			release, err := s.acquire(context.Background(), "minimal", blocks, urgent)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- urgent
+			release()
+		}()
+	}
+	// smaller normal tasks arrive first, the urgent tasks still go before them
+	for i := 0; i < 3; i++ {
+		start(false, 1)
+	}
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		start(true, 10)
+	}
+	time.Sleep(20 * time.Millisecond)
+	release()
+	for i := 0; i < 5; i++ {
+		if urgent := <-order; urgent != (i < 2) {
+			t.Fatalf("task %d: expected urgent=%v", i, i < 2)
+		}
+	}
+}
+
+func TestSchedulerSetConcurrency(t *testing.T) {
+	s := newTaskScheduler(2, 0, 0, nil)
+	release1, err := s.acquire(context.Background(), "minimal", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release2, err := s.acquire(context.Background(), "minimal", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// running tasks keep their slot, new tasks wait until the running tasks fit the lower concurrency
+	s.setConcurrency(1)
+	release1()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.acquire(ctx, "minimal", 1, false); err == nil {
+		t.Fatal("expected task to wait for the lower concurrency")
+	}
+	release2()
+	release1, err = s.acquire(context.Background(), "minimal", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a higher concurrency starts waiting tasks
+	started := make(chan struct{})
+	go func() {
+		release, err := s.acquire(context.Background(), "minimal", 1, false)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		close(started)
+		release()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	s.setConcurrency(2)
+	<-started
+	release1()
+	if s.slots != 2 || len(s.waiting) != 0 {
+		t.Errorf("unexpected scheduler state: %d slots, %d waiting", s.slots, len(s.waiting))
+	}
+}
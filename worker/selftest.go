@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+)
+
+// SelfTest runs the golden vector in the given directory through the client, and returns an error if the
+// output does not match. The directory contains pre.ssz, block_0.ssz ... block_<n-1>.ssz, and the expected post.ssz.
+func (w *Worker) SelfTest(vectorDir string) error {
+	expectedPost, err := ioutil.ReadFile(path.Join(vectorDir, "post.ssz"))
+	if err != nil {
+		return fmt.Errorf("failed to read expected post state: %v", err)
+	}
+	tr := &TransitionMsg{
+		SpecVersion: w.AllTargets()[0].SpecVersion,
+		SpecConfig:  w.AllTargets()[0].SpecConfig,
+		Key:         "self-test",
+		ResultKey:   uniqueID(),
+		WorkDir:     w.workDir(),
+	}
+	defer func() {
+		if err := os.RemoveAll(tr.DirPath()); err != nil {
+			log.Printf("cannot clean up temporary files of self-test: %v", err)
+		}
+	}()
+	if err := os.MkdirAll(tr.DirPath(), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to make self-test directory: %v", err)
+	}
+	if err := copyFile(path.Join(tr.DirPath(), "pre.ssz"), path.Join(vectorDir, "pre.ssz")); err != nil {
+		return fmt.Errorf("failed to copy pre state: %v", err)
+	}
+	for {
+		blockName := fmt.Sprintf("block_%d.ssz", tr.Blocks)
+		if err := copyFile(path.Join(tr.DirPath(), blockName), path.Join(vectorDir, blockName)); os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to copy %s: %v", blockName, err)
+		}
+		tr.Blocks++
+	}
+	out, err := w.runTransition(context.Background(), tr, w.primaryClient(), nil)
+	if err != nil {
+		return err
+	}
+	if !out.Success {
+		return fmt.Errorf("transition failed: %s", readTail(out.Stderr, logTailSize))
+	}
+	if expected, got := sha256.Sum256(expectedPost), w.hashPostState(tr, tr.DirPath()).Flat; got != expected {
+		return fmt.Errorf("post hash 0x%x does not match expected 0x%x", got, expected)
+	}
+	return nil
+}
+
+func copyFile(dst string, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,244 @@
+package worker
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ReleaseManifestName is the name of the release manifest in a release source, see ReleaseManifest.
+const ReleaseManifestName = "release.json"
+
+// ReleaseManifest describes the latest release of the worker.
+type ReleaseManifest struct {
+	// the version of the release, e.g. "v0.4.1"
+	Version string `json:"version"`
+	// the binary of the release per platform, formatted as <GOOS>-<GOARCH>, e.g. "linux-amd64"
+	Binaries map[string]ReleaseBinary `json:"binaries"`
+}
+
+// ReleaseBinary is the worker binary of a release, for a single platform.
+type ReleaseBinary struct {
+	// the name of the binary in the release source
+	Name string `json:"name"`
+	// the 0x-prefixed sha256 of the binary
+	SHA256 string `json:"sha256"`
+	// the base64 ed25519 signature of the release version, the platform and the sha256 of the binary, by the release key.
+	// See releaseSigningPayload.
+	Signature string `json:"signature"`
+}
+
+// ReleaseSource provides the release manifest and the binaries it references, by name.
+// A BlobStore of a release bucket is a ReleaseSource.
+type ReleaseSource interface {
+	NewReader(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// HTTPReleaseSource reads releases from a base URL,
+// e.g. https://github.com/<owner>/<repo>/releases/latest/download for the assets of the latest GitHub release.
+type HTTPReleaseSource struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func (s *HTTPReleaseSource) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(s.BaseURL, "/")+"/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status of %s: %s", name, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// SelfUpdate replaces the worker binary with newer signed releases, see Worker.RunSelfUpdate.
+type SelfUpdate struct {
+	Source ReleaseSource
+	// the key that signs the release binaries
+	PubKey ed25519.PublicKey
+	// the version of the running worker
+	Version string
+	// the path of the running worker binary, to replace
+	Executable string
+	// how often to check for a newer release
+	Interval time.Duration
+	// how long to wait for in-flight tasks to finish before installing a release. The update is retried later on timeout.
+	DrainTimeout time.Duration
+}
+
+// RunSelfUpdate checks the release source every interval for a newer release of the worker.
+// A newer binary is downloaded and verified, then the worker stops receiving tasks and waits for the in-flight tasks,
+// and the binary is swapped. It returns true once a release is installed, with the worker paused,
+// so the caller can clean up and restart with RestartProcess. It returns false when ctx is done.
+func (w *Worker) RunSelfUpdate(ctx context.Context, u *SelfUpdate) bool {
+	current, err := parseSpecVersion(u.Version)
+	if err != nil {
+		log.Printf("WARNING: self-update disabled, worker version %q is not a release version: %v", u.Version, err)
+		return false
+	}
+	// the binary of the previous version, swapped out by the last update
+	_ = os.Remove(u.Executable + ".old")
+	ticker := time.NewTicker(u.Interval)
+	defer ticker.Stop()
+	for {
+		installed, err := w.selfUpdate(ctx, u, current)
+		if err != nil {
+			log.Printf("self-update failed: %v", err)
+		}
+		if installed {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// selfUpdate installs the latest release if it is newer than the current version, and returns true if it did.
+func (w *Worker) selfUpdate(ctx context.Context, u *SelfUpdate, current specVersion) (bool, error) {
+	var manifest ReleaseManifest
+	if err := readReleaseFile(ctx, u.Source, ReleaseManifestName, 1<<20, func(data []byte) error {
+		return json.Unmarshal(data, &manifest)
+	}); err != nil {
+		return false, fmt.Errorf("failed to read release manifest: %v", err)
+	}
+	latest, err := parseSpecVersion(manifest.Version)
+	if err != nil {
+		return false, fmt.Errorf("invalid release version: %v", err)
+	}
+	if latest.compare(current) <= 0 {
+		return false, nil
+	}
+	platform := runtime.GOOS + "-" + runtime.GOARCH
+	bin, ok := manifest.Binaries[platform]
+	if !ok {
+		return false, fmt.Errorf("release %s has no binary for %s", manifest.Version, platform)
+	}
+	// the version is signed with the binary, an older signed binary cannot be served as a newer release
+	if err := verifyReleaseSignature(manifest.Version, platform, &bin, u.PubKey); err != nil {
+		return false, fmt.Errorf("refusing release %s: %v", manifest.Version, err)
+	}
+	log.Printf("downloading worker release %s (running %s)", manifest.Version, u.Version)
+	newPath := u.Executable + ".new"
+	if err := readReleaseFile(ctx, u.Source, bin.Name, 1<<30, func(data []byte) error {
+		if sum := sha256.Sum256(data); fmt.Sprintf("0x%x", sum) != bin.SHA256 {
+			return fmt.Errorf("checksum mismatch: expected %s, got 0x%x", bin.SHA256, sum)
+		}
+		return ioutil.WriteFile(newPath, data, 0755)
+	}); err != nil {
+		return false, fmt.Errorf("failed to download release %s: %v", manifest.Version, err)
+	}
+	defer os.Remove(newPath)
+
+	if !w.drain(ctx, u.DrainTimeout) {
+		w.Resume()
+		return false, fmt.Errorf("in-flight tasks did not finish within %s, installing release %s later", u.DrainTimeout, manifest.Version)
+	}
+	// a running binary cannot be overwritten on Windows, but it can be renamed
+	if err := os.Rename(u.Executable, u.Executable+".old"); err != nil {
+		w.Resume()
+		return false, fmt.Errorf("failed to move current binary: %v", err)
+	}
+	if err := os.Rename(newPath, u.Executable); err != nil {
+		if restoreErr := os.Rename(u.Executable+".old", u.Executable); restoreErr != nil {
+			log.Printf("WARNING: failed to restore the current binary: %v", restoreErr)
+		}
+		w.Resume()
+		return false, fmt.Errorf("failed to install release %s: %v", manifest.Version, err)
+	}
+	log.Printf("installed worker release %s", manifest.Version)
+	return true, nil
+}
+
+// readReleaseFile reads the named file of the release source, of at most limit bytes, and handles its contents.
+func readReleaseFile(ctx context.Context, src ReleaseSource, name string, limit int64, f func(data []byte) error) error {
+	r, err := src.NewReader(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > limit {
+		return fmt.Errorf("%s is larger than %d bytes", name, limit)
+	}
+	return f(data)
+}
+
+// releaseSigningPayload is the data that is signed for the binary of a release:
+// the version, the platform and the checksum, so a signed binary cannot be served as another version or platform.
+func releaseSigningPayload(version string, platform string, sha256 string) []byte {
+	return []byte("muskoka-worker release\n" + version + "\n" + platform + "\n" + sha256)
+}
+
+// verifyReleaseSignature checks the signature of the release binary of the platform, for the release version.
+// The checksum of the binary is checked once it is downloaded.
+func verifyReleaseSignature(version string, platform string, bin *ReleaseBinary, pubKey ed25519.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(bin.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %v", err)
+	}
+	if !ed25519.Verify(pubKey, releaseSigningPayload(version, platform, bin.SHA256), sig) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// drain pauses the worker, and waits for the received tasks to finish. It returns false on timeout.
+func (w *Worker) drain(ctx context.Context, timeout time.Duration) bool {
+	w.Pause()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt32(&w.handling) > 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline.C:
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// SignRelease adds the binary of the platform to the release manifest, with its checksum and signature.
+// The signature covers the version of the manifest, so the version must be set first.
+func SignRelease(manifest *ReleaseManifest, platform string, name string, data []byte, key ed25519.PrivateKey) {
+	if manifest.Binaries == nil {
+		manifest.Binaries = make(map[string]ReleaseBinary)
+	}
+	sum := fmt.Sprintf("0x%x", sha256.Sum256(data))
+	manifest.Binaries[platform] = ReleaseBinary{
+		Name:      name,
+		SHA256:    sum,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, releaseSigningPayload(manifest.Version, platform, sum))),
+	}
+}
@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSelfUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muskoka-selfupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	exe := filepath.Join(dir, "muskoka_worker")
+	if err := ioutil.WriteFile(exe, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releases := NewMemStore("releases")
+	publish := func(version string, binary []byte, signingKey ed25519.PrivateKey) {
+		manifest := ReleaseManifest{Version: version}
+		SignRelease(&manifest, runtime.GOOS+"-"+runtime.GOARCH, "muskoka_worker-"+version, binary, signingKey)
+		data, err := json.Marshal(&manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases.Put(ReleaseManifestName, data)
+		releases.Put("muskoka_worker-"+version, binary)
+	}
+	h := newHarness(t, "", &FakeRunner{})
+	defer h.Close()
+	u := &SelfUpdate{Source: releases, PubKey: pub, Version: "v0.2.0", Executable: exe, Interval: time.Hour, DrainTimeout: time.Second}
+	current, err := parseSpecVersion(u.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectBinary := func(expected string) {
+		t.Helper()
+		if data, err := ioutil.ReadFile(exe); err != nil || string(data) != expected {
+			t.Fatalf("expected binary %q, got %q (%v)", expected, data, err)
+		}
+	}
+
+	// not newer
+	publish("v0.2.0", []byte("same binary"), key)
+	if installed, err := h.worker.selfUpdate(context.Background(), u, current); installed || err != nil {
+		t.Fatalf("expected no update to the same version: %v", err)
+	}
+	expectBinary("old binary")
+
+	// signed by another key
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish("v0.3.0", []byte("spoofed binary"), otherKey)
+	if installed, err := h.worker.selfUpdate(context.Background(), u, current); installed || err == nil {
+		t.Fatal("expected release with an invalid signature to be refused")
+	}
+	expectBinary("old binary")
+	if paused, _ := h.worker.PauseStatus(); paused {
+		t.Fatal("expected worker to keep receiving tasks")
+	}
+
+	// an older signed release, served as a newer version
+	rollback := ReleaseManifest{Version: "v0.1.0"}
+	SignRelease(&rollback, runtime.GOOS+"-"+runtime.GOARCH, "muskoka_worker-v0.1.0", []byte("older binary"), key)
+	rollback.Version = "v0.4.0"
+	data, err := json.Marshal(&rollback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releases.Put(ReleaseManifestName, data)
+	releases.Put("muskoka_worker-v0.1.0", []byte("older binary"))
+	if installed, err := h.worker.selfUpdate(context.Background(), u, current); installed || err == nil {
+		t.Fatal("expected release with a version that is not signed to be refused")
+	}
+	expectBinary("old binary")
+
+	publish("v0.3.0", []byte("new binary"), key)
+	if installed, err := h.worker.selfUpdate(context.Background(), u, current); !installed || err != nil {
+		t.Fatalf("expected newer release to be installed: %v", err)
+	}
+	expectBinary("new binary")
+	if paused, _ := h.worker.PauseStatus(); !paused {
+		t.Error("expected worker to be paused until the restart")
+	}
+	if _, err := os.Stat(exe + ".new"); !os.IsNotExist(err) {
+		t.Error("expected downloaded binary to be moved")
+	}
+}
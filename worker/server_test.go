@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestServerHelperProcess is not a real test: it is the client process of the server mode tests.
+// It appends the blocks to the pre state, and fails the "bad" task.
+func TestServerHelperProcess(t *testing.T) {
+	if os.Getenv("MUSKOKA_SERVER_HELPER") != "1" {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "client started\n")
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req ServerRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			fmt.Fprintf(os.Stderr, "bad request: %v\n", err)
+			os.Exit(2)
+		}
+		fmt.Printf("processing %s\n", req.Key)
+		resp := ServerResponse{ID: req.ID, Status: "ok"}
+		if err := serverHelperTransition(&req); err != nil {
+			resp.Status, resp.Error = "error", err.Error()
+		}
+		data, _ := json.Marshal(&resp)
+		fmt.Println(string(data))
+	}
+	os.Exit(0)
+}
+
+func serverHelperTransition(req *ServerRequest) error {
+	if req.Key == "bad" {
+		return fmt.Errorf("invalid block")
+	}
+	out, err := ioutil.ReadFile(req.Pre)
+	if err != nil {
+		return err
+	}
+	for _, b := range req.Blocks {
+		data, err := ioutil.ReadFile(b)
+		if err != nil {
+			return err
+		}
+		out = append(out, data...)
+	}
+	return ioutil.WriteFile(req.Post, out, 0644)
+}
+
+func TestServerMode(t *testing.T) {
+	os.Setenv("MUSKOKA_SERVER_HELPER", "1")
+	defer os.Unsetenv("MUSKOKA_SERVER_HELPER")
+	runner := &ServerRunner{Fallback: ExecRunner{}}
+	defer runner.Close()
+	h := newHarness(t, "", runner)
+	defer h.Close()
+	h.worker.CliCmd = os.Args[0] + " -test.run=^TestServerHelperProcess$"
+	h.worker.AckPolicy = map[string]string{ErrorClassClient: ActionResult}
+
+	if !h.process(h.addTask("foo", []byte("pre-foo"), []byte("b0"), []byte("b1"))) {
+		t.Fatal("expected foo to be acked")
+	}
+	foo := h.result()
+	if !foo.Success || string(h.resultFile(foo.Files.PostState)) != "pre-foob0b1" {
+		t.Fatalf("unexpected result of foo: %+v", foo)
+	}
+	if out := string(h.resultFile(foo.Files.OutLog)); out != "processing foo\n" {
+		t.Errorf("unexpected stdout of foo: %q", out)
+	}
+
+	if !h.process(h.addTask("bad", []byte("pre-bad"))) {
+		t.Fatal("expected bad to be acked")
+	}
+	published := h.published()
+	bad := published[len(published)-1]
+	if bad.Success || bad.Status != StatusTransitionRejected {
+		t.Fatalf("expected bad to fail: %+v", bad)
+	}
+	if errLog := string(h.resultFile(bad.Files.ErrLog)); errLog != "invalid block\n" {
+		t.Errorf("unexpected stderr of bad: %q", errLog)
+	}
+
+	if len(runner.servers) != 1 {
+		t.Fatalf("expected a single client process, got %d", len(runner.servers))
+	}
+	for _, s := range runner.servers {
+		if s.nextID != 2 {
+			t.Errorf("expected the client process to run both tasks, got %d", s.nextID)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Attributes of signed result messages.
+const (
+	// the base64 ed25519 signature of the message data
+	AttrSignature = "signature"
+	// the hex-encoded ed25519 public key of the worker
+	AttrPublicKey = "public-key"
+	// the worker ID
+	AttrWorkerID = "worker-id"
+)
+
+// AttributePublisher is a Publisher that can send attributes with the message data.
+type AttributePublisher interface {
+	PublishWithAttributes(ctx context.Context, data []byte, attributes map[string]string) error
+}
+
+// LoadSigningKey reads a hex-encoded ed25519 private key, or its 32 byte seed, from the file.
+func LoadSigningKey(p string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("signing key is not hex-encoded: %v", err)
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	default:
+		return nil, fmt.Errorf("expected a %d byte seed or %d byte private key, got %d bytes", ed25519.SeedSize, ed25519.PrivateKeySize, len(key))
+	}
+}
+
+// resultAttributes returns the attributes of a result message: the signature of the data, the public key and the worker ID.
+// Nil if the worker has no signing key.
+func (w *Worker) resultAttributes(data []byte) map[string]string {
+	if w.SigningKey == nil {
+		return nil
+	}
+	return map[string]string{
+		AttrSignature: base64.StdEncoding.EncodeToString(ed25519.Sign(w.SigningKey, data)),
+		AttrPublicKey: hex.EncodeToString(w.SigningKey.Public().(ed25519.PublicKey)),
+		AttrWorkerID:  w.WorkerID,
+	}
+}
+
+// publishResult publishes the result message, signed if the worker has a signing key.
+// Signed results cannot be published to a publisher without attribute support.
+func (w *Worker) publishResult(ctx context.Context, p Publisher, data []byte) error {
+	if q, ok := p.(MultiQueue); ok {
+		p = q[0]
+	}
+	attrs := w.resultAttributes(data)
+	ap, ok := p.(AttributePublisher)
+	// the routing attributes and trace context are only added if the publisher supports attributes, they are optional
+	if ok {
+		attrs = addRoutingAttributes(attrs, data)
+	}
+	if tp := traceParent(ctx); tp != "" && ok {
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+		attrs[AttrTraceParent] = tp
+	}
+	if attrs == nil {
+		return p.Publish(ctx, data)
+	}
+	if !ok {
+		return fmt.Errorf("cannot publish signed result: the results topic does not support message attributes")
+	}
+	return ap.PublishWithAttributes(ctx, data, attrs)
+}
+
+// VerifyResult checks the signature of a result message against the public key in its attributes,
+// and returns the public key. The caller decides which keys to trust.
+func VerifyResult(data []byte, attributes map[string]string) (ed25519.PublicKey, error) {
+	pubKey, err := hex.DecodeString(attributes[AttrPublicKey])
+	if err != nil || len(pubKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("missing or invalid public key")
+	}
+	if err := verifySignature(&QueueMessage{Data: data, Attributes: attributes}, pubKey); err != nil {
+		return nil, err
+	}
+	return pubKey, nil
+}
+
+// CheckSigning checks that the result publishers support the attributes of signed results, if the worker has a signing key.
+func (w *Worker) CheckSigning() error {
+	if w.SigningKey == nil {
+		return nil
+	}
+	publishers := map[string]Publisher{"task queue": w.Queue, "mirror topic": w.MirrorTopic}
+	if q, ok := w.Queue.(MultiQueue); ok {
+		publishers["task queue"] = q[0]
+	}
+	for _, c := range w.ExtraClients {
+		publishers["results of "+c.Name] = c.Results
+	}
+	for name, p := range publishers {
+		if p == nil {
+			continue
+		}
+		if _, ok := p.(AttributePublisher); !ok {
+			return fmt.Errorf("the %s does not support message attributes, to publish signed results with", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignedResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "muskoka-signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	seed := bytes.Repeat([]byte{0x42}, ed25519.SeedSize)
+	keyPath := filepath.Join(dir, "worker.key")
+	if err := ioutil.WriteFile(keyPath, []byte(hex.EncodeToString(seed)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadSigningKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.SigningKey = key
+	if err := h.worker.CheckSigning(); err != nil {
+		t.Fatal(err)
+	}
+	if !h.process(h.addTask("foo", []byte("pre"))) {
+		t.Fatal("expected task to be acked")
+	}
+	data := h.queue.Published()
+	attrs := h.queue.PublishedAttributes()
+	if len(data) != 1 || len(attrs) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(data))
+	}
+	if attrs[0][AttrWorkerID] != h.worker.WorkerID {
+		t.Errorf("expected worker ID attribute, got %v", attrs[0])
+	}
+	pubKey, err := VerifyResult(data[0], attrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pubKey, ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)) {
+		t.Error("unexpected public key")
+	}
+	tampered := append([]byte(nil), data[0]...)
+	tampered[0] = ' '
+	if _, err := VerifyResult(tampered, attrs[0]); err == nil {
+		t.Error("expected tampered result to fail verification")
+	}
+
+	h.worker.Queue = &httpQueue{}
+	if err := h.worker.CheckSigning(); err == nil {
+		t.Error("expected queue without attributes to be refused")
+	}
+}
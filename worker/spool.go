@@ -0,0 +1,195 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the delay before the first retry of a spooled result, doubled on every failed attempt
+	spoolRetryDelay = 5 * time.Second
+	// the maximum delay between retries of a spooled result
+	spoolMaxRetryDelay = 10 * time.Minute
+)
+
+// spooledResult is a result message that could not be published after its result files were uploaded.
+type spooledResult struct {
+	// the name of the client that produced the result, to publish it to the results topic of the client
+	ClientName string    `json:"client-name"`
+	Key        string    `json:"key"`
+	Data       []byte    `json:"data"`
+	Spooled    time.Time `json:"spooled"`
+}
+
+// resultSpool keeps unpublished result messages on disk, one file per result, until they are published.
+type resultSpool struct {
+	dir string
+	// signals the retry loop that a result was spooled
+	wake chan struct{}
+
+	mu sync.Mutex
+	// retry state of the spooled files, by file name
+	attempts map[string]int
+	next     map[string]time.Time
+}
+
+func (w *Worker) spool() *resultSpool {
+	if w.ResultSpool == "" {
+		return nil
+	}
+	w.spoolOnce.Do(func() {
+		w.spoolState = &resultSpool{
+			dir:      w.ResultSpool,
+			wake:     make(chan struct{}, 1),
+			attempts: make(map[string]int),
+			next:     make(map[string]time.Time),
+		}
+	})
+	return w.spoolState
+}
+
+// spoolResult writes the result message of the client to the spool, to be published by RunResultSpool.
+func (w *Worker) spoolResult(c *taskClient, key string, data []byte) error {
+	s := w.spool()
+	if s == nil {
+		return fmt.Errorf("no result spool configured")
+	}
+	entry, err := json.Marshal(&spooledResult{ClientName: c.name, Key: key, Data: data, Spooled: w.now()})
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.json", time.Now().UnixNano(), strings.Replace(key, "/", "_", -1))
+	tmp := filepath.Join(s.dir, name+".tmp")
+	if err := ioutil.WriteFile(tmp, entry, 0644); err != nil {
+		return fmt.Errorf("failed to write spooled result: %v", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("failed to write spooled result: %v", err)
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// spoolPublisher returns the results topic of the named client, nil if the client is unknown.
+func (w *Worker) spoolPublisher(clientName string) Publisher {
+	if clientName == w.ClientName {
+		return w.Queue
+	}
+	for _, c := range w.ExtraClients {
+		if c.Name == clientName {
+			return c.Results
+		}
+	}
+	return nil
+}
+
+// RunResultSpool publishes the spooled results, until ctx is canceled. The results left by a previous run
+// of the worker are published first. Failed publishes are retried with exponential backoff.
+func (w *Worker) RunResultSpool(ctx context.Context) {
+	s := w.spool()
+	if s == nil {
+		return
+	}
+	for {
+		wait := w.publishSpooled(ctx, w.now())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// publishSpooled attempts to publish the spooled results that are due, and returns the time until the next one is.
+func (w *Worker) publishSpooled(ctx context.Context, now time.Time) time.Duration {
+	s := w.spool()
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		log.Printf("failed to read result spool %s: %v", s.dir, err)
+		return spoolRetryDelay
+	}
+	wait := spoolMaxRetryDelay
+	for _, f := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		s.mu.Lock()
+		next := s.next[name]
+		s.mu.Unlock()
+		if next.After(now) {
+			if d := next.Sub(now); d < wait {
+				wait = d
+			}
+			continue
+		}
+		if err := w.publishSpooledFile(ctx, filepath.Join(s.dir, name)); err != nil {
+			s.mu.Lock()
+			s.attempts[name]++
+			delay := spoolRetryDelay << uint(s.attempts[name]-1)
+			if delay > spoolMaxRetryDelay || delay <= 0 {
+				delay = spoolMaxRetryDelay
+			}
+			s.next[name] = now.Add(delay)
+			attempt := s.attempts[name]
+			s.mu.Unlock()
+			log.Printf("failed to publish spooled result %s (attempt %d), retrying in %s: %v", name, attempt, delay, err)
+			if delay < wait {
+				wait = delay
+			}
+			continue
+		}
+		s.mu.Lock()
+		delete(s.attempts, name)
+		delete(s.next, name)
+		s.mu.Unlock()
+	}
+	return wait
+}
+
+// publishSpooledFile publishes the spooled result of the file, and removes the file once published.
+// Invalid files are removed.
+func (w *Worker) publishSpooledFile(ctx context.Context, p string) error {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	var entry spooledResult
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Printf("removing invalid spooled result %s: %v", p, err)
+		_ = os.Remove(p)
+		return nil
+	}
+	pub := w.spoolPublisher(entry.ClientName)
+	if pub == nil {
+		return fmt.Errorf("unknown client %q", entry.ClientName)
+	}
+	publishCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	if err := w.publishResult(publishCtx, pub, entry.Data); err != nil {
+		return err
+	}
+	log.Printf("published spooled result of %s (%s), spooled at %s", entry.Key, entry.ClientName, entry.Spooled)
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to remove published spooled result %s: %v", p, err)
+	}
+	return nil
+}
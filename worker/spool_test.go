@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestResultSpool(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	dir, err := ioutil.TempDir("", "muskoka-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	h.worker.ResultSpool = dir
+	h.worker.Queue = failingPublishQueue{h.queue}
+
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked once its result is spooled")
+	}
+	if n := len(h.queue.Published()); n != 0 {
+		t.Fatalf("expected no published results, got %d", n)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected a spooled result, got %d: %v", len(files), err)
+	}
+
+	// a restarted worker retries the spooled result at fixed times
+	h.Close()
+	w := &Worker{Config: h.worker.Config, Inputs: h.inputs, Results: h.results, Queue: failingPublishQueue{h.queue}}
+	now := time.Now()
+	if wait := w.publishSpooled(context.Background(), now); wait != spoolRetryDelay {
+		t.Errorf("expected to retry after %s, got %s", spoolRetryDelay, wait)
+	}
+	if wait := w.publishSpooled(context.Background(), now.Add(time.Second)); wait != spoolRetryDelay-time.Second {
+		t.Errorf("expected to wait for the retry, got %s", wait)
+	}
+
+	// and publishes it once the queue is available
+	w = &Worker{Config: h.worker.Config, Inputs: h.inputs, Results: h.results, Queue: h.queue}
+	w.publishSpooled(context.Background(), now)
+	if res := h.result(); res.Key != "foo" || !res.Success {
+		t.Errorf("unexpected published result: %+v", res)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected the published result to be removed from the spool, got %d files", len(files))
+	}
+}
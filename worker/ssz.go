@@ -0,0 +1,452 @@
+package worker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// statePreset holds the constants of a spec version and config that determine the shape of a BeaconState.
+type statePreset struct {
+	// v0.8 states have shard crosslinks and committee roots, removed in v0.9
+	shards                    bool
+	shardCount                uint64
+	slotsPerHistoricalRoot    uint64
+	historicalRootsLimit      uint64
+	slotsPerEth1VotingPeriod  uint64
+	validatorRegistryLimit    uint64
+	epochsPerHistoricalVector uint64
+	epochsPerSlashingsVector  uint64
+	// MAX_ATTESTATIONS * SLOTS_PER_EPOCH
+	maxPendingAttestations    uint64
+	maxValidatorsPerCommittee uint64
+}
+
+// statePresets are the state presets per spec version prefix and config.
+var statePresets = map[string]map[string]*statePreset{
+	"v0.8.": {
+		"minimal": {shards: true, shardCount: 8, slotsPerHistoricalRoot: 64, historicalRootsLimit: 1 << 24,
+			slotsPerEth1VotingPeriod: 16, validatorRegistryLimit: 1 << 40, epochsPerHistoricalVector: 64,
+			epochsPerSlashingsVector: 64, maxPendingAttestations: 128 * 8, maxValidatorsPerCommittee: 4096},
+		"mainnet": {shards: true, shardCount: 1024, slotsPerHistoricalRoot: 8192, historicalRootsLimit: 1 << 24,
+			slotsPerEth1VotingPeriod: 1024, validatorRegistryLimit: 1 << 40, epochsPerHistoricalVector: 65536,
+			epochsPerSlashingsVector: 8192, maxPendingAttestations: 128 * 64, maxValidatorsPerCommittee: 4096},
+	},
+	"v0.9.": {
+		"minimal": {slotsPerHistoricalRoot: 64, historicalRootsLimit: 1 << 24,
+			slotsPerEth1VotingPeriod: 16, validatorRegistryLimit: 1 << 40, epochsPerHistoricalVector: 64,
+			epochsPerSlashingsVector: 64, maxPendingAttestations: 128 * 8, maxValidatorsPerCommittee: 2048},
+		"mainnet": {slotsPerHistoricalRoot: 8192, historicalRootsLimit: 1 << 24,
+			slotsPerEth1VotingPeriod: 1024, validatorRegistryLimit: 1 << 40, epochsPerHistoricalVector: 65536,
+			epochsPerSlashingsVector: 8192, maxPendingAttestations: 128 * 32, maxValidatorsPerCommittee: 2048},
+	},
+}
+
+// statePresetFor returns the state preset of the spec version and config.
+func statePresetFor(specVersion string, specConfig string) (*statePreset, error) {
+	for prefix, configs := range statePresets {
+		if strings.HasPrefix(specVersion, prefix) {
+			if p, ok := configs[specConfig]; ok {
+				return p, nil
+			}
+			return nil, fmt.Errorf("unsupported spec config: %s", specConfig)
+		}
+	}
+	return nil, fmt.Errorf("unsupported spec version: %s", specVersion)
+}
+
+// CheckSSZSupport returns an error if the SSZ layout of states of the spec version and config is unknown.
+func CheckSSZSupport(specVersion string, specConfig string) error {
+	_, err := statePresetFor(specVersion, specConfig)
+	return err
+}
+
+// SSZ sizes of the fixed-size containers in a BeaconState.
+const (
+	forkSize              = 4 + 4 + 8
+	blockHeaderSize       = 8 + 32 + 32 + 32 + 96
+	eth1DataSize          = 32 + 8 + 32
+	validatorSize         = 48 + 32 + 8 + 1 + 4*8
+	checkpointSize        = 8 + 32
+	crosslinkSize         = 8 + 32 + 8 + 8 + 32
+	attestationDataSizeV8 = 32 + 2*checkpointSize + crosslinkSize
+	attestationDataSizeV9 = 8 + 8 + 32 + 2*checkpointSize
+)
+
+// SSZTreeHasher returns a StateHasher for the hash-tree-root of BeaconStates of the spec version and config,
+// or nil if the state layout of the spec version or config is not known. See statePresets.
+func SSZTreeHasher(specVersion string, specConfig string) StateHasher {
+	preset, err := statePresetFor(specVersion, specConfig)
+	if err != nil {
+		return nil
+	}
+	return &sszStateHasher{preset: preset}
+}
+
+// sszStateHasher buffers the SSZ encoded BeaconState, to decode and merkleize it on Sum.
+type sszStateHasher struct {
+	preset *statePreset
+	buf    bytes.Buffer
+}
+
+func (h *sszStateHasher) Write(p []byte) (int, error) {
+	return h.buf.Write(p)
+}
+
+func (h *sszStateHasher) Sum() ([32]byte, error) {
+	return stateRoot(h.preset, h.buf.Bytes())
+}
+
+// zeroHashes[i] is the root of a tree of depth i with only zero chunks.
+var zeroHashes [65][32]byte
+
+func init() {
+	for i := 1; i < len(zeroHashes); i++ {
+		zeroHashes[i] = hashPair(zeroHashes[i-1], zeroHashes[i-1])
+	}
+}
+
+func hashPair(a [32]byte, b [32]byte) [32]byte {
+	var buf [64]byte
+	copy(buf[:32], a[:])
+	copy(buf[32:], b[:])
+	return sha256.Sum256(buf[:])
+}
+
+// merkleize returns the root of the chunks, padded with zero chunks to a tree with room for limit chunks.
+// The limit must be at least the number of chunks.
+func merkleize(chunks [][32]byte, limit uint64) [32]byte {
+	depth := 0
+	for (uint64(1) << uint(depth)) < limit {
+		depth++
+	}
+	if len(chunks) == 0 {
+		return zeroHashes[depth]
+	}
+	layer := append([][32]byte(nil), chunks...)
+	for d := 0; d < depth; d++ {
+		if len(layer)%2 == 1 {
+			layer = append(layer, zeroHashes[d])
+		}
+		next := make([][32]byte, len(layer)/2)
+		for i := range next {
+			next[i] = hashPair(layer[2*i], layer[2*i+1])
+		}
+		layer = next
+	}
+	return layer[0]
+}
+
+func mixInLength(root [32]byte, length uint64) [32]byte {
+	var l [32]byte
+	binary.LittleEndian.PutUint64(l[:8], length)
+	return hashPair(root, l)
+}
+
+// pack splits the bytes into zero-padded chunks.
+func pack(data []byte) [][32]byte {
+	chunks := make([][32]byte, (len(data)+31)/32)
+	for i := range chunks {
+		copy(chunks[i][:], data[i*32:])
+	}
+	return chunks
+}
+
+// bytesRoot is the root of a fixed-size byte vector, e.g. a 48 byte pubkey.
+func bytesRoot(data []byte) [32]byte {
+	return merkleize(pack(data), uint64(len(data)+31)/32)
+}
+
+// uint64Root is the root of a uint64 in its little-endian encoding.
+func uint64Root(data []byte) (out [32]byte) {
+	copy(out[:], data[:8])
+	return out
+}
+
+// fixedListRoot is the root of a list of fixed-size elements, each hashed with elemRoot.
+func fixedListRoot(data []byte, elemSize int, limit uint64, elemRoot func([]byte) [32]byte) ([32]byte, error) {
+	if len(data)%elemSize != 0 {
+		return [32]byte{}, fmt.Errorf("list of %d bytes is not a multiple of the element size %d", len(data), elemSize)
+	}
+	n := uint64(len(data) / elemSize)
+	if n > limit {
+		return [32]byte{}, fmt.Errorf("list of %d elements exceeds limit %d", n, limit)
+	}
+	chunks := make([][32]byte, n)
+	for i := range chunks {
+		chunks[i] = elemRoot(data[i*elemSize : (i+1)*elemSize])
+	}
+	return mixInLength(merkleize(chunks, limit), n), nil
+}
+
+// rootsVectorRoot is the root of a vector of n 32 byte roots.
+func rootsVectorRoot(data []byte, n uint64) [32]byte {
+	return merkleize(pack(data), n)
+}
+
+// uint64VectorRoot is the root of a vector of n uint64s.
+func uint64VectorRoot(data []byte, n uint64) [32]byte {
+	return merkleize(pack(data), (n*8+31)/32)
+}
+
+func forkRoot(data []byte) [32]byte {
+	return merkleize([][32]byte{bytesRoot(data[0:4]), bytesRoot(data[4:8]), uint64Root(data[8:16])}, 3)
+}
+
+func blockHeaderRoot(data []byte) [32]byte {
+	return merkleize([][32]byte{
+		uint64Root(data[0:8]), bytesRoot(data[8:40]), bytesRoot(data[40:72]), bytesRoot(data[72:104]), bytesRoot(data[104:200]),
+	}, 5)
+}
+
+func eth1DataRoot(data []byte) [32]byte {
+	return merkleize([][32]byte{bytesRoot(data[0:32]), uint64Root(data[32:40]), bytesRoot(data[40:72])}, 3)
+}
+
+func validatorRoot(data []byte) [32]byte {
+	var slashed [32]byte
+	slashed[0] = data[88]
+	return merkleize([][32]byte{
+		bytesRoot(data[0:48]), bytesRoot(data[48:80]), uint64Root(data[80:88]), slashed,
+		uint64Root(data[89:97]), uint64Root(data[97:105]), uint64Root(data[105:113]), uint64Root(data[113:121]),
+	}, 8)
+}
+
+func checkpointRoot(data []byte) [32]byte {
+	return merkleize([][32]byte{uint64Root(data[0:8]), bytesRoot(data[8:40])}, 2)
+}
+
+func crosslinkRoot(data []byte) [32]byte {
+	return merkleize([][32]byte{
+		uint64Root(data[0:8]), bytesRoot(data[8:40]), uint64Root(data[40:48]), uint64Root(data[48:56]), bytesRoot(data[56:88]),
+	}, 5)
+}
+
+func (p *statePreset) attestationDataSize() int {
+	if p.shards {
+		return attestationDataSizeV8
+	}
+	return attestationDataSizeV9
+}
+
+func (p *statePreset) attestationDataRoot(data []byte) [32]byte {
+	if p.shards {
+		return merkleize([][32]byte{
+			bytesRoot(data[0:32]), checkpointRoot(data[32:72]), checkpointRoot(data[72:112]), crosslinkRoot(data[112:200]),
+		}, 4)
+	}
+	return merkleize([][32]byte{
+		uint64Root(data[0:8]), uint64Root(data[8:16]), bytesRoot(data[16:48]), checkpointRoot(data[48:88]), checkpointRoot(data[88:128]),
+	}, 5)
+}
+
+// bitlistRoot is the root of a SSZ encoded bitlist, with the length delimiter bit.
+func bitlistRoot(data []byte, limit uint64) ([32]byte, error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return [32]byte{}, fmt.Errorf("bitlist is missing the length delimiter")
+	}
+	last := data[len(data)-1]
+	msb := uint64(0)
+	for last>>(msb+1) != 0 {
+		msb++
+	}
+	length := uint64(len(data)-1)*8 + msb
+	if length > limit {
+		return [32]byte{}, fmt.Errorf("bitlist of %d bits exceeds limit %d", length, limit)
+	}
+	bits := append([]byte(nil), data[:(length+7)/8]...)
+	if length%8 != 0 {
+		bits[len(bits)-1] = last &^ (1 << msb)
+	}
+	return mixInLength(merkleize(pack(bits), (limit+255)/256), length), nil
+}
+
+func (p *statePreset) pendingAttestationRoot(data []byte) ([32]byte, error) {
+	fixedSize := 4 + p.attestationDataSize() + 8 + 8
+	if len(data) < fixedSize {
+		return [32]byte{}, fmt.Errorf("pending attestation too short: %d bytes", len(data))
+	}
+	if offset := binary.LittleEndian.Uint32(data[0:4]); int(offset) != fixedSize {
+		return [32]byte{}, fmt.Errorf("invalid aggregation bits offset: %d", offset)
+	}
+	bitsRoot, err := bitlistRoot(data[fixedSize:], p.maxValidatorsPerCommittee)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	end := 4 + p.attestationDataSize()
+	return merkleize([][32]byte{
+		bitsRoot, p.attestationDataRoot(data[4:end]), uint64Root(data[end : end+8]), uint64Root(data[end+8 : end+16]),
+	}, 4), nil
+}
+
+// pendingAttestationsRoot is the root of a SSZ encoded list of pending attestations,
+// a variable-size element type: the list starts with the offsets of the elements.
+func (p *statePreset) pendingAttestationsRoot(data []byte) ([32]byte, error) {
+	var chunks [][32]byte
+	if len(data) > 0 {
+		if len(data) < 4 {
+			return [32]byte{}, fmt.Errorf("pending attestations too short: %d bytes", len(data))
+		}
+		first := binary.LittleEndian.Uint32(data[0:4])
+		if first%4 != 0 || first == 0 || int(first) > len(data) {
+			return [32]byte{}, fmt.Errorf("invalid first pending attestation offset: %d", first)
+		}
+		n := int(first / 4)
+		if uint64(n) > p.maxPendingAttestations {
+			return [32]byte{}, fmt.Errorf("%d pending attestations exceed limit %d", n, p.maxPendingAttestations)
+		}
+		for i := 0; i < n; i++ {
+			start := binary.LittleEndian.Uint32(data[i*4 : i*4+4])
+			end := uint32(len(data))
+			if i+1 < n {
+				end = binary.LittleEndian.Uint32(data[i*4+4 : i*4+8])
+			}
+			if start > end || int(end) > len(data) {
+				return [32]byte{}, fmt.Errorf("invalid pending attestation offsets: %d, %d", start, end)
+			}
+			root, err := p.pendingAttestationRoot(data[start:end])
+			if err != nil {
+				return [32]byte{}, fmt.Errorf("pending attestation %d: %v", i, err)
+			}
+			chunks = append(chunks, root)
+		}
+	}
+	return mixInLength(merkleize(chunks, p.maxPendingAttestations), uint64(len(chunks))), nil
+}
+
+// stateRoot computes the hash-tree-root of a SSZ encoded BeaconState.
+func stateRoot(p *statePreset, state []byte) ([32]byte, error) {
+	// the fields in order: a fixed-size field has a size, a variable-size field (size 0) has an offset in the fixed part.
+	type field struct {
+		size int
+		root func(data []byte) ([32]byte, error)
+	}
+	fixed := func(size int, root func([]byte) [32]byte) field {
+		return field{size: size, root: func(data []byte) ([32]byte, error) { return root(data), nil }}
+	}
+	variable := func(root func([]byte) ([32]byte, error)) field {
+		return field{root: root}
+	}
+	roots := func(n uint64) func([]byte) [32]byte {
+		return func(data []byte) [32]byte { return rootsVectorRoot(data, n) }
+	}
+	fields := []field{
+		fixed(8, uint64Root), // genesis_time
+		fixed(8, uint64Root), // slot
+		fixed(forkSize, forkRoot),
+		fixed(blockHeaderSize, blockHeaderRoot),
+		fixed(32*int(p.slotsPerHistoricalRoot), roots(p.slotsPerHistoricalRoot)), // block_roots
+		fixed(32*int(p.slotsPerHistoricalRoot), roots(p.slotsPerHistoricalRoot)), // state_roots
+		variable(func(data []byte) ([32]byte, error) { // historical_roots
+			return fixedListRoot(data, 32, p.historicalRootsLimit, bytesRoot)
+		}),
+		fixed(eth1DataSize, eth1DataRoot),
+		variable(func(data []byte) ([32]byte, error) { // eth1_data_votes
+			return fixedListRoot(data, eth1DataSize, p.slotsPerEth1VotingPeriod, eth1DataRoot)
+		}),
+		fixed(8, uint64Root), // eth1_deposit_index
+		variable(func(data []byte) ([32]byte, error) { // validators
+			return fixedListRoot(data, validatorSize, p.validatorRegistryLimit, validatorRoot)
+		}),
+		variable(func(data []byte) ([32]byte, error) { // balances
+			if len(data)%8 != 0 {
+				return [32]byte{}, fmt.Errorf("balances of %d bytes are not a multiple of 8", len(data))
+			}
+			n := uint64(len(data) / 8)
+			if n > p.validatorRegistryLimit {
+				return [32]byte{}, fmt.Errorf("%d balances exceed limit %d", n, p.validatorRegistryLimit)
+			}
+			return mixInLength(merkleize(pack(data), (p.validatorRegistryLimit*8+31)/32), n), nil
+		}),
+	}
+	if p.shards {
+		fields = append(fields, fixed(8, uint64Root)) // start_shard
+	}
+	fields = append(fields, fixed(32*int(p.epochsPerHistoricalVector), roots(p.epochsPerHistoricalVector))) // randao_mixes
+	if p.shards {
+		fields = append(fields,
+			fixed(32*int(p.epochsPerHistoricalVector), roots(p.epochsPerHistoricalVector)), // active_index_roots
+			fixed(32*int(p.epochsPerHistoricalVector), roots(p.epochsPerHistoricalVector)), // compact_committees_roots
+		)
+	}
+	fields = append(fields,
+		fixed(8*int(p.epochsPerSlashingsVector), func(data []byte) [32]byte { // slashings
+			return uint64VectorRoot(data, p.epochsPerSlashingsVector)
+		}),
+		variable(p.pendingAttestationsRoot), // previous_epoch_attestations
+		variable(p.pendingAttestationsRoot), // current_epoch_attestations
+	)
+	if p.shards {
+		crosslinks := func(data []byte) [32]byte {
+			chunks := make([][32]byte, p.shardCount)
+			for i := range chunks {
+				chunks[i] = crosslinkRoot(data[i*crosslinkSize:])
+			}
+			return merkleize(chunks, p.shardCount)
+		}
+		fields = append(fields,
+			fixed(crosslinkSize*int(p.shardCount), crosslinks), // previous_crosslinks
+			fixed(crosslinkSize*int(p.shardCount), crosslinks), // current_crosslinks
+		)
+	}
+	fields = append(fields,
+		fixed(1, bytesRoot), // justification_bits
+		fixed(checkpointSize, checkpointRoot),
+		fixed(checkpointSize, checkpointRoot),
+		fixed(checkpointSize, checkpointRoot),
+	)
+
+	fixedSize := 0
+	for _, f := range fields {
+		if f.size == 0 {
+			fixedSize += 4
+		} else {
+			fixedSize += f.size
+		}
+	}
+	if len(state) < fixedSize {
+		return [32]byte{}, fmt.Errorf("state too short: %d bytes, expected at least %d", len(state), fixedSize)
+	}
+	// the variable-size fields are in the order of their offsets, the last one runs until the end of the state
+	var offsets []int
+	pos := 0
+	for _, f := range fields {
+		if f.size == 0 {
+			offsets = append(offsets, int(binary.LittleEndian.Uint32(state[pos:pos+4])))
+			pos += 4
+		} else {
+			pos += f.size
+		}
+	}
+	if offsets[0] != fixedSize {
+		return [32]byte{}, fmt.Errorf("invalid first offset: %d, expected %d", offsets[0], fixedSize)
+	}
+	offsets = append(offsets, len(state))
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] < offsets[i-1] {
+			return [32]byte{}, fmt.Errorf("invalid offset: %d, after %d", offsets[i], offsets[i-1])
+		}
+	}
+	chunks := make([][32]byte, len(fields))
+	pos = 0
+	v := 0
+	for i, f := range fields {
+		var data []byte
+		if f.size == 0 {
+			data = state[offsets[v]:offsets[v+1]]
+			v++
+			pos += 4
+		} else {
+			data = state[pos : pos+f.size]
+			pos += f.size
+		}
+		root, err := f.root(data)
+		if err != nil {
+			return [32]byte{}, fmt.Errorf("field %d: %v", i, err)
+		}
+		chunks[i] = root
+	}
+	return merkleize(chunks, uint64(len(chunks))), nil
+}
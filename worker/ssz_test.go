@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+func TestMerkleize(t *testing.T) {
+	a, b, c := [32]byte{1}, [32]byte{2}, [32]byte{3}
+	expected := hashPair(hashPair(a, b), hashPair(c, [32]byte{}))
+	if root := merkleize([][32]byte{a, b, c}, 3); root != expected {
+		t.Errorf("unexpected root of 3 chunks: %x", root)
+	}
+	// a limit pads the tree with zero subtrees
+	if root := merkleize([][32]byte{a, b, c}, 8); root != hashPair(expected, zeroHashes[2]) {
+		t.Errorf("unexpected root of 3 chunks with limit 8: %x", root)
+	}
+	if root := merkleize(nil, 1<<40); root != zeroHashes[40] {
+		t.Errorf("unexpected root of empty list: %x", root)
+	}
+	if zeroHashes[1] != sha256.Sum256(make([]byte, 64)) {
+		t.Error("unexpected zero hash")
+	}
+}
+
+func TestBitlistRoot(t *testing.T) {
+	// bits 1, 0, 1 and the delimiter bit, in a tree of 8 chunks for 2048 bits
+	root, err := bitlistRoot([]byte{0x0d}, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := mixInLength(merkleize([][32]byte{{0x05}}, 8), 3); root != expected {
+		t.Errorf("unexpected bitlist root: %x", root)
+	}
+	if _, err := bitlistRoot([]byte{0x01, 0x00}, 2048); err == nil {
+		t.Error("expected bitlist without delimiter to fail")
+	}
+	if _, err := bitlistRoot([]byte{0xff, 0x01}, 4); err == nil {
+		t.Error("expected bitlist over the limit to fail")
+	}
+}
+
+// testState builds a v0.9.x minimal state with a single validator and the given finalized epoch.
+func testState(finalizedEpoch uint64) []byte {
+	// genesis_time, slot, fork, latest_block_header, block_roots, state_roots
+	historicalRootsPos := 8 + 8 + forkSize + blockHeaderSize + 2*32*64
+	votesPos := historicalRootsPos + 4 + eth1DataSize
+	validatorsPos := votesPos + 4 + 8
+	// randao_mixes, slashings
+	attestationsPos := validatorsPos + 4 + 4 + 64*32 + 64*8
+	fixedSize := attestationsPos + 4 + 4 + 1 + 3*checkpointSize
+	state := make([]byte, fixedSize+validatorSize+8)
+	for _, pos := range []int{historicalRootsPos, votesPos, validatorsPos} {
+		binary.LittleEndian.PutUint32(state[pos:], uint32(fixedSize))
+	}
+	binary.LittleEndian.PutUint32(state[validatorsPos+4:], uint32(fixedSize+validatorSize))
+	binary.LittleEndian.PutUint32(state[attestationsPos:], uint32(len(state)))
+	binary.LittleEndian.PutUint32(state[attestationsPos+4:], uint32(len(state)))
+	binary.LittleEndian.PutUint64(state[fixedSize-checkpointSize:], finalizedEpoch)
+	state[fixedSize] = 0xaa
+	binary.LittleEndian.PutUint64(state[fixedSize+validatorSize:], 32000000000)
+	return state
+}
+
+func TestSSZTreeHasher(t *testing.T) {
+	if SSZTreeHasher("v0.12.1", "minimal") != nil || SSZTreeHasher("v0.9.1", "unknown") != nil {
+		t.Error("expected no tree hasher for unknown spec versions and configs")
+	}
+	root := func(state []byte) [32]byte {
+		h := SSZTreeHasher("v0.9.1", "minimal")
+		if _, err := h.Write(state); err != nil {
+			t.Fatal(err)
+		}
+		r, err := h.Sum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	a, b := root(testState(1)), root(testState(1))
+	if a != b {
+		t.Error("expected the same root for the same state")
+	}
+	if root(testState(2)) == a {
+		t.Error("expected a different root for a different finalized epoch")
+	}
+
+	// the finalized checkpoint is the last field: the epoch and a zero root
+	state := testState(3)
+	fixedSize := len(state) - validatorSize - 8
+	cp := checkpointRoot(state[fixedSize-checkpointSize : fixedSize])
+	if cp != hashPair(uint64Root(state[fixedSize-checkpointSize:]), [32]byte{}) {
+		t.Error("unexpected checkpoint root")
+	}
+
+	h := SSZTreeHasher("v0.9.1", "minimal")
+	_, _ = h.Write(state[:len(state)-1])
+	if _, err := h.Sum(); err == nil {
+		t.Error("expected truncated balances to fail")
+	}
+	h = SSZTreeHasher("v0.8.3", "minimal")
+	_, _ = h.Write(state)
+	if _, err := h.Sum(); err == nil {
+		t.Error("expected a v0.9 state to fail with the v0.8 layout")
+	}
+}
+
+func TestSSZTreeHasherPresets(t *testing.T) {
+	// the reference merkleization pads with the zero hashes of the deposit contract
+	if root := refMerkleize(nil, 8); hex.EncodeToString(root[:]) != "c78009fdf07fc56a11f122370658a353aaa542ed63e44c4bc15ff4cd105ab33c" {
+		t.Fatalf("unexpected reference root of 8 zero chunks: %x", root)
+	}
+	for prefix, configs := range statePresets {
+		for config := range configs {
+			c, ok := refConfigs[prefix][config]
+			if !ok {
+				t.Fatalf("missing reference config of %s%s", prefix, config)
+			}
+			specVersion := prefix + "0"
+			for _, n := range []int{0, 1, 5} {
+				state := newRefValues(int64(n)).refState(c, n)
+				h := SSZTreeHasher(specVersion, config)
+				if _, err := h.Write(state.encode()); err != nil {
+					t.Fatal(err)
+				}
+				root, err := h.Sum()
+				if err != nil {
+					t.Errorf("%s/%s state with %d list elements: %v", specVersion, config, n, err)
+					continue
+				}
+				if expected := state.root(); root != expected {
+					t.Errorf("%s/%s state with %d list elements: root %x, expected %x", specVersion, config, n, root, expected)
+				}
+			}
+		}
+	}
+}
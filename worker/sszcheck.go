@@ -0,0 +1,218 @@
+package worker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path"
+)
+
+// Limits and sizes of the operations in a block body, the same in the minimal and mainnet configs.
+const (
+	maxProposerSlashings = 16
+	maxAttesterSlashings = 1
+	maxAttestations      = 128
+	maxDeposits          = 16
+	maxVoluntaryExits    = 16
+	// MAX_TRANSFERS is 0 in v0.8, transfers were removed in v0.9
+	maxTransfers = 0
+
+	proposerSlashingSize = 8 + 2*blockHeaderSize
+	depositSize          = 33*32 + 48 + 32 + 8 + 96
+	voluntaryExitSize    = 8 + 8 + 96
+	transferSize         = 5*8 + 48 + 96
+	signatureSize        = 96
+)
+
+// splitContainer splits a SSZ encoded container into its fields, given the size of every field,
+// 0 for variable-size fields. The offsets of the variable-size fields are checked.
+func splitContainer(data []byte, sizes []int) ([][]byte, error) {
+	fixedSize := 0
+	for _, s := range sizes {
+		if s == 0 {
+			fixedSize += 4
+		} else {
+			fixedSize += s
+		}
+	}
+	if len(data) < fixedSize {
+		return nil, fmt.Errorf("%d bytes, expected at least %d", len(data), fixedSize)
+	}
+	var offsets []int
+	pos := 0
+	for _, s := range sizes {
+		if s == 0 {
+			offsets = append(offsets, int(binary.LittleEndian.Uint32(data[pos:pos+4])))
+			pos += 4
+		} else {
+			pos += s
+		}
+	}
+	if len(offsets) == 0 {
+		if len(data) != fixedSize {
+			return nil, fmt.Errorf("%d bytes, expected %d", len(data), fixedSize)
+		}
+	} else if offsets[0] != fixedSize {
+		return nil, fmt.Errorf("invalid first offset: %d, expected %d", offsets[0], fixedSize)
+	}
+	offsets = append(offsets, len(data))
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] < offsets[i-1] {
+			return nil, fmt.Errorf("invalid offset: %d, after %d", offsets[i], offsets[i-1])
+		}
+	}
+	fields := make([][]byte, len(sizes))
+	pos = 0
+	v := 0
+	for i, s := range sizes {
+		if s == 0 {
+			fields[i] = data[offsets[v]:offsets[v+1]]
+			v++
+			pos += 4
+		} else {
+			fields[i] = data[pos : pos+s]
+			pos += s
+		}
+	}
+	return fields, nil
+}
+
+// checkFixedList checks a SSZ encoded list of fixed-size elements.
+func checkFixedList(data []byte, elemSize int, limit int) error {
+	if len(data)%elemSize != 0 {
+		return fmt.Errorf("list of %d bytes is not a multiple of the element size %d", len(data), elemSize)
+	}
+	if n := len(data) / elemSize; n > limit {
+		return fmt.Errorf("list of %d elements exceeds limit %d", n, limit)
+	}
+	return nil
+}
+
+// splitVariableList splits a SSZ encoded list of variable-size elements into its elements.
+func splitVariableList(data []byte, limit int) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("list too short: %d bytes", len(data))
+	}
+	first := binary.LittleEndian.Uint32(data[0:4])
+	if first%4 != 0 || first == 0 || int(first) > len(data) {
+		return nil, fmt.Errorf("invalid first offset: %d", first)
+	}
+	n := int(first / 4)
+	if n > limit {
+		return nil, fmt.Errorf("list of %d elements exceeds limit %d", n, limit)
+	}
+	elems := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		start := binary.LittleEndian.Uint32(data[i*4 : i*4+4])
+		end := uint32(len(data))
+		if i+1 < n {
+			end = binary.LittleEndian.Uint32(data[i*4+4 : i*4+8])
+		}
+		if start > end || int(end) > len(data) {
+			return nil, fmt.Errorf("invalid offsets of element %d: %d, %d", i, start, end)
+		}
+		elems[i] = data[start:end]
+	}
+	return elems, nil
+}
+
+// checkBeaconState checks if the data decodes as a BeaconState of the preset.
+func checkBeaconState(p *statePreset, data []byte) error {
+	_, err := stateRoot(p, data)
+	return err
+}
+
+// checkBlock checks if the data decodes as a block of the preset: a BeaconBlock, with the signature
+// as last field. The SignedBeaconBlock envelope only exists since v0.10, which has no known layout.
+func checkBlock(p *statePreset, data []byte) error {
+	fields, err := splitContainer(data, []int{8, 32, 32, 0, signatureSize})
+	if err != nil {
+		return fmt.Errorf("block: %v", err)
+	}
+	body := fields[3]
+	sizes := []int{signatureSize, eth1DataSize, 32, 0, 0, 0, 0, 0}
+	if p.shards {
+		// transfers
+		sizes = append(sizes, 0)
+	}
+	fields, err = splitContainer(body, sizes)
+	if err != nil {
+		return fmt.Errorf("block body: %v", err)
+	}
+	if err := checkFixedList(fields[3], proposerSlashingSize, maxProposerSlashings); err != nil {
+		return fmt.Errorf("proposer slashings: %v", err)
+	}
+	slashings, err := splitVariableList(fields[4], maxAttesterSlashings)
+	if err != nil {
+		return fmt.Errorf("attester slashings: %v", err)
+	}
+	for i, s := range slashings {
+		indexed, err := splitContainer(s, []int{0, 0})
+		if err != nil {
+			return fmt.Errorf("attester slashing %d: %v", i, err)
+		}
+		for j, a := range indexed {
+			// custody bit 0 and 1 indices, data and signature
+			if _, err := splitContainer(a, []int{0, 0, p.attestationDataSize(), signatureSize}); err != nil {
+				return fmt.Errorf("attester slashing %d, attestation %d: %v", i, j+1, err)
+			}
+		}
+	}
+	attestations, err := splitVariableList(fields[5], maxAttestations)
+	if err != nil {
+		return fmt.Errorf("attestations: %v", err)
+	}
+	// aggregation bits, data, custody bits and signature
+	attestationSizes := []int{0, p.attestationDataSize(), 0, signatureSize}
+	for i, a := range attestations {
+		if _, err := splitContainer(a, attestationSizes); err != nil {
+			return fmt.Errorf("attestation %d: %v", i, err)
+		}
+	}
+	if err := checkFixedList(fields[6], depositSize, maxDeposits); err != nil {
+		return fmt.Errorf("deposits: %v", err)
+	}
+	if err := checkFixedList(fields[7], voluntaryExitSize, maxVoluntaryExits); err != nil {
+		return fmt.Errorf("voluntary exits: %v", err)
+	}
+	if p.shards {
+		if err := checkFixedList(fields[8], transferSize, maxTransfers); err != nil {
+			return fmt.Errorf("transfers: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkInputs checks if the pre state of the downloaded task decodes as a BeaconState,
+// and the blocks of a block transition as blocks, for the spec version and config of the task.
+// Tasks of spec versions or configs without a known layout are not checked.
+func checkInputs(tr *TransitionMsg) error {
+	p, err := statePresetFor(tr.SpecVersion, tr.SpecConfig)
+	if err != nil {
+		return nil
+	}
+	dir := tr.DirPath()
+	pre, err := ioutil.ReadFile(path.Join(dir, "pre.ssz"))
+	if err != nil {
+		return fmt.Errorf("failed to read pre state: %v", err)
+	}
+	if err := checkBeaconState(p, pre); err != nil {
+		return fmt.Errorf("pre.ssz is not a valid %s/%s state: %v", tr.SpecVersion, tr.SpecConfig, err)
+	}
+	if !tr.isBlockTransition() {
+		return nil
+	}
+	for _, name := range tr.InputFiles() {
+		block, err := ioutil.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", name, err)
+		}
+		if err := checkBlock(p, block); err != nil {
+			return fmt.Errorf("%s is not a valid %s/%s block: %v", name, tr.SpecVersion, tr.SpecConfig, err)
+		}
+	}
+	return nil
+}
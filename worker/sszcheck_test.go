@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestCheckBlock(t *testing.T) {
+	for prefix, configs := range statePresets {
+		for config, p := range configs {
+			c, ok := refConfigs[prefix][config]
+			if !ok {
+				t.Fatalf("missing reference config of %s%s", prefix, config)
+			}
+			g := newRefValues(1)
+			name := prefix + "x/" + config
+			if err := checkBlock(p, g.refBlock(g.refBlockBody(c, 0)).encode()); err != nil {
+				t.Errorf("expected empty %s block to be valid: %v", name, err)
+			}
+			full := g.refBlock(g.refBlockBody(c, 2, g.attestation(c, 3), g.attestation(c, 17)))
+			if err := checkBlock(p, full.encode()); err != nil {
+				t.Errorf("expected %s block with operations to be valid: %v", name, err)
+			}
+			// attestations without custody bits are v0.10
+			noCustody := refContainer(g.bits(3, c.maxValidatorsPerCommittee), g.attestationData(c), g.bytes(96))
+			if err := checkBlock(p, g.refBlock(g.refBlockBody(c, 0, noCustody)).encode()); err == nil {
+				t.Errorf("expected %s block with attestation without custody bits to be invalid", name)
+			}
+			// as is the SignedBeaconBlock envelope
+			body := g.refBlockBody(c, 0)
+			signed := refContainer(refContainer(g.uint64(), g.bytes(32), g.bytes(32), body), g.bytes(96))
+			if err := checkBlock(p, signed.encode()); err == nil {
+				t.Errorf("expected %s block in a v0.10 envelope to be invalid", name)
+			}
+			if err := checkBlock(p, []byte("not a block")); err == nil {
+				t.Errorf("expected garbage to be an invalid %s block", name)
+			}
+		}
+	}
+
+	// the bodies differ in transfers, and the attestation data
+	v8, v9 := refConfigs["v0.8."]["minimal"], refConfigs["v0.9."]["minimal"]
+	g := newRefValues(2)
+	v8Block := g.refBlock(g.refBlockBody(v8, 1, g.attestation(v8, 5))).encode()
+	v9Block := g.refBlock(g.refBlockBody(v9, 1, g.attestation(v9, 5))).encode()
+	if err := checkBlock(statePresets["v0.9."]["minimal"], v8Block); err == nil {
+		t.Error("expected v0.8 block to be an invalid v0.9 block")
+	}
+	if err := checkBlock(statePresets["v0.8."]["minimal"], v9Block); err == nil {
+		t.Error("expected v0.9 block to be an invalid v0.8 block")
+	}
+	// MAX_TRANSFERS is 0
+	body := g.refBlockBody(v8, 0)
+	body.elems[8] = refList(16, refContainer(g.uint64(), g.uint64(), g.uint64(), g.uint64(), g.uint64(), g.bytes(48), g.bytes(96)))
+	if err := checkBlock(statePresets["v0.8."]["minimal"], g.refBlock(body).encode()); err == nil {
+		t.Error("expected v0.8 block with a transfer to be invalid")
+	}
+	// truncated operations
+	truncated := append([]byte(nil), v9Block[:len(v9Block)-1]...)
+	if err := checkBlock(statePresets["v0.9."]["minimal"], truncated); err == nil {
+		t.Error("expected truncated block to be invalid")
+	}
+}
+
+func TestCheckInputs(t *testing.T) {
+	tr := &TransitionMsg{SpecVersion: "v0.9.1", SpecConfig: "minimal", Key: "check-inputs", ResultKey: uniqueID(), Blocks: 1}
+	dir := tr.DirPath()
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path.Dir(dir))
+	write := func(name string, data []byte) {
+		if err := ioutil.WriteFile(path.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("pre.ssz", testState(0))
+	g := newRefValues(1)
+	write("block_0.ssz", g.refBlock(g.refBlockBody(refConfigs["v0.9."]["minimal"], 1)).encode())
+	if err := checkInputs(tr); err != nil {
+		t.Fatalf("expected valid inputs: %v", err)
+	}
+	write("block_0.ssz", []byte("garbage"))
+	if err := checkInputs(tr); err == nil || !strings.Contains(err.Error(), "block_0.ssz") {
+		t.Errorf("expected invalid block: %v", err)
+	}
+	// unknown layouts are not checked
+	tr.SpecVersion = "v0.10.0"
+	if err := checkInputs(tr); err != nil {
+		t.Errorf("expected unknown spec version to be skipped: %v", err)
+	}
+}
+
+func TestInvalidInputs(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.ValidateInputs = true
+
+	if !h.process(h.addTask("foo", []byte("pre-foo"), []byte("b0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	res := h.result()
+	if res.Success || res.Status != StatusInputError {
+		t.Fatalf("expected input-error result: %+v", res)
+	}
+	if errLog := string(h.resultFile(res.Files.ErrLog)); !strings.HasPrefix(errLog, "input error: pre.ssz is not a valid v0.8.3/minimal state") {
+		t.Errorf("unexpected err log: %q", errLog)
+	}
+	if out := string(h.resultFile(res.Files.OutLog)); out != "" {
+		t.Errorf("expected the client not to run, got output %q", out)
+	}
+}
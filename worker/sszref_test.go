@@ -0,0 +1,439 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+)
+
+// The reference SSZ values below encode and hash the phase 0 types of the v0.8 and v0.9 specs
+// from their definitions, independently of the flat layouts in ssz.go and sszcheck.go, to check those against.
+
+// sszRef is a SSZ value.
+type sszRef interface {
+	// the size of the encoding, 0 if variable-size
+	fixedSize() int
+	encode() []byte
+	root() [32]byte
+}
+
+// refMerkleize is the root of the chunks, padded with zero chunks to the next power of two of the limit.
+func refMerkleize(chunks [][32]byte, limit uint64) [32]byte {
+	width := uint64(1)
+	for width < limit {
+		width *= 2
+	}
+	layer := append([][32]byte(nil), chunks...)
+	var zero [32]byte
+	for ; width > 1; width /= 2 {
+		if len(layer)%2 == 1 {
+			layer = append(layer, zero)
+		}
+		next := make([][32]byte, len(layer)/2)
+		for i := range next {
+			next[i] = sha256.Sum256(append(layer[2*i][:], layer[2*i+1][:]...))
+		}
+		layer = next
+		zero = sha256.Sum256(append(zero[:], zero[:]...))
+	}
+	if len(layer) == 0 {
+		return zero
+	}
+	return layer[0]
+}
+
+func refMixInLength(root [32]byte, n int) [32]byte {
+	var l [32]byte
+	binary.LittleEndian.PutUint64(l[:], uint64(n))
+	return sha256.Sum256(append(root[:], l[:]...))
+}
+
+func refPack(data []byte) [][32]byte {
+	var chunks [][32]byte
+	for len(data) > 0 {
+		var c [32]byte
+		n := copy(c[:], data)
+		chunks = append(chunks, c)
+		data = data[n:]
+	}
+	return chunks
+}
+
+type refUint64 uint64
+
+func (v refUint64) fixedSize() int { return 8 }
+
+func (v refUint64) encode() []byte {
+	out := make([]byte, 8)
+	binary.LittleEndian.PutUint64(out, uint64(v))
+	return out
+}
+
+func (v refUint64) root() (out [32]byte) {
+	copy(out[:], v.encode())
+	return out
+}
+
+type refBool bool
+
+func (v refBool) fixedSize() int { return 1 }
+
+func (v refBool) encode() []byte {
+	if v {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func (v refBool) root() (out [32]byte) {
+	copy(out[:], v.encode())
+	return out
+}
+
+// refBytes is a fixed-size byte vector, e.g. a root, pubkey or signature.
+type refBytes []byte
+
+func (v refBytes) fixedSize() int { return len(v) }
+func (v refBytes) encode() []byte { return v }
+
+func (v refBytes) root() [32]byte {
+	return refMerkleize(refPack(v), uint64(len(v)+31)/32)
+}
+
+// refUint64s is a vector of uint64s, or a list if limit is not 0.
+type refUint64s struct {
+	values []uint64
+	limit  uint64
+}
+
+func (v refUint64s) fixedSize() int {
+	if v.limit != 0 {
+		return 0
+	}
+	return 8 * len(v.values)
+}
+
+func (v refUint64s) encode() []byte {
+	out := make([]byte, 8*len(v.values))
+	for i, x := range v.values {
+		binary.LittleEndian.PutUint64(out[i*8:], x)
+	}
+	return out
+}
+
+func (v refUint64s) root() [32]byte {
+	if v.limit == 0 {
+		return refMerkleize(refPack(v.encode()), uint64(len(v.values)*8+31)/32)
+	}
+	return refMixInLength(refMerkleize(refPack(v.encode()), (v.limit*8+31)/32), len(v.values))
+}
+
+// refBits is a bitvector, or a bitlist if limit is not 0.
+type refBits struct {
+	bits  []bool
+	limit uint64
+}
+
+func (v refBits) fixedSize() int {
+	if v.limit != 0 {
+		return 0
+	}
+	return (len(v.bits) + 7) / 8
+}
+
+func (v refBits) packed() []byte {
+	out := make([]byte, (len(v.bits)+7)/8)
+	for i, b := range v.bits {
+		if b {
+			out[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return out
+}
+
+func (v refBits) encode() []byte {
+	if v.limit == 0 {
+		return v.packed()
+	}
+	// the delimiter bit follows the bits
+	out := make([]byte, len(v.bits)/8+1)
+	copy(out, v.packed())
+	out[len(v.bits)/8] |= 1 << uint(len(v.bits)%8)
+	return out
+}
+
+func (v refBits) root() [32]byte {
+	if v.limit == 0 {
+		return refMerkleize(refPack(v.packed()), uint64(len(v.bits)+255)/256)
+	}
+	return refMixInLength(refMerkleize(refPack(v.packed()), (v.limit+255)/256), len(v.bits))
+}
+
+// refSeq is a container, a vector, or a list if limit is not 0. The elements of vectors and lists have the same type.
+type refSeq struct {
+	elems []sszRef
+	limit uint64
+	list  bool
+}
+
+func refContainer(fields ...sszRef) refSeq { return refSeq{elems: fields} }
+func refVector(elems ...sszRef) refSeq     { return refSeq{elems: elems} }
+func refList(limit uint64, elems ...sszRef) refSeq {
+	return refSeq{elems: elems, limit: limit, list: true}
+}
+
+func (v refSeq) fixedSize() int {
+	if v.list {
+		return 0
+	}
+	size := 0
+	for _, e := range v.elems {
+		s := e.fixedSize()
+		if s == 0 {
+			return 0
+		}
+		size += s
+	}
+	return size
+}
+
+func (v refSeq) encode() []byte {
+	fixedLen := 0
+	for _, e := range v.elems {
+		if s := e.fixedSize(); s == 0 {
+			fixedLen += 4
+		} else {
+			fixedLen += s
+		}
+	}
+	var fixed, variable []byte
+	for _, e := range v.elems {
+		if e.fixedSize() == 0 {
+			offset := make([]byte, 4)
+			binary.LittleEndian.PutUint32(offset, uint32(fixedLen+len(variable)))
+			fixed = append(fixed, offset...)
+			variable = append(variable, e.encode()...)
+		} else {
+			fixed = append(fixed, e.encode()...)
+		}
+	}
+	return append(fixed, variable...)
+}
+
+func (v refSeq) root() [32]byte {
+	chunks := make([][32]byte, len(v.elems))
+	for i, e := range v.elems {
+		chunks[i] = e.root()
+	}
+	if !v.list {
+		return refMerkleize(chunks, uint64(len(chunks)))
+	}
+	return refMixInLength(refMerkleize(chunks, v.limit), len(chunks))
+}
+
+// refConfig has the constants of a spec config that shape the phase 0 types, as defined in the spec release.
+type refConfig struct {
+	v8                        bool
+	shardCount                uint64
+	slotsPerEpoch             uint64
+	slotsPerHistoricalRoot    uint64
+	historicalRootsLimit      uint64
+	slotsPerEth1VotingPeriod  uint64
+	validatorRegistryLimit    uint64
+	epochsPerHistoricalVector uint64
+	epochsPerSlashingsVector  uint64
+	maxValidatorsPerCommittee uint64
+}
+
+// refConfigs are the configs of every spec version prefix of statePresets.
+var refConfigs = map[string]map[string]refConfig{
+	"v0.8.": {
+		"minimal": {v8: true, shardCount: 8, slotsPerEpoch: 8, slotsPerHistoricalRoot: 64, historicalRootsLimit: 16777216,
+			slotsPerEth1VotingPeriod: 16, validatorRegistryLimit: 1099511627776, epochsPerHistoricalVector: 64,
+			epochsPerSlashingsVector: 64, maxValidatorsPerCommittee: 4096},
+		"mainnet": {v8: true, shardCount: 1024, slotsPerEpoch: 64, slotsPerHistoricalRoot: 8192, historicalRootsLimit: 16777216,
+			slotsPerEth1VotingPeriod: 1024, validatorRegistryLimit: 1099511627776, epochsPerHistoricalVector: 65536,
+			epochsPerSlashingsVector: 8192, maxValidatorsPerCommittee: 4096},
+	},
+	"v0.9.": {
+		"minimal": {slotsPerEpoch: 8, slotsPerHistoricalRoot: 64, historicalRootsLimit: 16777216,
+			slotsPerEth1VotingPeriod: 16, validatorRegistryLimit: 1099511627776, epochsPerHistoricalVector: 64,
+			epochsPerSlashingsVector: 64, maxValidatorsPerCommittee: 2048},
+		"mainnet": {slotsPerEpoch: 32, slotsPerHistoricalRoot: 8192, historicalRootsLimit: 16777216,
+			slotsPerEth1VotingPeriod: 1024, validatorRegistryLimit: 1099511627776, epochsPerHistoricalVector: 65536,
+			epochsPerSlashingsVector: 8192, maxValidatorsPerCommittee: 2048},
+	},
+}
+
+// refValues generates deterministic random field values.
+type refValues struct {
+	rng *rand.Rand
+}
+
+func newRefValues(seed int64) *refValues {
+	return &refValues{rng: rand.New(rand.NewSource(seed))}
+}
+
+func (g *refValues) bytes(n int) refBytes {
+	out := make([]byte, n)
+	g.rng.Read(out)
+	return out
+}
+
+func (g *refValues) uint64() refUint64 {
+	return refUint64(g.rng.Uint64())
+}
+
+func (g *refValues) bits(n int, limit uint64) refBits {
+	bits := make([]bool, n)
+	for i := range bits {
+		bits[i] = g.rng.Intn(2) == 1
+	}
+	return refBits{bits: bits, limit: limit}
+}
+
+func (g *refValues) roots(n uint64) refSeq {
+	elems := make([]sszRef, n)
+	for i := range elems {
+		elems[i] = g.bytes(32)
+	}
+	return refVector(elems...)
+}
+
+func (g *refValues) checkpoint() refSeq {
+	return refContainer(g.uint64(), g.bytes(32))
+}
+
+func (g *refValues) crosslink() refSeq {
+	return refContainer(g.uint64(), g.bytes(32), g.uint64(), g.uint64(), g.bytes(32))
+}
+
+func (g *refValues) blockHeader() refSeq {
+	return refContainer(g.uint64(), g.bytes(32), g.bytes(32), g.bytes(32), g.bytes(96))
+}
+
+func (g *refValues) eth1Data() refSeq {
+	return refContainer(g.bytes(32), g.uint64(), g.bytes(32))
+}
+
+func (g *refValues) attestationData(c refConfig) refSeq {
+	if c.v8 {
+		return refContainer(g.bytes(32), g.checkpoint(), g.checkpoint(), g.crosslink())
+	}
+	return refContainer(g.uint64(), g.uint64(), g.bytes(32), g.checkpoint(), g.checkpoint())
+}
+
+func (g *refValues) validator() refSeq {
+	return refContainer(g.bytes(48), g.bytes(32), g.uint64(), refBool(g.rng.Intn(2) == 1),
+		g.uint64(), g.uint64(), g.uint64(), g.uint64())
+}
+
+func (g *refValues) pendingAttestation(c refConfig, bits int) refSeq {
+	return refContainer(g.bits(bits, c.maxValidatorsPerCommittee), g.attestationData(c), g.uint64(), g.uint64())
+}
+
+// refState is a BeaconState with the given number of elements in every list.
+func (g *refValues) refState(c refConfig, n int) refSeq {
+	var historicalRoots, votes, validators, previous, current []sszRef
+	balances := refUint64s{limit: c.validatorRegistryLimit}
+	for i := 0; i < n; i++ {
+		historicalRoots = append(historicalRoots, g.bytes(32))
+		votes = append(votes, g.eth1Data())
+		validators = append(validators, g.validator())
+		balances.values = append(balances.values, uint64(g.uint64()))
+		previous = append(previous, g.pendingAttestation(c, 1+i*37))
+		current = append(current, g.pendingAttestation(c, 300+i))
+	}
+	slashings := refUint64s{values: make([]uint64, c.epochsPerSlashingsVector)}
+	for i := range slashings.values {
+		slashings.values[i] = uint64(g.uint64())
+	}
+	maxPending := 128 * c.slotsPerEpoch
+	fields := []sszRef{
+		g.uint64(), g.uint64(), // genesis_time, slot
+		refContainer(g.bytes(4), g.bytes(4), g.uint64()), // fork
+		g.blockHeader(),
+		g.roots(c.slotsPerHistoricalRoot), g.roots(c.slotsPerHistoricalRoot), // block_roots, state_roots
+		refList(c.historicalRootsLimit, historicalRoots...),
+		g.eth1Data(),
+		refList(c.slotsPerEth1VotingPeriod, votes...),
+		g.uint64(), // eth1_deposit_index
+		refList(c.validatorRegistryLimit, validators...),
+		balances,
+	}
+	if c.v8 {
+		fields = append(fields, g.uint64()) // start_shard
+	}
+	fields = append(fields, g.roots(c.epochsPerHistoricalVector)) // randao_mixes
+	if c.v8 {
+		// active_index_roots, compact_committees_roots
+		fields = append(fields, g.roots(c.epochsPerHistoricalVector), g.roots(c.epochsPerHistoricalVector))
+	}
+	fields = append(fields, slashings, refList(maxPending, previous...), refList(maxPending, current...))
+	if c.v8 {
+		var prevCrosslinks, curCrosslinks []sszRef
+		for i := uint64(0); i < c.shardCount; i++ {
+			prevCrosslinks = append(prevCrosslinks, g.crosslink())
+			curCrosslinks = append(curCrosslinks, g.crosslink())
+		}
+		fields = append(fields, refVector(prevCrosslinks...), refVector(curCrosslinks...))
+	}
+	fields = append(fields, g.bits(4, 0), g.checkpoint(), g.checkpoint(), g.checkpoint())
+	return refContainer(fields...)
+}
+
+func (g *refValues) attestation(c refConfig, bits int) refSeq {
+	// custody bits are in both v0.8 and v0.9, they were removed in v0.10
+	return refContainer(g.bits(bits, c.maxValidatorsPerCommittee), g.attestationData(c),
+		g.bits(bits, c.maxValidatorsPerCommittee), g.bytes(96))
+}
+
+func (g *refValues) indexedAttestation(c refConfig, n int) refSeq {
+	var bit0, bit1 refUint64s
+	bit0.limit, bit1.limit = c.maxValidatorsPerCommittee, c.maxValidatorsPerCommittee
+	for i := 0; i < n; i++ {
+		bit0.values = append(bit0.values, uint64(i))
+		bit1.values = append(bit1.values, uint64(n+i))
+	}
+	return refContainer(bit0, bit1, g.attestationData(c), g.bytes(96))
+}
+
+func (g *refValues) deposit() refSeq {
+	proof := make([]sszRef, 33)
+	for i := range proof {
+		proof[i] = g.bytes(32)
+	}
+	return refContainer(refVector(proof...), refContainer(g.bytes(48), g.bytes(32), g.uint64(), g.bytes(96)))
+}
+
+// refBlockBody is a BeaconBlockBody with n operations of every type, and the given attestations.
+func (g *refValues) refBlockBody(c refConfig, n int, attestations ...sszRef) refSeq {
+	var proposerSlashings, attesterSlashings, deposits, exits []sszRef
+	for i := 0; i < n; i++ {
+		proposerSlashings = append(proposerSlashings, refContainer(g.uint64(), g.blockHeader(), g.blockHeader()))
+		deposits = append(deposits, g.deposit())
+		exits = append(exits, refContainer(g.uint64(), g.uint64(), g.bytes(96)))
+	}
+	if n > 0 {
+		// MAX_ATTESTER_SLASHINGS is 1
+		attesterSlashings = append(attesterSlashings, refContainer(g.indexedAttestation(c, 3), g.indexedAttestation(c, 5)))
+	}
+	fields := []sszRef{
+		g.bytes(96), g.eth1Data(), g.bytes(32), // randao_reveal, eth1_data, graffiti
+		refList(16, proposerSlashings...),
+		refList(1, attesterSlashings...),
+		refList(128, attestations...),
+		refList(16, deposits...),
+		refList(16, exits...),
+	}
+	if c.v8 {
+		// MAX_TRANSFERS is 0
+		fields = append(fields, refList(0))
+	}
+	return refContainer(fields...)
+}
+
+// refBlock is a BeaconBlock of v0.8 or v0.9: the signature is the last field, there is no SignedBeaconBlock yet.
+func (g *refValues) refBlock(body refSeq) refSeq {
+	return refContainer(g.uint64(), g.bytes(32), g.bytes(32), body, g.bytes(96))
+}
@@ -0,0 +1,175 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// stateField is a top-level field of a BeaconState, as compared by diffStates.
+type stateField struct {
+	name string
+	// the size of a fixed-size field, 0 for a variable-size field
+	size int
+	// the size of the elements of a vector or list field. 0 if the field is not a collection,
+	// or has elements of variable size.
+	elemSize int
+	// if the field is a uint64, reported as a number
+	number bool
+}
+
+// stateFields returns the fields of a BeaconState of the preset, in order. See stateRoot for the same layout.
+func (p *statePreset) stateFields() []stateField {
+	uint64Field := func(name string) stateField {
+		return stateField{name: name, size: 8, number: true}
+	}
+	vector := func(name string, elemSize int, n uint64) stateField {
+		return stateField{name: name, size: elemSize * int(n), elemSize: elemSize}
+	}
+	list := func(name string, elemSize int) stateField {
+		return stateField{name: name, elemSize: elemSize}
+	}
+	fields := []stateField{
+		uint64Field("genesis_time"),
+		uint64Field("slot"),
+		{name: "fork", size: forkSize},
+		{name: "latest_block_header", size: blockHeaderSize},
+		vector("block_roots", 32, p.slotsPerHistoricalRoot),
+		vector("state_roots", 32, p.slotsPerHistoricalRoot),
+		list("historical_roots", 32),
+		{name: "eth1_data", size: eth1DataSize},
+		list("eth1_data_votes", eth1DataSize),
+		uint64Field("eth1_deposit_index"),
+		list("validators", validatorSize),
+		list("balances", 8),
+	}
+	if p.shards {
+		fields = append(fields, uint64Field("start_shard"))
+	}
+	fields = append(fields, vector("randao_mixes", 32, p.epochsPerHistoricalVector))
+	if p.shards {
+		fields = append(fields,
+			vector("active_index_roots", 32, p.epochsPerHistoricalVector),
+			vector("compact_committees_roots", 32, p.epochsPerHistoricalVector),
+		)
+	}
+	fields = append(fields,
+		vector("slashings", 8, p.epochsPerSlashingsVector),
+		list("previous_epoch_attestations", 0),
+		list("current_epoch_attestations", 0),
+	)
+	if p.shards {
+		fields = append(fields,
+			vector("previous_crosslinks", crosslinkSize, p.shardCount),
+			vector("current_crosslinks", crosslinkSize, p.shardCount),
+		)
+	}
+	fields = append(fields,
+		stateField{name: "justification_bits", size: 1},
+		stateField{name: "previous_justified_checkpoint", size: checkpointSize},
+		stateField{name: "current_justified_checkpoint", size: checkpointSize},
+		stateField{name: "finalized_checkpoint", size: checkpointSize},
+	)
+	return fields
+}
+
+// StateDiff is the difference between the post state of a client and of the reference client for a task.
+// It is uploaded as the post-diff result file.
+type StateDiff struct {
+	Key           string `json:"key"`
+	SpecVersion   string `json:"spec-version"`
+	SpecConfig    string `json:"spec-config"`
+	Client        string `json:"client"`
+	ClientVersion string `json:"client-version"`
+	// the flat-hashes of the post states of the client, and of the reference client
+	PostHash          string `json:"post-hash"`
+	ReferencePostHash string `json:"reference-post-hash"`
+	// the fields of the BeaconState that differ, in order. Empty if the states could not be decoded.
+	Fields []FieldDiff `json:"fields,omitempty"`
+	// why the states could not be compared field by field, e.g. an unknown state layout. Empty if compared.
+	Error string `json:"error,omitempty"`
+}
+
+// FieldDiff is a field of the BeaconState that differs between the client and the reference client.
+type FieldDiff struct {
+	Field string `json:"field"`
+	// the values of the field, as a number or 0x-prefixed hex. Omitted for large fields.
+	Value          string `json:"value,omitempty"`
+	ReferenceValue string `json:"reference-value,omitempty"`
+	// the number of elements of a list field, if they differ
+	Length          *int `json:"length,omitempty"`
+	ReferenceLength *int `json:"reference-length,omitempty"`
+	// the indices of the first differing elements of a vector or list field, up to maxDiffElements
+	Elements []int `json:"elements,omitempty"`
+}
+
+const (
+	// field values up to this size are included in a diff
+	maxDiffValueSize = 128
+	// differing elements reported per field
+	maxDiffElements = 16
+)
+
+// diffStates compares two SSZ encoded BeaconStates of the preset field by field, and returns the differing fields.
+func diffStates(p *statePreset, state []byte, reference []byte) ([]FieldDiff, error) {
+	fields := p.stateFields()
+	sizes := make([]int, len(fields))
+	for i, f := range fields {
+		sizes[i] = f.size
+	}
+	a, err := splitContainer(state, sizes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid post state: %v", err)
+	}
+	b, err := splitContainer(reference, sizes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference post state: %v", err)
+	}
+	var diffs []FieldDiff
+	for i, f := range fields {
+		if bytes.Equal(a[i], b[i]) {
+			continue
+		}
+		d := FieldDiff{Field: f.name}
+		switch {
+		case f.number:
+			d.Value = fmt.Sprintf("%d", binary.LittleEndian.Uint64(a[i]))
+			d.ReferenceValue = fmt.Sprintf("%d", binary.LittleEndian.Uint64(b[i]))
+		case f.elemSize == 0 && f.size == 0:
+			// variable-size elements
+			elemsA, errA := splitVariableList(a[i], len(a[i]))
+			elemsB, errB := splitVariableList(b[i], len(b[i]))
+			if errA == nil && errB == nil {
+				d.setLengths(len(elemsA), len(elemsB))
+				for j := 0; j < len(elemsA) && j < len(elemsB) && len(d.Elements) < maxDiffElements; j++ {
+					if !bytes.Equal(elemsA[j], elemsB[j]) {
+						d.Elements = append(d.Elements, j)
+					}
+				}
+			}
+		case f.elemSize > 0:
+			if f.size == 0 {
+				d.setLengths(len(a[i])/f.elemSize, len(b[i])/f.elemSize)
+			}
+			for j := 0; (j+1)*f.elemSize <= len(a[i]) && (j+1)*f.elemSize <= len(b[i]) && len(d.Elements) < maxDiffElements; j++ {
+				if !bytes.Equal(a[i][j*f.elemSize:(j+1)*f.elemSize], b[i][j*f.elemSize:(j+1)*f.elemSize]) {
+					d.Elements = append(d.Elements, j)
+				}
+			}
+		}
+		if d.Value == "" && len(a[i]) <= maxDiffValueSize && len(b[i]) <= maxDiffValueSize {
+			d.Value = fmt.Sprintf("0x%x", a[i])
+			d.ReferenceValue = fmt.Sprintf("0x%x", b[i])
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, nil
+}
+
+// setLengths sets the lengths of a list field, if they differ.
+func (d *FieldDiff) setLengths(n int, referenceN int) {
+	if n != referenceN {
+		d.Length = &n
+		d.ReferenceLength = &referenceN
+	}
+}
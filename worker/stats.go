@@ -0,0 +1,197 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsDays is the number of days to keep statistics for.
+const statsDays = 30
+
+const statsDayFormat = "2006-01-02"
+
+// StatsCounts are the counters of the tasks of a spec version and task family, on a single day.
+type StatsCounts struct {
+	Tasks       int `json:"tasks"`
+	Successes   int `json:"successes"`
+	Divergences int `json:"divergences"`
+	// total execution time of the client
+	Duration time.Duration `json:"duration"`
+}
+
+func (c *StatsCounts) add(o *StatsCounts) {
+	c.Tasks += o.Tasks
+	c.Successes += o.Successes
+	c.Divergences += o.Divergences
+	c.Duration += o.Duration
+}
+
+// StatsSummary aggregates the statistics of a spec version and task family over a number of days.
+type StatsSummary struct {
+	SpecVersion  string  `json:"spec-version"`
+	Family       string  `json:"family"`
+	Tasks        int     `json:"tasks"`
+	SuccessRate  float64 `json:"success-rate"`
+	MeanDuration string  `json:"mean-duration"`
+	Divergences  int     `json:"divergences"`
+}
+
+// statsStore keeps rolling daily task statistics, optionally persisted to a file.
+type statsStore struct {
+	mu   sync.Mutex
+	path string
+	// day -> spec version -> task family -> counts
+	Days map[string]map[string]map[string]*StatsCounts `json:"days"`
+}
+
+func (w *Worker) stats() *statsStore {
+	w.statsOnce.Do(func() {
+		s := &statsStore{path: w.StatsFile, Days: make(map[string]map[string]map[string]*StatsCounts)}
+		if s.path != "" {
+			if data, err := ioutil.ReadFile(s.path); err == nil {
+				if err := json.Unmarshal(data, s); err != nil {
+					log.Printf("failed to decode stats file %s, starting with empty stats: %v", s.path, err)
+					s.Days = make(map[string]map[string]map[string]*StatsCounts)
+				}
+			} else if !os.IsNotExist(err) {
+				log.Printf("failed to read stats file %s: %v", s.path, err)
+			}
+		}
+		w.statsState = s
+	})
+	return w.statsState
+}
+
+// taskFamily groups tasks for statistics: the campaign of the task, or else the first segment of the task key.
+func taskFamily(tr *TransitionMsg) string {
+	if tr.Campaign != "" {
+		return tr.Campaign
+	}
+	if i := strings.Index(tr.Key, "/"); i > 0 {
+		return tr.Key[:i]
+	}
+	return "other"
+}
+
+// Record counts a completed task, and persists the stats if a stats file is configured.
+func (s *statsStore) Record(tr *TransitionMsg, success bool, divergent bool, duration time.Duration, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := now.UTC().Format(statsDayFormat)
+	versions, ok := s.Days[day]
+	if !ok {
+		versions = make(map[string]map[string]*StatsCounts)
+		s.Days[day] = versions
+		// drop the days that rolled out of the window
+		oldest := now.UTC().AddDate(0, 0, -statsDays).Format(statsDayFormat)
+		for d := range s.Days {
+			if d <= oldest {
+				delete(s.Days, d)
+			}
+		}
+	}
+	families, ok := versions[tr.SpecVersion]
+	if !ok {
+		families = make(map[string]*StatsCounts)
+		versions[tr.SpecVersion] = families
+	}
+	c, ok := families[taskFamily(tr)]
+	if !ok {
+		c = &StatsCounts{}
+		families[taskFamily(tr)] = c
+	}
+	c.Tasks++
+	if success {
+		c.Successes++
+	}
+	if divergent {
+		c.Divergences++
+	}
+	c.Duration += duration
+	if s.path != "" {
+		if err := s.save(); err != nil {
+			log.Printf("failed to persist stats: %v", err)
+		}
+	}
+}
+
+// save writes the stats to a temporary file first, to not corrupt the stats file on a crash.
+func (s *statsStore) save() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Summary aggregates the stats of the last days. Empty spec version or family filters match everything.
+func (s *statsStore) Summary(specVersion string, family string, days int, now time.Time) []StatsSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldest := now.UTC().AddDate(0, 0, -days).Format(statsDayFormat)
+	totals := make(map[[2]string]*StatsCounts)
+	for day, versions := range s.Days {
+		if day <= oldest {
+			continue
+		}
+		for v, families := range versions {
+			if specVersion != "" && v != specVersion {
+				continue
+			}
+			for f, c := range families {
+				if family != "" && f != family {
+					continue
+				}
+				k := [2]string{v, f}
+				if totals[k] == nil {
+					totals[k] = &StatsCounts{}
+				}
+				totals[k].add(c)
+			}
+		}
+	}
+	out := make([]StatsSummary, 0, len(totals))
+	for k, c := range totals {
+		sum := StatsSummary{SpecVersion: k[0], Family: k[1], Tasks: c.Tasks, Divergences: c.Divergences}
+		if c.Tasks > 0 {
+			sum.SuccessRate = float64(c.Successes) / float64(c.Tasks)
+			sum.MeanDuration = (c.Duration / time.Duration(c.Tasks)).String()
+		}
+		out = append(out, sum)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].SpecVersion != out[j].SpecVersion {
+			return out[i].SpecVersion < out[j].SpecVersion
+		}
+		return out[i].Family < out[j].Family
+	})
+	return out
+}
+
+// serveStats serves the stats summary. Query parameters: spec-version, family, days (default 7).
+func (w *Worker) serveStats(rw http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	days := 7
+	if v := q.Get("days"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || d <= 0 || d > statsDays {
+			http.Error(rw, fmt.Sprintf("days must be a number between 1 and %d", statsDays), http.StatusBadRequest)
+			return
+		}
+		days = d
+	}
+	writeJSON(rw, w.stats().Summary(q.Get("spec-version"), q.Get("family"), days, w.now()))
+}
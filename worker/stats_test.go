@@ -0,0 +1,40 @@
+package worker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStatsPersisted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stats-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statsFile := filepath.Join(dir, "stats.json")
+
+	now := time.Now()
+	w := &Worker{Config: Config{StatsFile: statsFile}}
+	tr := &TransitionMsg{SpecVersion: "v0.9.1", Key: "sanity/foo"}
+	w.stats().Record(tr, true, false, 2*time.Second, now)
+	w.stats().Record(tr, false, true, 4*time.Second, now)
+	// outside of the window
+	w.stats().Record(tr, true, false, time.Second, now.AddDate(0, 0, -10))
+
+	reloaded := &Worker{Config: Config{StatsFile: statsFile}}
+	rec := httptest.NewRecorder()
+	reloaded.HTTPHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/stats?spec-version=v0.9.1&family=sanity", nil))
+	var summary []StatsSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	expected := StatsSummary{SpecVersion: "v0.9.1", Family: "sanity", Tasks: 2, SuccessRate: 0.5, MeanDuration: "3s", Divergences: 1}
+	if len(summary) != 1 || summary[0] != expected {
+		t.Errorf("unexpected stats: %+v", summary)
+	}
+}
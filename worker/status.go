@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"encoding/json"
+	"expvar"
+	"log"
+	"net/http"
+	"time"
+)
+
+// WorkerStatus describes the worker and its active config.
+type WorkerStatus struct {
+	WorkerID      string         `json:"worker-id"`
+	ClientName    string         `json:"client-name"`
+	ClientVersion string         `json:"client-version"`
+	SpecVersion   string         `json:"spec-version"`
+	SpecConfigs   []string       `json:"spec-configs"`
+	Targets       []string       `json:"targets"`
+	Config        DynamicConfig  `json:"config"`
+	ConfigUpdates []ConfigUpdate `json:"config-updates"`
+	Disk          DiskStatus     `json:"disk"`
+	Paused        bool           `json:"paused"`
+	PausedSince   *time.Time     `json:"paused-since,omitempty"`
+}
+
+func (w *Worker) Status() WorkerStatus {
+	status := WorkerStatus{
+		WorkerID:      w.WorkerID,
+		ClientName:    w.ClientName,
+		ClientVersion: w.ClientVersion,
+		SpecVersion:   w.SpecVersion,
+		SpecConfigs:   w.SpecConfigs,
+		Targets:       w.targetNames(),
+		Config:        w.ActiveDynamicConfig(),
+		Disk:          w.DiskStatus(),
+	}
+	if paused, since := w.PauseStatus(); paused {
+		status.Paused = true
+		status.PausedSince = &since
+	}
+	w.mu.RLock()
+	status.ConfigUpdates = append([]ConfigUpdate(nil), w.configUpdates...)
+	w.mu.RUnlock()
+	return status
+}
+
+// HTTPHandler serves the worker endpoints:
+//
+//	/status: the worker status, including the active config and disk usage.
+//	/stats: rolling task statistics per spec version and task family, see serveStats.
+//	/debug/vars: expvar metrics, see PublishDiskMetrics.
+//	/metrics: Prometheus metrics, see workerMetrics.
+func (w *Worker) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/metrics", w.MetricsHandler())
+	mux.HandleFunc("/status", func(rw http.ResponseWriter, req *http.Request) {
+		writeJSON(rw, w.Status())
+	})
+	mux.HandleFunc("/stats", w.serveStats)
+	return mux
+}
+
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("failed to write http response: %v", err)
+	}
+}
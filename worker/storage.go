@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+const storageAPI = "https://storage.googleapis.com"
+
+// BlobStore is a flat namespace of objects, like a storage bucket.
+// Inputs are read from one, results are written to another.
+type BlobStore interface {
+	// NewReader opens the named object for reading. The caller must close the reader.
+	NewReader(ctx context.Context, name string) (io.ReadCloser, error)
+	// NewWriter creates or overwrites the named object.
+	// The object is only complete once Close returns without error.
+	NewWriter(ctx context.Context, name string) io.WriteCloser
+	// URL returns the location of the named object, to reference it in result messages.
+	URL(name string) string
+}
+
+// versionedStore is a BlobStore that identifies the contents of an object without reading it,
+// so downloads of the object can be cached.
+type versionedStore interface {
+	// Version returns an identifier of the current contents of the named object,
+	// that changes when the object is overwritten.
+	Version(ctx context.Context, name string) (string, error)
+}
+
+// encodingStore is a BlobStore that records the Content-Encoding of objects,
+// so the objects can be decompressed transparently when they are downloaded.
+type encodingStore interface {
+	// NewEncodedWriter is NewWriter for an object with the given Content-Encoding, e.g. "gzip".
+	NewEncodedWriter(ctx context.Context, name string, contentEncoding string) io.WriteCloser
+}
+
+// chunkedStore is a BlobStore that uploads large objects in chunks, retrying failed chunks on their own,
+// instead of restarting the whole upload.
+type chunkedStore interface {
+	// NewChunkedWriter is NewWriter with the given chunk size in bytes, and Content-Encoding (if not empty).
+	NewChunkedWriter(ctx context.Context, name string, contentEncoding string, chunkSize int) io.WriteCloser
+}
+
+// checksumStore is a BlobStore that reports the checksums of objects, to verify downloads with.
+type checksumStore interface {
+	Checksums(ctx context.Context, name string) (objectChecksums, error)
+}
+
+type gcsStore struct {
+	bucketName string
+	bucket     *storage.BucketHandle
+	// signs URLs of result files, nil if URLs cannot be signed
+	signer *GCSURLSigner
+}
+
+func newGCSStore(client *storage.Client, bucketName string) *gcsStore {
+	return &gcsStore{bucketName: bucketName, bucket: client.Bucket(bucketName)}
+}
+
+// NewGCSStore opens a GCS bucket. The signer signs URLs of result files, it may be nil if URLs cannot be signed.
+func NewGCSStore(client *storage.Client, bucketName string, signer *GCSURLSigner) BlobStore {
+	s := newGCSStore(client, bucketName)
+	s.signer = signer
+	return s
+}
+
+func (s *gcsStore) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	r, err := s.bucket.Object(name).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *gcsStore) Version(ctx context.Context, name string) (string, error) {
+	attrs, err := s.bucket.Object(name).Attrs(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%x", attrs.Generation, attrs.MD5), nil
+}
+
+func (s *gcsStore) Checksums(ctx context.Context, name string) (objectChecksums, error) {
+	attrs, err := s.bucket.Object(name).Attrs(ctx)
+	if err != nil {
+		return objectChecksums{}, err
+	}
+	// composite objects have no MD5
+	sums := objectChecksums{CRC32C: &attrs.CRC32C}
+	if len(attrs.MD5) > 0 {
+		sums.MD5 = attrs.MD5
+	}
+	return sums, nil
+}
+
+func (s *gcsStore) NewWriter(ctx context.Context, name string) io.WriteCloser {
+	return s.bucket.Object(name).NewWriter(ctx)
+}
+
+func (s *gcsStore) NewEncodedWriter(ctx context.Context, name string, contentEncoding string) io.WriteCloser {
+	w := s.bucket.Object(name).NewWriter(ctx)
+	w.ContentEncoding = contentEncoding
+	return w
+}
+
+// NewChunkedWriter uploads with a resumable upload, the client retries failed chunks.
+// The chunk size is rounded up to a multiple of 256 KiB.
+func (s *gcsStore) NewChunkedWriter(ctx context.Context, name string, contentEncoding string, chunkSize int) io.WriteCloser {
+	w := s.bucket.Object(name).NewWriter(ctx)
+	w.ContentEncoding = contentEncoding
+	w.ChunkSize = chunkSize
+	return w
+}
+
+func (s *gcsStore) URL(name string) string {
+	return fmt.Sprintf("%s/%s/%s", storageAPI, s.bucketName, name)
+}
+
+func (s *gcsStore) SignedURL(name string, expires time.Time) (string, error) {
+	if s.signer == nil {
+		return "", fmt.Errorf("no signing credentials for bucket %s", s.bucketName)
+	}
+	return s.signer.sign(s.bucketName, name, expires)
+}
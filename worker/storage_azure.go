@@ -0,0 +1,382 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// azureAPIVersion is the version of the Blob service REST API.
+	azureAPIVersion = "2019-12-12"
+	// azureBlockSize is the size of the blocks that large objects are uploaded in.
+	azureBlockSize = 4 << 20
+	// azureBlockAttempts is the number of attempts to upload a block.
+	azureBlockAttempts = 3
+	// azureIdentityEndpoint is the managed identity token endpoint of the Azure instance metadata service.
+	azureIdentityEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+// azureAuth authorizes requests to the Blob service.
+type azureAuth interface {
+	authorize(req *http.Request) error
+}
+
+// azureSharedKey signs requests with the account key, see
+// https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+type azureSharedKey struct {
+	account string
+	key     []byte
+}
+
+func (a *azureSharedKey) authorize(req *http.Request) error {
+	var msHeaders []string
+	for k := range req.Header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-ms-") {
+			msHeaders = append(msHeaders, k)
+		}
+	}
+	sort.Strings(msHeaders)
+	var canonical strings.Builder
+	for _, k := range msHeaders {
+		canonical.WriteString(k + ":" + strings.TrimSpace(req.Header.Get(k)) + "\n")
+	}
+	canonical.WriteString("/" + a.account + req.URL.EscapedPath())
+	query := req.URL.Query()
+	var params []string
+	for k := range query {
+		params = append(params, k)
+	}
+	sort.Strings(params)
+	for _, k := range params {
+		values := query[k]
+		sort.Strings(values)
+		canonical.WriteString("\n" + strings.ToLower(k) + ":" + strings.Join(values, ","))
+	}
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+	toSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, x-ms-date is used instead
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonical.String(),
+	}, "\n")
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(toSign))
+	req.Header.Set("Authorization", "SharedKey "+a.account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+// azureManagedIdentity authorizes requests with an OAuth token of the managed identity of the Azure instance.
+type azureManagedIdentity struct {
+	// client ID of a user-assigned identity, empty for the system-assigned identity
+	clientID string
+	endpoint string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (a *azureManagedIdentity) authorize(req *http.Request) error {
+	token, err := a.getToken(req.Context())
+	if err != nil {
+		return fmt.Errorf("failed to get managed identity token: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (a *azureManagedIdentity) getToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// refresh the token some time before it expires
+	if a.token != "" && time.Now().Add(time.Minute*5).Before(a.expires) {
+		return a.token, nil
+	}
+	q := url.Values{"api-version": {"2018-02-01"}, "resource": {"https://storage.azure.com/"}}
+	if a.clientID != "" {
+		q.Set("client_id", a.clientID)
+	}
+	req, err := http.NewRequest("GET", a.endpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresOn   string `json:"expires_on"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode token: %v", err)
+	}
+	expiresOn, err := strconv.ParseInt(out.ExpiresOn, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid token expiry: %v", err)
+	}
+	a.token = out.AccessToken
+	a.expires = time.Unix(expiresOn, 0)
+	return a.token, nil
+}
+
+// AzureAccount is a storage account, with the endpoint of its Blob service.
+type AzureAccount struct {
+	// e.g. https://<account>.blob.core.windows.net
+	endpoint string
+	auth     azureAuth
+	client   *http.Client
+}
+
+// ParseAzureConnectionString parses a storage account connection string, e.g.
+// "DefaultEndpointsProtocol=https;AccountName=<account>;AccountKey=<key>;EndpointSuffix=core.windows.net".
+// The Blob service endpoint can be overridden with BlobEndpoint, e.g. for an emulator.
+func ParseAzureConnectionString(conn string) (*AzureAccount, error) {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(conn, ";") {
+		if i := strings.Index(part, "="); i > 0 {
+			fields[part[:i]] = part[i+1:]
+		}
+	}
+	account, key := fields["AccountName"], fields["AccountKey"]
+	if account == "" || key == "" {
+		return nil, fmt.Errorf("connection string requires AccountName and AccountKey")
+	}
+	keyBytes, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AccountKey: %v", err)
+	}
+	endpoint := fields["BlobEndpoint"]
+	if endpoint == "" {
+		protocol, suffix := fields["DefaultEndpointsProtocol"], fields["EndpointSuffix"]
+		if protocol == "" {
+			protocol = "https"
+		}
+		if suffix == "" {
+			suffix = "core.windows.net"
+		}
+		endpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, account, suffix)
+	}
+	return &AzureAccount{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		auth:     &azureSharedKey{account: account, key: keyBytes},
+		client:   &http.Client{},
+	}, nil
+}
+
+// NewAzureManagedIdentityAccount authorizes with the managed identity of the Azure instance the worker runs on.
+func NewAzureManagedIdentityAccount(account string, clientID string) *AzureAccount {
+	return &AzureAccount{
+		endpoint: fmt.Sprintf("https://%s.blob.core.windows.net", account),
+		auth:     &azureManagedIdentity{clientID: clientID, endpoint: azureIdentityEndpoint},
+		client:   &http.Client{},
+	}
+}
+
+// do sends an authorized request, and returns the response if the status is 2xx.
+func (a *AzureAccount) do(ctx context.Context, method string, u string, headers map[string]string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = int64(len(body))
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if err := a.auth.authorize(req); err != nil {
+		return nil, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response status: %s: %s", resp.Status, msg)
+	}
+	return resp, nil
+}
+
+// azureStore is a BlobStore in a container of an Azure storage account.
+type azureStore struct {
+	account   *AzureAccount
+	container string
+}
+
+func NewAzureStore(account *AzureAccount, container string) *azureStore {
+	return &azureStore{account: account, container: container}
+}
+
+func (s *azureStore) URL(name string) string {
+	return fmt.Sprintf("%s/%s/%s", s.account.endpoint, s.container, name)
+}
+
+func (s *azureStore) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := s.account.do(ctx, "GET", s.URL(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *azureStore) Version(ctx context.Context, name string) (string, error) {
+	resp, err := s.account.do(ctx, "HEAD", s.URL(name), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// Checksums reports the Content-MD5 of the blob, if it was set on upload.
+func (s *azureStore) Checksums(ctx context.Context, name string) (objectChecksums, error) {
+	resp, err := s.account.do(ctx, "HEAD", s.URL(name), nil, nil)
+	if err != nil {
+		return objectChecksums{}, err
+	}
+	resp.Body.Close()
+	var sums objectChecksums
+	if v := resp.Header.Get("Content-MD5"); v != "" {
+		md5, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return objectChecksums{}, fmt.Errorf("invalid Content-MD5 %q: %v", v, err)
+		}
+		sums.MD5 = md5
+	}
+	return sums, nil
+}
+
+// NewWriter uploads small objects at once when closed, and large objects in blocks while writing.
+func (s *azureStore) NewWriter(ctx context.Context, name string) io.WriteCloser {
+	return s.NewChunkedWriter(ctx, name, "", azureBlockSize)
+}
+
+func (s *azureStore) NewEncodedWriter(ctx context.Context, name string, contentEncoding string) io.WriteCloser {
+	return s.NewChunkedWriter(ctx, name, contentEncoding, azureBlockSize)
+}
+
+// NewChunkedWriter uploads large objects in blocks of the chunk size, each block is retried on its own.
+func (s *azureStore) NewChunkedWriter(ctx context.Context, name string, contentEncoding string, chunkSize int) io.WriteCloser {
+	if chunkSize <= 0 {
+		chunkSize = azureBlockSize
+	}
+	return &azureWriter{ctx: ctx, store: s, url: s.URL(name), contentEncoding: contentEncoding, blockSize: chunkSize}
+}
+
+type azureWriter struct {
+	ctx             context.Context
+	store           *azureStore
+	url             string
+	contentEncoding string
+	blockSize       int
+	buf             []byte
+	blockIDs        []string
+	err             error
+}
+
+func (w *azureWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, p...)
+	for len(w.buf) >= w.blockSize {
+		if err := w.putBlock(w.buf[:w.blockSize]); err != nil {
+			w.err = err
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[w.blockSize:]...)
+	}
+	return len(p), nil
+}
+
+func (w *azureWriter) putBlock(data []byte) error {
+	// block IDs must have the same length within a blob
+	id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", len(w.blockIDs))))
+	var err error
+	for i := 1; i <= azureBlockAttempts; i++ {
+		var resp *http.Response
+		resp, err = w.store.account.do(w.ctx, "PUT", w.url+"?"+url.Values{"comp": {"block"}, "blockid": {id}}.Encode(), nil, data)
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if w.ctx.Err() != nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload block: %v", err)
+	}
+	w.blockIDs = append(w.blockIDs, id)
+	return nil
+}
+
+// Close uploads the remaining data, and commits the blocks.
+func (w *azureWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	headers := make(map[string]string)
+	if w.contentEncoding != "" {
+		headers["x-ms-blob-content-encoding"] = w.contentEncoding
+	}
+	if len(w.blockIDs) == 0 {
+		headers["x-ms-blob-type"] = "BlockBlob"
+		resp, err := w.store.account.do(w.ctx, "PUT", w.url, headers, w.buf)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	if len(w.buf) > 0 {
+		if err := w.putBlock(w.buf); err != nil {
+			return err
+		}
+	}
+	var list bytes.Buffer
+	list.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+	for _, id := range w.blockIDs {
+		list.WriteString("<Latest>" + id + "</Latest>")
+	}
+	list.WriteString("</BlockList>")
+	resp, err := w.store.account.do(w.ctx, "PUT", w.url+"?comp=blocklist", headers, list.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to commit blocks: %v", err)
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAzureStore(t *testing.T) {
+	var mu sync.Mutex
+	blobs := make(map[string][]byte)
+	blocks := make(map[string][]byte)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "SharedKey devaccount:") || req.Header.Get("x-ms-version") == "" {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		data, _ := ioutil.ReadAll(req.Body)
+		q := req.URL.Query()
+		switch {
+		case req.Method == "PUT" && q.Get("comp") == "block":
+			blocks[req.URL.Path+"/"+q.Get("blockid")] = data
+		case req.Method == "PUT" && q.Get("comp") == "blocklist":
+			var list struct {
+				Latest []string
+			}
+			if err := xml.Unmarshal(data, &list); err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			var blob []byte
+			for _, id := range list.Latest {
+				blob = append(blob, blocks[req.URL.Path+"/"+id]...)
+			}
+			blobs[req.URL.Path] = blob
+		case req.Method == "PUT" && req.Header.Get("x-ms-blob-type") == "BlockBlob":
+			blobs[req.URL.Path] = data
+		case req.Method == "GET":
+			blob, ok := blobs[req.URL.Path]
+			if !ok {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = rw.Write(blob)
+			return
+		default:
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rw.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	key := base64.StdEncoding.EncodeToString([]byte("secret"))
+	account, err := ParseAzureConnectionString("DefaultEndpointsProtocol=http;AccountName=devaccount;AccountKey=" + key + ";BlobEndpoint=" + srv.URL + "/devaccount;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewAzureStore(account, "results")
+	large := bytes.Repeat([]byte("0123456789abcdef"), azureBlockSize/16*2+10)
+	for name, data := range map[string][]byte{"small.log": []byte("small"), "large/post.ssz": large} {
+		wr := store.NewWriter(context.Background(), name)
+		if _, err := wr.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := wr.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := store.NewReader(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("unexpected contents of %s (%d bytes): %v", name, len(got), err)
+		}
+	}
+	if len(blocks) != 3 {
+		t.Errorf("expected large object to be uploaded in 3 blocks, got %d", len(blocks))
+	}
+	if _, err := store.NewReader(context.Background(), "missing"); err == nil {
+		t.Error("expected missing blob to fail")
+	}
+	if u := store.URL("small.log"); u != srv.URL+"/devaccount/results/small.log" {
+		t.Errorf("unexpected url: %s", u)
+	}
+}
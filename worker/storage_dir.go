@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dirStore is a BlobStore in a local directory, objects are files at their name relative to the directory.
+type dirStore struct {
+	dir string
+}
+
+func NewDirStore(dir string) *dirStore {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return &dirStore{dir: dir}
+}
+
+func (s *dirStore) path(name string) (string, error) {
+	p := filepath.Join(s.dir, filepath.FromSlash(name))
+	if p != s.dir && !strings.HasPrefix(p, s.dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("object name %s is outside of %s", name, s.dir)
+	}
+	return p, nil
+}
+
+func (s *dirStore) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (s *dirStore) Version(ctx context.Context, name string) (string, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano()), nil
+}
+
+func (s *dirStore) NewWriter(ctx context.Context, name string) io.WriteCloser {
+	p, err := s.path(name)
+	if err != nil {
+		return errWriter{err}
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return errWriter{err}
+	}
+	// write to a temporary file first, so the object only appears once it is complete
+	f, err := ioutil.TempFile(filepath.Dir(p), "."+filepath.Base(p)+".tmp")
+	if err != nil {
+		return errWriter{err}
+	}
+	return &dirWriter{f: f, dest: p}
+}
+
+func (s *dirStore) URL(name string) string {
+	return "file://" + filepath.ToSlash(filepath.Join(s.dir, filepath.FromSlash(name)))
+}
+
+type dirWriter struct {
+	f    *os.File
+	dest string
+	err  error
+}
+
+func (w *dirWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *dirWriter) Close() error {
+	closeErr := w.f.Close()
+	if w.err == nil {
+		w.err = closeErr
+	}
+	if w.err != nil {
+		_ = os.Remove(w.f.Name())
+		return w.err
+	}
+	return os.Rename(w.f.Name(), w.dest)
+}
@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirStore(t *testing.T) {
+	root, err := ioutil.TempDir("", "muskoka-fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	store := NewDirStore(filepath.Join(root, "results"))
+
+	wr := store.NewWriter(context.Background(), "v0.8.3/minimal/foo/post.ssz")
+	if _, err := wr.Write([]byte("post")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "results", "v0.8.3", "minimal", "foo", "post.ssz")); err == nil {
+		t.Error("expected object to only appear when complete")
+	}
+	if err := wr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := store.NewReader(context.Background(), "v0.8.3/minimal/foo/post.ssz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != "post" {
+		t.Errorf("unexpected object %q: %v", data, err)
+	}
+	if _, err := store.NewReader(context.Background(), "../outside"); err == nil {
+		t.Error("expected objects outside of the bucket to be refused")
+	}
+	if err := store.NewWriter(context.Background(), "../outside").Close(); err == nil {
+		t.Error("expected writes outside of the bucket to be refused")
+	}
+}
@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"io"
+	"strings"
+)
+
+// s3Store is a BlobStore in an S3 (or S3 compatible, e.g. MinIO) bucket.
+type s3Store struct {
+	client   s3iface.S3API
+	uploader *s3manager.Uploader
+	bucket   string
+	// endpoint of an S3 compatible service, objects are referenced with path-style URLs. Empty for AWS S3.
+	endpoint string
+}
+
+func NewS3Store(client s3iface.S3API, bucket string, endpoint string) *s3Store {
+	return &s3Store{client: client, uploader: s3manager.NewUploaderWithClient(client), bucket: bucket, endpoint: endpoint}
+}
+
+func (s *s3Store) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	out, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(name)})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *s3Store) Version(ctx context.Context, name string) (string, error) {
+	out, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(name)})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.ETag), nil
+}
+
+// Checksums reports the ETag as MD5, unless the object was uploaded in parts: then the ETag is not an MD5.
+func (s *s3Store) Checksums(ctx context.Context, name string) (objectChecksums, error) {
+	out, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(name)})
+	if err != nil {
+		return objectChecksums{}, err
+	}
+	var sums objectChecksums
+	if etag := strings.Trim(aws.StringValue(out.ETag), `"`); !strings.Contains(etag, "-") {
+		if md5, err := hex.DecodeString(etag); err == nil && len(md5) == 16 {
+			sums.MD5 = md5
+		}
+	}
+	return sums, nil
+}
+
+// NewWriter streams the object to S3 in the background, using multipart uploads for large objects.
+func (s *s3Store) NewWriter(ctx context.Context, name string) io.WriteCloser {
+	return s.NewEncodedWriter(ctx, name, "")
+}
+
+func (s *s3Store) NewEncodedWriter(ctx context.Context, name string, contentEncoding string) io.WriteCloser {
+	return s.NewChunkedWriter(ctx, name, contentEncoding, 0)
+}
+
+// NewChunkedWriter uploads large objects in multipart uploads with parts of the chunk size, each part is retried on its own.
+// The part size is at least 5 MiB, the default part size is used if the chunk size is 0.
+func (s *s3Store) NewChunkedWriter(ctx context.Context, name string, contentEncoding string, chunkSize int) io.WriteCloser {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+		Body:   pr,
+	}
+	if contentEncoding != "" {
+		input.ContentEncoding = aws.String(contentEncoding)
+	}
+	go func() {
+		_, err := s.uploader.UploadWithContext(ctx, input, func(u *s3manager.Uploader) {
+			if chunkSize > 0 {
+				u.PartSize = int64(chunkSize)
+				if u.PartSize < s3manager.MinUploadPartSize {
+					u.PartSize = s3manager.MinUploadPartSize
+				}
+			}
+		})
+		// unblock the writer if the upload failed early
+		_ = pr.CloseWithError(err)
+		done <- err
+	}()
+	return &s3Writer{pw: pw, done: done}
+}
+
+func (s *s3Store) URL(name string) string {
+	if s.endpoint != "" {
+		return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(s.endpoint, "/"), s.bucket, name)
+	}
+	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", s.bucket, name)
+}
+
+type s3Writer struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close completes the upload, and waits for it.
+func (w *s3Writer) Close() error {
+	_ = w.pw.Close()
+	return <-w.done
+}
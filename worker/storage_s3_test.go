@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestS3Store(t *testing.T) {
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.Method {
+		case "PUT":
+			data, _ := ioutil.ReadAll(req.Body)
+			objects[req.URL.Path] = data
+		case "GET":
+			data, ok := objects[req.URL.Path]
+			if !ok {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = rw.Write(data)
+		default:
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer srv.Close()
+
+	sess, err := session.NewSession(aws.NewConfig().WithRegion("us-east-1").WithEndpoint(srv.URL).
+		WithS3ForcePathStyle(true).WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewS3Store(s3.New(sess), "results", srv.URL)
+	wr := store.NewWriter(context.Background(), "a/b.ssz")
+	if _, err := wr.Write([]byte("post")); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := store.NewReader(context.Background(), "a/b.ssz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != "post" {
+		t.Errorf("unexpected object %q: %v", data, err)
+	}
+	if _, err := store.NewReader(context.Background(), "missing"); err == nil {
+		t.Error("expected missing object to fail")
+	}
+	if u := store.URL("a/b.ssz"); u != srv.URL+"/results/a/b.ssz" {
+		t.Errorf("unexpected url: %s", u)
+	}
+}
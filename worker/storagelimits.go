@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// throttleChunkSize is the most bytes a throttled read returns at once, so the rate limit is applied smoothly.
+const throttleChunkSize = 32 << 10
+
+// storageLimiter caps the storage operations of all tasks of the worker:
+// the number of concurrent downloads and uploads, and the upload bandwidth.
+type storageLimiter struct {
+	// a slot per running storage operation, nil if unlimited
+	slots chan struct{}
+	// nil if the upload bandwidth is unlimited
+	upload *byteRate
+}
+
+func (w *Worker) storageLimits() *storageLimiter {
+	w.storageLimitsOnce.Do(func() {
+		l := &storageLimiter{}
+		if w.MaxStorageConcurrency > 0 {
+			l.slots = make(chan struct{}, w.MaxStorageConcurrency)
+		}
+		if w.MaxUploadBps > 0 {
+			l.upload = &byteRate{bps: w.MaxUploadBps}
+		}
+		w.storageLimitsState = l
+	})
+	return w.storageLimitsState
+}
+
+// acquire waits for a slot to run a storage operation in. The returned function releases the slot.
+func (l *storageLimiter) acquire(ctx context.Context) (release func(), err error) {
+	if l.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// throttleUpload limits the reads of the upload source to the upload bandwidth, shared by all uploads.
+func (l *storageLimiter) throttleUpload(ctx context.Context, r io.Reader) io.Reader {
+	if l.upload == nil {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, rate: l.upload}
+}
+
+// byteRate paces a stream of bytes to a rate in bytes per second.
+type byteRate struct {
+	bps int64
+
+	mu sync.Mutex
+	// when the bytes passed so far are within the rate
+	next time.Time
+}
+
+// wait blocks until n more bytes fit in the rate.
+// Every call reserves its time slot first, so concurrent callers share the rate in order of arrival.
+func (b *byteRate) wait(ctx context.Context, n int) error {
+	b.mu.Lock()
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	delay := b.next.Sub(now)
+	b.next = b.next.Add(time.Duration(int64(n) * int64(time.Second) / b.bps))
+	b.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type throttledReader struct {
+	ctx  context.Context
+	r    io.Reader
+	rate *byteRate
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunkSize {
+		p = p[:throttleChunkSize]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.rate.wait(t.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
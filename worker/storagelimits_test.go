@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestStorageConcurrency(t *testing.T) {
+	w := &Worker{Config: Config{MaxStorageConcurrency: 2}}
+	l := w.storageLimits()
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := l.acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected to wait for a slot, got %v", err)
+	}
+	releases[0]()
+	if _, err := l.acquire(context.Background()); err != nil {
+		t.Errorf("expected a released slot: %v", err)
+	}
+}
+
+func TestUploadBandwidth(t *testing.T) {
+	w := &Worker{Config: Config{MaxUploadBps: 256 << 10}}
+	data := make([]byte, 128<<10)
+	start := time.Now()
+	got, err := ioutil.ReadAll(w.storageLimits().throttleUpload(context.Background(), bytes.NewReader(data)))
+	if err != nil || len(got) != len(data) {
+		t.Fatalf("expected all data, got %d bytes: %v", len(got), err)
+	}
+	// the first chunk passes immediately, the rest is paced
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("expected reads to take about 0.5s at the upload rate, took %s", d)
+	}
+
+	// unlimited by default
+	if r := (&Worker{}).storageLimits().throttleUpload(context.Background(), bytes.NewReader(data)); r == nil {
+		t.Error("expected a reader")
+	} else if _, ok := r.(*throttledReader); ok {
+		t.Error("expected unlimited uploads to not be throttled")
+	}
+}
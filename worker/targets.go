@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Target is a spec version and config to process tasks for. Each target has its own subscription.
+type Target struct {
+	SpecVersion string
+	SpecConfig  string
+}
+
+func (t Target) String() string {
+	return t.SpecVersion + "/" + t.SpecConfig
+}
+
+// ParseTarget parses a target formatted as <spec-version>/<spec-config>, e.g. "v0.8.3/minimal".
+func ParseTarget(s string) (Target, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Target{}, fmt.Errorf("expected <spec-version>/<spec-config>, got %q", s)
+	}
+	return Target{SpecVersion: parts[0], SpecConfig: parts[1]}, nil
+}
+
+// AllTargets returns the configured targets, or else the spec configs of the spec version.
+func (c *Config) AllTargets() []Target {
+	if len(c.Targets) > 0 {
+		return c.Targets
+	}
+	out := make([]Target, 0, len(c.SpecConfigs))
+	for _, specConfig := range c.SpecConfigs {
+		out = append(out, Target{SpecVersion: c.SpecVersion, SpecConfig: specConfig})
+	}
+	return out
+}
+
+// supportsTarget returns true if the spec version and config is one of the targets,
+// or if the spec version is in the SpecVersions range and the spec config is of any target.
+func (c *Config) supportsTarget(specVersion string, specConfig string) bool {
+	for _, t := range c.AllTargets() {
+		if t.SpecConfig == specConfig && (t.SpecVersion == specVersion || c.SpecVersions.Contains(specVersion)) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetNames returns the targets formatted as <spec-version>/<spec-config>.
+func (c *Config) targetNames() []string {
+	var out []string
+	for _, t := range c.AllTargets() {
+		out = append(out, t.String())
+	}
+	return out
+}
+
+// uniqueStrings returns the distinct values, in order of first appearance.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTargets(t *testing.T) {
+	if _, err := ParseTarget("v0.8.3"); err == nil {
+		t.Error("expected target without config to fail")
+	}
+	a, err := ParseTarget("v0.8.3/minimal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ParseTarget("v0.9.1/mainnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &Worker{Config: Config{SpecVersion: "v0.8.3", SpecConfigs: []string{"minimal", "mainnet"}}}
+	if !w.supportsTarget("v0.8.3", "mainnet") || w.supportsTarget("v0.9.1", "mainnet") {
+		t.Error("expected the spec configs of the spec version to be the targets by default")
+	}
+	w.Targets = []Target{a, b}
+	if !w.supportsTarget("v0.9.1", "mainnet") || w.supportsTarget("v0.8.3", "mainnet") || w.supportsTarget("v0.9.1", "minimal") {
+		t.Error("expected only the configured targets to be supported")
+	}
+	c := w.Capabilities()
+	if strings.Join(c.Targets, ",") != "v0.8.3/minimal,v0.9.1/mainnet" ||
+		strings.Join(c.SpecVersions, ",") != "v0.8.3,v0.9.1" || strings.Join(c.SpecConfigs, ",") != "minimal,mainnet" {
+		t.Errorf("unexpected capabilities: %+v", c)
+	}
+}
@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// cancelledTaskTTL is how long cancellations are remembered, to also drop matching tasks that are delivered later.
+const cancelledTaskTTL = time.Hour * 24
+
+var errTaskCancelled = errors.New("task was cancelled")
+
+type inflightTask struct {
+	msg       *TransitionMsg
+	started   time.Time
+	cancel    context.CancelFunc
+	cancelled bool
+	// the current phase, see progress
+	phase string
+}
+
+// trackTask registers the task as in-flight, and returns a context that is canceled when the task is cancelled.
+// The returned function must be called when the task is done.
+func (w *Worker) trackTask(ctx context.Context, tr *TransitionMsg) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	w.tasksMu.Lock()
+	defer w.tasksMu.Unlock()
+	if w.inflight == nil {
+		w.inflight = make(map[string]*inflightTask)
+	}
+	w.inflight[tr.ResultKey] = &inflightTask{msg: tr, started: w.now(), cancel: cancel}
+	return ctx, func() {
+		cancel()
+		w.tasksMu.Lock()
+		delete(w.inflight, tr.ResultKey)
+		w.tasksMu.Unlock()
+	}
+}
+
+// CancelTasks aborts all in-flight tasks with the given key or campaign (empty values match nothing),
+// and drops matching tasks that are delivered later. It returns the number of aborted in-flight tasks.
+func (w *Worker) CancelTasks(key string, campaign string) int {
+	w.tasksMu.Lock()
+	defer w.tasksMu.Unlock()
+	if w.cancelled == nil {
+		w.cancelled = make(map[string]time.Time)
+	}
+	now := w.now()
+	for id, t := range w.cancelled {
+		if now.Sub(t) > cancelledTaskTTL {
+			delete(w.cancelled, id)
+		}
+	}
+	if key != "" {
+		w.cancelled["key:"+key] = now
+	}
+	if campaign != "" {
+		w.cancelled["campaign:"+campaign] = now
+	}
+	count := 0
+	for _, t := range w.inflight {
+		if (key != "" && t.msg.Key == key) || (campaign != "" && t.msg.Campaign == campaign) {
+			log.Printf("cancelling in-flight task %s (campaign: %q)", t.msg.Key, t.msg.Campaign)
+			t.cancelled = true
+			t.cancel()
+			count++
+		}
+	}
+	return count
+}
+
+// setPhase records the current phase of the in-flight task.
+func (w *Worker) setPhase(tr *TransitionMsg, phase string) {
+	w.tasksMu.Lock()
+	defer w.tasksMu.Unlock()
+	if t, ok := w.inflight[tr.ResultKey]; ok {
+		t.phase = phase
+	}
+}
+
+// taskCancelled checks if the task was cancelled, before or during processing.
+func (w *Worker) taskCancelled(tr *TransitionMsg) bool {
+	w.tasksMu.Lock()
+	defer w.tasksMu.Unlock()
+	if t, ok := w.inflight[tr.ResultKey]; ok && t.cancelled {
+		return true
+	}
+	if t, ok := w.cancelled["key:"+tr.Key]; ok && w.now().Sub(t) <= cancelledTaskTTL {
+		return true
+	}
+	if tr.Campaign == "" {
+		return false
+	}
+	t, ok := w.cancelled["campaign:"+tr.Campaign]
+	return ok && w.now().Sub(t) <= cancelledTaskTTL
+}
+
+type taskExecution struct {
+	done chan struct{}
+	err  error
+}
+
+// coalesceTask runs process for the task, unless the same task is already being processed by the worker.
+// Duplicate deliveries wait for the running execution to complete, and share its outcome.
+func (w *Worker) coalesceTask(ctx context.Context, tr *TransitionMsg, process func() error) error {
+	id := tr.InputsBucketPathStart()
+	w.tasksMu.Lock()
+	if ex, ok := w.executions[id]; ok {
+		w.tasksMu.Unlock()
+		log.Printf("task %s is already being processed, waiting for it to complete", tr.Key)
+		select {
+		case <-ex.done:
+			return ex.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if w.executions == nil {
+		w.executions = make(map[string]*taskExecution)
+	}
+	ex := &taskExecution{done: make(chan struct{})}
+	w.executions[id] = ex
+	w.tasksMu.Unlock()
+
+	ex.err = process()
+
+	w.tasksMu.Lock()
+	delete(w.executions, id)
+	w.tasksMu.Unlock()
+	close(ex.done)
+	return ex.err
+}
@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesceTask(t *testing.T) {
+	w := &Worker{}
+	tr := &TransitionMsg{SpecVersion: "v0.8.3", SpecConfig: "minimal", Key: "foo"}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var runs int32
+	process := func() error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return nil
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		if i == 1 {
+			<-started
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = w.coalesceTask(context.Background(), tr, process)
+		}(i)
+	}
+	// let the duplicates reach the wait, then complete the execution
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if runs != 1 {
+		t.Errorf("expected a single execution, got %d", runs)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("expected delivery %d to succeed: %v", i, err)
+		}
+	}
+	// a later delivery is processed again
+	if err := w.coalesceTask(context.Background(), tr, process); err != nil || runs != 2 {
+		t.Error("expected later delivery to be processed")
+	}
+}
+
+func TestCancelledTaskExpires(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	w := &Worker{Clock: clock}
+	tr := &TransitionMsg{Key: "foo", Campaign: "bar"}
+	w.CancelTasks("", "bar")
+	if !w.taskCancelled(tr) {
+		t.Fatal("expected task of cancelled campaign to be dropped")
+	}
+	clock.Advance(cancelledTaskTTL + time.Second)
+	if w.taskCancelled(tr) {
+		t.Fatal("expected cancellation to expire")
+	}
+}
@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Task types beyond block transitions, to cover the other formats of the consensus spec tests.
+// These only run with a cli cmd for the type, see Config.TaskCliCmds.
+const (
+	// TaskTypeEpoch runs an epoch processing sub-transition on the pre state,
+	// the Operation of the task, e.g. "justification_and_finalization".
+	TaskTypeEpoch = "epoch"
+	// TaskTypeOperation processes a single operation on the pre state, e.g. an attestation or a deposit.
+	// The Operation of the task is the type of the operation, the operation itself is in operation.ssz.
+	TaskTypeOperation = "operation"
+	// TaskTypeSlots processes the pre state through the Slots of the task, without blocks.
+	TaskTypeSlots = "slots"
+)
+
+// KnownTaskType returns true if the worker knows how to load and run tasks of the type.
+func KnownTaskType(t string) bool {
+	switch t {
+	case TaskTypeBlocks, TaskTypeFinality, TaskTypeEpoch, TaskTypeOperation, TaskTypeSlots:
+		return true
+	default:
+		return false
+	}
+}
+
+// isBlockTransition returns true if the inputs of the task are a pre state and blocks.
+func (tr *TransitionMsg) isBlockTransition() bool {
+	t := tr.TaskType()
+	return t == TaskTypeBlocks || t == TaskTypeFinality
+}
+
+// InputFiles returns the names of the input files of the task besides pre.ssz, by task type.
+func (tr *TransitionMsg) InputFiles() []string {
+	switch tr.TaskType() {
+	case TaskTypeOperation:
+		return []string{"operation.ssz"}
+	case TaskTypeEpoch, TaskTypeSlots:
+		return nil
+	default:
+		var names []string
+		for i := 0; i < tr.Blocks; i++ {
+			names = append(names, fmt.Sprintf("block_%d.ssz", i))
+		}
+		return names
+	}
+}
+
+// checkTaskParams checks if the task has the parameters its type needs.
+func (tr *TransitionMsg) checkTaskParams() error {
+	switch tr.TaskType() {
+	case TaskTypeEpoch, TaskTypeOperation:
+		if tr.Operation == "" {
+			return fmt.Errorf("%s task without operation", tr.TaskType())
+		}
+	case TaskTypeSlots:
+		if tr.Slots == 0 {
+			return fmt.Errorf("slots task without slots")
+		}
+	}
+	return nil
+}
+
+// taskTypes returns the task types the worker can process.
+func (w *Worker) taskTypes() []string {
+	types := []string{TaskTypeBlocks, TaskTypeFinality}
+	var extra []string
+	for t, cmd := range w.TaskCliCmds {
+		if cmd != "" && t != TaskTypeBlocks && t != TaskTypeFinality {
+			extra = append(extra, t)
+		}
+	}
+	sort.Strings(extra)
+	return append(types, extra...)
+}
+
+// taskCliCmd returns the cli cmd to run the task with the client:
+// the cli cmd for the type of the task if the worker has one, else the cli cmd of the client.
+func (w *Worker) taskCliCmd(tr *TransitionMsg, c *taskClient) string {
+	if cmd := w.TaskCliCmds[tr.TaskType()]; cmd != "" && c.subDir == "" {
+		return cmd
+	}
+	return c.cliCmd
+}
+
+// taskArgs returns the flags of the parameters of a task that is not a block transition,
+// added by cliCmdBuilder after --pre and --post.
+func taskArgs(inv *Invocation) []string {
+	var args []string
+	if inv.Operation != "" {
+		args = append(args, "--operation", inv.Operation)
+	}
+	if inv.Slots > 0 {
+		args = append(args, "--slots", strconv.FormatUint(inv.Slots, 10))
+	}
+	return args
+}
@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOperationTask(t *testing.T) {
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+
+	msg := h.addTask("op", []byte("pre-op"))
+	msg.Type = TaskTypeOperation
+	msg.Operation = "attestation"
+	h.inputs.Put(msg.InputsBucketPathStart()+"/operation.ssz", []byte("att"))
+
+	// without a cli cmd for operation tasks, the task is ignored
+	if !h.process(msg) {
+		t.Fatal("expected unsupported task to be acked")
+	}
+	if n := len(h.published()); n != 0 {
+		t.Fatalf("expected no results of unsupported task, got %d", n)
+	}
+
+	h.worker.TaskCliCmds = map[string]string{TaskTypeOperation: h.worker.CliCmd}
+	if types := h.worker.Capabilities().TaskTypes; !reflect.DeepEqual(types, []string{TaskTypeBlocks, TaskTypeFinality, TaskTypeOperation}) {
+		t.Errorf("unexpected task types: %v", types)
+	}
+	if !h.process(msg) {
+		t.Fatal("expected task to be acked")
+	}
+	res := h.result()
+	if !res.Success || string(h.resultFile(res.Files.PostState)) != "pre-opatt" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if out := string(h.resultFile(res.Files.OutLog)); out != "operation attestation\nprocessing 1 blocks\n" {
+		t.Errorf("unexpected out log: %q", out)
+	}
+}
+
+func TestTaskTypeParams(t *testing.T) {
+	w := &Worker{Config: Config{TaskCliCmds: map[string]string{TaskTypeEpoch: "zcli transition sub-epoch", TaskTypeSlots: "zcli transition slots"}}}
+	if err := w.checkTaskType(&TransitionMsg{Type: TaskTypeEpoch}); err == nil {
+		t.Error("expected epoch task without operation to be rejected")
+	}
+	if err := w.checkTaskType(&TransitionMsg{Type: TaskTypeSlots, Slots: 3}); err != nil {
+		t.Errorf("expected slots task to be supported: %v", err)
+	}
+	if err := w.checkTaskType(&TransitionMsg{Type: TaskTypeOperation, Operation: "deposit"}); err == nil {
+		t.Error("expected operation task without cli cmd to be rejected")
+	}
+
+	spec, err := cliCmdBuilder{}.Build(&Invocation{CliCmd: "zcli transition slots", Type: TaskTypeSlots, Slots: 3, Pre: "pre.ssz", Post: "post.ssz"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"transition", "slots", "--pre", "pre.ssz", "--post", "post.ssz", "--slots", "3"}; !reflect.DeepEqual(spec.Args, expected) {
+		t.Errorf("unexpected args: %v", spec.Args)
+	}
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// Tenant isolates the results of a client team: results are written with the credentials of the team,
+// to the bucket of the team.
+type Tenant struct {
+	// service account key file to write results with. The default credentials are used if empty.
+	CredentialsFile string `json:"credentials-file,omitempty"`
+	ResultsBucket   string `json:"results-bucket"`
+}
+
+// LoadTenants reads a JSON object of tenants, keyed by client name.
+func LoadTenants(path string) (map[string]Tenant, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants file: %v", err)
+	}
+	var tenants map[string]Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("failed to decode tenants file: %v", err)
+	}
+	for name, t := range tenants {
+		if t.ResultsBucket == "" {
+			return nil, fmt.Errorf("tenant %s has no results bucket", name)
+		}
+	}
+	return tenants, nil
+}
+
+// clientStore only allows writes to the result prefixes of a single client.
+type clientStore struct {
+	BlobStore
+	clientName string
+	// the layout of the result paths, the default layout if nil
+	layout *ResultPathLayout
+}
+
+// NewClientStore wraps the store to only allow writes to the result prefixes of the client, in the layout of the results.
+func NewClientStore(store BlobStore, clientName string, layout *ResultPathLayout) BlobStore {
+	return &clientStore{BlobStore: store, clientName: clientName, layout: layout}
+}
+
+// pathClient returns the client name in the path of a result file.
+func (s *clientStore) pathClient(name string) string {
+	if s.layout == nil {
+		return DefaultResultPathLayout.Client(name)
+	}
+	return s.layout.Client(name)
+}
+
+func (s *clientStore) NewWriter(ctx context.Context, name string) io.WriteCloser {
+	if c := s.pathClient(name); c != s.clientName {
+		return errWriter{fmt.Errorf("client %s may not write to %s, result prefix belongs to client %q", s.clientName, name, c)}
+	}
+	return s.BlobStore.NewWriter(ctx, name)
+}
+
+// NewChunkedWriter is NewWriter in chunks, if the underlying store supports it.
+func (s *clientStore) NewChunkedWriter(ctx context.Context, name string, contentEncoding string, chunkSize int) io.WriteCloser {
+	cs, ok := s.BlobStore.(chunkedStore)
+	if !ok {
+		return s.NewWriter(ctx, name)
+	}
+	if c := s.pathClient(name); c != s.clientName {
+		return errWriter{fmt.Errorf("client %s may not write to %s, result prefix belongs to client %q", s.clientName, name, c)}
+	}
+	return cs.NewChunkedWriter(ctx, name, contentEncoding, chunkSize)
+}
+
+func (s *clientStore) SignedURL(name string, expires time.Time) (string, error) {
+	signer, ok := s.BlobStore.(signedURLStore)
+	if !ok {
+		return "", fmt.Errorf("results store cannot sign URLs")
+	}
+	return signer.SignedURL(name, expires)
+}
+
+type errWriter struct {
+	err error
+}
+
+func (w errWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
+
+func (w errWriter) Close() error {
+	return w.err
+}
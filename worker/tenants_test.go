@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"context"
+	"testing"
+)
+
+func TestClientStoreIsolation(t *testing.T) {
+	mem := NewMemStore("results-fakeclient")
+	h := newHarness(t, "", ExecRunner{})
+	defer h.Close()
+	h.worker.Results = &clientStore{BlobStore: mem, clientName: "fakeclient"}
+	if !h.process(h.addTask("foo", []byte("pre"), []byte("block0"))) {
+		t.Fatal("expected task to be acked")
+	}
+	if len(mem.Names()) == 0 {
+		t.Fatal("expected results to be written to the tenant bucket")
+	}
+
+	w := h.worker.Results.NewWriter(context.Background(), "v0.8.3/minimal/foo/otherclient/v1/abc/post.ssz")
+	_, _ = w.Write([]byte("spoofed"))
+	if err := w.Close(); err == nil {
+		t.Fatal("expected write to the result prefix of another client to fail")
+	}
+	if _, ok := mem.Get("v0.8.3/minimal/foo/otherclient/v1/abc/post.ssz"); ok {
+		t.Error("wrote to the result prefix of another client")
+	}
+}
@@ -0,0 +1,23 @@
+#!/bin/sh
+# Fake client for tests: the post state is the pre state with all blocks appended to it.
+# With --fail it writes nothing and exits with an error, like a client rejecting a block.
+fail=""
+pre=""
+post=""
+while [ $# -gt 0 ]; do
+	case "$1" in
+		--help) echo "usage: fake_client.sh [--fail] --pre <pre> --post <post> <blocks...>"; exit 0;;
+		--fail) fail=1; shift;;
+		--pre) pre="$2"; shift 2;;
+		--post) post="$2"; shift 2;;
+		--operation) echo "operation $2"; shift 2;;
+		--slots) echo "slots $2"; shift 2;;
+		*) break;;
+	esac
+done
+if [ -n "$fail" ]; then
+	echo "invalid block" >&2
+	exit 1
+fi
+echo "processing $# blocks"
+cat "$pre" "$@" > "$post"
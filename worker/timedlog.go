@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// timedLineWriter prefixes every line written to it with the time the line started arriving,
+// the time elapsed since the writer was created, and an optional tag.
+// Every line is written to the output with a single Write call.
+// Lines longer than maxTimedLineSize are split, to bound the memory used for chatty clients.
+type timedLineWriter struct {
+	out         io.Writer
+	tag         string
+	now         func() time.Time
+	start       time.Time
+	midLine     bool
+	lineStarted time.Time
+	line        []byte
+}
+
+// maxTimedLineSize is the maximum number of bytes of a line to buffer, before writing it out as a partial line.
+const maxTimedLineSize = 64 << 10
+
+func newTimedLineWriter(out io.Writer, tag string, now func() time.Time) *timedLineWriter {
+	return &timedLineWriter{out: out, tag: tag, now: now, start: now()}
+}
+
+func (w *timedLineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if !w.midLine {
+			w.midLine = true
+			w.lineStarted = w.now()
+		}
+		i := 0
+		for i < len(p) && p[i] != '\n' {
+			i++
+		}
+		if i == len(p) {
+			if space := maxTimedLineSize - len(w.line); len(p) >= space {
+				// spill the buffered part of the long line, and continue on a new line
+				w.line = append(w.line, p[:space]...)
+				if err := w.writeLine(); err != nil {
+					return 0, err
+				}
+				p = p[space:]
+				continue
+			}
+			w.line = append(w.line, p...)
+			break
+		}
+		w.line = append(w.line, p[:i]...)
+		if err := w.writeLine(); err != nil {
+			return 0, err
+		}
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+func (w *timedLineWriter) writeLine() error {
+	elapsed := w.lineStarted.Sub(w.start)
+	_, err := fmt.Fprintf(w.out, "%s +%.3fs %s%s\n", w.lineStarted.UTC().Format(time.RFC3339Nano), elapsed.Seconds(), w.tag, w.line)
+	w.line = w.line[:0]
+	w.midLine = false
+	return err
+}
+
+// Flush writes the remaining partial line, if any.
+func (w *timedLineWriter) Flush() error {
+	if !w.midLine {
+		return nil
+	}
+	return w.writeLine()
+}
+
+// syncWriter serializes writes to the underlying writer, to combine multiple output streams.
+type syncWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.Write(p)
+}
+
+// Do runs f while no writes are happening, e.g. to read what was written so far.
+func (w *syncWriter) Do(f func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f()
+}
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTimedLineWriter(t *testing.T) {
+	clock := time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC)
+	now := func() time.Time { return clock }
+	var buf bytes.Buffer
+	w := newTimedLineWriter(&buf, "", now)
+	_, _ = w.Write([]byte("first li"))
+	clock = clock.Add(time.Second)
+	_, _ = w.Write([]byte("ne\nsecond line\nthi"))
+	clock = clock.Add(30 * time.Second)
+	_, _ = w.Write([]byte("rd"))
+	_ = w.Flush()
+	expected := "2019-09-01T12:00:00Z +0.000s first line\n" +
+		"2019-09-01T12:00:01Z +1.000s second line\n" +
+		"2019-09-01T12:00:01Z +1.000s third\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestTimedLineWriterLongLine(t *testing.T) {
+	clock := time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	w := newTimedLineWriter(&buf, "", func() time.Time { return clock })
+	chunk := bytes.Repeat([]byte("x"), 1000)
+	for i := 0; i < 100; i++ {
+		_, _ = w.Write(chunk)
+	}
+	if len(w.line) >= maxTimedLineSize {
+		t.Errorf("buffered %d bytes of a single line", len(w.line))
+	}
+	_ = w.Flush()
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected long line to be split in 2, got %d lines", len(lines))
+	}
+	var total int
+	for _, line := range lines {
+		total += len(line) - len("2019-09-01T12:00:00Z +0.000s ")
+	}
+	if total != 100*1000 {
+		t.Errorf("expected all output to be written, got %d bytes", total)
+	}
+}
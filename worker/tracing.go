@@ -0,0 +1,257 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AttrTraceParent is the result message attribute with the W3C trace context of the task,
+// to correlate the processing of the result with the trace of the task.
+const AttrTraceParent = "traceparent"
+
+// traceServiceName is the service.name resource attribute of the exported spans.
+const traceServiceName = "muskoka-worker"
+
+// tracer records the spans of tasks, and exports the spans of a trace to an OTLP/HTTP collector
+// (JSON encoding) when its root span ends. Exports are best-effort, failures are logged.
+type tracer struct {
+	endpoint string
+	workerID string
+	client   *http.Client
+
+	mu sync.Mutex
+	// ended spans per trace, until the root span of the trace ends
+	ended map[[16]byte][]*span
+}
+
+// span is a timed operation of a task. A nil span is valid, and records nothing.
+type span struct {
+	t        *tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	start    time.Time
+
+	mu    sync.Mutex
+	attrs map[string]string
+	end   time.Time
+	err   string
+}
+
+func (w *Worker) tracer() *tracer {
+	w.tracerOnce.Do(func() {
+		if w.OTLPEndpoint != "" {
+			w.tracerState = &tracer{
+				endpoint: strings.TrimSuffix(w.OTLPEndpoint, "/") + "/v1/traces",
+				workerID: w.WorkerID,
+				client:   &http.Client{Timeout: 10 * time.Second},
+				ended:    make(map[[16]byte][]*span),
+			}
+		}
+	})
+	return w.tracerState
+}
+
+type spanKey struct{}
+
+// startSpan starts a span as child of the span of the context, or as root of a new trace.
+// Returns a nil span if tracing is disabled.
+func (w *Worker) startSpan(ctx context.Context, name string) (context.Context, *span) {
+	t := w.tracer()
+	if t == nil {
+		return ctx, nil
+	}
+	s := &span{t: t, name: name, start: time.Now(), attrs: make(map[string]string)}
+	if parent := spanFromContext(ctx); parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		_, _ = rand.Read(s.traceID[:])
+	}
+	_, _ = rand.Read(s.spanID[:])
+	return contextWithSpan(ctx, s), s
+}
+
+func contextWithSpan(ctx context.Context, s *span) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+func spanFromContext(ctx context.Context) *span {
+	s, _ := ctx.Value(spanKey{}).(*span)
+	return s
+}
+
+// traceParent returns the W3C traceparent header value of the span of the context, or empty if there is none.
+func traceParent(ctx context.Context) string {
+	s := spanFromContext(ctx)
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%x-%x-01", s.traceID, s.spanID)
+}
+
+// set adds an attribute to the span.
+func (s *span) set(key string, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// finish ends the span, with an error status if err is not nil.
+// The trace is exported when its root span is finished.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.mu.Unlock()
+	t := s.t
+	t.mu.Lock()
+	spans := append(t.ended[s.traceID], s)
+	if s.parentID != ([8]byte{}) {
+		t.ended[s.traceID] = spans
+		t.mu.Unlock()
+		return
+	}
+	delete(t.ended, s.traceID)
+	t.mu.Unlock()
+	go func() {
+		if err := t.export(spans); err != nil {
+			log.Printf("failed to export trace %x: %v", s.traceID, err)
+		}
+	}()
+}
+
+// OTLP/JSON encoding of the spans, see https://github.com/open-telemetry/opentelemetry-proto
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	StartTime    string          `json:"startTimeUnixNano"`
+	EndTime      string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusOk         = 1
+	otlpStatusError      = 2
+)
+
+func otlpAttributes(attrs map[string]string) []otlpAttribute {
+	out := make([]otlpAttribute, 0, len(attrs))
+	for k, v := range attrs {
+		out = append(out, otlpAttribute{Key: k, Value: otlpValue{StringValue: v}})
+	}
+	return out
+}
+
+func (s *span) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := otlpSpan{
+		TraceID:    hex.EncodeToString(s.traceID[:]),
+		SpanID:     hex.EncodeToString(s.spanID[:]),
+		Name:       s.name,
+		Kind:       otlpSpanKindInternal,
+		StartTime:  strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTime:    strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes: otlpAttributes(s.attrs),
+		Status:     otlpStatus{Code: otlpStatusOk},
+	}
+	if s.parentID != ([8]byte{}) {
+		out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	if s.err != "" {
+		out.Status = otlpStatus{Code: otlpStatusError, Message: s.err}
+	}
+	return out
+}
+
+// export posts the spans to the collector.
+func (t *tracer) export(spans []*span) error {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: traceServiceName}}
+	for _, s := range spans {
+		scope.Spans = append(scope.Spans, s.otlp())
+	}
+	resource := map[string]string{"service.name": traceServiceName}
+	if t.workerID != "" {
+		resource["service.instance.id"] = t.workerID
+	}
+	data, err := json.Marshal(&otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(resource)},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}})
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded with status %s", resp.Status)
+	}
+	return nil
+}
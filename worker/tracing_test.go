@@ -0,0 +1,58 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskTrace(t *testing.T) {
+	exports := make(chan otlpTraces, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var traces otlpTraces
+		if r.URL.Path != "/v1/traces" || json.NewDecoder(r.Body).Decode(&traces) != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		exports <- traces
+	}))
+	defer collector.Close()
+
+	h := newHarness(t, "", &FakeRunner{OutputFiles: map[string][]byte{"--post": []byte("post")}})
+	defer h.Close()
+	h.worker.OTLPEndpoint = collector.URL
+
+	if !h.process(h.addTask("foo", []byte("pre"))) {
+		t.Fatal("expected task to be acked")
+	}
+	var traces otlpTraces
+	select {
+	case traces = <-exports:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected trace to be exported")
+	}
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	names := make(map[string]otlpSpan)
+	for _, s := range spans {
+		names[s.Name] = s
+		if s.TraceID != spans[0].TraceID {
+			t.Errorf("expected all spans in one trace, got %s and %s", s.TraceID, spans[0].TraceID)
+		}
+	}
+	for _, name := range []string{"task", "download", "client", "execute", "upload", "hash", "publish"} {
+		if _, ok := names[name]; !ok {
+			t.Errorf("missing %s span, got %d spans", name, len(spans))
+		}
+	}
+	if names["task"].ParentSpanID != "" || names["publish"].ParentSpanID != names["client"].SpanID {
+		t.Error("unexpected span hierarchy")
+	}
+
+	attrs := h.queue.PublishedAttributes()
+	if len(attrs) != 1 || !strings.HasPrefix(attrs[0][AttrTraceParent], "00-"+names["task"].TraceID+"-"+names["publish"].SpanID) {
+		t.Errorf("expected trace context of the publish span in the result attributes, got %v", attrs)
+	}
+}
@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Actions for tasks that the worker does not support: of another spec version or config, with too many blocks,
+// or of an unsupported task type.
+const (
+	// ack and drop the task
+	UnsupportedAck = "ack"
+	// publish the task message to the unclaimed topic, and ack it
+	UnsupportedForward = "forward"
+	// nack the task after a delay, so another worker on the same subscription may claim it
+	UnsupportedNack = "nack"
+)
+
+// Attributes of forwarded unsupported task messages, if the unclaimed topic supports attributes.
+const (
+	// why the worker did not process the task
+	AttrUnsupportedReason = "unsupported-reason"
+)
+
+// ValidateUnsupportedAction checks if the action for unsupported tasks is known.
+func ValidateUnsupportedAction(action string) error {
+	switch action {
+	case UnsupportedAck, UnsupportedForward, UnsupportedNack:
+		return nil
+	default:
+		return fmt.Errorf("unknown action for unsupported tasks %q", action)
+	}
+}
+
+// handleUnsupported acks, forwards or nacks the message of a task the worker does not support,
+// as configured by UnsupportedAction. Failures to forward the message nack it instead.
+func (w *Worker) handleUnsupported(ctx context.Context, message *QueueMessage, key string, reason string) {
+	action := w.UnsupportedAction
+	if action == "" {
+		action = UnsupportedAck
+	}
+	log.Printf("WARNING: received unsupported task %s: %s. Action: %s", key, reason, action)
+	switch action {
+	case UnsupportedForward:
+		if err := w.forwardUnsupported(message, reason); err != nil {
+			log.Printf("failed to forward unsupported task %s, nack instead: %v", key, err)
+			w.nack(message)
+			return
+		}
+		message.Ack()
+	case UnsupportedNack:
+		timer := time.NewTimer(w.UnsupportedNackDelay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		w.nack(message)
+	default:
+		message.Ack()
+	}
+}
+
+// forwardUnsupported publishes the original task message to the unclaimed topic, with the reason as attribute if supported.
+func (w *Worker) forwardUnsupported(message *QueueMessage, reason string) error {
+	if w.UnclaimedTopic == nil {
+		return fmt.Errorf("no unclaimed topic configured")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if ap, ok := w.UnclaimedTopic.(AttributePublisher); ok {
+		return ap.PublishWithAttributes(ctx, message.Data, map[string]string{
+			AttrUnsupportedReason: reason,
+			AttrWorkerID:          w.WorkerID,
+		})
+	}
+	return w.UnclaimedTopic.Publish(ctx, message.Data)
+}
@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestForwardUnsupported(t *testing.T) {
+	h := newHarness(t, "", &FakeRunner{})
+	defer h.Close()
+	unclaimed := NewMemQueue(1)
+	h.worker.UnsupportedAction = UnsupportedForward
+	h.worker.UnclaimedTopic = unclaimed
+
+	msg := h.addTask("foo", []byte("pre"))
+	msg.SpecConfig = "mainnet"
+	if !h.process(msg) {
+		t.Fatal("expected forwarded task to be acked")
+	}
+	if len(h.published()) != 0 {
+		t.Error("expected unsupported task to not run")
+	}
+	forwarded := unclaimed.Published()
+	attrs := unclaimed.PublishedAttributes()
+	if len(forwarded) != 1 || attrs[0][AttrUnsupportedReason] == "" {
+		t.Fatalf("expected task to be forwarded with the reason, got %d messages: %v", len(forwarded), attrs)
+	}
+	var got TransitionMsg
+	if err := json.Unmarshal(forwarded[0], &got); err != nil || got.Key != "foo" || got.SpecConfig != "mainnet" {
+		t.Errorf("expected the original task message, got %+v: %v", got, err)
+	}
+}
+
+func TestNackUnsupported(t *testing.T) {
+	h := newHarness(t, "", &FakeRunner{})
+	defer h.Close()
+	h.worker.UnsupportedAction = UnsupportedNack
+	h.worker.UnsupportedNackDelay = 10 * time.Millisecond
+	h.worker.MaxBlocks = 1
+
+	if h.process(h.addTask("foo", []byte("pre"), []byte("block0"), []byte("block1"))) {
+		t.Error("expected task with too many blocks to be nacked")
+	}
+}
@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// uploadProgressInterval is how often the progress of a long running upload is logged.
+const uploadProgressInterval = time.Second * 10
+
+// uploadWatch counts the bytes read by an upload, to log its progress and detect stalls.
+type uploadWatch struct {
+	r io.Reader
+	// read so far, accessed atomically
+	n int64
+	// 1 if the upload was canceled for making no progress, accessed atomically
+	stalled int32
+}
+
+func (u *uploadWatch) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	atomic.AddInt64(&u.n, int64(n))
+	return n, err
+}
+
+func (u *uploadWatch) isStalled() bool {
+	return atomic.LoadInt32(&u.stalled) == 1
+}
+
+// watch logs the progress of the upload every uploadProgressInterval, and cancels the upload
+// if no data was read for the stall timeout (never if 0). It returns when done is closed.
+// Chunked writers read the next chunk only after the previous one is uploaded, so reads track the upload.
+func (u *uploadWatch) watch(bucketpath string, size int64, stallTimeout time.Duration, cancel context.CancelFunc, done <-chan struct{}) {
+	tick := time.Second
+	if stallTimeout > 0 && stallTimeout/2 < tick {
+		tick = stallTimeout / 2
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	start := time.Now()
+	lastLog := start
+	lastN := int64(0)
+	lastProgress := start
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			n := atomic.LoadInt64(&u.n)
+			if n != lastN {
+				lastN = n
+				lastProgress = now
+			} else if stallTimeout > 0 && now.Sub(lastProgress) >= stallTimeout {
+				log.Printf("upload of %s stalled at %d of %d bytes for %s, canceling", bucketpath, n, size, stallTimeout)
+				atomic.StoreInt32(&u.stalled, 1)
+				cancel()
+				return
+			}
+			if now.Sub(lastLog) >= uploadProgressInterval {
+				lastLog = now
+				pct := 100.0
+				if size > 0 {
+					pct = float64(n) * 100 / float64(size)
+				}
+				log.Printf("uploading %s: %d of %d bytes (%.1f%%) in %s", bucketpath, n, size, pct, now.Sub(start).Round(time.Second))
+			}
+		}
+	}
+}
+
+// resultWriter opens a writer for the result object: in chunks of UploadChunkSize if the store supports it,
+// and with a gzip Content-Encoding if the results are compressed. The second return value is the Content-Encoding.
+func (w *Worker) resultWriter(ctx context.Context, results BlobStore, bucketpath string) (io.WriteCloser, string) {
+	encoding := ""
+	es, ok := results.(encodingStore)
+	if ok && w.CompressResults {
+		encoding = "gzip"
+	}
+	if cs, ok := results.(chunkedStore); ok && w.UploadChunkSize > 0 {
+		return cs.NewChunkedWriter(ctx, bucketpath, encoding, w.UploadChunkSize), encoding
+	}
+	if encoding != "" {
+		return es.NewEncodedWriter(ctx, bucketpath, encoding), encoding
+	}
+	return results.NewWriter(ctx, bucketpath), ""
+}
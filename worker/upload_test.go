@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stallingStore accepts the first write of an upload, and then blocks until the upload is canceled.
+type stallingStore struct {
+	*MemStore
+	chunkSizes []int
+}
+
+type stallingWriter struct {
+	ctx     context.Context
+	written int
+}
+
+func (w *stallingWriter) Write(p []byte) (int, error) {
+	if w.written > 0 {
+		<-w.ctx.Done()
+		return 0, w.ctx.Err()
+	}
+	w.written += len(p)
+	return len(p), nil
+}
+
+func (w *stallingWriter) Close() error {
+	return w.ctx.Err()
+}
+
+func (s *stallingStore) NewChunkedWriter(ctx context.Context, name string, contentEncoding string, chunkSize int) io.WriteCloser {
+	s.chunkSizes = append(s.chunkSizes, chunkSize)
+	return &stallingWriter{ctx: ctx}
+}
+
+func TestUploadStall(t *testing.T) {
+	store := &stallingStore{MemStore: NewMemStore("results")}
+	w := &Worker{Config: Config{UploadChunkSize: 1 << 20, UploadStallTimeout: time.Millisecond * 100, StorageAttempts: 2}}
+	start := time.Now()
+	err := w.uploadResult(context.Background(), store, "foo/post.ssz", bytes.NewReader(bytes.Repeat([]byte{1}, 1<<20)))
+	if err == nil || !strings.Contains(err.Error(), "stalled") {
+		t.Fatalf("expected a stalled upload, got %v", err)
+	}
+	if time.Since(start) > time.Second*5 {
+		t.Errorf("stalled upload took too long to cancel: %s", time.Since(start))
+	}
+	if len(store.chunkSizes) != 2 || store.chunkSizes[0] != 1<<20 {
+		t.Errorf("expected 2 chunked attempts, got chunk sizes %v", store.chunkSizes)
+	}
+
+	w.UploadChunkSize = 0
+	if err := w.uploadResult(context.Background(), store, "foo/post.ssz", strings.NewReader("post")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Get("foo/post.ssz"); string(got) != "post" {
+		t.Errorf("expected an upload without chunks, got %q", got)
+	}
+}
+
+func TestUploadCancelled(t *testing.T) {
+	store := &stallingStore{MemStore: NewMemStore("results")}
+	w := &Worker{Config: Config{UploadChunkSize: 1 << 20, UploadStallTimeout: time.Minute, StorageAttempts: 3}}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*50, cancel)
+	start := time.Now()
+	err := w.uploadResult(ctx, store, "foo/post.ssz", bytes.NewReader(bytes.Repeat([]byte{1}, 1<<20)))
+	if err != context.Canceled {
+		t.Fatalf("expected a cancelled upload, got %v", err)
+	}
+	if time.Since(start) > time.Second*5 {
+		t.Errorf("cancelled upload took too long to stop: %s", time.Since(start))
+	}
+	if len(store.chunkSizes) != 1 {
+		t.Errorf("expected a cancelled upload not to be retried, got %d attempts", len(store.chunkSizes))
+	}
+	if err := w.uploadResult(ctx, store, "foo/post.ssz", strings.NewReader("post")); err != context.Canceled {
+		t.Errorf("expected no upload after the task is cancelled, got %v", err)
+	}
+	if _, ok := store.Get("foo/post.ssz"); ok {
+		t.Error("expected no uploaded post state")
+	}
+}
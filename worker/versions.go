@@ -0,0 +1,153 @@
+package worker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// specVersion is a semantic version of the spec, e.g. "v0.8.3". The "v" prefix is optional.
+type specVersion struct {
+	major, minor, patch int
+	// pre-release, e.g. "rc.1" of "v0.9.0-rc.1", empty for a release
+	pre string
+}
+
+func parseSpecVersion(s string) (specVersion, error) {
+	var v specVersion
+	core := strings.TrimPrefix(s, "v")
+	if i := strings.Index(core, "-"); i >= 0 {
+		core, v.pre = core[:i], core[i+1:]
+	}
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("expected a <major>.<minor>.<patch> version, got %q", s)
+	}
+	nums := []*int{&v.major, &v.minor, &v.patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version number %q in %q", p, s)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+// compare returns -1, 0 or 1 if v is lower, equal or higher than o. A pre-release is lower than its release.
+func (v specVersion) compare(o specVersion) int {
+	for _, d := range []int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	case v.pre < o.pre:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// versionConstraint compares a version to a bound, e.g. ">=0.8.3".
+type versionConstraint struct {
+	op    string
+	bound specVersion
+}
+
+var versionOps = []string{">=", "<=", ">", "<", "="}
+
+func parseVersionConstraint(s string) (versionConstraint, error) {
+	c := versionConstraint{op: "="}
+	for _, op := range versionOps {
+		if strings.HasPrefix(s, op) {
+			c.op, s = op, s[len(op):]
+			break
+		}
+	}
+	bound, err := parseSpecVersion(s)
+	if err != nil {
+		return c, err
+	}
+	c.bound = bound
+	return c, nil
+}
+
+func (c versionConstraint) matches(v specVersion) bool {
+	d := v.compare(c.bound)
+	switch c.op {
+	case ">=":
+		return d >= 0
+	case "<=":
+		return d <= 0
+	case ">":
+		return d > 0
+	case "<":
+		return d < 0
+	default:
+		return d == 0
+	}
+}
+
+// versionRange is a flag of a semantic version range: space-separated constraints that must all match,
+// e.g. ">=0.8.3 <0.9.0". Alternative ranges can be separated with "||". The empty range matches nothing.
+type versionRange struct {
+	raw  string
+	sets [][]versionConstraint
+}
+
+func (r *versionRange) String() string {
+	return r.raw
+}
+
+func (r *versionRange) Set(v string) error {
+	*r = versionRange{raw: strings.TrimSpace(v)}
+	if r.raw == "" {
+		return nil
+	}
+	for _, alt := range strings.Split(r.raw, "||") {
+		var set []versionConstraint
+		for _, field := range strings.Fields(alt) {
+			c, err := parseVersionConstraint(field)
+			if err != nil {
+				return err
+			}
+			set = append(set, c)
+		}
+		if len(set) == 0 {
+			return fmt.Errorf("empty alternative in version range %q", r.raw)
+		}
+		r.sets = append(r.sets, set)
+	}
+	return nil
+}
+
+// Contains returns true if the version is in the range. Versions that cannot be parsed are not.
+func (r *versionRange) Contains(version string) bool {
+	v, err := parseSpecVersion(version)
+	if err != nil {
+		return false
+	}
+	for _, set := range r.sets {
+		ok := true
+		for _, c := range set {
+			if !c.matches(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
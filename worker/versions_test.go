@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"testing"
+)
+
+func TestVersionRange(t *testing.T) {
+	var r versionRange
+	if err := r.Set(">=0.8.3 <0.9.0 || =v0.9.1"); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"v0.8.3":       true,
+		"0.8.10":       true,
+		"v0.8.2":       false,
+		"v0.9.0":       false,
+		"v0.9.0-rc.1":  true,
+		"v0.9.1":       true,
+		"v0.9.2":       false,
+		"not-a-semver": false,
+	}
+	for v, expected := range cases {
+		if got := r.Contains(v); got != expected {
+			t.Errorf("%s: expected %v, got %v", v, expected, got)
+		}
+	}
+	for _, invalid := range []string{">=0.8", "~0.8.3", "<0.9.0 ||"} {
+		if err := r.Set(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestSpecVersionRangeTasks(t *testing.T) {
+	h := newHarness(t, "", &FakeRunner{OutputFiles: map[string][]byte{"--post": []byte("post")}})
+	defer h.Close()
+	if err := h.worker.SpecVersions.Set(">=0.8.3 <0.9.0"); err != nil {
+		t.Fatal(err)
+	}
+	msg := h.addTask("foo", []byte("pre"))
+	msg.SpecVersion = "v0.8.4"
+	h.inputs.Put(msg.InputsBucketPathStart()+"/pre.ssz", []byte("pre"))
+	if !h.process(msg) {
+		t.Fatal("expected task to be acked")
+	}
+	if res := h.result(); !res.Success || res.SpecVersion != "v0.8.4" {
+		t.Errorf("expected task in the range to run, with its spec version in the result: %+v", res)
+	}
+
+	other := h.addTask("bar", []byte("pre"))
+	other.SpecVersion = "v0.9.0"
+	if !h.process(other) || len(h.published()) != 1 {
+		t.Error("expected task outside of the range to be acked and dropped")
+	}
+}
@@ -0,0 +1,1247 @@
+package worker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/sync/errgroup"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Config struct {
+	InputsBucket string
+	CliCmd       string
+	// Arguments appended to CliCmd to check if the client responds before consuming tasks. Not invoked if empty.
+	CliPreflightArgs string
+	GCPProjectID     string
+	SpecVersion      string
+	// Also accept tasks of other spec versions in this range, for the spec configs of the targets. Empty if not set.
+	SpecVersions versionRange
+	// The configs to process tasks for, each with their own subscription.
+	SpecConfigs []string
+	// The spec versions and configs to process tasks for, each with their own subscription.
+	// Every spec config of SpecVersion if empty.
+	Targets []Target
+	// Extra CLI arguments per spec config, e.g. to select the preset of the client.
+	ConfigCliArgs map[string]string
+	// The cli cmd per task type, e.g. for epoch processing tasks. Blocks and finality tasks run CliCmd if not set.
+	TaskCliCmds   map[string]string
+	WorkerID      string
+	ClientVersion string
+	ClientName    string
+	ResultsBucket string
+	CleanupTmp    bool
+	// The directory to put the task workspaces in. os.TempDir() if empty.
+	WorkDir string
+	// Tasks are refused (nacked) while the volume of the work dir has less free bytes. Not checked if 0.
+	MinFreeDisk int64
+	// Workspaces in the WorkDir that are not of a running or completed task, and were not modified for this long,
+	// are removed. E.g. left behind by a crashed run. Disabled if 0.
+	OrphanMaxAge time.Duration
+	// Maximum total size of the task work dirs, in bytes. The oldest completed workspaces are removed first. Unlimited if 0.
+	WorkDirQuota int64
+	// Also upload a log with stdout and stderr interleaved.
+	CombinedLog bool
+	// The OTLP/HTTP collector to export task traces to, e.g. http://localhost:4318. Tracing is disabled if empty.
+	OTLPEndpoint string
+	// Check if the inputs decode as a state and blocks of the spec version and config before running the client.
+	// Tasks with invalid inputs get an input-error result instead.
+	ValidateInputs bool
+	// Gzip the uploaded post states and logs, and set their Content-Encoding.
+	// Results are uploaded uncompressed to stores without Content-Encoding support (local dirs).
+	CompressResults bool
+	// Exit codes of the client that mean it rejected the transition, e.g. for an invalid block.
+	// Other failures are reported as client crashes.
+	RejectExitCodes []int
+	// How result files are referenced in result messages: ResultURLsPublic (default), ResultURLsSigned or ResultURLsPath.
+	ResultURLs string
+	// How long signed result URLs are valid, 7 days at most.
+	ResultURLTTL time.Duration
+	// The size of the chunks that results are uploaded in, by stores with resumable or multipart uploads.
+	// The store default if 0.
+	UploadChunkSize int
+	// Cancel and retry an upload if it makes no progress for this long. Never if 0.
+	UploadStallTimeout time.Duration
+	// The encoding of the published result messages: ResultFormatJSON (default) or ResultFormatProto.
+	ResultFormat string
+	// Stream partial logs of transitions running longer than LiveLogAfter, every LiveLogInterval. Disabled if 0.
+	LiveLogAfter    time.Duration
+	LiveLogInterval time.Duration
+	// Kill the client (and its child processes) if a transition runs longer than this. Unlimited if 0.
+	TransitionTimeout time.Duration
+	// The maximum number of attempts of a download or upload, with exponential backoff starting at StorageRetryDelay.
+	// A single attempt if 0.
+	StorageAttempts   int
+	StorageRetryDelay time.Duration
+	// Verify downloaded inputs with the MD5 or CRC32C checksums reported by the inputs store, and retry corrupted downloads.
+	VerifyInputs bool
+	// The maximum number of input files of a task to download at the same time. One at a time if 0.
+	DownloadParallelism int
+	// The maximum number of downloads and uploads at the same time, across all tasks. Unlimited if 0.
+	MaxStorageConcurrency int
+	// The maximum upload bandwidth in bytes per second, shared by all uploads. Unlimited if 0.
+	MaxUploadBps int64
+	// The maximum number of bytes of stdout, and of stderr, to capture of a client run. The rest is discarded. Unlimited if 0.
+	MaxCapturedOutput int64
+	// Directory to cache downloaded input files in, across tasks. Disabled if empty.
+	CacheDir string
+	// Directory to cache client binaries in, by checksum, see ClientArtifact.
+	// Tasks with a client artifact are refused if empty.
+	ArtifactDir string
+	// Upload a bundle to reproduce failed transitions with, see writeReproBundle.
+	ReproBundles bool
+	// Run multi-block transitions block by block, to upload the post state after every block.
+	PerBlockPosts bool
+	// The cli cmd of a reference client to run block transitions with after the client, to upload a diff
+	// of the post states if they differ. Disabled if empty.
+	ReferenceCmd string
+	// Where to read the JSON report of the client about a transition from, to embed in the result: ClientReportStdout or ClientReportFile.
+	// Disabled if empty.
+	ClientReport string
+	// Environment variables of the client command, for every task. Not applied by the server and gRPC runners.
+	ClientEnv map[string]string
+	// Environment variables that tasks may set for the client command, or name prefixes ending with "*". Refused if empty.
+	TaskEnvAllowlist []string
+	// The client build to run every task with, unless the task has its own artifact. The cli cmd or image of the runner if nil.
+	ClientArtifact *ClientArtifact
+	// Maximum total size of the cached input files, in bytes. The least recently used files are evicted first. Unlimited if 0.
+	CacheMaxBytes int64
+	// Tasks with more blocks are ignored. Unlimited if 0.
+	MaxBlocks int
+	// Batch CLI of the client, to run up to BatchSize tasks of the same spec version and config at once, see BatchManifest.
+	// Tasks wait at most BatchWait for a batch to fill up. Tasks run one by one if BatchSize < 2.
+	BatchCliCmd string
+	BatchSize   int
+	BatchWait   time.Duration
+	// The maximum number of tasks to process at the same time, smallest first. Unlimited if 0.
+	Concurrency int
+	// Tasks with at least LargeTaskBlocks blocks are large, and at most MaxLargeTasks of them run at the same time.
+	// Large tasks are not capped separately if LargeTaskBlocks is 0.
+	LargeTaskBlocks int
+	MaxLargeTasks   int
+	// Relative share of the task slots per spec config subscription, when tasks of multiple configs are waiting. 1 by default.
+	ConfigWeights map[string]int
+	// Results buckets, or bucket/prefix paths, that tasks may route their results to. Routing is refused if empty.
+	ResultRoutes []string
+	// Layout of the result files in the results bucket, see ParseResultPathTemplate. DefaultResultPathTemplate if empty.
+	ResultPathTemplate string
+	// Ack action per error class, see ackpolicy.go. Defaults are used for missing classes.
+	AckPolicy map[string]string
+	// Coalesce concurrent deliveries of the same task onto a single execution.
+	DedupDeliveries bool
+	// What to do with tasks of another target, with too many blocks, or of an unsupported type:
+	// UnsupportedAck (default), UnsupportedForward or UnsupportedNack, after the UnsupportedNackDelay.
+	UnsupportedAction    string
+	UnsupportedNackDelay time.Duration
+	// How Pub/Sub subscriptions receive task messages.
+	PubsubReceive PubsubReceiveSettings
+	// A file to record completed tasks in. Deliveries of a task completed within the DedupWindow,
+	// with the same client version, are acked without running it again. Disabled if empty.
+	DedupLedger string
+	DedupWindow time.Duration
+	// A directory to spool result messages in that failed to publish, after their result files were uploaded.
+	// Spooled results are retried with backoff, also after a restart. Disabled if empty.
+	ResultSpool string
+
+	// Canary task, re-run every CanaryInterval to detect drift. Disabled if the key is empty.
+	CanaryKey      string
+	CanaryBlocks   int
+	CanaryPostHash string
+	CanaryInterval time.Duration
+
+	// How often to publish a heartbeat to the heartbeat topic.
+	HeartbeatInterval time.Duration
+
+	// Directory to journal running tasks in, to recover them after a crash. Disabled if empty.
+	JournalDir string
+	// How to recover interrupted tasks: RecoverReport or RecoverRerun.
+	RecoverMode string
+	// File to persist rolling task statistics in. Kept in memory only if empty.
+	StatsFile string
+
+	// Directory with a golden vector to check the client with before consuming tasks. Disabled if empty.
+	SelfTestDir string
+}
+
+type Worker struct {
+	Config
+	Inputs  BlobStore
+	Results BlobStore
+	Queue   TaskQueue
+	Runner  CommandRunner
+	// Clock tells the time of cancellations, the task ledger, heartbeats and result bookkeeping. The system clock if nil.
+	Clock Clock
+	// Builder builds the client command of a task. The cli cmd with --pre and --post flags if nil.
+	Builder CommandBuilder
+	// ExtraClients run every task too, after the client of the worker. Optional.
+	ExtraClients []ExtraClient
+	// SigningKey signs the published result messages, see publishResult. Results are not signed if nil.
+	SigningKey ed25519.PrivateKey
+	// StatusTopic receives progress events of tasks. Optional.
+	StatusTopic Publisher
+	// HeartbeatTopic receives a heartbeat of the worker every HeartbeatInterval. Optional.
+	HeartbeatTopic Publisher
+	// QuarantineTopic receives the messages of failed tasks, with the quarantine ack action. Optional.
+	QuarantineTopic Publisher
+	// UnclaimedTopic receives the messages of unsupported tasks, with the forward action for unsupported tasks. Optional.
+	UnclaimedTopic Publisher
+	// MirrorStore and MirrorTopic receive copies of the results and result messages, best-effort. Optional.
+	MirrorStore BlobStore
+	MirrorTopic Publisher
+	// Exporter appends every published result to a local file. Optional.
+	Exporter *ResultExporter
+	// DivergenceTopic receives alerts of post hashes that disagree with the consensus of other clients. Optional.
+	DivergenceTopic Publisher
+	// OpenStore opens the store of a bucket, when the dynamic config changes buckets. Optional.
+	OpenStore func(bucketName string) BlobStore
+	// TreeHasher returns the hasher for the hash-tree-root of states of the spec version and config,
+	// or nil if not supported. Optional.
+	TreeHasher func(specVersion string, specConfig string) StateHasher
+	// OpenInputs opens the store of an inputs bucket, e.g. with fallback buckets. OpenStore is used if nil.
+	OpenInputs func(bucketName string) BlobStore
+	// OpenResults opens the store of a results bucket, e.g. with tenant credentials. OpenStore is used if nil.
+	OpenResults func(bucketName string) BlobStore
+
+	// mu guards the config and stores that can change at runtime.
+	mu            sync.RWMutex
+	configUpdates []ConfigUpdate
+	// the issued-at time of the last accepted control message
+	lastControl time.Time
+
+	// tasksMu guards the in-flight, cancelled and coalesced tasks.
+	tasksMu    sync.Mutex
+	inflight   map[string]*inflightTask
+	cancelled  map[string]time.Time
+	executions map[string]*taskExecution
+	// failures per task key, for nack backoff
+	failures map[string]int
+
+	schedulerOnce sync.Once
+	scheduler     *taskScheduler
+
+	janitorOnce  sync.Once
+	janitorState *janitor
+
+	consensusOnce  sync.Once
+	consensusState *consensusCache
+
+	statsOnce  sync.Once
+	statsState *statsStore
+
+	mirrorOnce  sync.Once
+	mirrorState *mirrorQueue
+
+	metricsOnce  sync.Once
+	metricsState *workerMetrics
+
+	cacheOnce  sync.Once
+	cacheState *inputCache
+
+	heartbeatOnce  sync.Once
+	heartbeatState *heartbeatState
+
+	batchOnce  sync.Once
+	batchState *taskBatcher
+
+	tracerOnce  sync.Once
+	tracerState *tracer
+
+	storageLimitsOnce  sync.Once
+	storageLimitsState *storageLimiter
+
+	ledgerOnce  sync.Once
+	ledgerState *taskLedger
+	spoolOnce   sync.Once
+	spoolState  *resultSpool
+
+	resultPathsOnce  sync.Once
+	resultPathsState *ResultPathLayout
+
+	// pauseMu guards the pause state. While paused, no tasks are received.
+	pauseMu     sync.Mutex
+	paused      bool
+	pausedSince time.Time
+	// closed on resume
+	resumed chan struct{}
+	// stops receiving tasks, to pause
+	stopReceive context.CancelFunc
+	// the number of received messages that are being handled, including tasks waiting for a task slot
+	handling int32
+}
+
+// Run processes tasks from the queue, until ctx is canceled or the queue fails.
+// While the worker is paused, no tasks are received.
+func (w *Worker) Run(ctx context.Context) error {
+	go w.RunJanitor(ctx)
+	if w.ResultSpool != "" {
+		go w.RunResultSpool(ctx)
+	}
+	if w.mirrorEnabled() {
+		go w.RunMirror(ctx)
+	}
+	if w.HeartbeatTopic != nil && w.HeartbeatInterval > 0 {
+		go w.RunHeartbeat(ctx)
+	}
+	for {
+		w.pauseMu.Lock()
+		if w.paused {
+			resumed := w.resumed
+			w.pauseMu.Unlock()
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-resumed:
+			}
+			continue
+		}
+		receiveCtx, stop := context.WithCancel(ctx)
+		w.stopReceive = stop
+		w.pauseMu.Unlock()
+		// tasks run with the worker context, so they continue when receiving stops to pause
+		err := w.Queue.Receive(receiveCtx, func(_ context.Context, message *QueueMessage) {
+			atomic.AddInt32(&w.handling, 1)
+			defer atomic.AddInt32(&w.handling, -1)
+			w.handleMessage(ctx, message)
+		})
+		paused := ctx.Err() == nil && receiveCtx.Err() != nil
+		stop()
+		if !paused {
+			return err
+		}
+	}
+}
+
+func (w *Worker) handleMessage(ctx context.Context, message *QueueMessage) {
+	if reason := w.attributeMismatch(message.Attributes); reason != "" {
+		w.handleUnsupported(ctx, message, "(not decoded)", reason)
+		return
+	}
+	var transitionMsg TransitionMsg
+	dec := json.NewDecoder(bytes.NewReader(message.Data))
+	if err := dec.Decode(&transitionMsg); err != nil {
+		log.Printf("failed to decode message JSON: %v (msg: %s)", err, message.Data)
+		w.handleFailure(ctx, message, "", &taskError{class: ErrorClassMalformed, err: err})
+		return
+	}
+	transitionMsg.Urgent = message.urgent
+	if !w.supportsTarget(transitionMsg.SpecVersion, transitionMsg.SpecConfig) {
+		w.handleUnsupported(ctx, message, transitionMsg.Key, fmt.Sprintf("target %s/%s, but was expecting one of %s", transitionMsg.SpecVersion, transitionMsg.SpecConfig, strings.Join(w.targetNames(), ", ")))
+		return
+	}
+	if w.MaxBlocks > 0 && transitionMsg.Blocks > w.MaxBlocks {
+		w.handleUnsupported(ctx, message, transitionMsg.Key, fmt.Sprintf("%d blocks, but only up to %d are supported", transitionMsg.Blocks, w.MaxBlocks))
+		return
+	}
+	if err := w.checkTaskType(&transitionMsg); err != nil {
+		w.handleUnsupported(ctx, message, transitionMsg.Key, fmt.Sprintf("unsupported task type: %v", err))
+		return
+	}
+	if err := w.checkClientArtifact(&transitionMsg); err != nil {
+		w.handleUnsupported(ctx, message, transitionMsg.Key, fmt.Sprintf("unsupported client artifact: %v", err))
+		return
+	}
+	if err := w.checkTaskEnv(&transitionMsg); err != nil {
+		w.handleUnsupported(ctx, message, transitionMsg.Key, fmt.Sprintf("unsupported client environment: %v", err))
+		return
+	}
+	if err := w.checkResultRoute(&transitionMsg); err != nil {
+		w.handleUnsupported(ctx, message, transitionMsg.Key, fmt.Sprintf("unsupported results route: %v", err))
+		return
+	}
+	if w.taskCancelled(&transitionMsg) {
+		log.Printf("received cancelled task %s (campaign: %q). Ack, but ignoring actual task.", transitionMsg.Key, transitionMsg.Campaign)
+		message.Ack()
+		return
+	}
+	if l := w.ledger(); l != nil {
+		if prev := l.completed(w.ledgerEntryOf(&transitionMsg), transitionMsg.Checksums, w.now()); prev != nil {
+			log.Printf("received duplicate of task %s, completed at %s. Ack, but ignoring actual task.", transitionMsg.Key, prev.Completed)
+			message.Ack()
+			return
+		}
+	}
+	var err error
+	if w.DedupDeliveries {
+		err = w.coalesceTask(ctx, &transitionMsg, func() error {
+			return w.processTask(ctx, &transitionMsg)
+		})
+	} else {
+		err = w.processTask(ctx, &transitionMsg)
+	}
+	w.heartbeat().recordTask(err)
+	if err != nil {
+		w.handleFailure(ctx, message, transitionMsg.Key, err)
+		return
+	}
+	w.resetFailures(transitionMsg.Key)
+	// tasks with inputs that failed to download may succeed when redelivered
+	if l := w.ledger(); l != nil && transitionMsg.InputError == "" {
+		l.record(w.ledgerEntryOf(&transitionMsg), w.now())
+	}
+	message.Ack()
+}
+
+// processTask runs the task. The task message should be acked if no error is returned,
+// see handleFailure for errors.
+func (w *Worker) processTask(ctx context.Context, transitionMsg *TransitionMsg) (err error) {
+	// Give the message a unique ID. Allow for processing of the same message in parallel
+	// (if event is fired multiple times, or different workers are processing it on the same host).
+	transitionMsg.ResultKey = uniqueID()
+	transitionMsg.WorkDir = w.workDir()
+	ctx, taskSpan := w.startSpan(ctx, "task")
+	taskSpan.set("task.key", transitionMsg.Key)
+	taskSpan.set("task.result_key", transitionMsg.ResultKey)
+	taskSpan.set("task.type", transitionMsg.TaskType())
+	taskSpan.set("task.spec_version", transitionMsg.SpecVersion)
+	taskSpan.set("task.spec_config", transitionMsg.SpecConfig)
+	if transitionMsg.Urgent {
+		taskSpan.set("task.urgent", "true")
+	}
+	defer func() { taskSpan.finish(err) }()
+	if s := w.taskScheduler(); s != nil {
+		release, err := s.acquire(ctx, transitionMsg.SpecConfig, transitionMsg.Blocks, transitionMsg.Urgent)
+		if err != nil {
+			return fmt.Errorf("stopped waiting to process: %v", err)
+		}
+		defer release()
+	}
+	if err := w.checkFreeDisk(); err != nil {
+		return fmt.Errorf("refusing task %s: %v", transitionMsg.Key, err)
+	}
+	ctx, done := w.trackTask(ctx, transitionMsg)
+	defer done()
+	w.journalStart(transitionMsg)
+	defer w.journalDone(transitionMsg)
+	log.Printf("processing %s (%s)", transitionMsg.Key, transitionMsg.SpecVersion)
+	w.progress(transitionMsg, PhaseDownloading)
+	downloadCtx, downloadSpan := w.startSpan(ctx, "download")
+	err = w.LoadFromBucket(downloadCtx, transitionMsg)
+	if err == nil {
+		err = w.provisionClientArtifact(downloadCtx, transitionMsg)
+	}
+	downloadSpan.finish(err)
+	if err != nil {
+		if w.taskCancelled(transitionMsg) {
+			log.Printf("cancelled task %s while downloading. Ack.", transitionMsg.Key)
+			w.cleanup(transitionMsg)
+			return nil
+		}
+		if ctx.Err() != nil {
+			w.cleanup(transitionMsg)
+			return err
+		}
+		if w.ackAction(ErrorClassInfra) != ActionResult {
+			w.cleanup(transitionMsg)
+			return &taskError{class: ErrorClassInfra, err: fmt.Errorf("failed to load data from bucket: %v", err)}
+		}
+		log.Printf("failed to load inputs of task %s, publishing the failure as result: %v", transitionMsg.Key, err)
+		transitionMsg.InputError = err.Error()
+	} else if w.ValidateInputs {
+		if err := checkInputs(transitionMsg); err != nil {
+			log.Printf("invalid inputs of task %s: %v", transitionMsg.Key, err)
+			transitionMsg.InputError = err.Error()
+		}
+	}
+	if err := w.Execute(ctx, transitionMsg); err == errTaskCancelled {
+		log.Printf("cancelled task %s while executing. Ack.", transitionMsg.Key)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	log.Printf("successfully processed transition: %s (%s)", transitionMsg.Key, transitionMsg.SpecVersion)
+	w.progress(transitionMsg, PhaseDone)
+	return nil
+}
+
+// LoadFromBucket downloads the inputs of the task to its workspace, and sets the hashes of the inputs on the task.
+// Up to DownloadParallelism files are downloaded at the same time. The first failure cancels the other downloads.
+func (w *Worker) LoadFromBucket(ctx context.Context, tr *TransitionMsg) error {
+	startFilepath := tr.DirPath()
+	if err := os.MkdirAll(startFilepath, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to make directory to download files to: %s: %v", startFilepath, err)
+	}
+	startBucketPath := tr.InputsBucketPathStart()
+	names := append([]string{"pre.ssz"}, tr.InputFiles()...)
+	fileHashes := make([]string, len(names))
+	parallelism := w.DownloadParallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	slots := make(chan struct{}, parallelism)
+	g, gctx := errgroup.WithContext(ctx)
+	for i, name := range names {
+		i, name := i, name
+		g.Go(func() error {
+			select {
+			case slots <- struct{}{}:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			defer func() { <-slots }()
+			hash, err := w.downloadInputFile(gctx, filepath.Join(startFilepath, name), startBucketPath+"/"+name)
+			if err != nil {
+				return fmt.Errorf("failed to load %s for spec version %s task %s: %v", name, tr.SpecVersion, tr.Key, err)
+			}
+			fileHashes[i] = fmt.Sprintf("0x%x", hash)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	tr.Inputs = &InputHashes{Pre: fileHashes[0], Blocks: fileHashes[1:]}
+	if err := verifyInputHashes(tr); err != nil {
+		return fmt.Errorf("inputs of spec version %s task %s do not match the task: %v", tr.SpecVersion, tr.Key, err)
+	}
+	return nil
+}
+
+// transitionOutput is the outcome of running the transition CLI on a loaded task.
+// The output of the client is streamed to log files in the workspace of the task, not kept in memory.
+type transitionOutput struct {
+	Success bool
+	// if the client was killed because it ran longer than the transition timeout
+	TimedOut bool
+	// the resource limit the client was killed for, if any
+	ResourceExceeded string
+	// if the client rejected the transition, see Worker.rejectsTransition
+	Rejected bool
+	// if the client exited successfully, without writing a post state
+	MissingPost bool
+	// if the results could not be uploaded
+	UploadFailed bool
+	// why the inputs failed to download or are invalid, if the client did not run because of it
+	InputError string
+	// the exit code of the client, -1 if it did not exit by itself, and the signal that killed it, if any
+	ExitCode int
+	Signal   string
+	// the exit info file in the output dir, empty if the client did not run
+	ExitFile string
+	// how long the client ran
+	Duration time.Duration
+	// the CPU time and memory used by the client, nil if unknown
+	Usage *ResourceUsage
+	// log file paths
+	Stdout string
+	Stderr string
+	// the same output, with a timestamp per line
+	StdoutTimed string
+	StderrTimed string
+	// stdout and stderr, interleaved in order of arrival. Empty if not enabled.
+	Combined string
+	// the diff of the post state with the reference client, empty if none
+	PostDiff string
+	// the intermediate post states after every block but the last, and their flat-hashes, see runPerBlock
+	BlockPosts      []string
+	BlockPostHashes []string
+	// the client command that ran, and its extra environment variables. Empty for batches.
+	Command []string
+	Env     []string
+	// the repro bundle of a failed transition, empty if none, see writeReproBundle
+	Repro string
+}
+
+// ResourceUsage returns the ResultMsg usage of the transition: the duration, and the CPU time and memory if known.
+func (out *transitionOutput) ResourceUsage() *ResourceUsage {
+	usage := ResourceUsage{}
+	if out.Usage != nil {
+		usage = *out.Usage
+	}
+	usage.DurationMs = int64(out.Duration / time.Millisecond)
+	return &usage
+}
+
+// Status returns the ResultMsg status of the transition.
+func (out *transitionOutput) Status() string {
+	switch {
+	case out.InputError != "":
+		return StatusInputError
+	case out.UploadFailed:
+		return StatusUploadFailed
+	case out.TimedOut:
+		return StatusTimeout
+	case out.ResourceExceeded != "":
+		return StatusResourceExceeded
+	case out.Rejected:
+		return StatusTransitionRejected
+	case out.MissingPost:
+		return StatusMissingPost
+	case out.Success:
+		return StatusSuccess
+	default:
+		return StatusClientCrash
+	}
+}
+
+// logTailSize is the maximum amount of client output to print in the worker log, per stream.
+const logTailSize = 2048
+
+// runTransition runs the CLI of the client on the downloaded task inputs. See hashPostState to hash the output.
+// The outputs are written to the output dir of the client.
+// If a live log target is given, the output of long-running transitions is streamed to it.
+func (w *Worker) runTransition(ctx context.Context, tr *TransitionMsg, c *taskClient, live *liveLogTarget) (*transitionOutput, error) {
+	transitionDirPath := tr.DirPath()
+	outDir := c.outDir(tr)
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to make output directory %s: %v", outDir, err)
+	}
+	cliCmd := w.taskCliCmd(tr, c)
+	if c.binary != "" {
+		var err error
+		if cliCmd, err = withProgram(cliCmd, c.binary); err != nil {
+			return nil, fmt.Errorf("invalid cli cmd: %v", err)
+		}
+	}
+	inv := &Invocation{
+		CliCmd:      cliCmd,
+		ConfigArgs:  w.ConfigCliArgs[tr.SpecConfig],
+		SpecVersion: tr.SpecVersion,
+		SpecConfig:  tr.SpecConfig,
+		Key:         tr.Key,
+		Type:        tr.TaskType(),
+		Operation:   tr.Operation,
+		Slots:       tr.Slots,
+		Dir:         transitionDirPath,
+		Pre:         filepath.Join(transitionDirPath, "pre.ssz"),
+		Post:        filepath.Join(outDir, "post.ssz"),
+		Report:      filepath.Join(outDir, clientReportName),
+	}
+	for _, name := range tr.InputFiles() {
+		inv.Inputs = append(inv.Inputs, filepath.Join(transitionDirPath, name))
+	}
+	if tr.isBlockTransition() {
+		inv.Blocks = inv.Inputs
+	}
+	if w.runsPerBlock(tr) {
+		return w.runPerBlock(ctx, tr, c, inv, live)
+	}
+	return w.runInvocation(ctx, tr, c, inv, outDir, live)
+}
+
+// runInvocation runs the client command of the invocation, with its outputs logged to files in the output dir.
+func (w *Worker) runInvocation(ctx context.Context, tr *TransitionMsg, c *taskClient, inv *Invocation, outDir string, live *liveLogTarget) (*transitionOutput, error) {
+	spec, err := w.commandBuilder().Build(inv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build client command: %v", err)
+	}
+	// custom builders may not use the cli cmd
+	if c.binary != "" {
+		spec.Name = c.binary
+	}
+	spec.Image = c.image
+	spec.Env = w.clientEnv(spec.Env, tr.Env)
+	out, err := w.runClientCommand(ctx, spec, inv.Dir, inv, outDir, w.transitionTimeout(), live)
+	if err != nil {
+		return nil, err
+	}
+	out.Command = append([]string{spec.Name}, spec.Args...)
+	out.Env = spec.Env
+	log.Printf("%s\nout (tail):\n%s\nerr (tail):\n%s\n", tr.Key, readTail(out.Stdout, logTailSize), readTail(out.Stderr, logTailSize))
+	return out, nil
+}
+
+// runClientCommand runs the client command in the work dir, with its output logged to files in the output dir.
+// The task is the transition the command runs, if it runs a single one.
+// The command is killed after the timeout, unlimited if 0.
+// If a live log target is given, the output of the long-running transition of the task is streamed to it.
+func (w *Worker) runClientCommand(ctx context.Context, spec CommandSpec, workDir string, task *Invocation, outDir string, timeout time.Duration, live *liveLogTarget) (*transitionOutput, error) {
+	out := transitionOutput{
+		Stdout:      filepath.Join(outDir, "stdout.log"),
+		Stderr:      filepath.Join(outDir, "stderr.log"),
+		StdoutTimed: filepath.Join(outDir, "stdout_timed.log"),
+		StderrTimed: filepath.Join(outDir, "stderr_timed.log"),
+	}
+	if w.CombinedLog {
+		out.Combined = filepath.Join(outDir, "combined.log")
+	}
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	create := func(p string) (io.Writer, error) {
+		f, err := os.Create(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create log file: %v", err)
+		}
+		files = append(files, f)
+		return f, nil
+	}
+	var stdin io.Reader
+	if spec.Stdin != "" {
+		f, err := os.Open(spec.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open stdin file: %v", err)
+		}
+		files = append(files, f)
+		stdin = f
+	}
+	stdoutF, err := create(out.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	stderrF, err := create(out.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	stdoutTimedF, err := create(out.StdoutTimed)
+	if err != nil {
+		return nil, err
+	}
+	stderrTimedF, err := create(out.StderrTimed)
+	if err != nil {
+		return nil, err
+	}
+	stdoutTimed := newTimedLineWriter(stdoutTimedF, "", time.Now)
+	stderrTimed := newTimedLineWriter(stderrTimedF, "", time.Now)
+	stdout := io.MultiWriter(stdoutF, stdoutTimed)
+	stderr := io.MultiWriter(stderrF, stderrTimed)
+	flush := []*timedLineWriter{stdoutTimed, stderrTimed}
+	if out.Combined != "" {
+		combinedF, err := create(out.Combined)
+		if err != nil {
+			return nil, err
+		}
+		combined := &syncWriter{out: combinedF}
+		stdoutCombined := newTimedLineWriter(combined, "out| ", time.Now)
+		stderrCombined := newTimedLineWriter(combined, "err| ", time.Now)
+		stdout = io.MultiWriter(stdout, stdoutCombined)
+		stderr = io.MultiWriter(stderr, stderrCombined)
+		flush = append(flush, stdoutCombined, stderrCombined)
+	}
+	stdoutCapped := capOutput(stdout, w.MaxCapturedOutput)
+	stderrCapped := capOutput(stderr, w.MaxCapturedOutput)
+	stdoutSync := &syncWriter{out: stdoutCapped}
+	stderrSync := &syncWriter{out: stderrCapped}
+	stopLive := func() {}
+	if task != nil && live != nil && w.LiveLogAfter > 0 {
+		stopLive = w.streamLiveLogs(ctx, task.Key, live, stdoutSync, out.Stdout, stderrSync, out.Stderr)
+	}
+	runCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	res, err := w.Runner.Run(runCtx, Command{
+		Name:    spec.Name,
+		Args:    spec.Args,
+		Env:     spec.Env,
+		Image:   spec.Image,
+		Stdin:   stdin,
+		WorkDir: workDir,
+		Stdout:  stdoutSync,
+		Stderr:  stderrSync,
+		Task:    task,
+	})
+	out.Duration = time.Since(start)
+	out.Usage = res.Usage
+	out.ExitCode = res.ExitCode
+	out.Signal = res.Signal
+	stopLive()
+	for _, tw := range flush {
+		_ = tw.Flush()
+	}
+	for name, cw := range map[string]io.Writer{"stdout": stdoutCapped, "stderr": stderrCapped} {
+		if c, ok := cw.(*cappedWriter); ok && c.Truncated() {
+			log.Printf("WARNING: truncated %s of transition command after %d bytes", name, w.MaxCapturedOutput)
+		}
+	}
+	// continue with whatever results the command was able to generate.
+	// May be the client resorting to an error-code because of a failed transition, which we still like to upload.
+	out.Success = true
+	if runCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		log.Printf("transition command timed out after %s, killed it", timeout)
+		out.Success = false
+		out.TimedOut = true
+	} else if err != nil {
+		log.Printf("transition command failed: %v", err)
+		out.Success = false
+	} else if res.ResourceExceeded != "" {
+		log.Printf("transition command exceeded the %s limit", res.ResourceExceeded)
+		out.Success = false
+		out.ResourceExceeded = res.ResourceExceeded
+	} else if res.ExitCode != 0 {
+		log.Printf("transition command exited with code %d", res.ExitCode)
+		out.Success = false
+		out.Rejected = w.rejectsTransition(res.ExitCode)
+	}
+	return &out, nil
+}
+
+// readTail reads up to the last n bytes of the file. Errors are returned as text, it is only used for logging.
+func readTail(p string, n int64) string {
+	f, err := os.Open(p)
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	prefix := ""
+	if size := info.Size(); size > n {
+		if _, err := f.Seek(size-n, io.SeekStart); err != nil {
+			return fmt.Sprintf("<%v>", err)
+		}
+		prefix = fmt.Sprintf("<%d bytes omitted>...", size-n)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return prefix + string(data)
+}
+
+// Execute runs the transition with every client, uploads the results and publishes the result messages.
+// If a client fails, the remaining clients still run, and the first error is returned.
+// If the task is cancelled while running, errTaskCancelled is returned, and no more results are uploaded.
+func (w *Worker) Execute(ctx context.Context, tr *TransitionMsg) error {
+	defer w.cleanup(tr)
+	results, err := w.resultsFor(tr)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, c := range w.taskClients() {
+		// extra clients only have a cli cmd for block transitions
+		if c.subDir != "" && !tr.isBlockTransition() {
+			continue
+		}
+		c = w.withClientArtifact(tr, c)
+		clientCtx, clientSpan := w.startSpan(ctx, "client")
+		clientSpan.set("client.name", c.name)
+		clientSpan.set("client.version", c.version)
+		err := w.executeClient(clientCtx, tr, c, results)
+		clientSpan.finish(err)
+		if err == errTaskCancelled {
+			return err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return firstErr
+}
+
+// executeClient runs the transition with the client, uploads the results and publishes the result message of the client.
+func (w *Worker) executeClient(ctx context.Context, tr *TransitionMsg, c *taskClient, results BlobStore) error {
+	log.Printf("executing request: %s (%s, %d inputs, spec version %s, client %s)\n", tr.Key, tr.TaskType(), len(tr.InputFiles()), tr.SpecVersion, c.name)
+	outDir := c.outDir(tr)
+	resultFiles := w.resultFilePaths(tr, c)
+	w.progress(tr, PhaseExecuting)
+	var out *transitionOutput
+	var err error
+	_, execSpan := w.startSpan(ctx, "execute")
+	if tr.InputError != "" {
+		out, err = w.inputErrorOutput(tr, outDir)
+	} else if c.subDir == "" && c.binary == "" && c.image == "" && len(tr.Env) == 0 && !w.runsPerBlock(tr) && w.batchEnabled() && tr.isBlockTransition() {
+		// only the client of the worker has a batch CLI, artifacts and environments of tasks run on their own
+		out, err = w.runBatched(ctx, tr, c)
+	} else {
+		out, err = w.runTransition(ctx, tr, c, &liveLogTarget{store: results, files: resultFiles})
+	}
+	if out != nil {
+		execSpan.set("client.exit_code", strconv.Itoa(out.ExitCode))
+	}
+	execSpan.finish(err)
+	if w.taskCancelled(tr) {
+		return errTaskCancelled
+	}
+	if err != nil {
+		return err
+	}
+	if out.Success {
+		if _, err := os.Stat(filepath.Join(outDir, "post.ssz")); os.IsNotExist(err) {
+			log.Printf("transition command of %s exited successfully, but wrote no post state", tr.Key)
+			out.Success = false
+			out.MissingPost = true
+		}
+	}
+	if w.runsPerBlock(tr) && out.InputError == "" {
+		if out.BlockPosts, out.BlockPostHashes, err = blockPostStates(tr, outDir); err != nil {
+			return err
+		}
+		for i := range out.BlockPosts {
+			resultFiles.BlockPostStates = append(resultFiles.BlockPostStates, path.Join(path.Dir(resultFiles.PostState), blockPostName(i)))
+		}
+	}
+	if out.Success && c.subDir == "" && w.ReferenceCmd != "" && tr.isBlockTransition() {
+		out.PostDiff = w.compareWithReference(ctx, tr, c)
+	}
+	if err := writeExitInfo(out, outDir); err != nil {
+		return err
+	}
+	if out.ExitFile == "" {
+		// the client did not run, there is no exit info to reference
+		resultFiles.ExitInfo = ""
+	}
+	if out.PostDiff == "" {
+		resultFiles.PostDiff = ""
+	}
+	// input errors are not a failure of the client
+	if !out.Success && out.InputError == "" && ctx.Err() == nil && w.ackAction(ErrorClassClient) != ActionResult {
+		return &taskError{class: ErrorClassClient, err: fmt.Errorf("transition failed: %s", readTail(out.Stderr, 200))}
+	}
+	if w.ReproBundles && !out.Success && out.InputError == "" {
+		if out.Repro, err = w.writeReproBundle(tr, c, out); err != nil {
+			log.Printf("failed to write repro bundle of %s: %v", tr.Key, err)
+			out.Repro = ""
+		}
+	}
+	if out.Repro == "" {
+		resultFiles.Repro = ""
+	}
+
+	// upload results, hashing the post state while uploading it.
+	// The task is only acked after all results are uploaded and the result message is published.
+	w.progress(tr, PhaseUploading)
+	hasher := w.newPostHasher(tr)
+	_, uploadSpan := w.startSpan(ctx, "upload")
+	uploaded, err := w.uploadResults(ctx, results, resultFiles, out, outDir, hasher)
+	uploadSpan.finish(err)
+	if err != nil && ctx.Err() != nil {
+		// the task is being stopped: nack it, without publishing the partial upload as result
+		return fmt.Errorf("upload of results of %s was cancelled: %v", tr.Key, err)
+	}
+	if err != nil {
+		if w.ackAction(ErrorClassInfra) != ActionResult {
+			return &taskError{class: ErrorClassInfra, err: fmt.Errorf("failed to upload results: %v", err)}
+		}
+		log.Printf("failed to upload results of %s, publishing the failure as result: %v", tr.Key, err)
+		out.Success = false
+		out.UploadFailed = true
+	}
+
+	_, hashSpan := w.startSpan(ctx, "hash")
+	post := hasher.sum()
+	hashSpan.finish(nil)
+	postHash := fmt.Sprintf("0x%x", post.Flat)
+	consensus, expected := w.consensus().Check(tr.Key, c.name, postHash)
+	var finality *FinalityInfo
+	if tr.TaskType() == TaskTypeFinality && out.Success {
+		finality, err = readFinality(tr.SpecVersion, tr.SpecConfig, filepath.Join(outDir, "post.ssz"))
+		if err != nil {
+			log.Printf("failed to read finality of post state of %s: %v", tr.Key, err)
+		}
+	}
+	matches := w.matchesExpected(ctx, tr, post)
+	urls, err := w.resultURLs(resultFiles, results)
+	if err != nil {
+		return &taskError{class: ErrorClassInfra, err: err}
+	}
+	reqMsg := ResultMsg{
+		Success:         out.Success,
+		Status:          out.Status(),
+		Exceeded:        out.ResourceExceeded,
+		PostHash:        postHash,
+		ClientName:      c.name,
+		ClientVersion:   c.version,
+		Key:             tr.Key,
+		SpecVersion:     tr.SpecVersion,
+		SpecConfig:      tr.SpecConfig,
+		PostRoot:        optionalRoot(post.Root),
+		Consensus:       consensus,
+		MatchesExpected: matches,
+		Finality:        finality,
+		Usage:           out.ResourceUsage(),
+		Exit:            out.ExitInfo(),
+		Inputs:          tr.Inputs,
+		BlockPostHashes: out.BlockPostHashes,
+		ClientReport:    w.readClientReport(tr, out, outDir),
+		Files:           urls,
+	}
+	data, err := w.encodeResult(&reqMsg)
+	if err != nil {
+		return err
+	}
+	publishSpanCtx, publishSpan := w.startSpan(ctx, "publish")
+	publishSpan.set("result.status", reqMsg.Status)
+	// the result is published even if the task is being stopped, but the trace context is kept
+	publishCtx, cancel := context.WithTimeout(contextWithSpan(context.Background(), spanFromContext(publishSpanCtx)), time.Second*5)
+	err = w.publishResult(publishCtx, c.results, data)
+	cancel()
+	publishSpan.finish(err)
+	if err != nil && w.ResultSpool != "" {
+		// the result files are uploaded, keep the result to publish later, instead of running the task again
+		if spoolErr := w.spoolResult(c, tr.Key, data); spoolErr != nil {
+			log.Printf("failed to spool result of %s: %v", tr.Key, spoolErr)
+		} else {
+			log.Printf("failed to publish result of %s, spooled it to retry later: %v", tr.Key, err)
+			err = nil
+		}
+	}
+	if err != nil {
+		return &taskError{class: ErrorClassInfra, err: fmt.Errorf("failed to publish result: %v", err)}
+	}
+
+	w.mirrorResult(tr.Key, results, uploaded, data)
+	if consensus == ConsensusDisagrees {
+		w.alertDivergence(tr, postHash, expected)
+	}
+	if out.Success {
+		w.consensus().Observe(tr.Key, c.name, postHash)
+	}
+	w.metrics().observeTransition(out)
+	w.stats().Record(tr, out.Success, consensus == ConsensusDisagrees, out.Duration, w.now())
+	w.exportResult(&reqMsg)
+	return nil
+}
+
+// uploadResults uploads the post state, if the client produced one, and the logs, and returns the uploaded paths.
+// All uploads are attempted, the first error is returned. Uploads stop when the context is done.
+// The post state is written to the hasher while it is uploaded.
+func (w *Worker) uploadResults(ctx context.Context, results BlobStore, resultFiles ResultFilesDataPaths, out *transitionOutput, outDir string, hasher *postHasher) ([]string, error) {
+	var uploaded []string
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	// try to upload post state, if it exists
+	f, err := os.Open(filepath.Join(outDir, "post.ssz"))
+	if os.IsNotExist(err) {
+		log.Printf("no post state to upload")
+	} else if err != nil {
+		fail(fmt.Errorf("cannot open post state to upload: %v", err))
+	} else {
+		r := &hashingReader{r: f, h: hasher}
+		if err := w.uploadResult(ctx, results, resultFiles.PostState, r); err != nil {
+			fail(fmt.Errorf("could not upload post-state: %v", err))
+		} else {
+			uploaded = append(uploaded, resultFiles.PostState)
+		}
+		if err := r.finish(); err != nil {
+			log.Printf("failed to hash post state: %v", err)
+		}
+		_ = f.Close()
+	}
+	logs := []struct {
+		name string
+		file string
+		dest string
+	}{
+		{"std-out", out.Stdout, resultFiles.OutLog},
+		{"std-err", out.Stderr, resultFiles.ErrLog},
+		{"timed std-out", out.StdoutTimed, resultFiles.OutLogTimed},
+		{"timed std-err", out.StderrTimed, resultFiles.ErrLogTimed},
+		{"combined log", out.Combined, resultFiles.CombinedLog},
+		{"exit info", out.ExitFile, resultFiles.ExitInfo},
+		{"post diff", out.PostDiff, resultFiles.PostDiff},
+		{"repro bundle", out.Repro, resultFiles.Repro},
+	}
+	for _, l := range logs {
+		if l.dest == "" || l.file == "" {
+			continue
+		}
+		if err := w.uploadFile(ctx, results, l.dest, l.file); err != nil {
+			fail(fmt.Errorf("could not upload %s: %v", l.name, err))
+		} else {
+			uploaded = append(uploaded, l.dest)
+		}
+	}
+	for i, p := range out.BlockPosts {
+		dest := resultFiles.BlockPostStates[i]
+		if err := w.uploadFile(ctx, results, dest, p); err != nil {
+			fail(fmt.Errorf("could not upload post state of block %d: %v", i, err))
+		} else {
+			uploaded = append(uploaded, dest)
+		}
+	}
+	return uploaded, firstErr
+}
+
+func (w *Worker) resultFilePaths(tr *TransitionMsg, c *taskClient) ResultFilesDataPaths {
+	bucketPathStart := w.ResultPaths().Path(tr, c.name, c.version)
+	resultFiles := ResultFilesDataPaths{
+		PostState:   fmt.Sprintf("%s/post.ssz", bucketPathStart),
+		ErrLog:      fmt.Sprintf("%s/std_err_log.txt", bucketPathStart),
+		OutLog:      fmt.Sprintf("%s/std_out_log.txt", bucketPathStart),
+		ErrLogTimed: fmt.Sprintf("%s/err_timed.log", bucketPathStart),
+		OutLogTimed: fmt.Sprintf("%s/out_timed.log", bucketPathStart),
+		ExitInfo:    fmt.Sprintf("%s/exit.json", bucketPathStart),
+	}
+	if w.CombinedLog {
+		resultFiles.CombinedLog = fmt.Sprintf("%s/combined.log", bucketPathStart)
+	}
+	if w.ReferenceCmd != "" && c.subDir == "" {
+		resultFiles.PostDiff = fmt.Sprintf("%s/%s", bucketPathStart, postDiffName)
+	}
+	if w.ReproBundles {
+		resultFiles.Repro = fmt.Sprintf("repro/%s.tar.gz", bucketPathStart)
+	}
+	return resultFiles
+}
+
+// uploadResult uploads the contents of r to the given path in the results store.
+// With CompressResults, the contents are gzipped, with a gzip Content-Encoding, if the store supports it.
+// Large objects are uploaded in chunks of UploadChunkSize, if the store supports it, see resultWriter.
+// An attempt is canceled when it makes no progress for UploadStallTimeout.
+// Failed uploads are retried from the start of r, see retryStorage, until the context is done.
+func (w *Worker) uploadResult(ctx context.Context, results BlobStore, bucketpath string, r io.ReadSeeker) error {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	return w.retryStorage(ctx, "upload "+bucketpath, func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		limits := w.storageLimits()
+		release, err := limits.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		src := &uploadWatch{r: limits.throttleUpload(ctx, r)}
+		done := make(chan struct{})
+		defer close(done)
+		go src.watch(bucketpath, size, w.UploadStallTimeout, cancel, done)
+		start := time.Now()
+		out, encoding := w.resultWriter(ctx, results, bucketpath)
+		var n int64
+		if encoding == "gzip" {
+			gz := gzip.NewWriter(out)
+			if n, err = io.Copy(gz, src); err == nil {
+				err = gz.Close()
+			}
+		} else {
+			n, err = io.Copy(out, src)
+		}
+		if err == nil {
+			err = out.Close()
+		} else {
+			_ = out.Close()
+		}
+		if err != nil {
+			if src.isStalled() {
+				return fmt.Errorf("upload stalled for %s: %v", w.UploadStallTimeout, err)
+			}
+			return err
+		}
+		w.metrics().observeUpload(start, n)
+		return nil
+	})
+}
+
+// uploadFile uploads the local file to the given path in the results store.
+func (w *Worker) uploadFile(ctx context.Context, results BlobStore, bucketpath string, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return w.uploadResult(ctx, results, bucketpath, f)
+}
+
+// downloadInputFile downloads the object to the file, and returns the sha256 of the contents, hashed while streaming.
+// With VerifyInputs, the download is verified with the checksums reported by the store.
+// Failed downloads are retried from the start, see retryStorage.
+func (w *Worker) downloadInputFile(ctx context.Context, filepath string, bucketpath string) (hash [32]byte, err error) {
+	store := w.inputs()
+	cache := w.inputCache()
+	var cacheKey string
+	if cache != nil {
+		cacheKey = w.inputCacheKey(ctx, store, bucketpath)
+		if cacheKey != "" {
+			if hash, ok := cache.get(cacheKey, filepath); ok {
+				w.metrics().cacheHits.Inc()
+				return hash, nil
+			}
+			w.metrics().cacheMisses.Inc()
+		}
+	}
+
+	checksums := w.inputChecksums(ctx, store, bucketpath)
+
+	out, err := os.Create(filepath)
+	if err != nil {
+		return hash, err
+	}
+	defer out.Close()
+
+	err = w.retryStorage(ctx, "download "+bucketpath, func() error {
+		if _, err := out.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		release, err := w.storageLimits().acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+		defer cancel()
+		start := time.Now()
+		r, err := store.NewReader(ctx, bucketpath)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		h := sha256.New()
+		dst := io.MultiWriter(out, h)
+		var verifier *checksumVerifier
+		if checksums != nil {
+			verifier = newChecksumVerifier(checksums)
+			dst = io.MultiWriter(out, h, verifier)
+		}
+		n, err := io.Copy(dst, r)
+		if err != nil {
+			return err
+		}
+		// a corrupted download is retried like a failed one
+		if verifier != nil {
+			if err := verifier.verify(); err != nil {
+				return fmt.Errorf("corrupted download: %v", err)
+			}
+		}
+		w.metrics().observeDownload(start, n)
+		copy(hash[:], h.Sum(nil))
+		return nil
+	})
+	if err == nil && cacheKey != "" {
+		if err := cache.add(cacheKey, filepath); err != nil {
+			log.Printf("failed to cache input %s: %v", bucketpath, err)
+		}
+	}
+	return hash, err
+}
+
+func uniqueID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand.Read error: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}